@@ -2,6 +2,7 @@ package anomaly
 
 import (
 	"fmt"
+	"github.com/sensorbee/jubatus/internal/fvconverter"
 	"github.com/sensorbee/jubatus/internal/pluginutil"
 	"github.com/ugorji/go/codec"
 	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
@@ -21,6 +22,10 @@ type anomalyMsgpack struct {
 type lightLOFState struct {
 	lightLOF           *LightLOF
 	featureVectorField string
+
+	// converter converts feature vectors before they're passed to LightLOF.
+	// It's nil when feature vectors are used as they are.
+	converter *fvconverter.Converter
 }
 
 var _ core.SavableSharedState = &lightLOFState{}
@@ -95,6 +100,11 @@ func (c *LightLOFStateCreator) CreateState(ctx *core.Context, params data.Map) (
 		return nil, fmt.Errorf("invalid unlearner: %v", unlearn)
 	}
 
+	conv, err := fvconverter.ExtractParams(params)
+	if err != nil {
+		return nil, err
+	}
+
 	// TODO: check hashNum, nnNum, rnnNum <= INT_MAX
 	llof, err := NewLightLOF(nnAlgo, int(hashNum), int(nnNum), int(rnnNum), maxSize, seed)
 	if err != nil {
@@ -103,6 +113,7 @@ func (c *LightLOFStateCreator) CreateState(ctx *core.Context, params data.Map) (
 	return &lightLOFState{
 		lightLOF:           llof,
 		featureVectorField: fv,
+		converter:          conv,
 	}, nil
 }
 
@@ -129,6 +140,8 @@ func (c *LightLOFStateCreator) LoadState(ctx *core.Context, r io.Reader, params
 	switch d.FormatVersion {
 	case 1:
 		return loadLightLOFStateFormatV1(ctx, r)
+	case 2:
+		return loadLightLOFStateFormatV2(ctx, r)
 	default:
 		return nil, fmt.Errorf("unsupported format version of LightLOFState container: %v", d.FormatVersion)
 	}
@@ -152,6 +165,30 @@ func loadLightLOFStateFormatV1(ctx *core.Context, r io.Reader) (core.SharedState
 	return s, nil
 }
 
+func loadLightLOFStateFormatV2(ctx *core.Context, r io.Reader) (core.SharedState, error) {
+	s := &lightLOFState{}
+
+	var d lightLOFStateMsgpack
+	dec := codec.NewDecoder(r, anomalyMsgpackHandle)
+	if err := dec.Decode(&d); err != nil {
+		return nil, err
+	}
+	s.featureVectorField = d.FeatureVectorField
+
+	conv, err := fvconverter.Load(r)
+	if err != nil {
+		return nil, err
+	}
+	s.converter = conv
+
+	llof, err := LoadLightLOF(r)
+	if err != nil {
+		return nil, err
+	}
+	s.lightLOF = llof
+	return s, nil
+}
+
 func (*lightLOFState) Terminate(ctx *core.Context) error {
 	return nil
 }
@@ -165,13 +202,17 @@ func (l *lightLOFState) Write(ctx *core.Context, t *core.Tuple) error {
 	if err != nil {
 		return fmt.Errorf("%s value is not a map: %v", l.featureVectorField, err)
 	}
+	fv, err = l.converter.ConvertAndUpdate(fv)
+	if err != nil {
+		return err
+	}
 
 	err = l.lightLOF.AddWithoutCalcScore(FeatureVector(fv))
 	return err
 }
 
 const (
-	anomalyFormatVersion = 1
+	anomalyFormatVersion = 2
 )
 
 func (l *lightLOFState) Save(ctx *core.Context, w io.Writer, params data.Map) error {
@@ -188,6 +229,9 @@ func (l *lightLOFState) Save(ctx *core.Context, w io.Writer, params data.Map) er
 	}); err != nil {
 		return err
 	}
+	if err := l.converter.Save(w); err != nil {
+		return err
+	}
 	return l.lightLOF.Save(w)
 }
 
@@ -197,7 +241,11 @@ func AddAndGetScore(ctx *core.Context, stateName string, featureVector data.Map)
 		return 0, err
 	}
 
-	score, err := l.lightLOF.Add(FeatureVector(featureVector))
+	fv, err := l.converter.ConvertAndUpdate(featureVector)
+	if err != nil {
+		return 0, err
+	}
+	score, err := l.lightLOF.Add(FeatureVector(fv))
 	if err != nil {
 		return 0, err
 	}
@@ -211,7 +259,11 @@ func CalcScore(ctx *core.Context, stateName string, featureVector data.Map) (flo
 		return 0, err
 	}
 
-	score, err := l.lightLOF.CalcScore(FeatureVector(featureVector))
+	fv, err := l.converter.Convert(featureVector)
+	if err != nil {
+		return 0, err
+	}
+	score, err := l.lightLOF.CalcScore(FeatureVector(fv))
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,322 @@
+package bandit
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ugorji/go/codec"
+	"io"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// Bandit solves multi-armed bandit problems. Arms are shared by all players
+// and each player has its own statistics of arms.
+type Bandit struct {
+	policy           Policy
+	params           params
+	assumeUnrewarded bool
+	seed             int64
+
+	arms    []string
+	players map[string]map[string]*ArmInfo
+
+	rg *rand.Rand
+	m  sync.Mutex
+}
+
+const (
+	// InvalidPolicy represents an invalid policy.
+	InvalidPolicy Policy = iota
+	// EpsilonGreedy represents the epsilon-greedy policy.
+	EpsilonGreedy
+	// UCB1 represents the UCB1 policy.
+	UCB1
+	// Softmax represents the softmax policy.
+	Softmax
+	// Exp3 represents the Exp3 policy.
+	Exp3
+	// ThompsonSampling represents Thompson sampling. It assumes that rewards
+	// are in [0, 1].
+	ThompsonSampling
+)
+
+// Policy is an enum type which represents policies of selecting arms.
+type Policy int
+
+var (
+	// ErrNoArm is returned when an arm is selected without registered arms.
+	ErrNoArm = errors.New("no arm is registered")
+)
+
+// New creates a Bandit. epsilon is only used by EpsilonGreedy, tau is only
+// used by Softmax, and gamma is only used by Exp3. When assumeUnrewarded is
+// true, a selected arm is counted as played with no reward until its reward
+// is registered. Otherwise, an arm is counted as played when its reward is
+// registered.
+func New(policy Policy, epsilon, tau, gamma float64, assumeUnrewarded bool, seed int64) (*Bandit, error) {
+	switch policy {
+	case EpsilonGreedy:
+		if !(0 <= epsilon && epsilon <= 1) {
+			return nil, errors.New("epsilon must be in [0, 1]")
+		}
+	case UCB1, ThompsonSampling:
+	case Softmax:
+		if !(tau > 0) {
+			return nil, errors.New("tau must be greater than zero")
+		}
+	case Exp3:
+		if !(0 < gamma && gamma <= 1) {
+			return nil, errors.New("gamma must be in (0, 1]")
+		}
+	default:
+		return nil, errors.New("invalid policy")
+	}
+	return &Bandit{
+		policy: policy,
+		params: params{
+			Epsilon: epsilon,
+			Tau:     tau,
+			Gamma:   gamma,
+		},
+		assumeUnrewarded: assumeUnrewarded,
+		seed:             seed,
+		players:          make(map[string]map[string]*ArmInfo),
+		rg:               rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+// RegisterArm registers an arm. It returns false when the arm has already
+// been registered.
+func (b *Bandit) RegisterArm(arm string) (bool, error) {
+	if arm == "" {
+		return false, errors.New("arm ID must not be empty")
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.armIndex(arm) >= 0 {
+		return false, nil
+	}
+	b.arms = append(b.arms, arm)
+	return true, nil
+}
+
+// DeleteArm deletes an arm and its statistics of all players. It returns
+// false when the arm doesn't exist.
+func (b *Bandit) DeleteArm(arm string) bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	i := b.armIndex(arm)
+	if i < 0 {
+		return false
+	}
+	b.arms = append(b.arms[:i], b.arms[i+1:]...)
+	for _, p := range b.players {
+		delete(p, arm)
+	}
+	return true
+}
+
+// SelectArm selects an arm which player should play next.
+func (b *Bandit) SelectArm(player string) (string, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if len(b.arms) == 0 {
+		return "", ErrNoArm
+	}
+
+	as := b.armInfos(player)
+	var i int
+	switch b.policy {
+	case EpsilonGreedy:
+		i = selectEpsilonGreedy(as, b.params.Epsilon, b.rg)
+	case UCB1:
+		i = selectUCB1(as)
+	case Softmax:
+		i = selectSoftmax(as, b.params.Tau, b.rg)
+	case Exp3:
+		i = selectExp3(as, b.params.Gamma, b.rg)
+	case ThompsonSampling:
+		i = selectThompsonSampling(as, b.rg)
+	}
+
+	arm := b.arms[i]
+	if b.assumeUnrewarded {
+		b.player(player, arm).TrialCount++
+	}
+	return arm, nil
+}
+
+// RegisterReward registers the reward which player got from arm.
+func (b *Bandit) RegisterReward(player, arm string, reward float64) error {
+	if math.IsNaN(reward) || math.IsInf(reward, 0) {
+		return errors.New("reward must be a finite number")
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	i := b.armIndex(arm)
+	if i < 0 {
+		return fmt.Errorf("arm '%v' isn't registered", arm)
+	}
+
+	if b.policy == Exp3 {
+		reward = exp3Update(b.armInfos(player), i, reward, b.params.Gamma)
+	}
+	a := b.player(player, arm)
+	if !b.assumeUnrewarded {
+		a.TrialCount++
+	}
+	a.Weight += reward
+	return nil
+}
+
+// ArmInfo returns statistics of all arms for player.
+func (b *Bandit) ArmInfo(player string) map[string]ArmInfo {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	as := b.armInfos(player)
+	ret := make(map[string]ArmInfo, len(as))
+	for i, a := range as {
+		ret[b.arms[i]] = a
+	}
+	return ret
+}
+
+// Reset clears statistics of player. It returns false when player doesn't
+// have any statistics.
+func (b *Bandit) Reset(player string) bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if _, ok := b.players[player]; !ok {
+		return false
+	}
+	delete(b.players, player)
+	return true
+}
+
+// Clear clears all arms and statistics.
+func (b *Bandit) Clear() {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.arms = nil
+	b.players = make(map[string]map[string]*ArmInfo)
+}
+
+// armIndex returns the index of arm in b.arms, or -1 when it doesn't exist.
+// It requires lock.
+func (b *Bandit) armIndex(arm string) int {
+	for i, a := range b.arms {
+		if a == arm {
+			return i
+		}
+	}
+	return -1
+}
+
+// armInfos returns statistics of player in the order of b.arms. It requires
+// lock.
+func (b *Bandit) armInfos(player string) []ArmInfo {
+	ret := make([]ArmInfo, len(b.arms))
+	p := b.players[player]
+	for i, arm := range b.arms {
+		if a, ok := p[arm]; ok {
+			ret[i] = *a
+		}
+	}
+	return ret
+}
+
+// player returns statistics of arm for player. It creates a new one when it
+// doesn't exist. It requires lock.
+func (b *Bandit) player(player, arm string) *ArmInfo {
+	p, ok := b.players[player]
+	if !ok {
+		p = make(map[string]*ArmInfo)
+		b.players[player] = p
+	}
+	a, ok := p[arm]
+	if !ok {
+		a = &ArmInfo{}
+		p[arm] = a
+	}
+	return a
+}
+
+const (
+	banditFormatVersion uint8 = 1
+)
+
+type banditMsgpack struct {
+	_struct struct{} `codec:",toarray"`
+
+	Policy           Policy
+	Params           params
+	AssumeUnrewarded bool
+	Seed             int64
+
+	Arms    []string
+	Players map[string]map[string]*ArmInfo
+}
+
+// Save saves the current state of Bandit. The state of the random number
+// generator isn't saved, and a loaded Bandit reinitializes it with the seed.
+func (b *Bandit) Save(w io.Writer) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if _, err := w.Write([]byte{banditFormatVersion}); err != nil {
+		return err
+	}
+
+	enc := codec.NewEncoder(w, banditMsgpackHandle)
+	return enc.Encode(&banditMsgpack{
+		Policy:           b.policy,
+		Params:           b.params,
+		AssumeUnrewarded: b.assumeUnrewarded,
+		Seed:             b.seed,
+		Arms:             b.arms,
+		Players:          b.players,
+	})
+}
+
+// Load loads Bandit from the saved data.
+func Load(r io.Reader) (*Bandit, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadFormatV1(r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of Bandit container: %v", formatVersion[0])
+	}
+}
+
+func loadFormatV1(r io.Reader) (*Bandit, error) {
+	m := banditMsgpack{}
+	dec := codec.NewDecoder(r, banditMsgpackHandle)
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+
+	b, err := New(m.Policy, m.Params.Epsilon, m.Params.Tau, m.Params.Gamma, m.AssumeUnrewarded, m.Seed)
+	if err != nil {
+		return nil, err
+	}
+	b.arms = m.Arms
+	if m.Players != nil {
+		b.players = m.Players
+	}
+	return b, nil
+}
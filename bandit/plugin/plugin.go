@@ -0,0 +1,17 @@
+package plugin
+
+import (
+	"github.com/sensorbee/jubatus/bandit"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+)
+
+func init() {
+	udf.MustRegisterGlobalUDSCreator("jubabandit", &bandit.StateCreator{})
+
+	udf.MustRegisterGlobalUDF("jubabandit_register_arm", udf.MustConvertGeneric(bandit.RegisterArm))
+	udf.MustRegisterGlobalUDF("jubabandit_delete_arm", udf.MustConvertGeneric(bandit.DeleteArm))
+	udf.MustRegisterGlobalUDF("jubabandit_select_arm", udf.MustConvertGeneric(bandit.SelectArm))
+	udf.MustRegisterGlobalUDF("jubabandit_register_reward", udf.MustConvertGeneric(bandit.RegisterReward))
+	udf.MustRegisterGlobalUDF("jubabandit_get_arm_info", udf.MustConvertGeneric(bandit.GetArmInfo))
+	udf.MustRegisterGlobalUDF("jubabandit_reset", udf.MustConvertGeneric(bandit.ResetPlayer))
+}
@@ -0,0 +1,178 @@
+package bandit
+
+import (
+	"math"
+	"math/rand"
+)
+
+// ArmInfo has statistics of an arm for a player.
+type ArmInfo struct {
+	_struct struct{} `codec:",toarray"`
+
+	// TrialCount is the number of times the arm was played.
+	TrialCount int
+
+	// Weight is the sum of rewards of the arm. When Exp3 is used, it's the
+	// logarithm of the weight of the arm instead.
+	Weight float64
+}
+
+func (a *ArmInfo) mean() float64 {
+	if a.TrialCount == 0 {
+		return 0
+	}
+	return a.Weight / float64(a.TrialCount)
+}
+
+// params has parameters of policies.
+type params struct {
+	_struct struct{} `codec:",toarray"`
+
+	Epsilon float64
+	Tau     float64
+	Gamma   float64
+}
+
+// selectEpsilonGreedy selects a random arm with probability eps and the arm
+// having the largest mean reward otherwise.
+func selectEpsilonGreedy(as []ArmInfo, eps float64, rg *rand.Rand) int {
+	if rg.Float64() < eps {
+		return rg.Intn(len(as))
+	}
+	return argmax(as, func(a *ArmInfo) float64 {
+		return a.mean()
+	})
+}
+
+// selectUCB1 selects an arm which hasn't been played yet if any, and the
+// arm having the largest upper confidence bound otherwise.
+func selectUCB1(as []ArmInfo) int {
+	total := 0
+	for i := range as {
+		if as[i].TrialCount == 0 {
+			return i
+		}
+		total += as[i].TrialCount
+	}
+	lnN := math.Log(float64(total))
+	return argmax(as, func(a *ArmInfo) float64 {
+		return a.mean() + math.Sqrt(2*lnN/float64(a.TrialCount))
+	})
+}
+
+// selectSoftmax selects an arm with the probability proportional to
+// exp(mean / tau).
+func selectSoftmax(as []ArmInfo, tau float64, rg *rand.Rand) int {
+	ws := make([]float64, len(as))
+	for i := range as {
+		ws[i] = as[i].mean() / tau
+	}
+	return sample(softmax(ws), rg)
+}
+
+// exp3Probs returns probabilities of selecting arms by Exp3.
+func exp3Probs(as []ArmInfo, gamma float64) []float64 {
+	ws := make([]float64, len(as))
+	for i := range as {
+		ws[i] = as[i].Weight
+	}
+	ps := softmax(ws)
+	k := float64(len(as))
+	for i := range ps {
+		ps[i] = (1-gamma)*ps[i] + gamma/k
+	}
+	return ps
+}
+
+// selectExp3 selects an arm by Exp3.
+func selectExp3(as []ArmInfo, gamma float64, rg *rand.Rand) int {
+	return sample(exp3Probs(as, gamma), rg)
+}
+
+// exp3Update returns the increment of the log weight of the i-th arm which
+// received reward.
+func exp3Update(as []ArmInfo, i int, reward, gamma float64) float64 {
+	p := exp3Probs(as, gamma)[i]
+	return gamma * reward / (p * float64(len(as)))
+}
+
+// selectThompsonSampling selects the arm having the largest sample drawn
+// from the beta posterior. Rewards are assumed to be in [0, 1].
+func selectThompsonSampling(as []ArmInfo, rg *rand.Rand) int {
+	return argmax(as, func(a *ArmInfo) float64 {
+		succ := math.Max(a.Weight, 0)
+		fail := math.Max(float64(a.TrialCount)-a.Weight, 0)
+		return betaRand(1+succ, 1+fail, rg)
+	})
+}
+
+// argmax returns the index of the arm having the largest score. The first
+// one is returned when there're ties.
+func argmax(as []ArmInfo, score func(a *ArmInfo) float64) int {
+	ix := 0
+	max := math.Inf(-1)
+	for i := range as {
+		if s := score(&as[i]); s > max {
+			ix = i
+			max = s
+		}
+	}
+	return ix
+}
+
+// softmax returns normalized exp(ws).
+func softmax(ws []float64) []float64 {
+	max := math.Inf(-1)
+	for _, w := range ws {
+		max = math.Max(max, w)
+	}
+	ps := make([]float64, len(ws))
+	sum := 0.0
+	for i, w := range ws {
+		ps[i] = math.Exp(w - max)
+		sum += ps[i]
+	}
+	for i := range ps {
+		ps[i] /= sum
+	}
+	return ps
+}
+
+// sample returns an index with the probability ps[i].
+func sample(ps []float64, rg *rand.Rand) int {
+	r := rg.Float64()
+	for i, p := range ps {
+		r -= p
+		if r < 0 {
+			return i
+		}
+	}
+	return len(ps) - 1
+}
+
+// betaRand returns a random number following Beta(a, b). a and b must be
+// greater than or equal to one.
+func betaRand(a, b float64, rg *rand.Rand) float64 {
+	x := gammaRand(a, rg)
+	y := gammaRand(b, rg)
+	return x / (x + y)
+}
+
+// gammaRand returns a random number following Gamma(a, 1) by the method of
+// Marsaglia and Tsang. a must be greater than or equal to one.
+func gammaRand(a float64, rg *rand.Rand) float64 {
+	d := a - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rg.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rg.Float64()
+		if math.Log(u) < x*x/2+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
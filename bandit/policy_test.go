@@ -0,0 +1,127 @@
+package bandit
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestExp3Update(t *testing.T) {
+	Convey("Given arms having uniform weights", t, func() {
+		Convey("the probability of each arm should be 1/k.", func() {
+			So(exp3Update(make([]ArmInfo, 2), 0, 1, 0.1), ShouldAlmostEqual, 0.1, 1e-9)
+			So(exp3Update(make([]ArmInfo, 4), 3, 0.5, 0.2), ShouldAlmostEqual, 0.1, 1e-9)
+		})
+	})
+
+	Convey("Given arms whose softmax probabilities are 0.75 and 0.25", t, func() {
+		as := []ArmInfo{{Weight: math.Log(3)}, {Weight: 0}}
+
+		Convey("with gamma 0.5, the probabilities should be mixed into 0.625 and 0.375.", func() {
+			So(exp3Update(as, 0, 0.5, 0.5), ShouldAlmostEqual, 0.2, 1e-9)
+			So(exp3Update(as, 1, 1, 0.5), ShouldAlmostEqual, 2.0/3, 1e-9)
+		})
+
+		Convey("the update with zero reward should be zero.", func() {
+			So(exp3Update(as, 1, 0, 0.5), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestSelectUCB1(t *testing.T) {
+	Convey("Given arms including ones which haven't been played", t, func() {
+		as := []ArmInfo{{TrialCount: 1, Weight: 1}, {}, {}}
+
+		Convey("UCB1 should select the first arm which hasn't been played.", func() {
+			So(selectUCB1(as), ShouldEqual, 1)
+		})
+	})
+
+	Convey("Given arms played the same number of times", t, func() {
+		Convey("UCB1 should select the arm having the largest mean.", func() {
+			as := []ArmInfo{{TrialCount: 100, Weight: 10}, {TrialCount: 100, Weight: 90}}
+			So(selectUCB1(as), ShouldEqual, 1)
+		})
+
+		Convey("UCB1 should select the first arm on a tie.", func() {
+			as := []ArmInfo{{TrialCount: 4, Weight: 2}, {TrialCount: 4, Weight: 2}}
+			So(selectUCB1(as), ShouldEqual, 0)
+		})
+	})
+
+	Convey("Given arms played different numbers of times", t, func() {
+		Convey("UCB1 should select the less played arm on a tie of means.", func() {
+			as := []ArmInfo{{TrialCount: 10, Weight: 5}, {TrialCount: 2, Weight: 1}}
+			So(selectUCB1(as), ShouldEqual, 1)
+		})
+
+		Convey("UCB1 should select the less played arm having a slightly smaller mean.", func() {
+			as := []ArmInfo{{TrialCount: 1000, Weight: 600}, {TrialCount: 3, Weight: 1.5}}
+			So(selectUCB1(as), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestGammaRand(t *testing.T) {
+	const n = 20000
+
+	Convey("Given a random number generator", t, func() {
+		rg := rand.New(rand.NewSource(0))
+
+		// gammaMoments returns the mean and the variance of n samples of
+		// Gamma(a, 1).
+		gammaMoments := func(a float64) (float64, float64) {
+			var sum, sqSum float64
+			for i := 0; i < n; i++ {
+				x := gammaRand(a, rg)
+				So(x, ShouldBeGreaterThan, 0)
+				sum += x
+				sqSum += x * x
+			}
+			mean := sum / n
+			return mean, sqSum/n - mean*mean
+		}
+
+		// betaMean returns the mean of n samples of Beta(a, b).
+		betaMean := func(a, b float64) float64 {
+			var sum float64
+			for i := 0; i < n; i++ {
+				x := betaRand(a, b, rg)
+				So(x, ShouldBeBetweenOrEqual, 0, 1)
+				sum += x
+			}
+			return sum / n
+		}
+
+		Convey("samples of Gamma(1, 1) should have mean and variance 1.", func() {
+			mean, variance := gammaMoments(1)
+			So(mean, ShouldAlmostEqual, 1, 0.05)
+			So(variance, ShouldAlmostEqual, 1, 0.1)
+		})
+
+		Convey("samples of Gamma(2.5, 1) should have mean and variance 2.5.", func() {
+			mean, variance := gammaMoments(2.5)
+			So(mean, ShouldAlmostEqual, 2.5, 0.125)
+			So(variance, ShouldAlmostEqual, 2.5, 0.25)
+		})
+
+		Convey("samples of Gamma(10, 1) should have mean and variance 10.", func() {
+			mean, variance := gammaMoments(10)
+			So(mean, ShouldAlmostEqual, 10, 0.5)
+			So(variance, ShouldAlmostEqual, 10, 1)
+		})
+
+		Convey("samples of Beta(1, 1) should be in [0, 1] and have mean 0.5.", func() {
+			So(betaMean(1, 1), ShouldAlmostEqual, 0.5, 0.01)
+		})
+
+		Convey("samples of Beta(2, 5) should be in [0, 1] and have mean 2/7.", func() {
+			So(betaMean(2, 5), ShouldAlmostEqual, 2.0/7, 0.01)
+		})
+
+		Convey("samples of Beta(10, 3) should be in [0, 1] and have mean 10/13.", func() {
+			So(betaMean(10, 3), ShouldAlmostEqual, 10.0/13, 0.01)
+		})
+	})
+}
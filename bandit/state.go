@@ -0,0 +1,286 @@
+package bandit
+
+import (
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/pluginutil"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// State is a state which has a Bandit. Writing a tuple to the state
+// registers the reward in the tuple.
+type State struct {
+	bandit      *Bandit
+	playerField string
+	armField    string
+	rewardField string
+}
+
+var _ core.SavableSharedState = &State{}
+
+type stateMsgpack struct {
+	_struct     struct{} `codec:",toarray"`
+	PlayerField string
+	ArmField    string
+	RewardField string
+}
+
+// StateCreator is used by BQL to create or load a State as a UDS.
+type StateCreator struct {
+}
+
+var _ udf.UDSLoader = &StateCreator{}
+
+// CreateState creates a new State.
+func (c *StateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	player, err := pluginutil.ExtractParamAsStringWithDefault(params, "player_id_field", "player_id")
+	if err != nil {
+		return nil, err
+	}
+	arm, err := pluginutil.ExtractParamAsStringWithDefault(params, "arm_id_field", "arm_id")
+	if err != nil {
+		return nil, err
+	}
+	reward, err := pluginutil.ExtractParamAsStringWithDefault(params, "reward_field", "reward")
+	if err != nil {
+		return nil, err
+	}
+
+	policyName, err := pluginutil.ExtractParamAsString(params, "method")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		policy            Policy
+		epsilon, tau, gam float64
+	)
+	switch strings.ToLower(policyName) {
+	case "epsilon_greedy":
+		policy = EpsilonGreedy
+		epsilon, err = pluginutil.ExtractParamAndConvertToFloat(params, "epsilon")
+	case "ucb1":
+		policy = UCB1
+	case "softmax":
+		policy = Softmax
+		tau, err = pluginutil.ExtractParamAndConvertToFloat(params, "tau")
+	case "exp3":
+		policy = Exp3
+		gam, err = pluginutil.ExtractParamAndConvertToFloat(params, "gamma")
+	case "ts":
+		policy = ThompsonSampling
+	default:
+		return nil, fmt.Errorf("invalid method: %s", policyName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	assumeUnrewarded, err := pluginutil.ExtractParamAsBoolWithDefault(params, "assume_unrewarded", false)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := pluginutil.ExtractParamAsIntWithDefault(params, "seed", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := New(policy, epsilon, tau, gam, assumeUnrewarded, seed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize bandit: %v", err)
+	}
+	return &State{
+		bandit:      b,
+		playerField: player,
+		armField:    arm,
+		rewardField: reward,
+	}, nil
+}
+
+var (
+	banditMsgpackHandle = &codec.MsgpackHandle{
+		RawToString: true,
+	}
+)
+
+func init() {
+	banditMsgpackHandle.MapType = reflect.TypeOf(map[string]interface{}{})
+}
+
+// LoadState loads a new State.
+func (c *StateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadStateFormatV1(ctx, r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of bandit State container: %v", formatVersion[0])
+	}
+}
+
+func loadStateFormatV1(ctx *core.Context, r io.Reader) (core.SharedState, error) {
+	var d stateMsgpack
+	dec := codec.NewDecoder(r, banditMsgpackHandle)
+	if err := dec.Decode(&d); err != nil {
+		return nil, err
+	}
+
+	b, err := Load(r)
+	if err != nil {
+		return nil, err
+	}
+	return &State{
+		bandit:      b,
+		playerField: d.PlayerField,
+		armField:    d.ArmField,
+		rewardField: d.RewardField,
+	}, nil
+}
+
+// Terminate terminates the state.
+func (*State) Terminate(ctx *core.Context) error {
+	return nil
+}
+
+// Write registers the reward which the player in the tuple got from the arm
+// in the tuple.
+func (s *State) Write(ctx *core.Context, t *core.Tuple) error {
+	vplayer, ok := t.Data[s.playerField]
+	if !ok {
+		return fmt.Errorf("%s field is missing", s.playerField)
+	}
+	player, err := data.AsString(vplayer)
+	if err != nil {
+		return fmt.Errorf("%s value is not a string: %v", s.playerField, err)
+	}
+
+	varm, ok := t.Data[s.armField]
+	if !ok {
+		return fmt.Errorf("%s field is missing", s.armField)
+	}
+	arm, err := data.AsString(varm)
+	if err != nil {
+		return fmt.Errorf("%s value is not a string: %v", s.armField, err)
+	}
+
+	vreward, ok := t.Data[s.rewardField]
+	if !ok {
+		return fmt.Errorf("%s field is missing", s.rewardField)
+	}
+	reward, err := data.ToFloat(vreward)
+	if err != nil {
+		return fmt.Errorf("%s value is not convertible to float: %v", s.rewardField, err)
+	}
+
+	return s.bandit.RegisterReward(player, arm, reward)
+}
+
+const (
+	banditStateFormatVersion = 1
+)
+
+// Save is provided as a part of core.SavableSharedState.
+func (s *State) Save(ctx *core.Context, w io.Writer, params data.Map) error {
+	if _, err := w.Write([]byte{banditStateFormatVersion}); err != nil {
+		return err
+	}
+
+	enc := codec.NewEncoder(w, banditMsgpackHandle)
+	if err := enc.Encode(&stateMsgpack{
+		PlayerField: s.playerField,
+		ArmField:    s.armField,
+		RewardField: s.rewardField,
+	}); err != nil {
+		return err
+	}
+	return s.bandit.Save(w)
+}
+
+// RegisterArm registers an arm. It returns false when the arm has already
+// been registered.
+func RegisterArm(ctx *core.Context, stateName string, armID string) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	return s.bandit.RegisterArm(armID)
+}
+
+// DeleteArm deletes an arm. It returns false when the arm doesn't exist.
+func DeleteArm(ctx *core.Context, stateName string, armID string) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	return s.bandit.DeleteArm(armID), nil
+}
+
+// SelectArm returns the ID of the arm which the player should play next.
+func SelectArm(ctx *core.Context, stateName string, playerID string) (string, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return "", err
+	}
+	return s.bandit.SelectArm(playerID)
+}
+
+// RegisterReward registers the reward which the player got from the arm.
+func RegisterReward(ctx *core.Context, stateName string, playerID string, armID string, reward float64) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	if err := s.bandit.RegisterReward(playerID, armID, reward); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetArmInfo returns statistics of all arms for the player. Each key of the
+// result is an arm ID and its value is a map having "trial_count" and
+// "weight".
+func GetArmInfo(ctx *core.Context, stateName string, playerID string) (data.Map, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	ret := data.Map{}
+	for arm, a := range s.bandit.ArmInfo(playerID) {
+		ret[arm] = data.Map{
+			"trial_count": data.Int(a.TrialCount),
+			"weight":      data.Float(a.Weight),
+		}
+	}
+	return ret, nil
+}
+
+// ResetPlayer clears statistics of the player. It returns false when the
+// player doesn't have any statistics.
+func ResetPlayer(ctx *core.Context, stateName string, playerID string) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	return s.bandit.Reset(playerID), nil
+}
+
+func lookupState(ctx *core.Context, stateName string) (*State, error) {
+	st, err := ctx.SharedStates.Get(stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := st.(*State); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("state '%v' isn't a bandit state", stateName)
+}
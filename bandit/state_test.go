@@ -0,0 +1,129 @@
+package bandit
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestBanditState(t *testing.T) {
+	methods := []data.Map{
+		{"method": data.String("epsilon_greedy"), "epsilon": data.Float(0.1)},
+		{"method": data.String("ucb1")},
+		{"method": data.String("softmax"), "tau": data.Float(0.1)},
+		{"method": data.String("exp3"), "gamma": data.Float(0.1)},
+		{"method": data.String("ts")},
+	}
+
+	for _, params := range methods {
+		params := params
+		Convey("Given a bandit state using "+string(params["method"].(data.String)), t, func() {
+			ctx := core.NewContext(nil)
+			c := StateCreator{}
+			ss, err := c.CreateState(ctx, params)
+			So(err, ShouldBeNil)
+			So(ctx.SharedStates.Add("bandit", "jubabandit", ss), ShouldBeNil)
+			s := ss.(*State)
+
+			for _, arm := range []string{"a", "b"} {
+				registered, err := RegisterArm(ctx, "bandit", arm)
+				So(err, ShouldBeNil)
+				So(registered, ShouldBeTrue)
+			}
+
+			// The arm "a" always gives a reward and "b" never does.
+			play := func(player string, n int) (selected map[string]int) {
+				selected = map[string]int{}
+				for i := 0; i < n; i++ {
+					arm, err := SelectArm(ctx, "bandit", player)
+					So(err, ShouldBeNil)
+					selected[arm]++
+
+					reward := 0
+					if arm == "a" {
+						reward = 1
+					}
+					So(s.Write(ctx, &core.Tuple{
+						Data: data.Map{
+							"player_id": data.String(player),
+							"arm_id":    data.String(arm),
+							"reward":    data.Int(reward),
+						},
+					}), ShouldBeNil)
+				}
+				return
+			}
+			play("p1", 100)
+
+			Convey("when playing more", func() {
+				selected := play("p1", 100)
+
+				Convey("it should mostly select the better arm.", func() {
+					So(selected["a"], ShouldBeGreaterThan, 70)
+				})
+			})
+
+			Convey("when getting arm information", func() {
+				info, err := GetArmInfo(ctx, "bandit", "p1")
+				So(err, ShouldBeNil)
+
+				Convey("it should have statistics of all arms.", func() {
+					So(len(info), ShouldEqual, 2)
+					a := info["a"].(data.Map)
+					b := info["b"].(data.Map)
+					So(a["trial_count"].(data.Int)+b["trial_count"].(data.Int), ShouldEqual, 100)
+				})
+			})
+
+			Convey("when resetting a player", func() {
+				reset, err := ResetPlayer(ctx, "bandit", "p1")
+				So(err, ShouldBeNil)
+				So(reset, ShouldBeTrue)
+
+				Convey("the player should have no trials.", func() {
+					info, err := GetArmInfo(ctx, "bandit", "p1")
+					So(err, ShouldBeNil)
+					So(info["a"], ShouldResemble, data.Map{
+						"trial_count": data.Int(0),
+						"weight":      data.Float(0),
+					})
+				})
+			})
+
+			Convey("when deleting an arm", func() {
+				deleted, err := DeleteArm(ctx, "bandit", "b")
+				So(err, ShouldBeNil)
+				So(deleted, ShouldBeTrue)
+
+				Convey("it should not be selected.", func() {
+					arm, err := SelectArm(ctx, "bandit", "p1")
+					So(err, ShouldBeNil)
+					So(arm, ShouldEqual, "a")
+				})
+
+				Convey("registering its reward should fail.", func() {
+					_, err := RegisterReward(ctx, "bandit", "p1", "b", 1)
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("when saving and loading the state", func() {
+				buf := bytes.NewBuffer(nil)
+				So(s.Save(ctx, buf, data.Map{}), ShouldBeNil)
+				s2, err := c.LoadState(ctx, buf, data.Map{})
+				So(err, ShouldBeNil)
+
+				Convey("the loaded state should be same.", func() {
+					b := s.bandit
+					b2 := s2.(*State).bandit
+					So(b2.policy, ShouldEqual, b.policy)
+					So(b2.params, ShouldResemble, b.params)
+					So(b2.arms, ShouldResemble, b.arms)
+					So(b2.ArmInfo("p1"), ShouldResemble, b.ArmInfo("p1"))
+				})
+			})
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package burst
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ugorji/go/codec"
+	"io"
+	"math"
+	"strings"
+	"sync"
+)
+
+// Burst detects bursts of keywords in a stream of documents. Documents are
+// grouped into batches by their positions, and the latest WindowBatchSize
+// batches are kept as a sliding window.
+type Burst struct {
+	windowBatchSize int
+	batchInterval   float64
+
+	keywords map[string]KeywordParam
+
+	// started is false until the first document is added.
+	started bool
+	// start is the index of the first batch in the window.
+	start int64
+	// latest is the index of the latest batch having documents.
+	latest int64
+	// all[i] is the number of documents in the batch start+i.
+	all []uint32
+	// relevant[k][i] is the number of documents containing the keyword k
+	// in the batch start+i.
+	relevant map[string][]uint32
+
+	m sync.RWMutex
+}
+
+// KeywordParam has parameters of a keyword.
+type KeywordParam struct {
+	_struct struct{} `codec:",toarray"`
+
+	// ScalingParam is the ratio of the rate of relevant documents in bursts
+	// to the average rate. It must be greater than one.
+	ScalingParam float64
+
+	// Gamma is the cost of entering a burst. It must be greater than zero.
+	Gamma float64
+}
+
+// Batch is a result of a batch.
+type Batch struct {
+	AllDataCount      uint32
+	RelevantDataCount uint32
+	BurstWeight       float64
+}
+
+// Window is a result of a keyword over the window.
+type Window struct {
+	// StartPos is the position where the first batch starts.
+	StartPos float64
+	Batches  []Batch
+}
+
+// NewBurst creates a Burst. windowBatchSize is the number of batches kept in
+// the window. batchInterval is the length of positions which a batch covers.
+func NewBurst(windowBatchSize int, batchInterval float64) (*Burst, error) {
+	if windowBatchSize <= 0 {
+		return nil, errors.New("window batch size must be greater than zero")
+	}
+	if !(batchInterval > 0) {
+		return nil, errors.New("batch interval must be greater than zero")
+	}
+	return &Burst{
+		windowBatchSize: windowBatchSize,
+		batchInterval:   batchInterval,
+		keywords:        make(map[string]KeywordParam),
+		all:             make([]uint32, windowBatchSize),
+		relevant:        make(map[string][]uint32),
+	}, nil
+}
+
+// AddDocument adds a document at pos. It returns false when the document is
+// older than the window and is ignored.
+func (b *Burst) AddDocument(text string, pos float64) (bool, error) {
+	if math.IsNaN(pos) || math.IsInf(pos, 0) {
+		return false, errors.New("position must be a finite number")
+	}
+	ix := int64(math.Floor(pos / b.batchInterval))
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if !b.started {
+		b.started = true
+		b.start = ix
+		b.latest = ix
+	}
+	if ix < b.start {
+		return false, nil
+	}
+	if end := b.start + int64(b.windowBatchSize); ix >= end {
+		b.slide(ix - end + 1)
+	}
+	if ix > b.latest {
+		b.latest = ix
+	}
+
+	i := ix - b.start
+	b.all[i]++
+	for k, r := range b.relevant {
+		if strings.Contains(text, k) {
+			r[i]++
+		}
+	}
+	return true, nil
+}
+
+// slide moves the window forward by n batches. It requires write lock.
+func (b *Burst) slide(n int64) {
+	b.start += n
+	shift := func(c []uint32) {
+		if n >= int64(len(c)) {
+			for i := range c {
+				c[i] = 0
+			}
+			return
+		}
+		copy(c, c[n:])
+		for i := len(c) - int(n); i < len(c); i++ {
+			c[i] = 0
+		}
+	}
+	shift(b.all)
+	for _, r := range b.relevant {
+		shift(r)
+	}
+}
+
+// AddKeyword registers a keyword. Documents added before registration aren't
+// counted as relevant. It returns false when the keyword has already been
+// registered.
+func (b *Burst) AddKeyword(keyword string, param KeywordParam) (bool, error) {
+	if keyword == "" {
+		return false, errors.New("keyword must not be empty")
+	}
+	if !(param.ScalingParam > 1) {
+		return false, errors.New("scaling parameter must be greater than one")
+	}
+	if !(param.Gamma > 0) {
+		return false, errors.New("gamma must be greater than zero")
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if _, ok := b.keywords[keyword]; ok {
+		return false, nil
+	}
+	b.keywords[keyword] = param
+	b.relevant[keyword] = make([]uint32, b.windowBatchSize)
+	return true, nil
+}
+
+// RemoveKeyword removes a keyword. It returns false when the keyword doesn't
+// exist.
+func (b *Burst) RemoveKeyword(keyword string) bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if _, ok := b.keywords[keyword]; !ok {
+		return false
+	}
+	delete(b.keywords, keyword)
+	delete(b.relevant, keyword)
+	return true
+}
+
+// RemoveAllKeywords removes all keywords.
+func (b *Burst) RemoveAllKeywords() {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.keywords = make(map[string]KeywordParam)
+	b.relevant = make(map[string][]uint32)
+}
+
+// Keywords returns all keywords and their parameters.
+func (b *Burst) Keywords() map[string]KeywordParam {
+	b.m.RLock()
+	defer b.m.RUnlock()
+
+	ret := make(map[string]KeywordParam, len(b.keywords))
+	for k, p := range b.keywords {
+		ret[k] = p
+	}
+	return ret
+}
+
+// Result returns the result of keyword over the window. Batches after the
+// latest document aren't included.
+func (b *Burst) Result(keyword string) (*Window, error) {
+	b.m.RLock()
+	defer b.m.RUnlock()
+
+	if _, ok := b.keywords[keyword]; !ok {
+		return nil, fmt.Errorf("keyword '%v' isn't registered", keyword)
+	}
+	return b.result(keyword), nil
+}
+
+// AllBurstedResults returns results of keywords whose latest batch is in a
+// burst.
+func (b *Burst) AllBurstedResults() map[string]*Window {
+	b.m.RLock()
+	defer b.m.RUnlock()
+
+	ret := map[string]*Window{}
+	for k := range b.keywords {
+		w := b.result(k)
+		if n := len(w.Batches); n > 0 && w.Batches[n-1].BurstWeight > 0 {
+			ret[k] = w
+		}
+	}
+	return ret
+}
+
+// result computes burst weights of keyword. It requires read lock.
+func (b *Burst) result(keyword string) *Window {
+	ret := &Window{
+		StartPos: float64(b.start) * b.batchInterval,
+		Batches:  []Batch{},
+	}
+	if !b.started {
+		return ret
+	}
+
+	n := int(b.latest-b.start) + 1
+	bs := make([]batch, n)
+	r := b.relevant[keyword]
+	for i := range bs {
+		bs[i] = batch{all: b.all[i], relevant: r[i]}
+	}
+	p := b.keywords[keyword]
+	ws := detect(bs, p.ScalingParam, p.Gamma)
+
+	ret.Batches = make([]Batch, n)
+	for i := range bs {
+		ret.Batches[i] = Batch{
+			AllDataCount:      bs[i].all,
+			RelevantDataCount: bs[i].relevant,
+			BurstWeight:       ws[i],
+		}
+	}
+	return ret
+}
+
+const (
+	burstFormatVersion uint8 = 1
+)
+
+type burstMsgpack struct {
+	_struct struct{} `codec:",toarray"`
+
+	WindowBatchSize int
+	BatchInterval   float64
+	Keywords        map[string]KeywordParam
+
+	Started  bool
+	Start    int64
+	Latest   int64
+	All      []uint32
+	Relevant map[string][]uint32
+}
+
+// Save saves the current state of Burst.
+func (b *Burst) Save(w io.Writer) error {
+	b.m.RLock()
+	defer b.m.RUnlock()
+
+	if _, err := w.Write([]byte{burstFormatVersion}); err != nil {
+		return err
+	}
+
+	enc := codec.NewEncoder(w, burstMsgpackHandle)
+	return enc.Encode(&burstMsgpack{
+		WindowBatchSize: b.windowBatchSize,
+		BatchInterval:   b.batchInterval,
+		Keywords:        b.keywords,
+		Started:         b.started,
+		Start:           b.start,
+		Latest:          b.latest,
+		All:             b.all,
+		Relevant:        b.relevant,
+	})
+}
+
+// LoadBurst loads Burst from the saved data.
+func LoadBurst(r io.Reader) (*Burst, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadBurstFormatV1(r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of Burst container: %v", formatVersion[0])
+	}
+}
+
+func loadBurstFormatV1(r io.Reader) (*Burst, error) {
+	m := burstMsgpack{}
+	dec := codec.NewDecoder(r, burstMsgpackHandle)
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+
+	b, err := NewBurst(m.WindowBatchSize, m.BatchInterval)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.All) != b.windowBatchSize {
+		return nil, errors.New("the number of batches doesn't match window batch size")
+	}
+	for k, r := range m.Relevant {
+		if len(r) != b.windowBatchSize {
+			return nil, fmt.Errorf("the number of batches of keyword '%v' doesn't match window batch size", k)
+		}
+	}
+	for k := range m.Keywords {
+		if _, ok := m.Relevant[k]; !ok {
+			return nil, fmt.Errorf("counts of keyword '%v' are missing", k)
+		}
+	}
+
+	if m.Keywords != nil {
+		b.keywords = m.Keywords
+	}
+	if m.Relevant != nil {
+		b.relevant = m.Relevant
+	}
+	b.started = m.Started
+	b.start = m.Start
+	b.latest = m.Latest
+	b.all = m.All
+	return b, nil
+}
@@ -0,0 +1,85 @@
+package burst
+
+import (
+	"math"
+)
+
+// batch has the number of documents in a batch and the number of documents
+// containing a keyword.
+type batch struct {
+	all      uint32
+	relevant uint32
+}
+
+// detect computes burst weights of batches by Kleinberg's two-state
+// automaton. The base state emits relevant documents with the average rate
+// over the batches and the burst state emits them with scaling times the
+// rate. Entering the burst state costs gamma * ln(len(bs)). The weight of a
+// batch in the burst state is the difference of the costs of the two states,
+// and zero otherwise.
+//
+// jubatus::core::burst::burst_detect
+func detect(bs []batch, scaling, gamma float64) []float64 {
+	ret := make([]float64, len(bs))
+	if len(bs) == 0 {
+		return ret
+	}
+
+	var all, relevant float64
+	for _, b := range bs {
+		all += float64(b.all)
+		relevant += float64(b.relevant)
+	}
+	if relevant == 0 || relevant >= all {
+		// No batch can be bursty.
+		return ret
+	}
+	p := [2]float64{relevant / all, math.Min(relevant/all*scaling, maxBurstRate)}
+	if p[1] <= p[0] {
+		return ret
+	}
+
+	cost := func(b batch, s int) float64 {
+		r := float64(b.relevant)
+		d := float64(b.all)
+		return -(r*math.Log(p[s]) + (d-r)*math.Log(1-p[s]))
+	}
+	up := gamma * math.Log(float64(len(bs)))
+
+	// Viterbi
+	total := [2]float64{cost(bs[0], 0), up + cost(bs[0], 1)}
+	prev := make([][2]int, len(bs))
+	for i := 1; i < len(bs); i++ {
+		var next [2]float64
+		// to the base state
+		if total[0] <= total[1] {
+			next[0], prev[i][0] = total[0], 0
+		} else {
+			next[0], prev[i][0] = total[1], 1
+		}
+		// to the burst state
+		if total[0]+up < total[1] {
+			next[1], prev[i][1] = total[0]+up, 0
+		} else {
+			next[1], prev[i][1] = total[1], 1
+		}
+		next[0] += cost(bs[i], 0)
+		next[1] += cost(bs[i], 1)
+		total = next
+	}
+
+	s := 0
+	if total[1] < total[0] {
+		s = 1
+	}
+	for i := len(bs) - 1; i >= 0; i-- {
+		if s == 1 {
+			ret[i] = cost(bs[i], 0) - cost(bs[i], 1)
+		}
+		s = prev[i][s]
+	}
+	return ret
+}
+
+// maxBurstRate is the upper bound of the emission rate of the burst state.
+const maxBurstRate = 1 - 1e-6
@@ -0,0 +1,73 @@
+package burst
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	Convey("Given no batch", t, func() {
+		Convey("detect should return no weight.", func() {
+			So(detect(nil, 2, 1), ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given batches without relevant documents", t, func() {
+		bs := []batch{{10, 0}, {10, 0}}
+
+		Convey("detect should not detect bursts.", func() {
+			So(bursted(detect(bs, 2, 1)), ShouldResemble, []bool{false, false})
+		})
+	})
+
+	Convey("Given batches whose documents are all relevant", t, func() {
+		bs := []batch{{10, 10}, {5, 5}}
+
+		Convey("detect should not detect bursts.", func() {
+			So(bursted(detect(bs, 2, 1)), ShouldResemble, []bool{false, false})
+		})
+	})
+
+	Convey("Given batches having the constant rate", t, func() {
+		bs := []batch{{100, 1}, {100, 1}, {100, 1}, {100, 1}, {100, 1}}
+
+		Convey("detect should not detect bursts.", func() {
+			So(bursted(detect(bs, 2, 1)), ShouldResemble, []bool{false, false, false, false, false})
+		})
+	})
+
+	Convey("Given batches having a peak", t, func() {
+		bs := []batch{{100, 1}, {100, 1}, {100, 50}, {100, 1}, {100, 1}}
+
+		Convey("detect should only give a positive weight to the peak.", func() {
+			So(bursted(detect(bs, 2, 1)), ShouldResemble, []bool{false, false, true, false, false})
+		})
+
+		Convey("detect should not detect bursts with a large transition cost.", func() {
+			So(bursted(detect(bs, 2, 100)), ShouldResemble, []bool{false, false, false, false, false})
+		})
+
+		Convey("detect should not detect bursts with scaling not greater than one.", func() {
+			So(bursted(detect(bs, 1, 1)), ShouldResemble, []bool{false, false, false, false, false})
+		})
+	})
+
+	Convey("Given batches having a plateau", t, func() {
+		bs := []batch{{100, 1}, {100, 40}, {100, 40}, {100, 1}, {100, 1}}
+
+		Convey("detect should only give positive weights to the plateau.", func() {
+			So(bursted(detect(bs, 2, 1)), ShouldResemble, []bool{false, true, true, false, false})
+		})
+	})
+}
+
+// bursted returns whether each batch has a positive weight. It also checks
+// that weights aren't negative.
+func bursted(ws []float64) []bool {
+	ret := make([]bool, len(ws))
+	for i, w := range ws {
+		So(w, ShouldBeGreaterThanOrEqualTo, 0)
+		ret[i] = w > 0
+	}
+	return ret
+}
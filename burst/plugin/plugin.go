@@ -0,0 +1,17 @@
+package plugin
+
+import (
+	"github.com/sensorbee/jubatus/burst"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+)
+
+func init() {
+	udf.MustRegisterGlobalUDSCreator("jubaburst", &burst.StateCreator{})
+
+	udf.MustRegisterGlobalUDF("jubaburst_add_keyword", udf.MustConvertGeneric(burst.AddKeyword))
+	udf.MustRegisterGlobalUDF("jubaburst_remove_keyword", udf.MustConvertGeneric(burst.RemoveKeyword))
+	udf.MustRegisterGlobalUDF("jubaburst_remove_all_keywords", udf.MustConvertGeneric(burst.RemoveAllKeywords))
+	udf.MustRegisterGlobalUDF("jubaburst_keywords", udf.MustConvertGeneric(burst.Keywords))
+	udf.MustRegisterGlobalUDF("jubaburst_get_result", udf.MustConvertGeneric(burst.GetResult))
+	udf.MustRegisterGlobalUDF("jubaburst_get_all_bursted_results", udf.MustConvertGeneric(burst.GetAllBurstedResults))
+}
@@ -0,0 +1,265 @@
+package burst
+
+import (
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/pluginutil"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"reflect"
+)
+
+// State is a state which has a Burst. Writing a tuple to the state adds a
+// document having the text and the position in the tuple.
+type State struct {
+	burst         *Burst
+	textField     string
+	positionField string
+}
+
+var _ core.SavableSharedState = &State{}
+
+type stateMsgpack struct {
+	_struct       struct{} `codec:",toarray"`
+	TextField     string
+	PositionField string
+}
+
+// StateCreator is used by BQL to create or load a State as a UDS.
+type StateCreator struct {
+}
+
+var _ udf.UDSLoader = &StateCreator{}
+
+// CreateState creates a new State.
+func (c *StateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	text, err := pluginutil.ExtractParamAsStringWithDefault(params, "text_field", "text")
+	if err != nil {
+		return nil, err
+	}
+	pos, err := pluginutil.ExtractParamAsStringWithDefault(params, "position_field", "position")
+	if err != nil {
+		return nil, err
+	}
+
+	windowBatchSize, err := pluginutil.ExtractParamAsBoundedInt(params, "window_batch_size")
+	if err != nil {
+		return nil, err
+	}
+	batchInterval, err := pluginutil.ExtractParamAndConvertToFloat(params, "batch_interval")
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := NewBurst(windowBatchSize, float64(batchInterval))
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize burst: %v", err)
+	}
+	return &State{
+		burst:         b,
+		textField:     text,
+		positionField: pos,
+	}, nil
+}
+
+var (
+	burstMsgpackHandle = &codec.MsgpackHandle{
+		RawToString: true,
+	}
+)
+
+func init() {
+	burstMsgpackHandle.MapType = reflect.TypeOf(map[string]interface{}{})
+}
+
+// LoadState loads a new State.
+func (c *StateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadStateFormatV1(ctx, r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of burst State container: %v", formatVersion[0])
+	}
+}
+
+func loadStateFormatV1(ctx *core.Context, r io.Reader) (core.SharedState, error) {
+	var d stateMsgpack
+	dec := codec.NewDecoder(r, burstMsgpackHandle)
+	if err := dec.Decode(&d); err != nil {
+		return nil, err
+	}
+
+	b, err := LoadBurst(r)
+	if err != nil {
+		return nil, err
+	}
+	return &State{
+		burst:         b,
+		textField:     d.TextField,
+		positionField: d.PositionField,
+	}, nil
+}
+
+// Terminate terminates the state.
+func (*State) Terminate(ctx *core.Context) error {
+	return nil
+}
+
+// Write adds a document having the text and the position in the tuple.
+// Documents older than the window are ignored.
+func (s *State) Write(ctx *core.Context, t *core.Tuple) error {
+	vtext, ok := t.Data[s.textField]
+	if !ok {
+		return fmt.Errorf("%s field is missing", s.textField)
+	}
+	text, err := data.AsString(vtext)
+	if err != nil {
+		return fmt.Errorf("%s value is not a string: %v", s.textField, err)
+	}
+
+	vpos, ok := t.Data[s.positionField]
+	if !ok {
+		return fmt.Errorf("%s field is missing", s.positionField)
+	}
+	pos, err := data.ToFloat(vpos)
+	if err != nil {
+		return fmt.Errorf("%s value is not convertible to float: %v", s.positionField, err)
+	}
+
+	_, err = s.burst.AddDocument(text, pos)
+	return err
+}
+
+const (
+	burstStateFormatVersion = 1
+)
+
+// Save is provided as a part of core.SavableSharedState.
+func (s *State) Save(ctx *core.Context, w io.Writer, params data.Map) error {
+	if _, err := w.Write([]byte{burstStateFormatVersion}); err != nil {
+		return err
+	}
+
+	enc := codec.NewEncoder(w, burstMsgpackHandle)
+	if err := enc.Encode(&stateMsgpack{
+		TextField:     s.textField,
+		PositionField: s.positionField,
+	}); err != nil {
+		return err
+	}
+	return s.burst.Save(w)
+}
+
+// AddKeyword registers keyword with its scaling parameter and gamma. It
+// returns false when the keyword has already been registered.
+func AddKeyword(ctx *core.Context, stateName string, keyword string, scalingParam float64, gamma float64) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	return s.burst.AddKeyword(keyword, KeywordParam{
+		ScalingParam: scalingParam,
+		Gamma:        gamma,
+	})
+}
+
+// RemoveKeyword removes keyword. It returns false when the keyword doesn't
+// exist.
+func RemoveKeyword(ctx *core.Context, stateName string, keyword string) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	return s.burst.RemoveKeyword(keyword), nil
+}
+
+// RemoveAllKeywords removes all keywords.
+func RemoveAllKeywords(ctx *core.Context, stateName string) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	s.burst.RemoveAllKeywords()
+	return true, nil
+}
+
+// Keywords returns all keywords. Each key of the result is a keyword and its
+// value is a map having "scaling_param" and "gamma".
+func Keywords(ctx *core.Context, stateName string) (data.Map, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	ret := data.Map{}
+	for k, p := range s.burst.Keywords() {
+		ret[k] = data.Map{
+			"scaling_param": data.Float(p.ScalingParam),
+			"gamma":         data.Float(p.Gamma),
+		}
+	}
+	return ret, nil
+}
+
+// GetResult returns the result of keyword over the window. The result is a
+// map having "start_pos" and "batches". Each element of "batches" is a map
+// having "all_data_count", "relevant_data_count", and "burst_weight".
+func GetResult(ctx *core.Context, stateName string, keyword string) (data.Map, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	w, err := s.burst.Result(keyword)
+	if err != nil {
+		return nil, err
+	}
+	return windowToMap(w), nil
+}
+
+// GetAllBurstedResults returns results of keywords whose latest batch is in
+// a burst. Each key of the result is a keyword and its value has the same
+// form as the result of GetResult.
+func GetAllBurstedResults(ctx *core.Context, stateName string) (data.Map, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	ret := data.Map{}
+	for k, w := range s.burst.AllBurstedResults() {
+		ret[k] = windowToMap(w)
+	}
+	return ret, nil
+}
+
+func windowToMap(w *Window) data.Map {
+	bs := make(data.Array, len(w.Batches))
+	for i, b := range w.Batches {
+		bs[i] = data.Map{
+			"all_data_count":      data.Int(b.AllDataCount),
+			"relevant_data_count": data.Int(b.RelevantDataCount),
+			"burst_weight":        data.Float(b.BurstWeight),
+		}
+	}
+	return data.Map{
+		"start_pos": data.Float(w.StartPos),
+		"batches":   bs,
+	}
+}
+
+func lookupState(ctx *core.Context, stateName string) (*State, error) {
+	st, err := ctx.SharedStates.Get(stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := st.(*State); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("state '%v' isn't a burst state", stateName)
+}
@@ -0,0 +1,140 @@
+package burst
+
+import (
+	"bytes"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestBurstState(t *testing.T) {
+	Convey("Given a burst state", t, func() {
+		ctx := core.NewContext(nil)
+		c := StateCreator{}
+		ss, err := c.CreateState(ctx, data.Map{
+			"window_batch_size": data.Int(5),
+			"batch_interval":    data.Int(10),
+		})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("burst", "jubaburst", ss), ShouldBeNil)
+		s := ss.(*State)
+
+		added, err := AddKeyword(ctx, "burst", "fire", 2, 1)
+		So(err, ShouldBeNil)
+		So(added, ShouldBeTrue)
+		added, err = AddKeyword(ctx, "burst", "rain", 2, 1)
+		So(err, ShouldBeNil)
+		So(added, ShouldBeTrue)
+
+		write := func(text string, pos int) {
+			So(s.Write(ctx, &core.Tuple{
+				Data: data.Map{
+					"text":     data.String(text),
+					"position": data.Int(pos),
+				},
+			}), ShouldBeNil)
+		}
+		// Each batch has 10 documents. "rain" appears constantly and "fire"
+		// appears many times in the last batch.
+		for b := 0; b < 5; b++ {
+			for i := 0; i < 10; i++ {
+				text := "sunny"
+				if i < 2 {
+					text = "rain"
+				}
+				if b == 4 && i >= 2 && i < 9 {
+					text = "fire"
+				}
+				write(fmt.Sprint(text, " ", i), b*10+i)
+			}
+		}
+
+		Convey("when getting the result of a bursting keyword", func() {
+			res, err := GetResult(ctx, "burst", "fire")
+			So(err, ShouldBeNil)
+
+			Convey("it should have weights only in the last batch.", func() {
+				So(res["start_pos"], ShouldEqual, data.Float(0))
+				bs := res["batches"].(data.Array)
+				So(len(bs), ShouldEqual, 5)
+				for i := 0; i < 4; i++ {
+					So(bs[i].(data.Map)["all_data_count"], ShouldEqual, data.Int(10))
+					So(bs[i].(data.Map)["relevant_data_count"], ShouldEqual, data.Int(0))
+					So(bs[i].(data.Map)["burst_weight"], ShouldEqual, data.Float(0))
+				}
+				So(bs[4].(data.Map)["relevant_data_count"], ShouldEqual, data.Int(7))
+				So(bs[4].(data.Map)["burst_weight"], ShouldBeGreaterThan, data.Float(0))
+			})
+		})
+
+		Convey("when getting all bursted results", func() {
+			res, err := GetAllBurstedResults(ctx, "burst")
+			So(err, ShouldBeNil)
+
+			Convey("it should only have the bursting keyword.", func() {
+				So(len(res), ShouldEqual, 1)
+				So(res, ShouldContainKey, "fire")
+			})
+		})
+
+		Convey("when adding documents after the window", func() {
+			write("fire", 55)
+			write("fire", 3)
+
+			Convey("the window should slide and old documents should be ignored.", func() {
+				res, err := GetResult(ctx, "burst", "fire")
+				So(err, ShouldBeNil)
+				So(res["start_pos"], ShouldEqual, data.Float(10))
+				bs := res["batches"].(data.Array)
+				So(len(bs), ShouldEqual, 5)
+				So(bs[0].(data.Map)["all_data_count"], ShouldEqual, data.Int(10))
+				So(bs[4].(data.Map)["all_data_count"], ShouldEqual, data.Int(1))
+				So(bs[4].(data.Map)["relevant_data_count"], ShouldEqual, data.Int(1))
+			})
+		})
+
+		Convey("when removing a keyword", func() {
+			removed, err := RemoveKeyword(ctx, "burst", "fire")
+			So(err, ShouldBeNil)
+			So(removed, ShouldBeTrue)
+
+			Convey("it should not have the keyword.", func() {
+				kws, err := Keywords(ctx, "burst")
+				So(err, ShouldBeNil)
+				So(kws, ShouldResemble, data.Map{
+					"rain": data.Map{
+						"scaling_param": data.Float(2),
+						"gamma":         data.Float(1),
+					},
+				})
+				_, err = GetResult(ctx, "burst", "fire")
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("when saving and loading the state", func() {
+			buf := bytes.NewBuffer(nil)
+			So(s.Save(ctx, buf, data.Map{}), ShouldBeNil)
+			s2, err := c.LoadState(ctx, buf, data.Map{})
+			So(err, ShouldBeNil)
+
+			Convey("the loaded state should be same.", func() {
+				b := s.burst
+				b2 := s2.(*State).burst
+				So(b2.keywords, ShouldResemble, b.keywords)
+				So(b2.all, ShouldResemble, b.all)
+				So(b2.relevant, ShouldResemble, b.relevant)
+				So(b2.start, ShouldEqual, b.start)
+				So(b2.latest, ShouldEqual, b.latest)
+
+				r, err := b.Result("fire")
+				So(err, ShouldBeNil)
+				r2, err := b2.Result("fire")
+				So(err, ShouldBeNil)
+				So(r2, ShouldResemble, r)
+			})
+		})
+	})
+}
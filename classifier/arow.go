@@ -9,14 +9,11 @@ import (
 	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"io"
 	"math"
-	"sync"
 )
 
 // AROW holds a model for classification.
 type AROW struct {
-	model  model
-	intern *intern.Intern
-	m      sync.RWMutex
+	linearClassifier
 
 	regWeight float32
 }
@@ -27,11 +24,11 @@ func NewAROW(regWeight float32) (*AROW, error) {
 	if regWeight <= 0 {
 		return nil, errors.New("regularization weight must be larger than zero")
 	}
-	return &AROW{
-		model:     make(model),
+	a := &AROW{
 		regWeight: regWeight,
-		intern:    intern.New(),
-	}, nil
+	}
+	a.init()
+	return a, nil
 }
 
 // Train trains a model with a feature vector and a label.
@@ -43,15 +40,10 @@ func (a *AROW) Train(v FeatureVector, label Label) error {
 	a.m.Lock()
 	defer a.m.Unlock()
 
-	if _, ok := a.model[label]; !ok {
-		a.model[label] = make(weights)
-	}
-
-	fvForScores, fvFull, err := v.toInternal(a.intern)
+	scores, fvFull, err := a.prepareTrain(v, label)
 	if err != nil {
 		return err
 	}
-	scores := a.model.scores(fvForScores)
 	incorr, _ := scores.maxExcept(label)
 	margin := scores.margin(label, incorr)
 
@@ -84,29 +76,53 @@ func (a *AROW) Train(v FeatureVector, label Label) error {
 	return nil
 }
 
-// Classify classifies a feature vector. This function returns
-// all labels and scores.
-func (a *AROW) Classify(v FeatureVector) (LScores, error) {
-	a.m.RLock()
-	defer a.m.RUnlock()
-	intfv, err := v.toInternalForScores(a.intern)
-	if err != nil {
-		return nil, err
+// TrainMultiLabel trains a model with a feature vector and a set of labels.
+// Each label in the model is trained as a binary classifier which tells
+// whether the feature vector has the label or not (one-vs-rest).
+func (a *AROW) TrainMultiLabel(v FeatureVector, labels []Label) error {
+	positive := make(map[Label]bool, len(labels))
+	for _, l := range labels {
+		if l == "" {
+			return errors.New("label must not be empty")
+		}
+		positive[l] = true
 	}
-	scores := a.model.scores(intfv)
-	return scores, nil
-}
 
-// Clear clears a model.
-func (a *AROW) Clear() {
 	a.m.Lock()
 	defer a.m.Unlock()
-	a.model = make(model)
-	a.intern = intern.New()
+
+	fvFull, err := a.prepareTrainMultiLabel(v, labels)
+	if err != nil {
+		return err
+	}
+
+	for l, ws := range a.model {
+		var y float32 = -1
+		if positive[l] {
+			y = 1
+		}
+		margin := y * ws.score(fvFull)
+		if margin >= 1 {
+			continue
+		}
+
+		variance := ws.variance(fvFull)
+		beta := 1 / (variance + 1/a.regWeight)
+		alpha := (1 - margin) * beta
+
+		for _, elem := range fvFull {
+			if y > 0 {
+				ws.positiveUpdate(alpha, beta, elem.dim, elem.value)
+			} else {
+				ws.negativeUpdate(alpha, beta, elem.dim, elem.value)
+			}
+		}
+	}
+	return nil
 }
 
 var (
-	arowFormatVersion uint8 = 1
+	arowFormatVersion uint8 = 2
 )
 
 type arowMsgpack struct {
@@ -120,18 +136,10 @@ func (a *AROW) Save(w io.Writer) error {
 	a.m.RLock()
 	defer a.m.RUnlock()
 
-	if _, err := w.Write([]byte{arowFormatVersion}); err != nil {
-		return err
-	}
-
-	enc := codec.NewEncoder(w, classifierMsgpackHandle)
-	if err := enc.Encode(&arowMsgpack{
+	return a.save(w, arowFormatVersion, &arowMsgpack{
 		Model:     a.model,
 		RegWeight: a.regWeight,
-	}); err != nil {
-		return err
-	}
-	return a.intern.Save(w)
+	})
 }
 
 // TODO: Provide Load which is memory&CPU efficient than the current
@@ -147,6 +155,8 @@ func LoadAROW(r io.Reader) (*AROW, error) {
 	switch formatVersion[0] {
 	case 1:
 		return loadAROWFormatV1(r)
+	case 2:
+		return loadAROWFormatV2(r)
 	default:
 		return nil, fmt.Errorf("unsupported format version of AROW container: %v", formatVersion[0])
 	}
@@ -163,11 +173,24 @@ func loadAROWFormatV1(r io.Reader) (*AROW, error) {
 		return nil, err
 	}
 
-	return &AROW{
-		model:     m.Model,
-		intern:    i,
+	a := &AROW{
 		regWeight: m.RegWeight,
-	}, nil
+	}
+	a.model = m.Model
+	a.intern = i
+	a.labelCounts = make(map[Label]uint64)
+	return a, nil
+}
+
+func loadAROWFormatV2(r io.Reader) (*AROW, error) {
+	a := &AROW{}
+	m := arowMsgpack{}
+	if err := a.load(r, &m); err != nil {
+		return nil, err
+	}
+	a.model = m.Model
+	a.regWeight = m.RegWeight
+	return a, nil
 }
 
 // RegWeight returns regularization weight.
@@ -204,6 +227,26 @@ func (v FeatureVector) toInternal(intern *intern.Intern) (fVectorForScores, fVec
 	return fVectorForScores(full), full, nil
 }
 
+// toHashed converts a feature vector to internal format by hashing keys into
+// maxSize dimensions. Values of keys having the same hash are summed up.
+func (v FeatureVector) toHashed(maxSize int) (fVector, error) {
+	idx := make(map[dim]int, len(v))
+	ret := make(fVector, 0, len(v))
+	err := nested.Flatten(data.Map(v), func(key string, value float32) {
+		d := dim(intern.Hash(key, maxSize))
+		if i, ok := idx[d]; ok {
+			ret[i].value += value
+			return
+		}
+		idx[d] = len(ret)
+		ret = append(ret, fElement{d, value})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
 type appender func(string, float32)
 
 type dim int
@@ -214,6 +257,14 @@ type fElement struct {
 type fVector []fElement
 type fVectorForScores []fElement
 
+func (v fVector) squaredNorm() float32 {
+	var norm2 float32
+	for _, elem := range v {
+		norm2 += elem.value * elem.value
+	}
+	return norm2
+}
+
 // Label represents labels for classification.
 type Label string
 type weight struct {
@@ -231,6 +282,40 @@ func initialWeight() weight {
 	}
 }
 
+// score returns the inner product of the weights and a feature vector.
+func (ws weights) score(v fVector) float32 {
+	var score float32
+	for _, x := range v {
+		score += x.value * ws[x.dim].Weight
+	}
+	return score
+}
+
+// get returns the weight of dim. It returns the initial weight when dim
+// doesn't have a weight yet.
+func (ws weights) get(dim dim) weight {
+	if w, ok := ws[dim]; ok {
+		return w
+	}
+	return initialWeight()
+}
+
+// add adds x to the weight of dim.
+func (ws weights) add(dim dim, x float32) {
+	w := ws.get(dim)
+	w.Weight += x
+	ws[dim] = w
+}
+
+// confidenceUpdate moves the weight of dim by stepWidth * covariance * x and
+// adds invCovStep to the inverse of the covariance.
+func (ws weights) confidenceUpdate(dim dim, stepWidth, invCovStep, x float32) {
+	w := ws.get(dim)
+	w.Weight += stepWidth * w.Covariance * x
+	w.Covariance = 1 / (1/w.Covariance + invCovStep)
+	ws[dim] = w
+}
+
 func (ws weights) negativeUpdate(alpha, beta float32, dim dim, x float32) {
 	ws.update(alpha, beta, dim, x, (*weight).negativeUpdate)
 }
@@ -240,12 +325,7 @@ func (ws weights) positiveUpdate(alpha, beta float32, dim dim, x float32) {
 }
 
 func (ws weights) update(alpha, beta float32, dim dim, x float32, f weightUpdateFunction) {
-	var weight weight
-	if w, ok := ws[dim]; ok {
-		weight = w
-	} else {
-		weight = initialWeight()
-	}
+	weight := ws.get(dim)
 	f(&weight, alpha, beta, x)
 	ws[dim] = weight
 }
@@ -334,6 +414,15 @@ func variance(v fVector, w1, w2 weights) float32 {
 	return variance
 }
 
+// variance returns the variance of the score of a feature vector.
+func (ws weights) variance(v fVector) float32 {
+	var variance float32
+	for _, elem := range v {
+		variance += ws.covariance(elem.dim) * elem.value * elem.value
+	}
+	return variance
+}
+
 // TODO: consider to rename
 func (ws weights) covariance(dim dim) float32 {
 	if ws == nil {
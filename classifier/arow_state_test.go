@@ -2,7 +2,9 @@ package classifier
 
 import (
 	"bytes"
+	"github.com/sensorbee/jubatus/internal/intern"
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/ugorji/go/codec"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"testing"
@@ -50,9 +52,9 @@ func TestAROWStateSaveLoad(t *testing.T) {
 					So(a2, ShouldResemble, a)
 
 					fv := FeatureVector(data.Map{"n": data.Int(10)})
-					s, err := a.arow.Classify(fv)
+					s, err := a.classifier.Classify(fv)
 					So(err, ShouldBeNil)
-					s2, err := a2.(*AROWState).arow.Classify(fv)
+					s2, err := a2.(*AROWState).classifier.Classify(fv)
 					So(err, ShouldBeNil)
 					So(s2, ShouldResemble, s)
 				})
@@ -60,3 +62,37 @@ func TestAROWStateSaveLoad(t *testing.T) {
 		})
 	})
 }
+
+func TestLoadAROWFormatV1(t *testing.T) {
+	Convey("Given an AROW saved in format version 1", t, func() {
+		i := intern.New()
+		d := dim(i.Get("x"))
+		buf := bytes.NewBuffer([]byte{1})
+		enc := codec.NewEncoder(buf, classifierMsgpackHandle)
+		So(enc.Encode(&arowMsgpack{
+			Model: model{
+				"a": weights{d: {Weight: 1, Covariance: 0.5}},
+				"b": weights{d: {Weight: -1, Covariance: 0.5}},
+			},
+			RegWeight: 0.1,
+		}), ShouldBeNil)
+		So(i.Save(buf), ShouldBeNil)
+
+		Convey("when loading it", func() {
+			a, err := LoadAROW(buf)
+			So(err, ShouldBeNil)
+
+			Convey("it should have the same weights.", func() {
+				So(a.RegWeight(), ShouldEqual, 0.1)
+				s, err := a.Classify(FeatureVector{"x": data.Int(1)})
+				So(err, ShouldBeNil)
+				l, _ := s.Max()
+				So(l, ShouldEqual, "a")
+			})
+
+			Convey("it should have zero label counts.", func() {
+				So(a.Labels(), ShouldResemble, map[Label]uint64{"a": 0, "b": 0})
+			})
+		})
+	})
+}
@@ -0,0 +1,141 @@
+package classifier
+
+import (
+	"math"
+	"sync"
+)
+
+// plattCalibrator converts scores of labels into probabilities by Platt
+// scaling, i.e. p = 1 / (1 + exp(-(A * score + B))). Parameters of each label
+// are trained online by AdaGrad with scores computed before the classifier
+// is trained with the same data, so that they aren't fitted to scores of
+// data the classifier has already seen.
+type plattCalibrator struct {
+	_struct struct{} `codec:",toarray"`
+
+	LearningRate float64
+	Params       map[Label]*plattParams
+
+	m sync.RWMutex
+}
+
+type plattParams struct {
+	_struct struct{} `codec:",toarray"`
+
+	A float64
+	B float64
+
+	// SqGradA and SqGradB are sums of squared gradients used by AdaGrad.
+	SqGradA float64
+	SqGradB float64
+
+	// Pos and Neg are the numbers of positive and negative examples. They
+	// are used to smooth targets as Platt's original method does.
+	Pos uint64
+	Neg uint64
+}
+
+const (
+	defaultCalibrationLearningRate = 0.1
+	adaGradEpsilon                 = 1e-8
+)
+
+func newPlattCalibrator(learningRate float64) *plattCalibrator {
+	return &plattCalibrator{
+		LearningRate: learningRate,
+		Params:       make(map[Label]*plattParams),
+	}
+}
+
+func newPlattParams() *plattParams {
+	return &plattParams{
+		A: 1,
+	}
+}
+
+// update trains parameters of all labels in scores and labels with a datum
+// having scores and labels. Labels which don't have scores are regarded as
+// having zero scores.
+func (c *plattCalibrator) update(scores LScores, labels []Label) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	positive := make(map[Label]bool, len(labels))
+	for _, l := range labels {
+		positive[l] = true
+		if _, ok := c.Params[l]; !ok {
+			c.Params[l] = newPlattParams()
+		}
+	}
+	for l := range scores {
+		if _, ok := c.Params[Label(l)]; !ok {
+			c.Params[Label(l)] = newPlattParams()
+		}
+	}
+
+	for l, p := range c.Params {
+		if _, ok := scores[string(l)]; !ok && !positive[l] {
+			continue
+		}
+		p.update(scores.score(l), positive[l], c.LearningRate)
+	}
+}
+
+// deleteLabel deletes parameters of a label so that the label is calibrated
+// from scratch when it's added again.
+func (c *plattCalibrator) deleteLabel(l Label) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	delete(c.Params, l)
+}
+
+func (p *plattParams) update(score float32, positive bool, learningRate float64) {
+	var y float64
+	if positive {
+		p.Pos++
+		y = (float64(p.Pos) + 1) / (float64(p.Pos) + 2)
+	} else {
+		p.Neg++
+		y = 1 / (float64(p.Neg) + 2)
+	}
+
+	s := float64(score)
+	d := p.probability(s) - y
+	gA := d * s
+	gB := d
+	p.SqGradA += gA * gA
+	p.SqGradB += gB * gB
+	p.A -= learningRate * gA / math.Sqrt(p.SqGradA+adaGradEpsilon)
+	p.B -= learningRate * gB / math.Sqrt(p.SqGradB+adaGradEpsilon)
+}
+
+func (p *plattParams) probability(score float64) float64 {
+	return 1 / (1 + math.Exp(-(p.A*score + p.B)))
+}
+
+// probabilities converts scores into probabilities. Labels which haven't
+// been calibrated yet use the standard sigmoid function. When normalize is
+// true, probabilities are normalized so that their sum is 1.
+func (c *plattCalibrator) probabilities(scores LScores, normalize bool) map[Label]float64 {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	ret := make(map[Label]float64, len(scores))
+	sum := 0.0
+	for l := range scores {
+		p, ok := c.Params[Label(l)]
+		if !ok {
+			p = newPlattParams()
+		}
+		x := p.probability(float64(scores.score(Label(l))))
+		ret[Label(l)] = x
+		sum += x
+	}
+
+	if normalize && sum > 0 {
+		for l, x := range ret {
+			ret[l] = x / sum
+		}
+	}
+	return ret
+}
@@ -0,0 +1,153 @@
+package classifier
+
+import (
+	"io"
+)
+
+// Classifier is an interface which all classification algorithms implement.
+type Classifier interface {
+	// Train trains a model with a feature vector and a label.
+	Train(v FeatureVector, label Label) error
+
+	// Classify classifies a feature vector. It returns all labels and their
+	// scores.
+	Classify(v FeatureVector) (LScores, error)
+
+	// Clear clears a model.
+	Clear()
+
+	// Save saves the current state of the model.
+	Save(w io.Writer) error
+}
+
+// MultiLabelClassifier is an interface which classification algorithms
+// supporting multi-label classification implement.
+type MultiLabelClassifier interface {
+	Classifier
+
+	// TrainMultiLabel trains a model with a feature vector and a set of
+	// labels the feature vector has.
+	TrainMultiLabel(v FeatureVector, labels []Label) error
+}
+
+// LabelManager is an interface which classification algorithms managing
+// labels explicitly implement.
+type LabelManager interface {
+	// AddLabel registers a label without training. It returns false when the
+	// label has already been registered.
+	AddLabel(label Label) (bool, error)
+
+	// DeleteLabel deletes a label from a model. It returns false when the
+	// label doesn't exist.
+	DeleteLabel(label Label) bool
+
+	// Labels returns all labels and the number of training data of each
+	// label.
+	Labels() map[Label]uint64
+}
+
+// FeatureHasher is an interface which classification algorithms supporting
+// the hashing trick implement.
+type FeatureHasher interface {
+	// SetHashMaxSize makes a model hash keys of feature vectors into maxSize
+	// dimensions instead of keeping all keys. Zero disables hashing. It
+	// must be called before training.
+	SetHashMaxSize(maxSize int) error
+
+	// HashMaxSize returns the number of dimensions into which keys are
+	// hashed. It returns zero when hashing is disabled.
+	HashMaxSize() int
+}
+
+// Pruner is an interface which classification algorithms supporting pruning
+// of dimensions implement.
+type Pruner interface {
+	// SetPruningPolicy sets a policy to drop dimensions from a model. nil
+	// disables pruning.
+	SetPruningPolicy(p *PruningPolicy) error
+
+	// PruningPolicy returns the current pruning policy. It returns nil when
+	// pruning is disabled.
+	PruningPolicy() *PruningPolicy
+}
+
+// WeightInspector is an interface which linear classification algorithms
+// implement to expose their weights.
+type WeightInspector interface {
+	// TopWeights returns at most n features having the largest positive
+	// weights and n features having the largest negative weights of each
+	// label.
+	TopWeights(n int) map[Label]*LabelWeights
+}
+
+// Explainer is an interface which linear classification algorithms
+// implement to explain their scores.
+type Explainer interface {
+	// Explain returns contributions of features of v to the score of label.
+	Explain(v FeatureVector, label Label) ([]Contribution, error)
+}
+
+var (
+	_ Classifier = &AROW{}
+	_ Classifier = &Perceptron{}
+	_ Classifier = &PassiveAggressive{}
+	_ Classifier = &PassiveAggressive1{}
+	_ Classifier = &PassiveAggressive2{}
+	_ Classifier = &ConfidenceWeighted{}
+	_ Classifier = &NormalHerd{}
+	_ Classifier = &NearestNeighbor{}
+)
+
+var (
+	_ LabelManager = &AROW{}
+	_ LabelManager = &Perceptron{}
+	_ LabelManager = &PassiveAggressive{}
+	_ LabelManager = &PassiveAggressive1{}
+	_ LabelManager = &PassiveAggressive2{}
+	_ LabelManager = &ConfidenceWeighted{}
+	_ LabelManager = &NormalHerd{}
+)
+
+var (
+	_ MultiLabelClassifier = &AROW{}
+)
+
+var (
+	_ FeatureHasher = &AROW{}
+	_ FeatureHasher = &Perceptron{}
+	_ FeatureHasher = &PassiveAggressive{}
+	_ FeatureHasher = &PassiveAggressive1{}
+	_ FeatureHasher = &PassiveAggressive2{}
+	_ FeatureHasher = &ConfidenceWeighted{}
+	_ FeatureHasher = &NormalHerd{}
+)
+
+var (
+	_ Pruner = &AROW{}
+	_ Pruner = &Perceptron{}
+	_ Pruner = &PassiveAggressive{}
+	_ Pruner = &PassiveAggressive1{}
+	_ Pruner = &PassiveAggressive2{}
+	_ Pruner = &ConfidenceWeighted{}
+	_ Pruner = &NormalHerd{}
+)
+
+var (
+	_ WeightInspector = &AROW{}
+	_ WeightInspector = &Perceptron{}
+	_ WeightInspector = &PassiveAggressive{}
+	_ WeightInspector = &PassiveAggressive1{}
+	_ WeightInspector = &PassiveAggressive2{}
+	_ WeightInspector = &ConfidenceWeighted{}
+	_ WeightInspector = &NormalHerd{}
+)
+
+var (
+	_ Explainer = &AROW{}
+	_ Explainer = &Perceptron{}
+	_ Explainer = &PassiveAggressive{}
+	_ Explainer = &PassiveAggressive1{}
+	_ Explainer = &PassiveAggressive2{}
+	_ Explainer = &ConfidenceWeighted{}
+	_ Explainer = &NormalHerd{}
+)
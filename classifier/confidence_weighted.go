@@ -0,0 +1,116 @@
+package classifier
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ConfidenceWeighted holds a model for classification using Confidence
+// Weighted (CW) learning.
+type ConfidenceWeighted struct {
+	linearClassifier
+
+	regWeight float32
+}
+
+// NewConfidenceWeighted creates a ConfidenceWeighted model. regWeight is the
+// confidence parameter of CW. When regWeight is large, the model learns
+// quickly but harms from noise. regWeight must be larger than zero.
+func NewConfidenceWeighted(regWeight float32) (*ConfidenceWeighted, error) {
+	if regWeight <= 0 {
+		return nil, errors.New("regularization weight must be larger than zero")
+	}
+	cw := &ConfidenceWeighted{
+		regWeight: regWeight,
+	}
+	cw.init()
+	return cw, nil
+}
+
+// Train trains a model with a feature vector and a label.
+//
+// jubatus::core::classifier::confidence_weighted::train
+func (cw *ConfidenceWeighted) Train(v FeatureVector, label Label) error {
+	if label == "" {
+		return errors.New("label must not be empty")
+	}
+
+	cw.m.Lock()
+	defer cw.m.Unlock()
+
+	scores, fvFull, err := cw.prepareTrain(v, label)
+	if err != nil {
+		return err
+	}
+	incorr, _ := scores.maxExcept(label)
+	margin := -scores.margin(label, incorr)
+	variance := variance(fvFull, cw.model[label], cw.model[incorr])
+
+	C := cw.regWeight
+	b := 1 + 2*C*margin
+	gamma := -b + float32(math.Sqrt(float64(b*b-8*C*(margin-C*variance))))
+	if !(gamma > 0) {
+		// gamma can also be NaN.
+		return nil
+	}
+	gamma /= 4 * C * variance
+
+	cw.updateWithConfidence(fvFull, gamma, func(x float32) float32 {
+		return 2 * gamma * C * x * x
+	}, label, incorr)
+	return nil
+}
+
+const (
+	cwFormatVersion uint8 = 1
+)
+
+type cwMsgpack struct {
+	_struct   struct{} `codec:",toarray"`
+	Model     model
+	RegWeight float32
+}
+
+// Save saves the current state of ConfidenceWeighted.
+func (cw *ConfidenceWeighted) Save(w io.Writer) error {
+	cw.m.RLock()
+	defer cw.m.RUnlock()
+
+	return cw.save(w, cwFormatVersion, &cwMsgpack{
+		Model:     cw.model,
+		RegWeight: cw.regWeight,
+	})
+}
+
+// LoadConfidenceWeighted loads ConfidenceWeighted from the saved data.
+func LoadConfidenceWeighted(r io.Reader) (*ConfidenceWeighted, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadConfidenceWeightedFormatV1(r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of ConfidenceWeighted container: %v", formatVersion[0])
+	}
+}
+
+func loadConfidenceWeightedFormatV1(r io.Reader) (*ConfidenceWeighted, error) {
+	cw := &ConfidenceWeighted{}
+	m := cwMsgpack{}
+	if err := cw.load(r, &m); err != nil {
+		return nil, err
+	}
+	cw.model = m.Model
+	cw.regWeight = m.RegWeight
+	return cw, nil
+}
+
+// RegWeight returns regularization weight.
+func (cw *ConfidenceWeighted) RegWeight() float32 {
+	return cw.regWeight
+}
@@ -0,0 +1,37 @@
+package classifier
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+)
+
+// ConfidenceWeightedStateCreator is used by BQL to create or load a State
+// having CW classification algorithm as a UDS.
+type ConfidenceWeightedStateCreator struct {
+}
+
+var _ udf.UDSLoader = &ConfidenceWeightedStateCreator{}
+
+// CreateState creates a new state for CW classifier.
+func (c *ConfidenceWeightedStateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	rw, err := extractRegWeight(params)
+	if err != nil {
+		return nil, err
+	}
+
+	cw, err := NewConfidenceWeighted(rw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize CW: %v", err)
+	}
+	return newState("cw", cw, params)
+}
+
+// LoadState loads a new state for CW classifier.
+func (c *ConfidenceWeightedStateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	return loadState(ctx, r, "cw", func(r io.Reader) (Classifier, error) {
+		return LoadConfidenceWeighted(r)
+	})
+}
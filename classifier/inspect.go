@@ -0,0 +1,196 @@
+package classifier
+
+import (
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/intern"
+	"github.com/sensorbee/jubatus/internal/nested"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+)
+
+// FeatureWeight is a weight of a feature in a linear model.
+type FeatureWeight struct {
+	// Key is the flattened key of the feature rendered by
+	// nested.ReadableKey. Keys of hashed features are "#" followed by their
+	// hash values because original keys aren't kept.
+	Key    string
+	Weight float32
+
+	// Covariance is the variance of the weight. It's only set when
+	// LabelWeights.HasCovariance is true.
+	Covariance float32
+}
+
+// LabelWeights has features having the largest positive weights and the
+// largest negative weights of a label. Positive is sorted in the descending
+// order of weights and Negative is sorted in the ascending order.
+type LabelWeights struct {
+	Positive []FeatureWeight
+	Negative []FeatureWeight
+
+	// HasCovariance is true when the algorithm tracks confidence of weights.
+	HasCovariance bool
+}
+
+// topWeights returns at most n positive and n negative weights of each label.
+// Covariance is set when withCov is true. It requires read lock.
+func (l *linearClassifier) topWeights(n int, withCov bool) map[Label]*LabelWeights {
+	var keys map[int]string
+	if l.hashMaxSize == 0 {
+		keys = l.intern.Reverse()
+	}
+	key := func(d dim) string {
+		if keys == nil {
+			return fmt.Sprintf("#%v", int(d))
+		}
+		return nested.ReadableKey(keys[int(d)])
+	}
+
+	ret := make(map[Label]*LabelWeights, len(l.model))
+	for label, ws := range l.model {
+		var pos, neg byWeight
+		for d, w := range ws {
+			fw := FeatureWeight{
+				Key:    key(d),
+				Weight: w.Weight,
+			}
+			if withCov {
+				fw.Covariance = w.Covariance
+			}
+			switch {
+			case w.Weight > 0:
+				pos = append(pos, fw)
+			case w.Weight < 0:
+				neg = append(neg, fw)
+			}
+		}
+		sort.Sort(sort.Reverse(pos))
+		sort.Sort(neg)
+		if len(pos) > n {
+			pos = pos[:n]
+		}
+		if len(neg) > n {
+			neg = neg[:n]
+		}
+		ret[label] = &LabelWeights{
+			Positive:      pos,
+			Negative:      neg,
+			HasCovariance: withCov,
+		}
+	}
+	return ret
+}
+
+// TopWeights returns at most n features having the largest positive weights
+// and n features having the largest negative weights of each label.
+func (l *linearClassifier) TopWeights(n int) map[Label]*LabelWeights {
+	l.m.RLock()
+	defer l.m.RUnlock()
+	return l.topWeights(n, false)
+}
+
+// TopWeights returns at most n features having the largest positive weights
+// and n features having the largest negative weights of each label with
+// their covariance.
+func (a *AROW) TopWeights(n int) map[Label]*LabelWeights {
+	a.m.RLock()
+	defer a.m.RUnlock()
+	return a.topWeights(n, true)
+}
+
+// TopWeights returns at most n features having the largest positive weights
+// and n features having the largest negative weights of each label with
+// their covariance.
+func (cw *ConfidenceWeighted) TopWeights(n int) map[Label]*LabelWeights {
+	cw.m.RLock()
+	defer cw.m.RUnlock()
+	return cw.topWeights(n, true)
+}
+
+// TopWeights returns at most n features having the largest positive weights
+// and n features having the largest negative weights of each label with
+// their covariance.
+func (nh *NormalHerd) TopWeights(n int) map[Label]*LabelWeights {
+	nh.m.RLock()
+	defer nh.m.RUnlock()
+	return nh.topWeights(n, true)
+}
+
+// byWeight sorts features in the ascending order of weights. Ties are broken
+// by keys to make the result deterministic.
+type byWeight []FeatureWeight
+
+func (b byWeight) Len() int {
+	return len(b)
+}
+
+func (b byWeight) Less(i, j int) bool {
+	if b[i].Weight != b[j].Weight {
+		return b[i].Weight < b[j].Weight
+	}
+	return b[i].Key < b[j].Key
+}
+
+func (b byWeight) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
+
+// Contribution is a contribution of a feature to a score. The contribution
+// is Value * Weight.
+type Contribution struct {
+	// Key is the flattened key of the feature.
+	Key    string
+	Value  float32
+	Weight float32
+}
+
+// Explain returns contributions of features of v to the score of label. The
+// sum of the contributions is the score Classify returns.
+func (l *linearClassifier) Explain(v FeatureVector, label Label) ([]Contribution, error) {
+	l.m.RLock()
+	defer l.m.RUnlock()
+
+	ws, ok := l.model[label]
+	if !ok {
+		return nil, fmt.Errorf("label '%v' doesn't exist", label)
+	}
+
+	var ret []Contribution
+	if err := nested.Flatten(data.Map(v), func(key string, value float32) {
+		var d dim
+		if l.hashMaxSize > 0 {
+			d = dim(intern.Hash(key, l.hashMaxSize))
+		} else {
+			d = dim(l.intern.GetOrZero(key))
+		}
+		ret = append(ret, Contribution{
+			Key:    key,
+			Value:  value,
+			Weight: ws[d].Weight,
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// byContribution sorts contributions in the descending order of their
+// absolute values. Ties are broken by keys to make the result deterministic.
+type byContribution []Contribution
+
+func (b byContribution) Len() int {
+	return len(b)
+}
+
+func (b byContribution) Less(i, j int) bool {
+	ci := abs(b[i].Value * b[i].Weight)
+	cj := abs(b[j].Value * b[j].Weight)
+	if ci != cj {
+		return ci > cj
+	}
+	return b[i].Key < b[j].Key
+}
+
+func (b byContribution) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
@@ -0,0 +1,349 @@
+package classifier
+
+import (
+	"errors"
+	"github.com/sensorbee/jubatus/internal/intern"
+	"github.com/sensorbee/jubatus/internal/pruning"
+	"github.com/ugorji/go/codec"
+	"io"
+	"sync"
+)
+
+// linearClassifier is a base of linear classification algorithms. It has a
+// weight vector for each label and classifies a feature vector by the inner
+// products of them.
+//
+// jubatus::core::classifier::linear_classifier
+type linearClassifier struct {
+	model  model
+	intern *intern.Intern
+	m      sync.RWMutex
+
+	// hashMaxSize is the number of dimensions into which keys of feature
+	// vectors are hashed. intern isn't used when it's greater than zero.
+	hashMaxSize int
+
+	// labelCounts has the number of training data of each label.
+	labelCounts map[Label]uint64
+
+	// pruner drops dimensions from the model. It's nil when pruning is
+	// disabled.
+	pruner *pruning.Pruner
+}
+
+func (l *linearClassifier) init() {
+	l.model = make(model)
+	l.intern = intern.New()
+	l.labelCounts = make(map[Label]uint64)
+}
+
+// Classify classifies a feature vector. This function returns
+// all labels and scores.
+func (l *linearClassifier) Classify(v FeatureVector) (LScores, error) {
+	l.m.RLock()
+	defer l.m.RUnlock()
+	intfv, err := l.toInternalForScores(v)
+	if err != nil {
+		return nil, err
+	}
+	scores := l.model.scores(intfv)
+	return scores, nil
+}
+
+// Clear clears a model.
+func (l *linearClassifier) Clear() {
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.init()
+	if l.pruner != nil {
+		l.pruner.Reset()
+	}
+}
+
+// prepareTrain registers label to the model and converts a feature vector to
+// the internal format. It returns the current scores of the feature vector.
+// It requires write lock.
+func (l *linearClassifier) prepareTrain(v FeatureVector, label Label) (LScores, fVector, error) {
+	if _, ok := l.model[label]; !ok {
+		l.model[label] = make(weights)
+	}
+
+	fvForScores, fvFull, err := l.toInternal(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	l.touch(fvFull)
+	l.labelCounts[label]++
+	return l.model.scores(fvForScores), fvFull, nil
+}
+
+// prepareTrainMultiLabel registers labels to the model and converts a feature
+// vector to the internal format. It requires write lock.
+func (l *linearClassifier) prepareTrainMultiLabel(v FeatureVector, labels []Label) (fVector, error) {
+	for _, label := range labels {
+		if _, ok := l.model[label]; !ok {
+			l.model[label] = make(weights)
+		}
+	}
+
+	_, fvFull, err := l.toInternal(v)
+	if err != nil {
+		return nil, err
+	}
+	l.touch(fvFull)
+	for _, label := range labels {
+		l.labelCounts[label]++
+	}
+	return fvFull, nil
+}
+
+// toInternalForScores converts a feature vector to the internal format by
+// hashing or interning keys. It requires read lock.
+func (l *linearClassifier) toInternalForScores(v FeatureVector) (fVectorForScores, error) {
+	if l.hashMaxSize > 0 {
+		fv, err := v.toHashed(l.hashMaxSize)
+		return fVectorForScores(fv), err
+	}
+	return v.toInternalForScores(l.intern)
+}
+
+// toInternal converts a feature vector to the internal format by hashing or
+// interning keys. It requires write lock.
+func (l *linearClassifier) toInternal(v FeatureVector) (fVectorForScores, fVector, error) {
+	if l.hashMaxSize > 0 {
+		fv, err := v.toHashed(l.hashMaxSize)
+		return fVectorForScores(fv), fv, err
+	}
+	return v.toInternal(l.intern)
+}
+
+// SetHashMaxSize makes the model hash keys of feature vectors into maxSize
+// dimensions instead of interning them, so that the size of the model is
+// bounded. Zero disables hashing. It must be called before training.
+func (l *linearClassifier) SetHashMaxSize(maxSize int) error {
+	if maxSize < 0 {
+		return errors.New("hash max size must not be less than zero")
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	for _, ws := range l.model {
+		if len(ws) > 0 {
+			return errors.New("hash max size cannot be changed after training")
+		}
+	}
+	l.hashMaxSize = maxSize
+	return nil
+}
+
+// HashMaxSize returns the number of dimensions into which keys are hashed.
+// It returns zero when hashing is disabled.
+func (l *linearClassifier) HashMaxSize() int {
+	l.m.RLock()
+	defer l.m.RUnlock()
+	return l.hashMaxSize
+}
+
+// SetPruningPolicy sets a policy to drop dimensions from the model. nil
+// disables pruning.
+func (l *linearClassifier) SetPruningPolicy(p *PruningPolicy) error {
+	if p != nil && p.Interval == 0 {
+		return errors.New("pruning interval must be greater than zero")
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if p == nil {
+		l.pruner = nil
+		return nil
+	}
+	l.pruner = pruning.New(p)
+	return nil
+}
+
+// PruningPolicy returns the current pruning policy. It returns nil when
+// pruning is disabled.
+func (l *linearClassifier) PruningPolicy() *PruningPolicy {
+	l.m.RLock()
+	defer l.m.RUnlock()
+
+	if l.pruner == nil {
+		return nil
+	}
+	p := *l.pruner.Policy
+	return &p
+}
+
+// touch notifies the pruner that v is being trained and prunes the model
+// when it's time to do. It requires write lock.
+func (l *linearClassifier) touch(v fVector) {
+	if l.pruner == nil {
+		return
+	}
+	dims := v.dims()
+	if !l.pruner.Touch(dims) {
+		return
+	}
+
+	// Dimensions of v are kept in live because v is about to be added to
+	// the model.
+	live := l.pruner.Prune(l.model.prunable(), dims)
+	if l.hashMaxSize > 0 {
+		return
+	}
+	l.intern.Compact(func(id int) bool {
+		return live[id]
+	})
+}
+
+// AddLabel registers a label with zero weights. It returns false when the
+// label has already been registered.
+func (l *linearClassifier) AddLabel(label Label) (bool, error) {
+	if label == "" {
+		return false, errors.New("label must not be empty")
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if _, ok := l.model[label]; ok {
+		return false, nil
+	}
+	l.model[label] = make(weights)
+	l.labelCounts[label] = 0
+	return true, nil
+}
+
+// DeleteLabel deletes a label and its weights from the model. It returns
+// false when the label doesn't exist.
+func (l *linearClassifier) DeleteLabel(label Label) bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if _, ok := l.model[label]; !ok {
+		return false
+	}
+	delete(l.model, label)
+	delete(l.labelCounts, label)
+	return true
+}
+
+// Labels returns all labels in the model and the number of training data of
+// each label.
+func (l *linearClassifier) Labels() map[Label]uint64 {
+	l.m.RLock()
+	defer l.m.RUnlock()
+
+	ret := make(map[Label]uint64, len(l.model))
+	for label := range l.model {
+		ret[label] = l.labelCounts[label]
+	}
+	return ret
+}
+
+// update adds stepWidth * v to weights of correct and subtracts it from
+// weights of incorrect. incorrect can be empty. It requires write lock.
+//
+// jubatus::core::classifier::linear_classifier::update_weight
+func (l *linearClassifier) update(v fVector, stepWidth float32, correct, incorrect Label) {
+	var incorrWeights weights
+	if incorrect != "" {
+		incorrWeights = l.model[incorrect]
+	}
+	corrWeights := l.model[correct]
+
+	for _, elem := range v {
+		d := stepWidth * elem.value
+		if incorrect != "" {
+			incorrWeights.add(elem.dim, -d)
+		}
+		corrWeights.add(elem.dim, d)
+	}
+}
+
+// updateWithConfidence updates weights of correct and incorrect with their
+// covariance. The mean of each dimension moves by stepWidth * covariance * x
+// and the inverse of the covariance increases by invCovStep(x). incorrect can
+// be empty. It requires write lock.
+//
+// jubatus::core::classifier::confidence_weighted::update
+// jubatus::core::classifier::normal_herd::update
+func (l *linearClassifier) updateWithConfidence(v fVector, stepWidth float32, invCovStep func(x float32) float32,
+	correct, incorrect Label) {
+	var incorrWeights weights
+	if incorrect != "" {
+		incorrWeights = l.model[incorrect]
+	}
+	corrWeights := l.model[correct]
+
+	for _, elem := range v {
+		step := invCovStep(elem.value)
+		if incorrect != "" {
+			incorrWeights.confidenceUpdate(elem.dim, -stepWidth, step, elem.value)
+		}
+		corrWeights.confidenceUpdate(elem.dim, stepWidth, step, elem.value)
+	}
+}
+
+type linearMsgpack struct {
+	_struct     struct{} `codec:",toarray"`
+	LabelCounts map[Label]uint64
+	HashMaxSize int
+
+	// Pruner is nil when pruning is disabled.
+	Pruner *pruning.Pruner
+}
+
+// save saves the model with an algorithm specific header. It requires read
+// lock.
+func (l *linearClassifier) save(w io.Writer, formatVersion uint8, header interface{}) error {
+	if _, err := w.Write([]byte{formatVersion}); err != nil {
+		return err
+	}
+
+	enc := codec.NewEncoder(w, classifierMsgpackHandle)
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+	if err := enc.Encode(&linearMsgpack{
+		LabelCounts: l.labelCounts,
+		HashMaxSize: l.hashMaxSize,
+		Pruner:      l.pruner,
+	}); err != nil {
+		return err
+	}
+	return l.intern.Save(w)
+}
+
+// load decodes an algorithm specific header saved by linearClassifier.save
+// and loads the rest of the model except weights, which are a part of the
+// header. The format version must be read by the caller.
+func (l *linearClassifier) load(r io.Reader, header interface{}) error {
+	dec := codec.NewDecoder(r, classifierMsgpackHandle)
+	if err := dec.Decode(header); err != nil {
+		return err
+	}
+
+	var d linearMsgpack
+	if err := dec.Decode(&d); err != nil {
+		return err
+	}
+	l.labelCounts = d.LabelCounts
+	l.hashMaxSize = d.HashMaxSize
+	l.pruner = d.Pruner
+	if l.labelCounts == nil {
+		l.labelCounts = make(map[Label]uint64)
+	}
+	if l.pruner != nil && l.pruner.LastUsed == nil {
+		l.pruner.LastUsed = make(map[int]uint64)
+	}
+
+	i, err := intern.Load(r)
+	if err != nil {
+		return err
+	}
+	l.intern = i
+	return nil
+}
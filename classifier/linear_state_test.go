@@ -0,0 +1,317 @@
+package classifier
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestLinearStatesSaveLoad(t *testing.T) {
+	ctx := core.NewContext(nil)
+	creators := []struct {
+		name   string
+		c      udf.UDSLoader
+		params data.Map
+	}{
+		{"perceptron", &PerceptronStateCreator{}, data.Map{}},
+		{"pa", &PassiveAggressiveStateCreator{}, data.Map{}},
+		{"pa1", &PassiveAggressive1StateCreator{}, data.Map{"regularization_weight": data.Float(0.5)}},
+		{"pa2", &PassiveAggressive2StateCreator{}, data.Map{"regularization_weight": data.Float(0.5)}},
+		{"cw", &ConfidenceWeightedStateCreator{}, data.Map{"regularization_weight": data.Float(1)}},
+		{"nherd", &NormalHerdStateCreator{}, data.Map{"regularization_weight": data.Float(0.1)}},
+	}
+
+	for _, cr := range creators {
+		cr := cr
+		Convey("Given a trained "+cr.name+" State", t, func() {
+			ss, err := cr.c.CreateState(ctx, cr.params)
+			So(err, ShouldBeNil)
+			s := ss.(*State)
+
+			for i := 0; i < 100; i++ {
+				l := "a"
+				if i%2 == 1 {
+					l = "b"
+				}
+				So(s.Write(ctx, &core.Tuple{
+					Data: data.Map{
+						"label": data.String(l),
+						"feature_vector": data.Map{
+							l:   data.Int(1),
+							"n": data.Int(i % 3),
+						},
+					},
+				}), ShouldBeNil)
+			}
+
+			Convey("it should classify a feature vector correctly.", func() {
+				sc, err := s.classifier.Classify(FeatureVector{"a": data.Int(1)})
+				So(err, ShouldBeNil)
+				l, _ := sc.Max()
+				So(l, ShouldEqual, "a")
+				sc, err = s.classifier.Classify(FeatureVector{"b": data.Int(1)})
+				So(err, ShouldBeNil)
+				l, _ = sc.Max()
+				So(l, ShouldEqual, "b")
+			})
+
+			Convey("when saving it", func() {
+				buf := bytes.NewBuffer(nil)
+				err := s.Save(ctx, buf, data.Map{})
+
+				Convey("it should succeed.", func() {
+					So(err, ShouldBeNil)
+
+					Convey("and the loaded state should be same.", func() {
+						s2, err := cr.c.LoadState(ctx, buf, data.Map{})
+						So(err, ShouldBeNil)
+						So(s2, ShouldResemble, s)
+
+						fv := FeatureVector(data.Map{"n": data.Int(2)})
+						sc, err := s.classifier.Classify(fv)
+						So(err, ShouldBeNil)
+						sc2, err := s2.(*State).classifier.Classify(fv)
+						So(err, ShouldBeNil)
+						So(sc2, ShouldResemble, sc)
+					})
+				})
+			})
+		})
+	}
+}
+
+func TestLabelManagement(t *testing.T) {
+	ctx := core.NewContext(nil)
+	c := AROWStateCreator{}
+	s, err := c.CreateState(ctx, data.Map{
+		"regularization_weight": data.Float(1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.SharedStates.Add("arow", "jubaclassifier_arow", s); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		l := "a"
+		if i%5 == 0 {
+			l = "b"
+		}
+		if err := s.(*State).Write(ctx, &core.Tuple{
+			Data: data.Map{
+				"label": data.String(l),
+				"feature_vector": data.Map{
+					l: data.Int(1),
+				},
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Convey("Given a trained AROW state", t, func() {
+		Convey("when getting labels", func() {
+			ls, err := Labels(ctx, "arow")
+
+			Convey("it should return training counts of all labels.", func() {
+				So(err, ShouldBeNil)
+				So(ls, ShouldResemble, data.Map{
+					"a": data.Int(8),
+					"b": data.Int(2),
+				})
+			})
+		})
+
+		Convey("when adding a new label", func() {
+			added, err := AddLabel(ctx, "arow", "c")
+			So(err, ShouldBeNil)
+
+			Convey("it should be registered with no training data.", func() {
+				So(added, ShouldBeTrue)
+				ls, err := Labels(ctx, "arow")
+				So(err, ShouldBeNil)
+				So(ls["c"], ShouldEqual, data.Int(0))
+
+				sc, err := Classify(ctx, "arow", data.Map{"a": data.Int(1)})
+				So(err, ShouldBeNil)
+				So(sc["c"], ShouldEqual, data.Float(0))
+			})
+
+			Convey("adding it again should return false.", func() {
+				added, err := AddLabel(ctx, "arow", "c")
+				So(err, ShouldBeNil)
+				So(added, ShouldBeFalse)
+			})
+		})
+
+		Convey("when deleting a label", func() {
+			deleted, err := DeleteLabel(ctx, "arow", "b")
+			So(err, ShouldBeNil)
+
+			Convey("it should be removed from classification results.", func() {
+				So(deleted, ShouldBeTrue)
+				sc, err := Classify(ctx, "arow", data.Map{"b": data.Int(1)})
+				So(err, ShouldBeNil)
+				_, ok := sc["b"]
+				So(ok, ShouldBeFalse)
+			})
+
+			Convey("deleting it again should return false.", func() {
+				deleted, err := DeleteLabel(ctx, "arow", "b")
+				So(err, ShouldBeNil)
+				So(deleted, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestTopWeights(t *testing.T) {
+	ctx := core.NewContext(nil)
+	creators := []struct {
+		name    string
+		c       udf.UDSLoader
+		params  data.Map
+		withCov bool
+	}{
+		{"arow", &AROWStateCreator{}, data.Map{"regularization_weight": data.Float(1)}, true},
+		{"pa", &PassiveAggressiveStateCreator{}, data.Map{}, false},
+	}
+
+	for _, c := range creators {
+		s, err := c.c.CreateState(ctx, c.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ctx.SharedStates.Add(c.name, "jubaclassifier_"+c.name, s); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			l := "spam"
+			if i%2 == 0 {
+				l = "ham"
+			}
+			if err := s.(*State).Write(ctx, &core.Tuple{
+				Data: data.Map{
+					"label": data.String(l),
+					"feature_vector": data.Map{
+						"word": data.Map{l: data.Int(2)},
+						"len":  data.Int(1),
+					},
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, c := range creators {
+		c := c
+		Convey("Given a trained "+c.name+" state", t, func() {
+			Convey("when getting top weights", func() {
+				ws, err := TopWeights(ctx, c.name, 1)
+				So(err, ShouldBeNil)
+
+				Convey("the most positive feature of each label should be its word.", func() {
+					for _, l := range []string{"spam", "ham"} {
+						m, err := ws.Get(data.MustCompilePath(l))
+						So(err, ShouldBeNil)
+						pos := m.(data.Map)["positive"].(data.Array)
+						So(len(pos), ShouldEqual, 1)
+						fw := pos[0].(data.Map)
+						So(fw["key"], ShouldEqual, data.String("word."+l))
+						_, hasCov := fw["covariance"]
+						So(hasCov, ShouldEqual, c.withCov)
+					}
+				})
+
+				Convey("the most negative feature of each label should be the other word.", func() {
+					neg := ws["spam"].(data.Map)["negative"].(data.Array)
+					So(len(neg), ShouldEqual, 1)
+					So(neg[0].(data.Map)["key"], ShouldEqual, data.String("word.ham"))
+				})
+			})
+		})
+	}
+}
+
+func TestExplain(t *testing.T) {
+	ctx := core.NewContext(nil)
+	c := AROWStateCreator{}
+	s, err := c.CreateState(ctx, data.Map{
+		"regularization_weight": data.Float(1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.SharedStates.Add("arow", "jubaclassifier_arow", s); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		l := "spam"
+		if i%2 == 0 {
+			l = "ham"
+		}
+		if err := s.(*State).Write(ctx, &core.Tuple{
+			Data: data.Map{
+				"label": data.String(l),
+				"feature_vector": data.Map{
+					"word": data.Map{l: data.Int(2)},
+				},
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Convey("Given a trained AROW state", t, func() {
+		fv := data.Map{
+			"word":    data.Map{"spam": data.Int(1)},
+			"unknown": data.Int(1),
+		}
+
+		Convey("when explaining a classification", func() {
+			e, err := Explain(ctx, "arow", fv)
+			So(err, ShouldBeNil)
+
+			Convey("it should have the classified label and its score.", func() {
+				scores, err := Classify(ctx, "arow", fv)
+				So(err, ShouldBeNil)
+				So(e["label"], ShouldEqual, data.String("spam"))
+				So(e["score"], ShouldEqual, scores["spam"])
+			})
+
+			Convey("it should have contributions sorted by their absolute values.", func() {
+				cs := e["contributions"].(data.Array)
+				So(len(cs), ShouldEqual, 2)
+				So(cs[0].(data.Map)["key"], ShouldEqual, data.String("word.spam"))
+				So(cs[0].(data.Map)["contribution"], ShouldEqual, e["score"])
+				So(cs[1].(data.Map)["key"], ShouldEqual, data.String("unknown"))
+				So(cs[1].(data.Map)["contribution"], ShouldEqual, data.Float(0))
+			})
+		})
+
+		Convey("when explaining a requested label", func() {
+			e, err := ExplainLabel(ctx, "arow", fv, "ham")
+			So(err, ShouldBeNil)
+
+			Convey("it should have a negative score.", func() {
+				So(e["label"], ShouldEqual, data.String("ham"))
+				sc, _ := data.AsFloat(e["score"])
+				So(sc, ShouldBeLessThan, 0)
+			})
+		})
+
+		Convey("when explaining a nonexistent label", func() {
+			_, err := ExplainLabel(ctx, "arow", fv, "unknown")
+
+			Convey("it should fail.", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
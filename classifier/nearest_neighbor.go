@@ -0,0 +1,256 @@
+package classifier
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/nearest"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// NearestNeighbor holds a model for classification using k-nearest
+// neighbors. It stores all labeled rows and votes among the k nearest rows.
+type NearestNeighbor struct {
+	nn      nearest.Neighbor
+	nnAlgo  NNAlgorithm
+	hashNum int
+
+	// labels[i] is the label of the row whose ID is i+1.
+	labels      []Label
+	labelCounts map[Label]int
+
+	k     int
+	alpha float32
+
+	// for random unlearner
+	maxSize int
+	rg      *rand.Rand
+
+	m sync.RWMutex
+}
+
+const (
+	// InvalidNNAlgorithm represents an invalid nearest neighbor algorithm.
+	InvalidNNAlgorithm = nearest.InvalidAlgorithm
+	// LSH represents locality sensitive hashing.
+	LSH = nearest.LSHAlgorithm
+	// Minhash represents minhash.
+	Minhash = nearest.MinhashAlgorithm
+	// EuclidLSH represents locality sensitive hashing with euclidean distance.
+	EuclidLSH = nearest.EuclidLSHAlgorithm
+)
+
+// NNAlgorithm is an enum type which represents nearest neighbor algorithms.
+type NNAlgorithm = nearest.Algorithm
+
+// NewNearestNeighbor creates a NearestNeighbor model. k is the number of
+// neighbors which vote for a label. Each neighbor votes exp(-alpha * distance)
+// to its label. maxSize is the maximum number of rows and 0 means no limit.
+// When the number of rows exceeds maxSize, a randomly selected row is
+// unlearned.
+func NewNearestNeighbor(nnAlgo NNAlgorithm, hashNum, k int, alpha float32, maxSize int, seed int64) (*NearestNeighbor, error) {
+	const maxSizeLimit = 0x7fffffff
+
+	if hashNum <= 0 {
+		return nil, errors.New("number of hash bits must be greater than zero")
+	}
+	if k <= 0 {
+		return nil, errors.New("number of nearest neighbor must be greater than zero")
+	}
+	if alpha < 0 {
+		return nil, errors.New("local sensitivity must not be less than zero")
+	}
+	if maxSize < 0 {
+		return nil, errors.New("max size must be greater than or equal to zero")
+	}
+	if maxSize > maxSizeLimit {
+		return nil, fmt.Errorf("max size must be less than or equal to %v", maxSizeLimit)
+	}
+
+	nn, err := nearest.New(nnAlgo, hashNum)
+	if err != nil {
+		return nil, err
+	}
+
+	// maxSize == 0 means no unlearn.
+	if maxSize == 0 {
+		maxSize = maxSizeLimit
+	}
+
+	return &NearestNeighbor{
+		nn:          nn,
+		nnAlgo:      nnAlgo,
+		hashNum:     hashNum,
+		labelCounts: make(map[Label]int),
+		k:           k,
+		alpha:       alpha,
+		maxSize:     maxSize,
+		rg:          rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+// Train trains a model with a feature vector and a label.
+func (n *NearestNeighbor) Train(v FeatureVector, label Label) error {
+	if label == "" {
+		return errors.New("label must not be empty")
+	}
+
+	nnfv, err := nearest.FlattenFeatureVector(data.Map(v))
+	if err != nil {
+		return err
+	}
+
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	var id nearest.ID
+	if len(n.labels) < n.maxSize {
+		n.labels = append(n.labels, label)
+		id = nearest.ID(len(n.labels))
+	} else {
+		// unlearn
+		id = nearest.ID(n.rg.Intn(n.maxSize)) + 1
+		old := n.labels[id-1]
+		if n.labelCounts[old]--; n.labelCounts[old] == 0 {
+			delete(n.labelCounts, old)
+		}
+		n.labels[id-1] = label
+	}
+	n.labelCounts[label]++
+	n.nn.SetRow(id, nnfv)
+	return nil
+}
+
+// Classify classifies a feature vector. This function returns
+// all labels and scores.
+//
+// jubatus::core::classifier::nearest_neighbor_classifier::classify_with_scores
+func (n *NearestNeighbor) Classify(v FeatureVector) (LScores, error) {
+	nnfv, err := nearest.FlattenFeatureVector(data.Map(v))
+	if err != nil {
+		return nil, err
+	}
+
+	n.m.RLock()
+	defer n.m.RUnlock()
+
+	scores := make(map[Label]float32, len(n.labelCounts))
+	for l := range n.labelCounts {
+		scores[l] = 0
+	}
+	if len(n.labels) > 0 {
+		for _, nb := range n.nn.NeighborRowFromFV(nnfv, n.k) {
+			scores[n.labels[nb.ID-1]] += float32(math.Exp(float64(-n.alpha * nb.Dist)))
+		}
+	}
+
+	ret := make(LScores, len(scores))
+	for l, s := range scores {
+		ret[string(l)] = data.Float(s)
+	}
+	return ret, nil
+}
+
+// Clear clears a model.
+func (n *NearestNeighbor) Clear() {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	// The arguments have already been validated.
+	n.nn, _ = nearest.New(n.nnAlgo, n.hashNum)
+	n.labels = nil
+	n.labelCounts = make(map[Label]int)
+}
+
+const (
+	nearestNeighborFormatVersion uint8 = 1
+)
+
+type nearestNeighborMsgpack struct {
+	_struct struct{} `codec:",toarray"`
+
+	NNAlgorithm NNAlgorithm
+	HashNum     int
+
+	Labels []Label
+
+	K       int
+	Alpha   float32
+	MaxSize int
+}
+
+// Save saves the current state of NearestNeighbor.
+func (n *NearestNeighbor) Save(w io.Writer) error {
+	n.m.RLock()
+	defer n.m.RUnlock()
+
+	if _, err := w.Write([]byte{nearestNeighborFormatVersion}); err != nil {
+		return err
+	}
+
+	enc := codec.NewEncoder(w, classifierMsgpackHandle)
+	if err := enc.Encode(&nearestNeighborMsgpack{
+		NNAlgorithm: n.nnAlgo,
+		HashNum:     n.hashNum,
+
+		Labels: n.labels,
+
+		K:       n.k,
+		Alpha:   n.alpha,
+		MaxSize: n.maxSize,
+	}); err != nil {
+		return err
+	}
+	return nearest.Save(n.nn, w)
+}
+
+// LoadNearestNeighbor loads NearestNeighbor from the saved data.
+func LoadNearestNeighbor(r io.Reader) (*NearestNeighbor, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadNearestNeighborFormatV1(r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of NearestNeighbor container: %v", formatVersion[0])
+	}
+}
+
+func loadNearestNeighborFormatV1(r io.Reader) (*NearestNeighbor, error) {
+	m := nearestNeighborMsgpack{}
+	dec := codec.NewDecoder(r, classifierMsgpackHandle)
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	nn, err := nearest.Load(r)
+	if err != nil {
+		return nil, err
+	}
+
+	labelCounts := make(map[Label]int)
+	for _, l := range m.Labels {
+		labelCounts[l]++
+	}
+
+	return &NearestNeighbor{
+		nn:      nn,
+		nnAlgo:  m.NNAlgorithm,
+		hashNum: m.HashNum,
+
+		labels:      m.Labels,
+		labelCounts: labelCounts,
+
+		k:     m.K,
+		alpha: m.Alpha,
+
+		maxSize: m.MaxSize,
+		rg:      rand.New(rand.NewSource(0)),
+	}, nil
+}
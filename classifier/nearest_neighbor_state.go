@@ -0,0 +1,87 @@
+package classifier
+
+import (
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/pluginutil"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"strings"
+)
+
+// NearestNeighborStateCreator is used by BQL to create or load a State
+// having k-nearest neighbor classification algorithm as a UDS.
+type NearestNeighborStateCreator struct {
+}
+
+var _ udf.UDSLoader = &NearestNeighborStateCreator{}
+
+// CreateState creates a new state for k-nearest neighbor classifier.
+func (c *NearestNeighborStateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	nnAlgoName, err := pluginutil.ExtractParamAsString(params, "nearest_neighbor_algorithm")
+	if err != nil {
+		return nil, err
+	}
+
+	var nnAlgo NNAlgorithm
+	switch strings.ToLower(nnAlgoName) {
+	case "lsh":
+		nnAlgo = LSH
+	case "minhash":
+		nnAlgo = Minhash
+	case "euclid_lsh":
+		nnAlgo = EuclidLSH
+	default:
+		return nil, fmt.Errorf("invalid nearest_neighbor_algorithm: %s", nnAlgoName)
+	}
+
+	hashNum, err := pluginutil.ExtractParamAsBoundedInt(params, "hash_num")
+	if err != nil {
+		return nil, err
+	}
+	nnNum, err := pluginutil.ExtractParamAsBoundedInt(params, "nearest_neighbor_num")
+	if err != nil {
+		return nil, err
+	}
+	alpha, err := pluginutil.ExtractParamAndConvertToFloat(params, "local_sensitivity")
+	if err != nil {
+		return nil, err
+	}
+
+	unlearn, err := pluginutil.ExtractParamAsStringWithDefault(params, "unlearner", "no")
+	if err != nil {
+		return nil, err
+	}
+	var maxSize int
+	var seed int64
+	switch unlearn {
+	case "no":
+		maxSize = 0
+	case "random":
+		maxSize, err = pluginutil.ExtractParamAsBoundedInt(params, "max_size")
+		if err != nil {
+			return nil, err
+		}
+
+		seed, err = pluginutil.ExtractParamAsIntWithDefault(params, "seed", 0)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid unlearner: %v", unlearn)
+	}
+
+	nn, err := NewNearestNeighbor(nnAlgo, hashNum, nnNum, float32(alpha), maxSize, seed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize nearest neighbor classifier: %v", err)
+	}
+	return newState("nearest_neighbor", nn, params)
+}
+
+// LoadState loads a new state for k-nearest neighbor classifier.
+func (c *NearestNeighborStateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	return loadState(ctx, r, "nearest_neighbor", func(r io.Reader) (Classifier, error) {
+		return LoadNearestNeighbor(r)
+	})
+}
@@ -0,0 +1,133 @@
+package classifier
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestNearestNeighborStateSaveLoad(t *testing.T) {
+	ctx := core.NewContext(nil)
+	c := NearestNeighborStateCreator{}
+	ss, err := c.CreateState(ctx, data.Map{
+		"nearest_neighbor_algorithm": data.String("lsh"),
+		"hash_num":                   data.Int(64),
+		"nearest_neighbor_num":       data.Int(5),
+		"local_sensitivity":          data.Float(1),
+		"unlearner":                  data.String("random"),
+		"max_size":                   data.Int(50),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := ss.(*State)
+
+	for i := 0; i < 100; i++ {
+		l := "a"
+		if i%2 == 1 {
+			l = "b"
+		}
+		if err := s.Write(ctx, &core.Tuple{
+			Data: data.Map{
+				"label": data.String(l),
+				"feature_vector": data.Map{
+					l:   data.Int(10),
+					"n": data.Int(i % 3),
+				},
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Convey("Given a trained NearestNeighbor State", t, func() {
+		n := s.classifier.(*NearestNeighbor)
+
+		Convey("it should not have rows more than max_size.", func() {
+			So(len(n.labels), ShouldEqual, 50)
+			cnt := 0
+			for _, c := range n.labelCounts {
+				cnt += c
+			}
+			So(cnt, ShouldEqual, 50)
+		})
+
+		Convey("it should classify a feature vector correctly.", func() {
+			scores, err := n.Classify(FeatureVector{"a": data.Int(1)})
+			So(err, ShouldBeNil)
+			l, _ := scores.Max()
+			So(l, ShouldEqual, "a")
+			So(len(scores), ShouldEqual, 2)
+		})
+
+		Convey("when saving it", func() {
+			buf := bytes.NewBuffer(nil)
+			err := s.Save(ctx, buf, data.Map{})
+
+			Convey("it should succeed.", func() {
+				So(err, ShouldBeNil)
+
+				Convey("and the loaded state should be same.", func() {
+					s2, err := c.LoadState(ctx, buf, data.Map{})
+					So(err, ShouldBeNil)
+
+					n2 := s2.(*State).classifier.(*NearestNeighbor)
+					So(n2.nn, ShouldResemble, n.nn)
+					So(n2.nnAlgo, ShouldEqual, n.nnAlgo)
+					So(n2.hashNum, ShouldEqual, n.hashNum)
+					So(n2.labels, ShouldResemble, n.labels)
+					So(n2.labelCounts, ShouldResemble, n.labelCounts)
+					So(n2.k, ShouldEqual, n.k)
+					So(n2.alpha, ShouldEqual, n.alpha)
+					So(n2.maxSize, ShouldEqual, n.maxSize)
+					So(n2.rg, ShouldNotBeNil)
+
+					fv := FeatureVector(data.Map{"n": data.Int(2)})
+					sc, err := n.Classify(fv)
+					So(err, ShouldBeNil)
+					sc2, err := n2.Classify(fv)
+					So(err, ShouldBeNil)
+					So(sc2, ShouldResemble, sc)
+				})
+			})
+		})
+	})
+}
+
+func TestNearestNeighborStateOneNeighbor(t *testing.T) {
+	ctx := core.NewContext(nil)
+	c := NearestNeighborStateCreator{}
+
+	Convey("Given NearestNeighbor States with nearest_neighbor_num = 1", t, func() {
+		for _, algo := range []string{"lsh", "minhash", "euclid_lsh"} {
+			ss, err := c.CreateState(ctx, data.Map{
+				"nearest_neighbor_algorithm": data.String(algo),
+				"hash_num":                   data.Int(64),
+				"nearest_neighbor_num":       data.Int(1),
+				"local_sensitivity":          data.Float(1),
+			})
+			So(err, ShouldBeNil)
+			s := ss.(*State)
+			for _, l := range []string{"a", "b", "c"} {
+				So(s.Write(ctx, &core.Tuple{
+					Data: data.Map{
+						"label":          data.String(l),
+						"feature_vector": data.Map{l: data.Int(1)},
+					},
+				}), ShouldBeNil)
+			}
+
+			Convey("when classifying a feature vector with "+algo, func() {
+				scores, err := s.classifier.Classify(FeatureVector{"b": data.Int(1)})
+				So(err, ShouldBeNil)
+
+				Convey("it should be classified by the nearest row.", func() {
+					l, _ := scores.Max()
+					So(l, ShouldEqual, "b")
+				})
+			})
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package classifier
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// NormalHerd holds a model for classification using Normal Herd (NHERD).
+type NormalHerd struct {
+	linearClassifier
+
+	regWeight float32
+}
+
+// NewNormalHerd creates a NormalHerd model. regWeight means sensitivity for
+// data like AROW. regWeight must be larger than zero.
+func NewNormalHerd(regWeight float32) (*NormalHerd, error) {
+	if regWeight <= 0 {
+		return nil, errors.New("regularization weight must be larger than zero")
+	}
+	nh := &NormalHerd{
+		regWeight: regWeight,
+	}
+	nh.init()
+	return nh, nil
+}
+
+// Train trains a model with a feature vector and a label.
+//
+// jubatus::core::classifier::normal_herd::train
+func (nh *NormalHerd) Train(v FeatureVector, label Label) error {
+	if label == "" {
+		return errors.New("label must not be empty")
+	}
+
+	nh.m.Lock()
+	defer nh.m.Unlock()
+
+	scores, fvFull, err := nh.prepareTrain(v, label)
+	if err != nil {
+		return err
+	}
+	incorr, _ := scores.maxExcept(label)
+	margin := -scores.margin(label, incorr)
+	if margin >= 1 {
+		return nil
+	}
+	variance := variance(fvFull, nh.model[label], nh.model[incorr])
+
+	C := nh.regWeight
+	stepWidth := (1 - margin) / (variance + 1/C)
+	nh.updateWithConfidence(fvFull, stepWidth, func(x float32) float32 {
+		return (2*C + C*C*variance) * x * x
+	}, label, incorr)
+	return nil
+}
+
+const (
+	nherdFormatVersion uint8 = 1
+)
+
+type nherdMsgpack struct {
+	_struct   struct{} `codec:",toarray"`
+	Model     model
+	RegWeight float32
+}
+
+// Save saves the current state of NormalHerd.
+func (nh *NormalHerd) Save(w io.Writer) error {
+	nh.m.RLock()
+	defer nh.m.RUnlock()
+
+	return nh.save(w, nherdFormatVersion, &nherdMsgpack{
+		Model:     nh.model,
+		RegWeight: nh.regWeight,
+	})
+}
+
+// LoadNormalHerd loads NormalHerd from the saved data.
+func LoadNormalHerd(r io.Reader) (*NormalHerd, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadNormalHerdFormatV1(r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of NormalHerd container: %v", formatVersion[0])
+	}
+}
+
+func loadNormalHerdFormatV1(r io.Reader) (*NormalHerd, error) {
+	nh := &NormalHerd{}
+	m := nherdMsgpack{}
+	if err := nh.load(r, &m); err != nil {
+		return nil, err
+	}
+	nh.model = m.Model
+	nh.regWeight = m.RegWeight
+	return nh, nil
+}
+
+// RegWeight returns regularization weight.
+func (nh *NormalHerd) RegWeight() float32 {
+	return nh.regWeight
+}
@@ -0,0 +1,37 @@
+package classifier
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+)
+
+// NormalHerdStateCreator is used by BQL to create or load a State having
+// NHERD classification algorithm as a UDS.
+type NormalHerdStateCreator struct {
+}
+
+var _ udf.UDSLoader = &NormalHerdStateCreator{}
+
+// CreateState creates a new state for NHERD classifier.
+func (c *NormalHerdStateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	rw, err := extractRegWeight(params)
+	if err != nil {
+		return nil, err
+	}
+
+	nh, err := NewNormalHerd(rw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize NHERD: %v", err)
+	}
+	return newState("nherd", nh, params)
+}
+
+// LoadState loads a new state for NHERD classifier.
+func (c *NormalHerdStateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	return loadState(ctx, r, "nherd", func(r io.Reader) (Classifier, error) {
+		return LoadNormalHerd(r)
+	})
+}
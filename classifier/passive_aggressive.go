@@ -0,0 +1,274 @@
+package classifier
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// PassiveAggressive holds a model for classification using Passive
+// Aggressive (PA).
+type PassiveAggressive struct {
+	linearClassifier
+}
+
+// NewPassiveAggressive creates a PassiveAggressive model.
+func NewPassiveAggressive() *PassiveAggressive {
+	pa := &PassiveAggressive{}
+	pa.init()
+	return pa
+}
+
+// Train trains a model with a feature vector and a label.
+//
+// jubatus::core::classifier::passive_aggressive::train
+func (pa *PassiveAggressive) Train(v FeatureVector, label Label) error {
+	return trainPassiveAggressive(&pa.linearClassifier, v, label, func(loss, sqNorm float32) float32 {
+		return loss / (2 * sqNorm)
+	})
+}
+
+var (
+	paFormatVersion uint8 = 1
+)
+
+type paMsgpack struct {
+	_struct struct{} `codec:",toarray"`
+	Model   model
+}
+
+// Save saves the current state of PassiveAggressive.
+func (pa *PassiveAggressive) Save(w io.Writer) error {
+	pa.m.RLock()
+	defer pa.m.RUnlock()
+
+	return pa.save(w, paFormatVersion, &paMsgpack{
+		Model: pa.model,
+	})
+}
+
+// LoadPassiveAggressive loads PassiveAggressive from the saved data.
+func LoadPassiveAggressive(r io.Reader) (*PassiveAggressive, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadPassiveAggressiveFormatV1(r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of PassiveAggressive container: %v", formatVersion[0])
+	}
+}
+
+func loadPassiveAggressiveFormatV1(r io.Reader) (*PassiveAggressive, error) {
+	pa := &PassiveAggressive{}
+	m := paMsgpack{}
+	if err := pa.load(r, &m); err != nil {
+		return nil, err
+	}
+	pa.model = m.Model
+	return pa, nil
+}
+
+// PassiveAggressive1 holds a model for classification using Passive
+// Aggressive I (PA1).
+type PassiveAggressive1 struct {
+	linearClassifier
+
+	regWeight float32
+}
+
+// NewPassiveAggressive1 creates a PassiveAggressive1 model. regWeight is the
+// upper bound of the step width. regWeight must be larger than zero.
+func NewPassiveAggressive1(regWeight float32) (*PassiveAggressive1, error) {
+	if regWeight <= 0 {
+		return nil, errors.New("regularization weight must be larger than zero")
+	}
+	pa := &PassiveAggressive1{
+		regWeight: regWeight,
+	}
+	pa.init()
+	return pa, nil
+}
+
+// Train trains a model with a feature vector and a label.
+//
+// jubatus::core::classifier::passive_aggressive_1::train
+func (pa *PassiveAggressive1) Train(v FeatureVector, label Label) error {
+	return trainPassiveAggressive(&pa.linearClassifier, v, label, func(loss, sqNorm float32) float32 {
+		return min32(pa.regWeight, loss/(2*sqNorm))
+	})
+}
+
+var (
+	pa1FormatVersion uint8 = 1
+)
+
+type pa1Msgpack struct {
+	_struct   struct{} `codec:",toarray"`
+	Model     model
+	RegWeight float32
+}
+
+// Save saves the current state of PassiveAggressive1.
+func (pa *PassiveAggressive1) Save(w io.Writer) error {
+	pa.m.RLock()
+	defer pa.m.RUnlock()
+
+	return pa.save(w, pa1FormatVersion, &pa1Msgpack{
+		Model:     pa.model,
+		RegWeight: pa.regWeight,
+	})
+}
+
+// LoadPassiveAggressive1 loads PassiveAggressive1 from the saved data.
+func LoadPassiveAggressive1(r io.Reader) (*PassiveAggressive1, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadPassiveAggressive1FormatV1(r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of PassiveAggressive1 container: %v", formatVersion[0])
+	}
+}
+
+func loadPassiveAggressive1FormatV1(r io.Reader) (*PassiveAggressive1, error) {
+	pa := &PassiveAggressive1{}
+	m := pa1Msgpack{}
+	if err := pa.load(r, &m); err != nil {
+		return nil, err
+	}
+	pa.model = m.Model
+	pa.regWeight = m.RegWeight
+	return pa, nil
+}
+
+// RegWeight returns regularization weight.
+func (pa *PassiveAggressive1) RegWeight() float32 {
+	return pa.regWeight
+}
+
+// PassiveAggressive2 holds a model for classification using Passive
+// Aggressive II (PA2).
+type PassiveAggressive2 struct {
+	linearClassifier
+
+	regWeight float32
+}
+
+// NewPassiveAggressive2 creates a PassiveAggressive2 model. regWeight is
+// sensitivity for data like AROW. regWeight must be larger than zero.
+func NewPassiveAggressive2(regWeight float32) (*PassiveAggressive2, error) {
+	if regWeight <= 0 {
+		return nil, errors.New("regularization weight must be larger than zero")
+	}
+	pa := &PassiveAggressive2{
+		regWeight: regWeight,
+	}
+	pa.init()
+	return pa, nil
+}
+
+// Train trains a model with a feature vector and a label.
+//
+// jubatus::core::classifier::passive_aggressive_2::train
+func (pa *PassiveAggressive2) Train(v FeatureVector, label Label) error {
+	return trainPassiveAggressive(&pa.linearClassifier, v, label, func(loss, sqNorm float32) float32 {
+		return loss / (2*sqNorm + 1/(2*pa.regWeight))
+	})
+}
+
+var (
+	pa2FormatVersion uint8 = 1
+)
+
+type pa2Msgpack struct {
+	_struct   struct{} `codec:",toarray"`
+	Model     model
+	RegWeight float32
+}
+
+// Save saves the current state of PassiveAggressive2.
+func (pa *PassiveAggressive2) Save(w io.Writer) error {
+	pa.m.RLock()
+	defer pa.m.RUnlock()
+
+	return pa.save(w, pa2FormatVersion, &pa2Msgpack{
+		Model:     pa.model,
+		RegWeight: pa.regWeight,
+	})
+}
+
+// LoadPassiveAggressive2 loads PassiveAggressive2 from the saved data.
+func LoadPassiveAggressive2(r io.Reader) (*PassiveAggressive2, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadPassiveAggressive2FormatV1(r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of PassiveAggressive2 container: %v", formatVersion[0])
+	}
+}
+
+func loadPassiveAggressive2FormatV1(r io.Reader) (*PassiveAggressive2, error) {
+	pa := &PassiveAggressive2{}
+	m := pa2Msgpack{}
+	if err := pa.load(r, &m); err != nil {
+		return nil, err
+	}
+	pa.model = m.Model
+	pa.regWeight = m.RegWeight
+	return pa, nil
+}
+
+// RegWeight returns regularization weight.
+func (pa *PassiveAggressive2) RegWeight() float32 {
+	return pa.regWeight
+}
+
+// trainPassiveAggressive trains l with the common procedure of PA, PA1, and
+// PA2. stepWidth calculates the step width from the hinge loss and the
+// squared norm of the feature vector, which is the only difference of the
+// algorithms.
+func trainPassiveAggressive(l *linearClassifier, v FeatureVector, label Label, stepWidth func(loss, sqNorm float32) float32) error {
+	if label == "" {
+		return errors.New("label must not be empty")
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	scores, fvFull, err := l.prepareTrain(v, label)
+	if err != nil {
+		return err
+	}
+	incorr, _ := scores.maxExcept(label)
+	loss := 1 + scores.margin(label, incorr)
+	if loss < 0 {
+		return nil
+	}
+
+	sqNorm := fvFull.squaredNorm()
+	if sqNorm == 0 {
+		return nil
+	}
+	l.update(fvFull, stepWidth(loss, sqNorm), label, incorr)
+	return nil
+}
+
+func min32(x, y float32) float32 {
+	if x < y {
+		return x
+	}
+	return y
+}
@@ -0,0 +1,84 @@
+package classifier
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+)
+
+// PassiveAggressiveStateCreator is used by BQL to create or load a State
+// having PA classification algorithm as a UDS.
+type PassiveAggressiveStateCreator struct {
+}
+
+var _ udf.UDSLoader = &PassiveAggressiveStateCreator{}
+
+// CreateState creates a new state for PA classifier.
+func (c *PassiveAggressiveStateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	return newState("pa", NewPassiveAggressive(), params)
+}
+
+// LoadState loads a new state for PA classifier.
+func (c *PassiveAggressiveStateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	return loadState(ctx, r, "pa", func(r io.Reader) (Classifier, error) {
+		return LoadPassiveAggressive(r)
+	})
+}
+
+// PassiveAggressive1StateCreator is used by BQL to create or load a State
+// having PA1 classification algorithm as a UDS.
+type PassiveAggressive1StateCreator struct {
+}
+
+var _ udf.UDSLoader = &PassiveAggressive1StateCreator{}
+
+// CreateState creates a new state for PA1 classifier.
+func (c *PassiveAggressive1StateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	rw, err := extractRegWeight(params)
+	if err != nil {
+		return nil, err
+	}
+
+	pa, err := NewPassiveAggressive1(rw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize PA1: %v", err)
+	}
+	return newState("pa1", pa, params)
+}
+
+// LoadState loads a new state for PA1 classifier.
+func (c *PassiveAggressive1StateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	return loadState(ctx, r, "pa1", func(r io.Reader) (Classifier, error) {
+		return LoadPassiveAggressive1(r)
+	})
+}
+
+// PassiveAggressive2StateCreator is used by BQL to create or load a State
+// having PA2 classification algorithm as a UDS.
+type PassiveAggressive2StateCreator struct {
+}
+
+var _ udf.UDSLoader = &PassiveAggressive2StateCreator{}
+
+// CreateState creates a new state for PA2 classifier.
+func (c *PassiveAggressive2StateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	rw, err := extractRegWeight(params)
+	if err != nil {
+		return nil, err
+	}
+
+	pa, err := NewPassiveAggressive2(rw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize PA2: %v", err)
+	}
+	return newState("pa2", pa, params)
+}
+
+// LoadState loads a new state for PA2 classifier.
+func (c *PassiveAggressive2StateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	return loadState(ctx, r, "pa2", func(r io.Reader) (Classifier, error) {
+		return LoadPassiveAggressive2(r)
+	})
+}
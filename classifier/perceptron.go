@@ -0,0 +1,87 @@
+package classifier
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Perceptron holds a model for classification using the perceptron
+// algorithm.
+type Perceptron struct {
+	linearClassifier
+}
+
+// NewPerceptron creates a Perceptron model.
+func NewPerceptron() *Perceptron {
+	p := &Perceptron{}
+	p.init()
+	return p
+}
+
+// Train trains a model with a feature vector and a label.
+//
+// jubatus::core::classifier::perceptron::train
+func (p *Perceptron) Train(v FeatureVector, label Label) error {
+	if label == "" {
+		return errors.New("label must not be empty")
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	scores, fvFull, err := p.prepareTrain(v, label)
+	if err != nil {
+		return err
+	}
+	predicted, _ := scores.Max()
+	if predicted == label {
+		return nil
+	}
+	p.update(fvFull, 1, label, predicted)
+	return nil
+}
+
+var (
+	perceptronFormatVersion uint8 = 1
+)
+
+type perceptronMsgpack struct {
+	_struct struct{} `codec:",toarray"`
+	Model   model
+}
+
+// Save saves the current state of Perceptron.
+func (p *Perceptron) Save(w io.Writer) error {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	return p.save(w, perceptronFormatVersion, &perceptronMsgpack{
+		Model: p.model,
+	})
+}
+
+// LoadPerceptron loads Perceptron from the saved data.
+func LoadPerceptron(r io.Reader) (*Perceptron, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadPerceptronFormatV1(r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of Perceptron container: %v", formatVersion[0])
+	}
+}
+
+func loadPerceptronFormatV1(r io.Reader) (*Perceptron, error) {
+	p := &Perceptron{}
+	m := perceptronMsgpack{}
+	if err := p.load(r, &m); err != nil {
+		return nil, err
+	}
+	p.model = m.Model
+	return p, nil
+}
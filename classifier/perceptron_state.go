@@ -0,0 +1,27 @@
+package classifier
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+)
+
+// PerceptronStateCreator is used by BQL to create or load a State having
+// Perceptron classification algorithm as a UDS.
+type PerceptronStateCreator struct {
+}
+
+var _ udf.UDSLoader = &PerceptronStateCreator{}
+
+// CreateState creates a new state for Perceptron classifier.
+func (c *PerceptronStateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	return newState("perceptron", NewPerceptron(), params)
+}
+
+// LoadState loads a new state for Perceptron classifier.
+func (c *PerceptronStateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	return loadState(ctx, r, "perceptron", func(r io.Reader) (Classifier, error) {
+		return LoadPerceptron(r)
+	})
+}
@@ -8,16 +8,27 @@ import (
 
 func init() {
 	udf.MustRegisterGlobalUDSCreator("jubaclassifier_arow", &classifier.AROWStateCreator{})
+	udf.MustRegisterGlobalUDSCreator("jubaclassifier_perceptron", &classifier.PerceptronStateCreator{})
+	udf.MustRegisterGlobalUDSCreator("jubaclassifier_pa", &classifier.PassiveAggressiveStateCreator{})
+	udf.MustRegisterGlobalUDSCreator("jubaclassifier_pa1", &classifier.PassiveAggressive1StateCreator{})
+	udf.MustRegisterGlobalUDSCreator("jubaclassifier_pa2", &classifier.PassiveAggressive2StateCreator{})
+	udf.MustRegisterGlobalUDSCreator("jubaclassifier_cw", &classifier.ConfidenceWeightedStateCreator{})
+	udf.MustRegisterGlobalUDSCreator("jubaclassifier_nherd", &classifier.NormalHerdStateCreator{})
+	udf.MustRegisterGlobalUDSCreator("jubaclassifier_nearest_neighbor", &classifier.NearestNeighborStateCreator{})
 
-	// The name jubaclassify is not only for AROW, but for all classifier algorithms.
-	// We have implemented only AROW, so we use the name for arowClassify for now.
-	// When we have to implement another classification algorithm, generalize jubaclassify
-	// to other algorithms. For example, define classifier.Classifier and adjust all algorithms to it.
-	udf.MustRegisterGlobalUDF("jubaclassify", udf.MustConvertGeneric(classifier.AROWClassify))
+	udf.MustRegisterGlobalUDF("jubaclassify", udf.MustConvertGeneric(classifier.Classify))
+	udf.MustRegisterGlobalUDF("jubaclassify_explain", udf.MustConvertGeneric(classifier.Explain))
+	udf.MustRegisterGlobalUDF("jubaclassify_explain_label", udf.MustConvertGeneric(classifier.ExplainLabel))
+	udf.MustRegisterGlobalUDF("jubaclassify_probabilities", udf.MustConvertGeneric(classifier.Probabilities))
+	udf.MustRegisterGlobalUDF("jubaclassifier_add_label", udf.MustConvertGeneric(classifier.AddLabel))
+	udf.MustRegisterGlobalUDF("jubaclassifier_delete_label", udf.MustConvertGeneric(classifier.DeleteLabel))
+	udf.MustRegisterGlobalUDF("jubaclassifier_labels", udf.MustConvertGeneric(classifier.Labels))
+	udf.MustRegisterGlobalUDF("jubaclassifier_top_weights", udf.MustConvertGeneric(classifier.TopWeights))
 
 	// TODO: consider to rename
 	udf.MustRegisterGlobalUDF("juba_classified_label", udf.MustConvertGeneric(classifier.ClassifiedLabel))
 
 	udf.MustRegisterGlobalUDF("juba_classified_score", udf.MustConvertGeneric(classifier.ClassifiedScore))
+	udf.MustRegisterGlobalUDF("juba_classified_labels", udf.MustConvertGeneric(classifier.ClassifiedLabels))
 	udf.MustRegisterGlobalUDF("juba_softmax", udf.MustConvertGeneric(math.Softmax))
 }
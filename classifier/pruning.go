@@ -0,0 +1,61 @@
+package classifier
+
+import (
+	"github.com/sensorbee/jubatus/internal/pruning"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// PruningPolicy specifies how dimensions are dropped from a linear model.
+// MaxDims is the maximum number of dimensions each label can have.
+type PruningPolicy = pruning.Policy
+
+// ParsePruningPolicy parses a pruning policy:
+//
+//	{
+//	  "weight_threshold": 0.001,
+//	  "max_idle": 100000,
+//	  "max_dims_per_label": 50000,
+//	  "interval": 1000
+//	}
+//
+// All keys are optional. interval is 1000 by default.
+func ParsePruningPolicy(m data.Map) (*PruningPolicy, error) {
+	return pruning.ParsePolicy(m, "max_dims_per_label")
+}
+
+// prunable returns weights of all labels to be pruned.
+func (m model) prunable() []pruning.Weights {
+	ret := make([]pruning.Weights, 0, len(m))
+	for _, ws := range m {
+		ret = append(ret, ws)
+	}
+	return ret
+}
+
+// EachWeight is provided as a part of pruning.Weights.
+func (ws weights) EachWeight(f func(d int, w float32)) {
+	for d, w := range ws {
+		f(int(d), w.Weight)
+	}
+}
+
+// Drop is provided as a part of pruning.Weights.
+func (ws weights) Drop(d int) {
+	delete(ws, dim(d))
+}
+
+// dims returns dimensions of v.
+func (v fVector) dims() []int {
+	ret := make([]int, len(v))
+	for i, e := range v {
+		ret[i] = int(e.dim)
+	}
+	return ret
+}
+
+func abs(x float32) float32 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,764 @@
+package classifier
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/fvconverter"
+	"github.com/sensorbee/jubatus/internal/nested"
+	"github.com/sensorbee/jubatus/internal/pluginutil"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// classfierMsgpack has information of the saved file.
+type classifierMsgpack struct {
+	_struct   struct{} `codec:",toarray"`
+	Algorithm string
+}
+
+// State is a state which supports any classification algorithm implementing
+// Classifier. All classifier UDSs create this state so that UDFs such as
+// jubaclassify work regardless of the algorithm.
+type State struct {
+	classifier         Classifier
+	algorithm          string
+	labelField         string
+	featureVectorField string
+
+	// multiLabel is true when the label field can have an array of labels.
+	multiLabel bool
+
+	// converter converts feature vectors before they're passed to the
+	// classifier. It's nil when feature vectors are used as they are.
+	converter *fvconverter.Converter
+
+	// calibrator converts scores into calibrated probabilities. It's nil
+	// when calibration is disabled.
+	calibrator *plattCalibrator
+}
+
+var _ core.SavableSharedState = &State{}
+
+type stateMsgpack struct {
+	_struct            struct{} `codec:",toarray"`
+	LabelField         string
+	FeatureVectorField string
+}
+
+type stateMsgpackV2 struct {
+	_struct            struct{} `codec:",toarray"`
+	LabelField         string
+	FeatureVectorField string
+	MultiLabel         bool
+
+	// Calibrator is nil when calibration is disabled.
+	Calibrator *plattCalibrator
+}
+
+// newState creates a new State having c. It extracts common parameters from
+// params.
+func newState(algorithm string, c Classifier, params data.Map) (core.SharedState, error) {
+	label, err := pluginutil.ExtractParamAsStringWithDefault(params, "label_field", "label")
+	if err != nil {
+		return nil, err
+	}
+	fv, err := pluginutil.ExtractParamAsStringWithDefault(params, "feature_vector_field", "feature_vector")
+	if err != nil {
+		return nil, err
+	}
+	multi, err := pluginutil.ExtractParamAsBoolWithDefault(params, "multi_label", false)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := c.(MultiLabelClassifier); multi && !ok {
+		return nil, fmt.Errorf("%v classifier doesn't support multi_label", algorithm)
+	}
+	conv, err := fvconverter.ExtractParams(params)
+	if err != nil {
+		return nil, err
+	}
+	hashMaxSize, err := pluginutil.ExtractParamAsBoundedIntWithDefault(params, "hash_max_size", 0)
+	if err != nil {
+		return nil, err
+	}
+	if hashMaxSize != 0 {
+		h, ok := c.(FeatureHasher)
+		if !ok {
+			return nil, fmt.Errorf("%v classifier doesn't support hash_max_size", algorithm)
+		}
+		if hashMaxSize < 0 {
+			return nil, errors.New("hash_max_size parameter must not be less than zero")
+		}
+		if err := h.SetHashMaxSize(hashMaxSize); err != nil {
+			return nil, err
+		}
+	}
+	calibrator, err := extractCalibrator(params)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := params["pruning"]; ok {
+		p, ok := c.(Pruner)
+		if !ok {
+			return nil, fmt.Errorf("%v classifier doesn't support pruning", algorithm)
+		}
+		m, err := data.AsMap(v)
+		if err != nil {
+			return nil, fmt.Errorf("pruning parameter is not a map: %v", err)
+		}
+		policy, err := ParsePruningPolicy(m)
+		if err != nil {
+			return nil, fmt.Errorf("pruning parameter is invalid: %v", err)
+		}
+		if err := p.SetPruningPolicy(policy); err != nil {
+			return nil, err
+		}
+	}
+
+	return &State{
+		classifier:         c,
+		algorithm:          algorithm,
+		labelField:         label,
+		featureVectorField: fv,
+		multiLabel:         multi,
+		converter:          conv,
+		calibrator:         calibrator,
+	}, nil
+}
+
+// extractCalibrator extracts calibration parameters. "calibration" is "none"
+// or "platt" and "calibration_learning_rate" is the learning rate of Platt
+// scaling. It returns nil when calibration is disabled.
+func extractCalibrator(params data.Map) (*plattCalibrator, error) {
+	method, err := pluginutil.ExtractParamAsStringWithDefault(params, "calibration", "none")
+	if err != nil {
+		return nil, err
+	}
+	switch method {
+	case "none":
+		return nil, nil
+	case "platt":
+	default:
+		return nil, fmt.Errorf("invalid calibration: %v", method)
+	}
+
+	lr, err := pluginutil.ExtractParamAndConvertToFloatWithDefault(params, "calibration_learning_rate", defaultCalibrationLearningRate)
+	if err != nil {
+		return nil, err
+	}
+	if lr <= 0 {
+		return nil, errors.New("calibration_learning_rate parameter must be greater than zero")
+	}
+	return newPlattCalibrator(lr), nil
+}
+
+// extractRegWeight extracts regularization_weight parameter which is common to
+// many algorithms.
+func extractRegWeight(params data.Map) (float32, error) {
+	rw, err := pluginutil.ExtractParamAndConvertToFloat(params, "regularization_weight")
+	if err != nil {
+		return 0, err
+	}
+	if rw <= 0 {
+		return 0, errors.New("regularization_weight parameter must be greater than zero")
+	}
+	return float32(rw), nil
+}
+
+var (
+	classifierMsgpackHandle = &codec.MsgpackHandle{
+		RawToString: true,
+	}
+)
+
+func init() {
+	classifierMsgpackHandle.MapType = reflect.TypeOf(map[string]interface{}{})
+}
+
+// classifierLoader loads a Classifier saved by Classifier.Save.
+type classifierLoader func(r io.Reader) (Classifier, error)
+
+// loadState loads a State having the given algorithm.
+func loadState(ctx *core.Context, r io.Reader, algorithm string, load classifierLoader) (core.SharedState, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadStateFormatV1(ctx, r, algorithm, load)
+	case 2:
+		return loadStateFormatV2(ctx, r, algorithm, load)
+	default:
+		return nil, fmt.Errorf("unsupported format version of classifier State container: %v", formatVersion[0])
+	}
+}
+
+func loadStateFormatV1(ctx *core.Context, r io.Reader, algorithm string, load classifierLoader) (core.SharedState, error) {
+	var header classifierMsgpack
+	dec := codec.NewDecoder(r, classifierMsgpackHandle)
+	if err := dec.Decode(&header); err != nil {
+		return nil, err
+	}
+	if header.Algorithm != algorithm {
+		return nil, fmt.Errorf("unsupported classification algorithm: %v", header.Algorithm)
+	}
+
+	s := &State{
+		algorithm: algorithm,
+	}
+
+	var d stateMsgpack
+	if err := dec.Decode(&d); err != nil {
+		return nil, err
+	}
+	s.labelField = d.LabelField
+	s.featureVectorField = d.FeatureVectorField
+
+	c, err := load(r)
+	if err != nil {
+		return nil, err
+	}
+	s.classifier = c
+	return s, nil
+}
+
+func loadStateFormatV2(ctx *core.Context, r io.Reader, algorithm string, load classifierLoader) (core.SharedState, error) {
+	var header classifierMsgpack
+	dec := codec.NewDecoder(r, classifierMsgpackHandle)
+	if err := dec.Decode(&header); err != nil {
+		return nil, err
+	}
+	if header.Algorithm != algorithm {
+		return nil, fmt.Errorf("unsupported classification algorithm: %v", header.Algorithm)
+	}
+
+	// This is the current format and no data type conversion is required.
+	s := &State{
+		algorithm: algorithm,
+	}
+
+	var d stateMsgpackV2
+	if err := dec.Decode(&d); err != nil {
+		return nil, err
+	}
+	s.labelField = d.LabelField
+	s.featureVectorField = d.FeatureVectorField
+	s.multiLabel = d.MultiLabel
+	s.calibrator = d.Calibrator
+	if s.calibrator != nil && s.calibrator.Params == nil {
+		s.calibrator.Params = make(map[Label]*plattParams)
+	}
+
+	conv, err := fvconverter.Load(r)
+	if err != nil {
+		return nil, err
+	}
+	s.converter = conv
+
+	c, err := load(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := c.(MultiLabelClassifier); s.multiLabel && !ok {
+		return nil, fmt.Errorf("%v classifier doesn't support multi_label", algorithm)
+	}
+	s.classifier = c
+	return s, nil
+}
+
+// Terminate terminates the state.
+func (*State) Terminate(ctx *core.Context) error {
+	return nil
+}
+
+// Write trains the machine learning model the state has with a given tuple.
+func (s *State) Write(ctx *core.Context, t *core.Tuple) error {
+	vlabel, ok := t.Data[s.labelField]
+	if !ok {
+		return fmt.Errorf("%s field is missing", s.labelField)
+	}
+
+	vfv, ok := t.Data[s.featureVectorField]
+	if !ok {
+		return fmt.Errorf("%s field is missing", s.featureVectorField)
+	}
+	fv, err := data.AsMap(vfv)
+	if err != nil {
+		return fmt.Errorf("%s value is not a map: %v", s.featureVectorField, err)
+	}
+	fv, doc, err := s.converter.ConvertForUpdate(fv)
+	if err != nil {
+		return err
+	}
+
+	if s.multiLabel {
+		labels, err := toLabels(vlabel)
+		if err != nil {
+			return fmt.Errorf("%s value is not a string or an array of strings: %v", s.labelField, err)
+		}
+		scores, err := s.scoresForCalibration(fv)
+		if err != nil {
+			return err
+		}
+		// newState and loadState guarantee that the classifier supports multi-label.
+		if err := s.classifier.(MultiLabelClassifier).TrainMultiLabel(FeatureVector(fv), labels); err != nil {
+			return err
+		}
+		s.converter.Update(doc)
+		s.calibrate(scores, labels)
+		return nil
+	}
+
+	label, err := data.AsString(vlabel)
+	if err != nil {
+		return fmt.Errorf("%s value is not a string: %v", s.labelField, err)
+	}
+	scores, err := s.scoresForCalibration(fv)
+	if err != nil {
+		return err
+	}
+	if err := s.classifier.Train(FeatureVector(fv), Label(label)); err != nil {
+		return err
+	}
+	s.converter.Update(doc)
+	s.calibrate(scores, []Label{Label(label)})
+	return nil
+}
+
+// scoresForCalibration computes scores of fv to train the calibrator. They
+// must be computed before the classifier is trained with fv. fv must already
+// be converted. It returns nil when calibration is disabled.
+func (s *State) scoresForCalibration(fv data.Map) (LScores, error) {
+	if s.calibrator == nil {
+		return nil, nil
+	}
+	return s.classifier.Classify(FeatureVector(fv))
+}
+
+// calibrate trains the calibrator with scores computed by
+// scoresForCalibration. It must only be called after the classifier is
+// successfully trained so that invalid labels aren't added to the
+// calibrator.
+func (s *State) calibrate(scores LScores, labels []Label) {
+	if s.calibrator == nil {
+		return
+	}
+	s.calibrator.update(scores, labels)
+}
+
+// toLabels converts a string or an array of strings to labels.
+func toLabels(v data.Value) ([]Label, error) {
+	if v.Type() == data.TypeString {
+		l, _ := data.AsString(v)
+		return []Label{Label(l)}, nil
+	}
+
+	a, err := data.AsArray(v)
+	if err != nil {
+		return nil, err
+	}
+	labels := make([]Label, len(a))
+	for i, e := range a {
+		l, err := data.AsString(e)
+		if err != nil {
+			return nil, err
+		}
+		labels[i] = Label(l)
+	}
+	return labels, nil
+}
+
+const (
+	classifierFormatVersion uint8 = 2
+)
+
+// Save is provided as a part of core.SavableSharedState.
+func (s *State) Save(ctx *core.Context, w io.Writer, params data.Map) error {
+	if _, err := w.Write([]byte{classifierFormatVersion}); err != nil {
+		return err
+	}
+
+	// This is the format version of the root container and doesn't related to
+	// how each algorithm is saved.
+	enc := codec.NewEncoder(w, classifierMsgpackHandle)
+	if err := enc.Encode(&classifierMsgpack{
+		Algorithm: s.algorithm,
+	}); err != nil {
+		return err
+	}
+
+	if s.calibrator != nil {
+		s.calibrator.m.RLock()
+		defer s.calibrator.m.RUnlock()
+	}
+	if err := enc.Encode(&stateMsgpackV2{
+		LabelField:         s.labelField,
+		FeatureVectorField: s.featureVectorField,
+		MultiLabel:         s.multiLabel,
+		Calibrator:         s.calibrator,
+	}); err != nil {
+		return err
+	}
+	if err := s.converter.Save(w); err != nil {
+		return err
+	}
+	return s.classifier.Save(w)
+}
+
+// Classify classifies the input using the given model having stateName.
+func Classify(ctx *core.Context, stateName string, featureVector data.Map) (data.Map, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	fv, err := s.converter.Convert(featureVector)
+	if err != nil {
+		return nil, err
+	}
+	scores, err := s.classifier.Classify(FeatureVector(fv))
+	return data.Map(scores), err
+}
+
+// Explain classifies the input using the given model having stateName and
+// returns contributions of its features to the score of the classified label:
+//
+//	{
+//	  "label": "spam",
+//	  "score": 1.5,
+//	  "contributions": [
+//	    {"key": "word.free", "value": 1, "weight": 1.2, "contribution": 1.2},
+//	    ...
+//	  ]
+//	}
+//
+// Keys are converted by the converter of the state and contributions are
+// sorted in the descending order of their absolute values.
+func Explain(ctx *core.Context, stateName string, featureVector data.Map) (data.Map, error) {
+	s, e, fv, err := lookupExplainer(ctx, stateName, featureVector)
+	if err != nil {
+		return nil, err
+	}
+	scores, err := s.classifier.Classify(FeatureVector(fv))
+	if err != nil {
+		return nil, err
+	}
+	if len(scores) == 0 {
+		return nil, fmt.Errorf("the model of state '%v' doesn't have any label", stateName)
+	}
+	label, _ := scores.Max()
+	return explain(e, fv, label)
+}
+
+// ExplainLabel returns contributions of features of the input to the score of
+// the given label in the same format as Explain.
+func ExplainLabel(ctx *core.Context, stateName string, featureVector data.Map, label string) (data.Map, error) {
+	_, e, fv, err := lookupExplainer(ctx, stateName, featureVector)
+	if err != nil {
+		return nil, err
+	}
+	return explain(e, fv, Label(label))
+}
+
+// lookupExplainer looks up a state supporting explanation and converts
+// featureVector with its converter.
+func lookupExplainer(ctx *core.Context, stateName string, featureVector data.Map) (*State, Explainer, data.Map, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	e, ok := s.classifier.(Explainer)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("%v classifier of state '%v' doesn't support explanation", s.algorithm, stateName)
+	}
+	fv, err := s.converter.Convert(featureVector)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return s, e, fv, nil
+}
+
+func explain(e Explainer, fv data.Map, label Label) (data.Map, error) {
+	cs, err := e.Explain(FeatureVector(fv), label)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byContribution(cs))
+
+	var score float32
+	a := make(data.Array, len(cs))
+	for i, c := range cs {
+		score += c.Value * c.Weight
+		a[i] = data.Map{
+			"key":          data.String(nested.ReadableKey(c.Key)),
+			"value":        data.Float(c.Value),
+			"weight":       data.Float(c.Weight),
+			"contribution": data.Float(c.Value * c.Weight),
+		}
+	}
+	return data.Map{
+		"label":         data.String(label),
+		"score":         data.Float(score),
+		"contributions": a,
+	}, nil
+}
+
+// Probabilities classifies the input using the given model having stateName
+// and returns probabilities of labels calibrated by Platt scaling. The
+// probabilities sum up to 1 unless the state is multi-label. The state must
+// be created with calibration enabled.
+func Probabilities(ctx *core.Context, stateName string, featureVector data.Map) (data.Map, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	if s.calibrator == nil {
+		return nil, fmt.Errorf("state '%v' doesn't have calibration enabled", stateName)
+	}
+
+	fv, err := s.converter.Convert(featureVector)
+	if err != nil {
+		return nil, err
+	}
+	scores, err := s.classifier.Classify(FeatureVector(fv))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := data.Map{}
+	for l, p := range s.calibrator.probabilities(scores, !s.multiLabel) {
+		ret[string(l)] = data.Float(p)
+	}
+	return ret, nil
+}
+
+// AddLabel registers a label to the model having stateName. It returns false
+// when the label has already been registered.
+func AddLabel(ctx *core.Context, stateName string, label string) (bool, error) {
+	lm, err := lookupLabelManager(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	return lm.AddLabel(Label(label))
+}
+
+// DeleteLabel deletes a label from the model having stateName. Calibration
+// parameters of the label are also deleted. It returns false when the label
+// doesn't exist.
+func DeleteLabel(ctx *core.Context, stateName string, label string) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	lm, err := s.labelManager(stateName)
+	if err != nil {
+		return false, err
+	}
+
+	deleted := lm.DeleteLabel(Label(label))
+	if s.calibrator != nil {
+		s.calibrator.deleteLabel(Label(label))
+	}
+	return deleted, nil
+}
+
+// Labels returns a map from all labels of the model having stateName to the
+// number of training data of each label.
+func Labels(ctx *core.Context, stateName string) (data.Map, error) {
+	lm, err := lookupLabelManager(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := lm.Labels()
+	ret := make(data.Map, len(labels))
+	for l, c := range labels {
+		ret[string(l)] = data.Int(c)
+	}
+	return ret, nil
+}
+
+// TopWeights returns at most n features having the largest positive weights
+// and n features having the largest negative weights of each label of the
+// model having stateName:
+//
+//	{
+//	  "label": {
+//	    "positive": [{"key": "a.b", "weight": 1.5, "covariance": 0.2}, ...],
+//	    "negative": [...]
+//	  },
+//	  ...
+//	}
+//
+// covariance is only included when the algorithm tracks it.
+func TopWeights(ctx *core.Context, stateName string, n int) (data.Map, error) {
+	if n < 0 {
+		return nil, errors.New("the number of features must not be less than zero")
+	}
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	wi, ok := s.classifier.(WeightInspector)
+	if !ok {
+		return nil, fmt.Errorf("%v classifier of state '%v' doesn't support weight inspection", s.algorithm, stateName)
+	}
+
+	ret := data.Map{}
+	for l, tw := range wi.TopWeights(n) {
+		ret[string(l)] = data.Map{
+			"positive": featureWeightsToArray(tw.Positive, tw.HasCovariance),
+			"negative": featureWeightsToArray(tw.Negative, tw.HasCovariance),
+		}
+	}
+	return ret, nil
+}
+
+func featureWeightsToArray(fws []FeatureWeight, withCov bool) data.Array {
+	ret := make(data.Array, len(fws))
+	for i, fw := range fws {
+		m := data.Map{
+			"key":    data.String(fw.Key),
+			"weight": data.Float(fw.Weight),
+		}
+		if withCov {
+			m["covariance"] = data.Float(fw.Covariance)
+		}
+		ret[i] = m
+	}
+	return ret
+}
+
+func lookupLabelManager(ctx *core.Context, stateName string) (LabelManager, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return s.labelManager(stateName)
+}
+
+func (s *State) labelManager(stateName string) (LabelManager, error) {
+	if lm, ok := s.classifier.(LabelManager); ok {
+		return lm, nil
+	}
+	return nil, fmt.Errorf("%v classifier of state '%v' doesn't support label management", s.algorithm, stateName)
+}
+
+func lookupState(ctx *core.Context, stateName string) (*State, error) {
+	st, err := ctx.SharedStates.Get(stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := st.(*State); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("state '%v' isn't a classifier state", stateName)
+}
+
+// ClassifiedLabel returns the label having the highest score in a
+// classification result.
+func ClassifiedLabel(scores data.Map) (string, error) {
+	if len(scores) == 0 {
+		return "", errors.New("attempt to get a label from an empty map")
+	}
+
+	// LScores.Max() cannot be used here because scores is passed by a user.
+	// LScores.Max() expects all values are float.
+	l, _, err := maxLabelScore(scores)
+	if err != nil {
+		return "", err
+	}
+	return l, nil
+}
+
+// ClassifiedScore returns the highest score in a classification result.
+func ClassifiedScore(scores data.Map) (float64, error) {
+	if len(scores) == 0 {
+		return 0, errors.New("attempt to get a score from an empty map")
+	}
+
+	_, s, err := maxLabelScore(scores)
+	if err != nil {
+		return 0, err
+	}
+	return s, nil
+}
+
+// ClassifiedLabels returns labels whose scores are greater than threshold in
+// a classification result. Labels are sorted in descending order of their
+// scores. This function is mainly for multi-label classification.
+func ClassifiedLabels(scores data.Map, threshold float64) (data.Array, error) {
+	ls := make(labelScores, 0, len(scores))
+	for l, s := range scores {
+		sc, err := data.AsFloat(s)
+		if err != nil {
+			return nil, fmt.Errorf("score for %s is not a float: %v", l, err)
+		}
+		if sc > threshold {
+			ls = append(ls, labelScore{l, sc})
+		}
+	}
+	sort.Sort(ls)
+
+	ret := make(data.Array, len(ls))
+	for i, l := range ls {
+		ret[i] = data.String(l.label)
+	}
+	return ret, nil
+}
+
+type labelScore struct {
+	label string
+	score float64
+}
+
+type labelScores []labelScore
+
+func (ls labelScores) Len() int {
+	return len(ls)
+}
+
+func (ls labelScores) Less(i, j int) bool {
+	if ls[i].score == ls[j].score {
+		return ls[i].label < ls[j].label
+	}
+	return ls[i].score > ls[j].score
+}
+
+func (ls labelScores) Swap(i, j int) {
+	ls[i], ls[j] = ls[j], ls[i]
+}
+
+// maxLabelScore returns the max score and its label in a data.Map.
+// This function are same as LScores.Max() except error checking.
+func maxLabelScore(scores data.Map) (label string, score float64, err error) {
+	if len(scores) == 0 {
+		err = errors.New("attempt to find a max score from an empty map")
+		return "", 0, err
+	}
+
+	score = minusInf
+	for l, s := range scores {
+		sc, err := data.AsFloat(s)
+		if err != nil {
+			err = fmt.Errorf("score for %s is not a float: %v", l, err)
+			return "", 0, err
+		}
+		if sc > score {
+			label = l
+			score = sc
+		}
+	}
+
+	return label, score, nil
+}
+
+var minusInf = math.Inf(-1)
@@ -0,0 +1,577 @@
+package classifier
+
+import (
+	"bytes"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestStateMultiLabel(t *testing.T) {
+	ctx := core.NewContext(nil)
+	c := AROWStateCreator{}
+	as, err := c.CreateState(ctx, data.Map{
+		"regularization_weight": data.Float(1),
+		"multi_label":           data.Bool(true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := as.(*State)
+
+	tags := []data.Value{
+		data.Array{data.String("x"), data.String("y")},
+		data.Array{data.String("x")},
+		data.String("y"),
+		data.Array{},
+	}
+	fvs := []data.Map{
+		{"x": data.Int(1), "y": data.Int(1)},
+		{"x": data.Int(1)},
+		{"y": data.Int(1)},
+		{"z": data.Int(1)},
+	}
+	for i := 0; i < 40; i++ {
+		if err := a.Write(ctx, &core.Tuple{
+			Data: data.Map{
+				"label":          tags[i%len(tags)],
+				"feature_vector": fvs[i%len(fvs)],
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Convey("Given a State trained with multiple labels", t, func() {
+		Convey("when classifying a feature vector", func() {
+			classify := func(fv data.Map) data.Array {
+				s, err := a.classifier.Classify(FeatureVector(fv))
+				So(err, ShouldBeNil)
+				ls, err := ClassifiedLabels(data.Map(s), 0)
+				So(err, ShouldBeNil)
+				return ls
+			}
+
+			Convey("labels having positive scores should be the labels of the feature vector.", func() {
+				ls := classify(fvs[0])
+				So(len(ls), ShouldEqual, 2)
+				So(ls, ShouldContain, data.String("x"))
+				So(ls, ShouldContain, data.String("y"))
+
+				So(classify(fvs[1]), ShouldResemble, data.Array{data.String("x")})
+				So(classify(fvs[2]), ShouldResemble, data.Array{data.String("y")})
+				So(classify(fvs[3]), ShouldBeEmpty)
+			})
+		})
+
+		Convey("when writing a tuple having a non-string label", func() {
+			err := a.Write(ctx, &core.Tuple{
+				Data: data.Map{
+					"label":          data.Array{data.Int(1)},
+					"feature_vector": fvs[0],
+				},
+			})
+
+			Convey("it should fail.", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("when saving it", func() {
+			buf := bytes.NewBuffer(nil)
+			err := a.Save(ctx, buf, data.Map{})
+			So(err, ShouldBeNil)
+
+			Convey("the loaded state should be same.", func() {
+				a2, err := c.LoadState(ctx, buf, data.Map{})
+				So(err, ShouldBeNil)
+				So(a2, ShouldResemble, a)
+			})
+		})
+	})
+}
+
+func TestStateConverter(t *testing.T) {
+	ctx := core.NewContext(nil)
+	c := AROWStateCreator{}
+	as, err := c.CreateState(ctx, data.Map{
+		"regularization_weight": data.Float(1),
+		"converter": data.Map{
+			"string_rules": data.Array{
+				data.Map{
+					"key":           data.String("*"),
+					"type":          data.String("space"),
+					"sample_weight": data.String("bin"),
+					"global_weight": data.String("bin"),
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := as.(*State)
+	if err := ctx.SharedStates.Add("arow", "jubaclassifier_arow", a); err != nil {
+		t.Fatal(err)
+	}
+
+	docs := []struct {
+		label string
+		text  string
+	}{
+		{"error", "disk failure detected"},
+		{"info", "backup completed"},
+		{"error", "network failure"},
+		{"info", "user logged in"},
+	}
+	for i := 0; i < 10; i++ {
+		for _, d := range docs {
+			if err := a.Write(ctx, &core.Tuple{
+				Data: data.Map{
+					"label":          data.String(d.label),
+					"feature_vector": data.Map{"message": data.String(d.text)},
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	Convey("Given a trained State having a converter", t, func() {
+		Convey("when classifying a text", func() {
+			s, err := Classify(ctx, "arow", data.Map{"message": data.String("power failure")})
+			So(err, ShouldBeNil)
+
+			Convey("it should be classified by its words.", func() {
+				l, err := ClassifiedLabel(s)
+				So(err, ShouldBeNil)
+				So(l, ShouldEqual, "error")
+			})
+		})
+
+		Convey("when saving and loading it", func() {
+			buf := bytes.NewBuffer(nil)
+			So(a.Save(ctx, buf, data.Map{}), ShouldBeNil)
+			a2, err := c.LoadState(ctx, buf, data.Map{})
+			So(err, ShouldBeNil)
+
+			Convey("the loaded state should convert feature vectors in the same way.", func() {
+				fv := data.Map{"message": data.String("backup failure")}
+				conv, err := a.converter.Convert(fv)
+				So(err, ShouldBeNil)
+				conv2, err := a2.(*State).converter.Convert(fv)
+				So(err, ShouldBeNil)
+				So(conv2, ShouldResemble, conv)
+			})
+		})
+	})
+
+	Convey("Given a State having a converter with idf", t, func() {
+		s, err := c.CreateState(ctx, data.Map{
+			"regularization_weight": data.Float(1),
+			"converter": data.Map{
+				"string_rules": data.Array{
+					data.Map{
+						"key":           data.String("*"),
+						"type":          data.String("space"),
+						"sample_weight": data.String("tf"),
+						"global_weight": data.String("idf"),
+					},
+				},
+			},
+		})
+		So(err, ShouldBeNil)
+		st := s.(*State)
+		saveConverter := func() []byte {
+			buf := bytes.NewBuffer(nil)
+			So(st.converter.Save(buf), ShouldBeNil)
+			return buf.Bytes()
+		}
+		before := saveConverter()
+
+		Convey("when writing a tuple having an empty label", func() {
+			err := st.Write(ctx, &core.Tuple{
+				Data: data.Map{
+					"label":          data.String(""),
+					"feature_vector": data.Map{"message": data.String("disk failure")},
+				},
+			})
+
+			Convey("it should fail without updating document frequencies.", func() {
+				So(err, ShouldNotBeNil)
+				So(saveConverter(), ShouldResemble, before)
+			})
+		})
+
+		Convey("when writing a valid tuple", func() {
+			So(st.Write(ctx, &core.Tuple{
+				Data: data.Map{
+					"label":          data.String("error"),
+					"feature_vector": data.Map{"message": data.String("disk failure")},
+				},
+			}), ShouldBeNil)
+
+			Convey("document frequencies should be updated.", func() {
+				So(saveConverter(), ShouldNotResemble, before)
+			})
+		})
+	})
+}
+
+func TestStateHashing(t *testing.T) {
+	ctx := core.NewContext(nil)
+	c := AROWStateCreator{}
+	as, err := c.CreateState(ctx, data.Map{
+		"regularization_weight": data.Float(1),
+		"hash_max_size":         data.Int(16),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := as.(*State)
+	arow := a.classifier.(*AROW)
+
+	for i := 0; i < 100; i++ {
+		label := "odd"
+		if i%2 == 0 {
+			label = "even"
+		}
+		if err := a.Write(ctx, &core.Tuple{
+			Data: data.Map{
+				"label": data.String(label),
+				"feature_vector": data.Map{
+					"url":   data.Map{fmt.Sprintf("http://example.com/%v", i): data.Int(1)},
+					"label": data.Map{label: data.Int(1)},
+				},
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Convey("Given a trained State with hash_max_size", t, func() {
+		Convey("its model should be bounded by hash_max_size.", func() {
+			for _, ws := range arow.model {
+				So(len(ws), ShouldBeLessThanOrEqualTo, 16)
+			}
+		})
+
+		Convey("keys shouldn't be interned.", func() {
+			So(arow.intern.GetOrZero("label\x00odd"), ShouldEqual, 0)
+		})
+
+		Convey("when saving and loading it", func() {
+			buf := bytes.NewBuffer(nil)
+			So(a.Save(ctx, buf, data.Map{}), ShouldBeNil)
+			a2, err := c.LoadState(ctx, buf, data.Map{})
+			So(err, ShouldBeNil)
+
+			Convey("the loaded state should have the same hash max size and scores.", func() {
+				arow2 := a2.(*State).classifier.(*AROW)
+				So(arow2.HashMaxSize(), ShouldEqual, 16)
+
+				fv := FeatureVector{"label": data.Map{"odd": data.Int(1)}}
+				s, err := arow.Classify(fv)
+				So(err, ShouldBeNil)
+				s2, err := arow2.Classify(fv)
+				So(err, ShouldBeNil)
+				So(s2, ShouldResemble, s)
+			})
+		})
+
+		Convey("changing its hash max size should fail.", func() {
+			So(arow.SetHashMaxSize(32), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestStatePruning(t *testing.T) {
+	ctx := core.NewContext(nil)
+	c := AROWStateCreator{}
+	as, err := c.CreateState(ctx, data.Map{
+		"regularization_weight": data.Float(1),
+		"pruning": data.Map{
+			"max_dims_per_label": data.Int(5),
+			"interval":           data.Int(10),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := as.(*State)
+	arow := a.classifier.(*AROW)
+	if err := ctx.SharedStates.Add("arow", "jubaclassifier_arow", a); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		label := "odd"
+		if i%2 == 0 {
+			label = "even"
+		}
+		if err := a.Write(ctx, &core.Tuple{
+			Data: data.Map{
+				"label": data.String(label),
+				"feature_vector": data.Map{
+					"url":   data.Map{fmt.Sprintf("http://example.com/%v", i): data.Int(1)},
+					"label": data.Map{label: data.Int(1)},
+				},
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Convey("Given a trained State with a pruning policy", t, func() {
+		Convey("its labels shouldn't have too many dimensions.", func() {
+			// The last datum was added after pruning.
+			for _, ws := range arow.model {
+				So(len(ws), ShouldBeLessThanOrEqualTo, 5+2)
+			}
+		})
+
+		Convey("its intern should be compacted.", func() {
+			So(arow.intern.Len(), ShouldBeLessThanOrEqualTo, 2*5+2)
+			So(arow.intern.GetOrZero("url\x00http://example.com/0"), ShouldEqual, 0)
+		})
+
+		Convey("recently used dimensions should be kept.", func() {
+			s, err := Classify(ctx, "arow", data.Map{"label": data.Map{"even": data.Int(1)}})
+			So(err, ShouldBeNil)
+			l, err := ClassifiedLabel(s)
+			So(err, ShouldBeNil)
+			So(l, ShouldEqual, "even")
+		})
+
+		Convey("when saving and loading it", func() {
+			buf := bytes.NewBuffer(nil)
+			So(a.Save(ctx, buf, data.Map{}), ShouldBeNil)
+			a2, err := c.LoadState(ctx, buf, data.Map{})
+			So(err, ShouldBeNil)
+
+			Convey("the loaded state should have the same pruner.", func() {
+				arow2 := a2.(*State).classifier.(*AROW)
+				So(arow2.pruner, ShouldResemble, arow.pruner)
+			})
+		})
+	})
+
+	Convey("Given a State pruning by both max_idle and weight_threshold", t, func() {
+		s, err := c.CreateState(ctx, data.Map{
+			"regularization_weight": data.Float(1),
+			"pruning": data.Map{
+				// All weights are below the threshold, so all dimensions
+				// are dropped on every pruning.
+				"weight_threshold": data.Float(100),
+				"max_idle":         data.Int(2),
+				"interval":         data.Int(1),
+			},
+		})
+		So(err, ShouldBeNil)
+		arow := s.(*State).classifier.(*AROW)
+
+		Convey("when training it with a dimension appearing in every datum", func() {
+			for i := 0; i < 5; i++ {
+				So(s.(*State).Write(ctx, &core.Tuple{
+					Data: data.Map{
+						"label": data.String("a"),
+						"feature_vector": data.Map{
+							"x":  data.Int(1),
+							"id": data.Map{fmt.Sprint(i): data.Int(1)},
+						},
+					},
+				}), ShouldBeNil)
+			}
+
+			Convey("the dimensions of the last datum should keep their last usage.", func() {
+				for _, k := range []string{"x", "id\x004"} {
+					d := arow.intern.GetOrZero(k)
+					So(d, ShouldNotEqual, 0)
+					So(arow.model["a"], ShouldContainKey, dim(d))
+					So(arow.pruner.LastUsed[d], ShouldEqual, 5)
+				}
+			})
+
+			Convey("dimensions of older data should be dropped.", func() {
+				So(arow.intern.GetOrZero("id\x003"), ShouldEqual, 0)
+				So(len(arow.model["a"]), ShouldEqual, 2)
+				So(len(arow.pruner.LastUsed), ShouldEqual, 2)
+			})
+		})
+	})
+
+	Convey("Given an invalid pruning policy", t, func() {
+		_, err := c.CreateState(ctx, data.Map{
+			"regularization_weight": data.Float(1),
+			"pruning": data.Map{
+				"interval": data.Int(0),
+			},
+		})
+
+		Convey("creating a state should fail.", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestStateCalibration(t *testing.T) {
+	ctx := core.NewContext(nil)
+	c := AROWStateCreator{}
+	as, err := c.CreateState(ctx, data.Map{
+		"regularization_weight": data.Float(1),
+		"calibration":           data.String("platt"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := as.(*State)
+	if err := ctx.SharedStates.Add("arow", "jubaclassifier_arow", a); err != nil {
+		t.Fatal(err)
+	}
+
+	// "x" mostly means "pos" but it's sometimes "neg".
+	for i := 0; i < 200; i++ {
+		label := "pos"
+		fv := data.Map{"x": data.Int(1)}
+		switch {
+		case i%2 == 1:
+			label = "neg"
+			fv = data.Map{"y": data.Int(1)}
+		case i%10 == 0:
+			label = "neg"
+		}
+		if err := a.Write(ctx, &core.Tuple{
+			Data: data.Map{
+				"label":          data.String(label),
+				"feature_vector": fv,
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Convey("Given a trained State with calibration", t, func() {
+		Convey("when getting probabilities", func() {
+			ps, err := Probabilities(ctx, "arow", data.Map{"x": data.Int(1)})
+			So(err, ShouldBeNil)
+
+			Convey("they should sum up to 1.", func() {
+				pos, _ := data.AsFloat(ps["pos"])
+				neg, _ := data.AsFloat(ps["neg"])
+				So(pos+neg, ShouldAlmostEqual, 1, 1e-6)
+			})
+
+			Convey("the likely label should have a higher but uncertain probability.", func() {
+				pos, _ := data.AsFloat(ps["pos"])
+				So(pos, ShouldBeBetween, 0.5, 0.99)
+			})
+		})
+
+		Convey("when saving and loading it", func() {
+			buf := bytes.NewBuffer(nil)
+			So(a.Save(ctx, buf, data.Map{}), ShouldBeNil)
+			a2, err := c.LoadState(ctx, buf, data.Map{})
+			So(err, ShouldBeNil)
+
+			Convey("the loaded state should have the same calibrator.", func() {
+				So(a2.(*State).calibrator.Params, ShouldResemble, a.calibrator.Params)
+				So(a2.(*State).calibrator.LearningRate, ShouldEqual, a.calibrator.LearningRate)
+			})
+		})
+	})
+
+	Convey("Given a state with calibration", t, func() {
+		s, err := c.CreateState(ctx, data.Map{
+			"regularization_weight": data.Float(1),
+			"calibration":           data.String("platt"),
+		})
+		So(err, ShouldBeNil)
+		st := s.(*State)
+
+		Convey("when writing a tuple having an empty label", func() {
+			err := st.Write(ctx, &core.Tuple{
+				Data: data.Map{
+					"label":          data.String(""),
+					"feature_vector": data.Map{"x": data.Int(1)},
+				},
+			})
+
+			Convey("it should fail without updating the calibrator.", func() {
+				So(err, ShouldNotBeNil)
+				So(st.calibrator.Params, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given a state with calibration trained with two labels", t, func() {
+		s, err := c.CreateState(ctx, data.Map{
+			"regularization_weight": data.Float(1),
+			"calibration":           data.String("platt"),
+		})
+		So(err, ShouldBeNil)
+		st := s.(*State)
+		ctx := core.NewContext(nil)
+		So(ctx.SharedStates.Add("arow_delete_label", "jubaclassifier_arow", st), ShouldBeNil)
+
+		write := func(label string) {
+			So(st.Write(ctx, &core.Tuple{
+				Data: data.Map{
+					"label":          data.String(label),
+					"feature_vector": data.Map{label: data.Int(1)},
+				},
+			}), ShouldBeNil)
+		}
+		for i := 0; i < 10; i++ {
+			write("pos")
+			write("neg")
+		}
+
+		Convey("when deleting a label", func() {
+			deleted, err := DeleteLabel(ctx, "arow_delete_label", "neg")
+			So(err, ShouldBeNil)
+			So(deleted, ShouldBeTrue)
+
+			Convey("the calibrator should drop parameters of the label.", func() {
+				So(st.calibrator.Params, ShouldContainKey, Label("pos"))
+				So(st.calibrator.Params, ShouldNotContainKey, Label("neg"))
+			})
+
+			Convey("and training the label again", func() {
+				write("neg")
+
+				Convey("the label should be calibrated from scratch.", func() {
+					p := st.calibrator.Params[Label("neg")]
+					So(p, ShouldNotBeNil)
+					So(p.Pos, ShouldEqual, 1)
+					So(p.Neg, ShouldEqual, 0)
+				})
+			})
+		})
+	})
+
+	Convey("Given a state without calibration", t, func() {
+		s, err := c.CreateState(ctx, data.Map{
+			"regularization_weight": data.Float(1),
+		})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("arow_without_calibration", "jubaclassifier_arow", s), ShouldBeNil)
+
+		Convey("getting probabilities should fail.", func() {
+			_, err := Probabilities(ctx, "arow_without_calibration", data.Map{"x": data.Int(1)})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given an invalid calibration method", t, func() {
+		_, err := c.CreateState(ctx, data.Map{
+			"regularization_weight": data.Float(1),
+			"calibration":           data.String("unknown"),
+		})
+
+		Convey("creating a state should fail.", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
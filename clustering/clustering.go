@@ -0,0 +1,410 @@
+package clustering
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/nearest"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"math/rand"
+	"sync"
+)
+
+// Clustering holds points in a storage and clusters them into k clusters
+// every time the storage requests to update the model.
+type Clustering struct {
+	method Method
+	k      int
+
+	storage storage
+
+	// centers is nil until the first clustering is performed.
+	centers []vector
+	// gmm is only used by GMM.
+	gmm *gmmModel
+	// dbscanConf and dbscan are only used by DBSCAN.
+	dbscanConf *dbscanConfig
+	dbscan     *dbscanModel
+
+	rg *rand.Rand
+	m  sync.RWMutex
+}
+
+const (
+	// InvalidMethod represents an invalid clustering method.
+	InvalidMethod Method = iota
+	// KMeans represents k-means.
+	KMeans
+	// GMM represents Gaussian mixture models.
+	GMM
+	// DBSCAN represents density-based spatial clustering of applications
+	// with noise.
+	DBSCAN
+)
+
+// Method is an enum type which represents clustering methods.
+type Method int
+
+// Member is a weighted point belonging to a cluster.
+type Member struct {
+	Weight float32
+	Point  data.Map
+}
+
+var (
+	// ErrNotClustered is returned when clustering hasn't been performed yet.
+	ErrNotClustered = errors.New("clustering hasn't been performed yet")
+
+	// ErrNoise is returned when a point doesn't belong to any cluster of
+	// DBSCAN.
+	ErrNoise = errors.New("the point is a noise")
+)
+
+func newClustering(method Method, k int, s storage, seed int64) (*Clustering, error) {
+	if k <= 0 {
+		return nil, errors.New("number of clusters must be greater than zero")
+	}
+	if method != KMeans && method != GMM {
+		return nil, errors.New("invalid clustering method")
+	}
+	return &Clustering{
+		method:  method,
+		k:       k,
+		storage: s,
+		rg:      rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+// NewWithSimpleStorage creates a Clustering which clusters the latest
+// bucketSize points every time bucketSize points are pushed.
+func NewWithSimpleStorage(method Method, k, bucketSize int, seed int64) (*Clustering, error) {
+	s, err := newSimpleStorage(bucketSize)
+	if err != nil {
+		return nil, err
+	}
+	return newClustering(method, k, s, seed)
+}
+
+// NewWithCompressiveStorage creates a Clustering which compresses every
+// bucketSize points into compressedBucketSize weighted points. Compressed
+// points are compressed again when bucketLength buckets are accumulated.
+// Weights of old points are multiplied by 1 - forgettingFactor at every
+// compression.
+func NewWithCompressiveStorage(method Method, k, bucketSize, compressedBucketSize, bucketLength int,
+	forgettingFactor float32, seed int64) (*Clustering, error) {
+	if compressedBucketSize < k {
+		return nil, errors.New("compressed bucket size must be greater than or equal to number of clusters")
+	}
+	s, err := newCompressiveStorage(bucketSize, compressedBucketSize, bucketLength, forgettingFactor)
+	if err != nil {
+		return nil, err
+	}
+	return newClustering(method, k, s, seed)
+}
+
+// NewDBSCAN creates a Clustering using DBSCAN. It clusters the latest
+// bucketSize points every time bucketSize points are pushed. eps is the
+// radius of neighborhoods measured by the distance of nnAlgo. A point having
+// at least minCorePoint points including itself in its neighborhood is a core
+// point.
+func NewDBSCAN(bucketSize int, eps float32, minCorePoint int, nnAlgo NNAlgorithm, hashNum int) (*Clustering, error) {
+	if eps <= 0 {
+		return nil, errors.New("eps must be greater than zero")
+	}
+	if minCorePoint <= 0 {
+		return nil, errors.New("min core point must be greater than zero")
+	}
+	if hashNum <= 0 {
+		return nil, errors.New("number of hash bits must be greater than zero")
+	}
+	if _, err := nearest.New(nnAlgo, hashNum); err != nil {
+		return nil, err
+	}
+
+	s, err := newSimpleStorage(bucketSize)
+	if err != nil {
+		return nil, err
+	}
+	return &Clustering{
+		method:  DBSCAN,
+		storage: s,
+		dbscanConf: &dbscanConfig{
+			Eps:          eps,
+			MinCorePoint: minCorePoint,
+			NNAlgorithm:  nnAlgo,
+			HashNum:      hashNum,
+		},
+		rg: rand.New(rand.NewSource(0)),
+	}, nil
+}
+
+// Push adds a point to the storage. It updates clusters when the storage
+// requests it.
+func (c *Clustering) Push(v FeatureVector) error {
+	vec, err := v.toInternal()
+	if err != nil {
+		return err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if !c.storage.add(vec, c.rg) {
+		return nil
+	}
+	ps := c.storage.points()
+	if c.method == DBSCAN {
+		snapshot := make([]point, len(ps))
+		copy(snapshot, ps)
+		m, n := dbscan(snapshot, c.dbscanConf)
+		c.dbscan = m
+		c.centers = m.centers(n)
+		return nil
+	}
+	if len(ps) < c.k {
+		return nil
+	}
+
+	switch c.method {
+	case KMeans:
+		c.centers = kmeans(ps, c.k, c.rg)
+	case GMM:
+		c.gmm = gmm(ps, c.k, c.rg)
+		c.centers = c.gmm.Means
+	}
+	return nil
+}
+
+// KCenter returns centers of all clusters.
+func (c *Clustering) KCenter() ([]data.Map, error) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	if c.centers == nil {
+		return nil, ErrNotClustered
+	}
+	ret := make([]data.Map, len(c.centers))
+	for i, cent := range c.centers {
+		ret[i] = cent.toMap()
+	}
+	return ret, nil
+}
+
+// NearestCenter returns the center of the cluster v belongs to.
+func (c *Clustering) NearestCenter(v FeatureVector) (data.Map, error) {
+	vec, err := v.toInternal()
+	if err != nil {
+		return nil, err
+	}
+
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	if c.centers == nil {
+		return nil, ErrNotClustered
+	}
+	ix := c.nearestIx(vec)
+	if ix == noise {
+		return nil, ErrNoise
+	}
+	return c.centers[ix].toMap(), nil
+}
+
+// NearestMembers returns members of the cluster v belongs to.
+func (c *Clustering) NearestMembers(v FeatureVector) ([]Member, error) {
+	vec, err := v.toInternal()
+	if err != nil {
+		return nil, err
+	}
+
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	if c.centers == nil {
+		return nil, ErrNotClustered
+	}
+	ix := c.nearestIx(vec)
+	if ix == noise {
+		return nil, ErrNoise
+	}
+	return c.members()[ix], nil
+}
+
+// ClusterID returns the index of the cluster v belongs to. The index
+// corresponds to the order of centers returned by KCenter. It returns -1 when
+// v is a noise point of DBSCAN.
+func (c *Clustering) ClusterID(v FeatureVector) (int, error) {
+	vec, err := v.toInternal()
+	if err != nil {
+		return 0, err
+	}
+
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	if c.centers == nil {
+		return 0, ErrNotClustered
+	}
+	return c.nearestIx(vec), nil
+}
+
+// NoisePoints returns points which don't belong to any cluster of DBSCAN.
+func (c *Clustering) NoisePoints() ([]data.Map, error) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	if c.method != DBSCAN {
+		return nil, errors.New("only DBSCAN has noise points")
+	}
+	if c.dbscan == nil {
+		return nil, ErrNotClustered
+	}
+	ret := []data.Map{}
+	for i, p := range c.dbscan.Points {
+		if c.dbscan.Labels[i] == noise {
+			ret = append(ret, p.Vector.toMap())
+		}
+	}
+	return ret, nil
+}
+
+// CoreMembers returns members of all clusters. The ith element of the result
+// corresponds to the ith center returned by KCenter.
+func (c *Clustering) CoreMembers() ([][]Member, error) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	if c.centers == nil {
+		return nil, ErrNotClustered
+	}
+	return c.members(), nil
+}
+
+// nearestIx returns the index of the cluster v belongs to. It returns -1 when
+// v is a noise point of DBSCAN. It requires read lock.
+func (c *Clustering) nearestIx(v vector) int {
+	switch c.method {
+	case GMM:
+		return c.gmm.nearestIx(v)
+	case DBSCAN:
+		return c.dbscan.label(v)
+	}
+	ix, _ := nearestIx(c.centers, v)
+	return ix
+}
+
+// members assigns points in the storage to clusters. Members of DBSCAN are
+// points of the snapshot used for the last clustering except noise points.
+// It requires read lock.
+func (c *Clustering) members() [][]Member {
+	ret := make([][]Member, len(c.centers))
+	for i := range ret {
+		ret[i] = []Member{}
+	}
+	if c.method == DBSCAN {
+		for i, p := range c.dbscan.Points {
+			if l := c.dbscan.Labels[i]; l != noise {
+				ret[l] = append(ret[l], Member{
+					Weight: p.Weight,
+					Point:  p.Vector.toMap(),
+				})
+			}
+		}
+		return ret
+	}
+
+	for _, p := range c.storage.points() {
+		ix := c.nearestIx(p.Vector)
+		ret[ix] = append(ret[ix], Member{
+			Weight: p.Weight,
+			Point:  p.Vector.toMap(),
+		})
+	}
+	return ret
+}
+
+const (
+	clusteringFormatVersion uint8 = 1
+)
+
+type clusteringMsgpack struct {
+	_struct    struct{} `codec:",toarray"`
+	Method     Method
+	K          int
+	Centers    []vector
+	GMM        *gmmModel
+	DBSCANConf *dbscanConfig
+	DBSCAN     *dbscanModel
+}
+
+// Save saves the current state of Clustering.
+func (c *Clustering) Save(w io.Writer) error {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	if _, err := w.Write([]byte{clusteringFormatVersion}); err != nil {
+		return err
+	}
+
+	enc := codec.NewEncoder(w, clusteringMsgpackHandle)
+	if err := enc.Encode(&clusteringMsgpack{
+		Method:     c.method,
+		K:          c.k,
+		Centers:    c.centers,
+		GMM:        c.gmm,
+		DBSCANConf: c.dbscanConf,
+		DBSCAN:     c.dbscan,
+	}); err != nil {
+		return err
+	}
+	return saveStorage(c.storage, w)
+}
+
+// Load loads Clustering from the saved data.
+func Load(r io.Reader) (*Clustering, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadFormatV1(r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of Clustering container: %v", formatVersion[0])
+	}
+}
+
+func loadFormatV1(r io.Reader) (*Clustering, error) {
+	var m clusteringMsgpack
+	dec := codec.NewDecoder(r, clusteringMsgpackHandle)
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	s, err := loadStorage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.DBSCAN != nil {
+		if m.DBSCANConf == nil {
+			return nil, errors.New("DBSCAN model doesn't have its config")
+		}
+		if _, err := nearest.New(m.DBSCANConf.NNAlgorithm, m.DBSCANConf.HashNum); err != nil {
+			return nil, err
+		}
+		m.DBSCAN.build(m.DBSCANConf)
+	}
+
+	return &Clustering{
+		method:     m.Method,
+		k:          m.K,
+		storage:    s,
+		centers:    m.Centers,
+		gmm:        m.GMM,
+		dbscanConf: m.DBSCANConf,
+		dbscan:     m.DBSCAN,
+		rg:         rand.New(rand.NewSource(0)),
+	}, nil
+}
@@ -0,0 +1,165 @@
+package clustering
+
+import (
+	"github.com/sensorbee/jubatus/internal/nearest"
+)
+
+const (
+	// InvalidNNAlgorithm represents an invalid nearest neighbor algorithm.
+	InvalidNNAlgorithm = nearest.InvalidAlgorithm
+	// LSH represents locality sensitive hashing.
+	LSH = nearest.LSHAlgorithm
+	// Minhash represents minhash.
+	Minhash = nearest.MinhashAlgorithm
+	// EuclidLSH represents locality sensitive hashing with euclidean distance.
+	EuclidLSH = nearest.EuclidLSHAlgorithm
+)
+
+// NNAlgorithm is an enum type which represents nearest neighbor algorithms
+// used by DBSCAN.
+type NNAlgorithm = nearest.Algorithm
+
+const (
+	// noise is the label of noise points.
+	noise = -1
+	// unvisited is the label of points which haven't been visited yet.
+	unvisited = -2
+)
+
+// dbscanConfig has parameters of DBSCAN.
+type dbscanConfig struct {
+	_struct      struct{} `codec:",toarray"`
+	Eps          float32
+	MinCorePoint int
+	NNAlgorithm  NNAlgorithm
+	HashNum      int
+}
+
+// dbscanModel is the result of DBSCAN over a snapshot of the storage.
+type dbscanModel struct {
+	_struct struct{} `codec:",toarray"`
+
+	Points []point
+	// Labels[i] is the cluster ID of Points[i]. It's -1 for noise points.
+	Labels []int
+	// Core[i] is true when Points[i] is a core point.
+	Core []bool
+
+	// nn has Points whose IDs are their indices + 1. It isn't saved and is
+	// rebuilt on load.
+	nn  nearest.Neighbor
+	eps float32
+}
+
+// dbscan clusters ps by DBSCAN. The number of clusters is returned along
+// with the model.
+//
+// jubatus::core::clustering::dbscan::batch
+func dbscan(ps []point, conf *dbscanConfig) (*dbscanModel, int) {
+	m := &dbscanModel{
+		Points: ps,
+		Labels: make([]int, len(ps)),
+		Core:   make([]bool, len(ps)),
+	}
+	// The config has already been validated.
+	m.build(conf)
+
+	neighbors := make([][]int, len(ps))
+	for i := range ps {
+		neighbors[i] = m.neighborsFromID(i)
+		m.Core[i] = len(neighbors[i]) >= conf.MinCorePoint
+		m.Labels[i] = unvisited
+	}
+
+	n := 0
+	for i := range ps {
+		if m.Labels[i] != unvisited {
+			continue
+		}
+		if !m.Core[i] {
+			m.Labels[i] = noise
+			continue
+		}
+
+		m.Labels[i] = n
+		queue := append([]int{}, neighbors[i]...)
+		for len(queue) > 0 {
+			j := queue[0]
+			queue = queue[1:]
+			switch m.Labels[j] {
+			case noise:
+				// border point
+				m.Labels[j] = n
+				continue
+			case unvisited:
+			default:
+				continue
+			}
+			m.Labels[j] = n
+			if m.Core[j] {
+				queue = append(queue, neighbors[j]...)
+			}
+		}
+		n++
+	}
+	return m, n
+}
+
+// build creates the nearest neighbor index of Points.
+func (m *dbscanModel) build(conf *dbscanConfig) {
+	m.nn, _ = nearest.New(conf.NNAlgorithm, conf.HashNum)
+	m.eps = conf.Eps
+	for i, p := range m.Points {
+		m.nn.SetRow(nearest.ID(i+1), nearest.NewFeatureVector(p.Vector))
+	}
+}
+
+// neighborsFromID returns indices of points in the eps-neighborhood of
+// Points[i] including itself.
+func (m *dbscanModel) neighborsFromID(i int) []int {
+	return m.withinEps(m.nn.NeighborRowFromID(nearest.ID(i+1), len(m.Points)))
+}
+
+// label returns the cluster ID of v. v belongs to the cluster of the nearest
+// core point in its eps-neighborhood. It returns -1 when v is a noise point.
+func (m *dbscanModel) label(v vector) int {
+	if len(m.Points) == 0 {
+		return noise
+	}
+	for _, i := range m.withinEps(m.nn.NeighborRowFromFV(nearest.NewFeatureVector(v), len(m.Points))) {
+		if m.Core[i] {
+			return m.Labels[i]
+		}
+	}
+	return noise
+}
+
+func (m *dbscanModel) withinEps(res []nearest.IDist) []int {
+	ret := []int{}
+	for _, d := range res {
+		if d.Dist > m.eps {
+			break
+		}
+		ret = append(ret, int(d.ID-1))
+	}
+	return ret
+}
+
+// centers returns the mean of each cluster.
+func (m *dbscanModel) centers(n int) []vector {
+	ret := make([]vector, n)
+	counts := make([]float32, n)
+	for i := range ret {
+		ret[i] = vector{}
+	}
+	for i, p := range m.Points {
+		if l := m.Labels[i]; l != noise {
+			ret[l].addScaled(1, p.Vector)
+			counts[l]++
+		}
+	}
+	for i := range ret {
+		ret[i].scale(1 / counts[i])
+	}
+	return ret
+}
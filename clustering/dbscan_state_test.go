@@ -0,0 +1,98 @@
+package clustering
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math/rand"
+	"testing"
+)
+
+func TestDBSCANState(t *testing.T) {
+	Convey("Given a clustering state using DBSCAN", t, func() {
+		ctx := core.NewContext(nil)
+		c := StateCreator{}
+		ss, err := c.CreateState(ctx, data.Map{
+			"method":                     data.String("dbscan"),
+			"bucket_size":                data.Int(101),
+			"eps":                        data.Float(1),
+			"min_core_point":             data.Int(3),
+			"nearest_neighbor_algorithm": data.String("euclid_lsh"),
+			"hash_num":                   data.Int(512),
+		})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("cl", "jubaclustering", ss), ShouldBeNil)
+		s := ss.(*State)
+
+		Convey("when pushing points around two centers and an outlier", func() {
+			rg := rand.New(rand.NewSource(1))
+			for i := 0; i < 100; i++ {
+				x := 10 * float64(i%2)
+				So(s.Write(ctx, &core.Tuple{
+					Data: data.Map{
+						"feature_vector": data.Map{
+							"x": data.Float(x + rg.NormFloat64()*0.1),
+							"y": data.Float(x + rg.NormFloat64()*0.1),
+						},
+					},
+				}), ShouldBeNil)
+			}
+			So(s.Write(ctx, &core.Tuple{
+				Data: data.Map{
+					"feature_vector": data.Map{
+						"x": data.Float(-20),
+						"y": data.Float(30),
+					},
+				},
+			}), ShouldBeNil)
+
+			Convey("it should find two clusters.", func() {
+				cs, err := KCenter(ctx, "cl")
+				So(err, ShouldBeNil)
+				So(len(cs), ShouldEqual, 2)
+
+				id0, err := ClusterID(ctx, "cl", data.Map{"x": data.Float(0), "y": data.Float(0)})
+				So(err, ShouldBeNil)
+				id1, err := ClusterID(ctx, "cl", data.Map{"x": data.Float(10), "y": data.Float(10)})
+				So(err, ShouldBeNil)
+				So(id0, ShouldBeGreaterThanOrEqualTo, 0)
+				So(id1, ShouldBeGreaterThanOrEqualTo, 0)
+				So(id0, ShouldNotEqual, id1)
+
+				ms, err := NearestMembers(ctx, "cl", data.Map{"x": data.Float(10), "y": data.Float(10)})
+				So(err, ShouldBeNil)
+				So(len(ms), ShouldEqual, 50)
+			})
+
+			Convey("it should detect the outlier as a noise.", func() {
+				ps, err := NoisePoints(ctx, "cl")
+				So(err, ShouldBeNil)
+				So(ps, ShouldResemble, data.Array{
+					data.Map{"x": data.Float(-20), "y": data.Float(30)},
+				})
+
+				id, err := ClusterID(ctx, "cl", data.Map{"x": data.Float(-20), "y": data.Float(30)})
+				So(err, ShouldBeNil)
+				So(id, ShouldEqual, -1)
+
+				_, err = NearestCenter(ctx, "cl", data.Map{"x": data.Float(-20), "y": data.Float(30)})
+				So(err, ShouldEqual, ErrNoise)
+			})
+
+			Convey("and saving and loading it", func() {
+				buf := bytes.NewBuffer(nil)
+				So(s.Save(ctx, buf, data.Map{}), ShouldBeNil)
+				s2, err := c.LoadState(ctx, buf, data.Map{})
+				So(err, ShouldBeNil)
+
+				Convey("the loaded state should be same.", func() {
+					c2 := s2.(*State).clustering
+					So(c2.dbscanConf, ShouldResemble, s.clustering.dbscanConf)
+					So(c2.dbscan, ShouldResemble, s.clustering.dbscan)
+					So(c2.centers, ShouldResemble, s.clustering.centers)
+				})
+			})
+		})
+	})
+}
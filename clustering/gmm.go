@@ -0,0 +1,165 @@
+package clustering
+
+import (
+	"math"
+	"math/rand"
+)
+
+const (
+	gmmMaxIteration = 100
+	gmmTolerance    = 1e-5
+
+	// minVariance prevents a component from collapsing to a point.
+	minVariance = 1e-6
+)
+
+// gmmModel is a Gaussian mixture model having diagonal covariance matrices.
+type gmmModel struct {
+	_struct   struct{} `codec:",toarray"`
+	Means     []vector
+	Variances []vector
+	Mixtures  []float32
+}
+
+// gmm fits a Gaussian mixture model having k components to weighted points
+// by the EM algorithm initialized with k-means. len(ps) must be greater than
+// or equal to k.
+//
+// jubatus::core::clustering::gmm::batch
+func gmm(ps []point, k int, rg *rand.Rand) *gmmModel {
+	ds := dims(ps)
+	xs := make([][]float64, len(ps))
+	for i, p := range ps {
+		xs[i] = make([]float64, len(ds))
+		for j, d := range ds {
+			xs[i][j] = float64(p.Vector[d])
+		}
+	}
+
+	centers := kmeans(ps, k, rg)
+	k = len(centers)
+	means := make([][]float64, k)
+	vars := make([][]float64, k)
+	mix := make([]float64, k)
+	for c := range centers {
+		means[c] = make([]float64, len(ds))
+		vars[c] = make([]float64, len(ds))
+		for j, d := range ds {
+			means[c][j] = float64(centers[c][d])
+			vars[c][j] = 1
+		}
+		mix[c] = 1 / float64(k)
+	}
+
+	resp := make([][]float64, len(ps))
+	for i := range resp {
+		resp[i] = make([]float64, k)
+	}
+	prevLL := math.Inf(-1)
+	for iter := 0; iter < gmmMaxIteration; iter++ {
+		// E-step
+		var ll float64
+		for i, x := range xs {
+			maxLog := math.Inf(-1)
+			for c := 0; c < k; c++ {
+				resp[i][c] = math.Log(mix[c]) + logGaussian(x, means[c], vars[c])
+				maxLog = math.Max(maxLog, resp[i][c])
+			}
+			var sum float64
+			for c := 0; c < k; c++ {
+				resp[i][c] = math.Exp(resp[i][c] - maxLog)
+				sum += resp[i][c]
+			}
+			for c := 0; c < k; c++ {
+				resp[i][c] /= sum
+			}
+			ll += float64(ps[i].Weight) * (maxLog + math.Log(sum))
+		}
+
+		// M-step
+		var total float64
+		for _, p := range ps {
+			total += float64(p.Weight)
+		}
+		for c := 0; c < k; c++ {
+			var nc float64
+			mean := make([]float64, len(ds))
+			for i, x := range xs {
+				r := resp[i][c] * float64(ps[i].Weight)
+				nc += r
+				for j := range x {
+					mean[j] += r * x[j]
+				}
+			}
+			if nc == 0 {
+				continue
+			}
+			variance := make([]float64, len(ds))
+			for j := range mean {
+				mean[j] /= nc
+			}
+			for i, x := range xs {
+				r := resp[i][c] * float64(ps[i].Weight)
+				for j := range x {
+					d := x[j] - mean[j]
+					variance[j] += r * d * d
+				}
+			}
+			for j := range variance {
+				variance[j] = math.Max(variance[j]/nc, minVariance)
+			}
+			means[c] = mean
+			vars[c] = variance
+			mix[c] = nc / total
+		}
+
+		if math.Abs(ll-prevLL) < gmmTolerance*math.Abs(ll) {
+			break
+		}
+		prevLL = ll
+	}
+
+	ret := &gmmModel{
+		Means:     make([]vector, k),
+		Variances: make([]vector, k),
+		Mixtures:  make([]float32, k),
+	}
+	for c := 0; c < k; c++ {
+		ret.Means[c] = make(vector, len(ds))
+		ret.Variances[c] = make(vector, len(ds))
+		for j, d := range ds {
+			ret.Means[c][d] = float32(means[c][j])
+			ret.Variances[c][d] = float32(vars[c][j])
+		}
+		ret.Mixtures[c] = float32(mix[c])
+	}
+	return ret
+}
+
+func logGaussian(x, mean, variance []float64) float64 {
+	var ret float64
+	for j := range x {
+		d := x[j] - mean[j]
+		ret -= 0.5 * (math.Log(2*math.Pi*variance[j]) + d*d/variance[j])
+	}
+	return ret
+}
+
+// nearestIx returns the index of the component having the largest posterior
+// probability of v. Dimensions which didn't appear in training are ignored.
+func (g *gmmModel) nearestIx(v vector) int {
+	ix := 0
+	max := math.Inf(-1)
+	for c := range g.Means {
+		l := math.Log(float64(g.Mixtures[c]))
+		for d, m := range g.Means[c] {
+			variance := float64(g.Variances[c][d])
+			x := float64(v[d] - m)
+			l -= 0.5 * (math.Log(2*math.Pi*variance) + x*x/variance)
+		}
+		if l > max {
+			ix, max = c, l
+		}
+	}
+	return ix
+}
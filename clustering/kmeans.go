@@ -0,0 +1,125 @@
+package clustering
+
+import (
+	"math/rand"
+)
+
+const (
+	kmeansMaxIteration = 100
+)
+
+// kmeansPP selects at most k points from ps by weighted k-means++ seeding
+// and returns their indices.
+func kmeansPP(ps []point, k int, rg *rand.Rand) []int {
+	if len(ps) == 0 || k <= 0 {
+		return nil
+	}
+
+	// minDists[i] is the weighted squared distance from ps[i] to the
+	// nearest selected point.
+	minDists := make([]float32, len(ps))
+	for i, p := range ps {
+		minDists[i] = p.Weight
+	}
+
+	ret := make([]int, 0, k)
+	selected := make([]bool, len(ps))
+	for len(ret) < k && len(ret) < len(ps) {
+		ix := sample(minDists, selected, rg)
+		ret = append(ret, ix)
+		selected[ix] = true
+
+		c := ps[ix].Vector
+		for i, p := range ps {
+			d := p.Weight * p.Vector.squaredDist(c)
+			if len(ret) == 1 || d < minDists[i] {
+				minDists[i] = d
+			}
+		}
+	}
+	return ret
+}
+
+// sample selects an index with probability proportional to ws[i]. Indices
+// already selected are skipped. When all weights are zero, it selects one of
+// the remaining indices uniformly.
+func sample(ws []float32, selected []bool, rg *rand.Rand) int {
+	var sum float64
+	for i, w := range ws {
+		if !selected[i] {
+			sum += float64(w)
+		}
+	}
+
+	if sum > 0 {
+		r := rg.Float64() * sum
+		last := -1
+		for i, w := range ws {
+			if selected[i] {
+				continue
+			}
+			last = i
+			if r -= float64(w); r < 0 {
+				return i
+			}
+		}
+		if last >= 0 {
+			// rounding error
+			return last
+		}
+	}
+
+	remaining := make([]int, 0, len(ws))
+	for i := range ws {
+		if !selected[i] {
+			remaining = append(remaining, i)
+		}
+	}
+	return remaining[rg.Intn(len(remaining))]
+}
+
+// kmeans clusters weighted points into k clusters by Lloyd's algorithm
+// initialized with k-means++. len(ps) must be greater than or equal to k.
+//
+// jubatus::core::clustering::kmeans_clustering_method::batch_update
+func kmeans(ps []point, k int, rg *rand.Rand) []vector {
+	centers := make([]vector, 0, k)
+	for _, ix := range kmeansPP(ps, k, rg) {
+		c := make(vector, len(ps[ix].Vector))
+		c.addScaled(1, ps[ix].Vector)
+		centers = append(centers, c)
+	}
+
+	assign := make([]int, len(ps))
+	for iter := 0; iter < kmeansMaxIteration; iter++ {
+		changed := false
+		for i, p := range ps {
+			ix, _ := nearestIx(centers, p.Vector)
+			if iter == 0 || ix != assign[i] {
+				changed = true
+			}
+			assign[i] = ix
+		}
+		if !changed {
+			break
+		}
+
+		sums := make([]vector, len(centers))
+		weights := make([]float32, len(centers))
+		for i := range sums {
+			sums[i] = vector{}
+		}
+		for i, p := range ps {
+			sums[assign[i]].addScaled(p.Weight, p.Vector)
+			weights[assign[i]] += p.Weight
+		}
+		for i := range centers {
+			// An empty cluster keeps the previous center.
+			if weights[i] > 0 {
+				sums[i].scale(1 / weights[i])
+				centers[i] = sums[i]
+			}
+		}
+	}
+	return centers
+}
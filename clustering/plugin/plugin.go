@@ -0,0 +1,17 @@
+package plugin
+
+import (
+	"github.com/sensorbee/jubatus/clustering"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+)
+
+func init() {
+	udf.MustRegisterGlobalUDSCreator("jubaclustering", &clustering.StateCreator{})
+
+	udf.MustRegisterGlobalUDF("jubaclustering_nearest_center", udf.MustConvertGeneric(clustering.NearestCenter))
+	udf.MustRegisterGlobalUDF("jubaclustering_nearest_members", udf.MustConvertGeneric(clustering.NearestMembers))
+	udf.MustRegisterGlobalUDF("jubaclustering_k_center", udf.MustConvertGeneric(clustering.KCenter))
+	udf.MustRegisterGlobalUDF("jubaclustering_core_members", udf.MustConvertGeneric(clustering.CoreMembers))
+	udf.MustRegisterGlobalUDF("jubaclustering_cluster_id", udf.MustConvertGeneric(clustering.ClusterID))
+	udf.MustRegisterGlobalUDF("jubaclustering_noise_points", udf.MustConvertGeneric(clustering.NoisePoints))
+}
@@ -0,0 +1,392 @@
+package clustering
+
+import (
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/fvconverter"
+	"github.com/sensorbee/jubatus/internal/pluginutil"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// State is a state which has a Clustering. Writing a tuple to the state
+// pushes its feature vector to the Clustering.
+type State struct {
+	clustering         *Clustering
+	featureVectorField string
+
+	// converter converts feature vectors before they're passed to the
+	// clustering. It's nil when feature vectors are used as they are.
+	converter *fvconverter.Converter
+}
+
+var _ core.SavableSharedState = &State{}
+
+type stateMsgpack struct {
+	_struct            struct{} `codec:",toarray"`
+	FeatureVectorField string
+}
+
+// StateCreator is used by BQL to create or load a State as a UDS.
+type StateCreator struct {
+}
+
+var _ udf.UDSLoader = &StateCreator{}
+
+// CreateState creates a new State.
+func (c *StateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	fv, err := pluginutil.ExtractParamAsStringWithDefault(params, "feature_vector_field", "feature_vector")
+	if err != nil {
+		return nil, err
+	}
+	conv, err := fvconverter.ExtractParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	methodName, err := pluginutil.ExtractParamAsString(params, "method")
+	if err != nil {
+		return nil, err
+	}
+	var method Method
+	switch strings.ToLower(methodName) {
+	case "kmeans":
+		method = KMeans
+	case "gmm":
+		method = GMM
+	case "dbscan":
+		s, err := createDBSCANState(fv, params)
+		if err != nil {
+			return nil, err
+		}
+		s.converter = conv
+		return s, nil
+	default:
+		return nil, fmt.Errorf("invalid method: %s", methodName)
+	}
+
+	k, err := pluginutil.ExtractParamAsBoundedInt(params, "k")
+	if err != nil {
+		return nil, err
+	}
+	bucketSize, err := pluginutil.ExtractParamAsBoundedInt(params, "bucket_size")
+	if err != nil {
+		return nil, err
+	}
+	seed, err := pluginutil.ExtractParamAsIntWithDefault(params, "seed", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	compressor, err := pluginutil.ExtractParamAsStringWithDefault(params, "compressor_method", "simple")
+	if err != nil {
+		return nil, err
+	}
+
+	var cl *Clustering
+	switch compressor {
+	case "simple":
+		cl, err = NewWithSimpleStorage(method, k, bucketSize, seed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize clustering: %v", err)
+		}
+
+	case "compressive":
+		cbs, err := pluginutil.ExtractParamAsBoundedInt(params, "compressed_bucket_size")
+		if err != nil {
+			return nil, err
+		}
+		bl, err := pluginutil.ExtractParamAsBoundedIntWithDefault(params, "bucket_length", 2)
+		if err != nil {
+			return nil, err
+		}
+		ff, err := pluginutil.ExtractParamAndConvertToFloatWithDefault(params, "forgetting_factor", 0)
+		if err != nil {
+			return nil, err
+		}
+		cl, err = NewWithCompressiveStorage(method, k, bucketSize, cbs, bl, float32(ff), seed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize clustering: %v", err)
+		}
+
+	default:
+		return nil, fmt.Errorf("invalid compressor_method: %v", compressor)
+	}
+
+	return &State{
+		clustering:         cl,
+		featureVectorField: fv,
+		converter:          conv,
+	}, nil
+}
+
+// createDBSCANState creates a State using DBSCAN. DBSCAN only supports the
+// simple storage.
+func createDBSCANState(fv string, params data.Map) (*State, error) {
+	compressor, err := pluginutil.ExtractParamAsStringWithDefault(params, "compressor_method", "simple")
+	if err != nil {
+		return nil, err
+	}
+	if compressor != "simple" {
+		return nil, fmt.Errorf("dbscan doesn't support compressor_method: %v", compressor)
+	}
+
+	bucketSize, err := pluginutil.ExtractParamAsBoundedInt(params, "bucket_size")
+	if err != nil {
+		return nil, err
+	}
+	eps, err := pluginutil.ExtractParamAndConvertToFloat(params, "eps")
+	if err != nil {
+		return nil, err
+	}
+	minCorePoint, err := pluginutil.ExtractParamAsBoundedInt(params, "min_core_point")
+	if err != nil {
+		return nil, err
+	}
+
+	nnAlgoName, err := pluginutil.ExtractParamAsString(params, "nearest_neighbor_algorithm")
+	if err != nil {
+		return nil, err
+	}
+	var nnAlgo NNAlgorithm
+	switch strings.ToLower(nnAlgoName) {
+	case "lsh":
+		nnAlgo = LSH
+	case "minhash":
+		nnAlgo = Minhash
+	case "euclid_lsh":
+		nnAlgo = EuclidLSH
+	default:
+		return nil, fmt.Errorf("invalid nearest_neighbor_algorithm: %s", nnAlgoName)
+	}
+	hashNum, err := pluginutil.ExtractParamAsBoundedInt(params, "hash_num")
+	if err != nil {
+		return nil, err
+	}
+
+	cl, err := NewDBSCAN(bucketSize, float32(eps), minCorePoint, nnAlgo, hashNum)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize clustering: %v", err)
+	}
+	return &State{
+		clustering:         cl,
+		featureVectorField: fv,
+	}, nil
+}
+
+var (
+	clusteringMsgpackHandle = &codec.MsgpackHandle{
+		RawToString: true,
+	}
+)
+
+func init() {
+	clusteringMsgpackHandle.MapType = reflect.TypeOf(map[string]interface{}{})
+}
+
+// LoadState loads a new State.
+func (c *StateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadStateFormatV1(ctx, r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of clustering State container: %v", formatVersion[0])
+	}
+}
+
+func loadStateFormatV1(ctx *core.Context, r io.Reader) (core.SharedState, error) {
+	var d stateMsgpack
+	dec := codec.NewDecoder(r, clusteringMsgpackHandle)
+	if err := dec.Decode(&d); err != nil {
+		return nil, err
+	}
+
+	conv, err := fvconverter.Load(r)
+	if err != nil {
+		return nil, err
+	}
+	cl, err := Load(r)
+	if err != nil {
+		return nil, err
+	}
+	return &State{
+		clustering:         cl,
+		featureVectorField: d.FeatureVectorField,
+		converter:          conv,
+	}, nil
+}
+
+// Terminate terminates the state.
+func (*State) Terminate(ctx *core.Context) error {
+	return nil
+}
+
+// Write pushes the feature vector in the tuple to the Clustering.
+func (s *State) Write(ctx *core.Context, t *core.Tuple) error {
+	vfv, ok := t.Data[s.featureVectorField]
+	if !ok {
+		return fmt.Errorf("%s field is missing", s.featureVectorField)
+	}
+	fv, err := data.AsMap(vfv)
+	if err != nil {
+		return fmt.Errorf("%s value is not a map: %v", s.featureVectorField, err)
+	}
+	fv, err = s.converter.ConvertAndUpdate(fv)
+	if err != nil {
+		return err
+	}
+
+	return s.clustering.Push(FeatureVector(fv))
+}
+
+const (
+	clusteringStateFormatVersion = 1
+)
+
+// Save is provided as a part of core.SavableSharedState.
+func (s *State) Save(ctx *core.Context, w io.Writer, params data.Map) error {
+	if _, err := w.Write([]byte{clusteringStateFormatVersion}); err != nil {
+		return err
+	}
+
+	enc := codec.NewEncoder(w, clusteringMsgpackHandle)
+	if err := enc.Encode(&stateMsgpack{
+		FeatureVectorField: s.featureVectorField,
+	}); err != nil {
+		return err
+	}
+	if err := s.converter.Save(w); err != nil {
+		return err
+	}
+	return s.clustering.Save(w)
+}
+
+// NearestCenter returns the center of the cluster featureVector belongs to.
+func NearestCenter(ctx *core.Context, stateName string, featureVector data.Map) (data.Map, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	fv, err := s.converter.Convert(featureVector)
+	if err != nil {
+		return nil, err
+	}
+	return s.clustering.NearestCenter(FeatureVector(fv))
+}
+
+// NearestMembers returns members of the cluster featureVector belongs to.
+// Each element of the result is a map having "weight" and "point".
+func NearestMembers(ctx *core.Context, stateName string, featureVector data.Map) (data.Array, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	fv, err := s.converter.Convert(featureVector)
+	if err != nil {
+		return nil, err
+	}
+	ms, err := s.clustering.NearestMembers(FeatureVector(fv))
+	if err != nil {
+		return nil, err
+	}
+	return membersToArray(ms), nil
+}
+
+// KCenter returns centers of all clusters.
+func KCenter(ctx *core.Context, stateName string) (data.Array, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := s.clustering.KCenter()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(data.Array, len(cs))
+	for i, c := range cs {
+		ret[i] = c
+	}
+	return ret, nil
+}
+
+// CoreMembers returns members of all clusters. The ith element of the result
+// is an array of members of the cluster whose center is the ith element of
+// the result of KCenter.
+func CoreMembers(ctx *core.Context, stateName string) (data.Array, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	mss, err := s.clustering.CoreMembers()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(data.Array, len(mss))
+	for i, ms := range mss {
+		ret[i] = membersToArray(ms)
+	}
+	return ret, nil
+}
+
+// ClusterID returns the index of the cluster featureVector belongs to. It
+// returns -1 when featureVector is a noise point of DBSCAN.
+func ClusterID(ctx *core.Context, stateName string, featureVector data.Map) (int, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return 0, err
+	}
+	fv, err := s.converter.Convert(featureVector)
+	if err != nil {
+		return 0, err
+	}
+	return s.clustering.ClusterID(FeatureVector(fv))
+}
+
+// NoisePoints returns points which don't belong to any cluster of DBSCAN.
+func NoisePoints(ctx *core.Context, stateName string) (data.Array, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := s.clustering.NoisePoints()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(data.Array, len(ps))
+	for i, p := range ps {
+		ret[i] = p
+	}
+	return ret, nil
+}
+
+func membersToArray(ms []Member) data.Array {
+	ret := make(data.Array, len(ms))
+	for i, m := range ms {
+		ret[i] = data.Map{
+			"weight": data.Float(m.Weight),
+			"point":  m.Point,
+		}
+	}
+	return ret
+}
+
+func lookupState(ctx *core.Context, stateName string) (*State, error) {
+	st, err := ctx.SharedStates.Get(stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := st.(*State); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("state '%v' isn't a clustering state", stateName)
+}
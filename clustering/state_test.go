@@ -0,0 +1,106 @@
+package clustering
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math/rand"
+	"testing"
+)
+
+func TestClusteringState(t *testing.T) {
+	configs := []data.Map{
+		{"method": data.String("kmeans"), "compressor_method": data.String("simple")},
+		{"method": data.String("gmm"), "compressor_method": data.String("simple")},
+		{"method": data.String("kmeans"), "compressor_method": data.String("compressive"),
+			"compressed_bucket_size": data.Int(20), "forgetting_factor": data.Float(0.1)},
+		{"method": data.String("gmm"), "compressor_method": data.String("compressive"),
+			"compressed_bucket_size": data.Int(20), "forgetting_factor": data.Float(0.1)},
+	}
+
+	for _, params := range configs {
+		params := params
+		params["k"] = data.Int(2)
+		params["bucket_size"] = data.Int(50)
+
+		name := params["method"].String() + " with " + params["compressor_method"].String() + " storage"
+		Convey("Given a clustering state using "+name, t, func() {
+			ctx := core.NewContext(nil)
+			c := StateCreator{}
+			ss, err := c.CreateState(ctx, params)
+			So(err, ShouldBeNil)
+			So(ctx.SharedStates.Add("cl", "jubaclustering", ss), ShouldBeNil)
+			s := ss.(*State)
+
+			Convey("when no clustering has been performed", func() {
+				_, err := KCenter(ctx, "cl")
+
+				Convey("it should fail.", func() {
+					So(err, ShouldEqual, ErrNotClustered)
+				})
+			})
+
+			Convey("when pushing points around two centers", func() {
+				rg := rand.New(rand.NewSource(1))
+				for i := 0; i < 200; i++ {
+					x := 10 * float64(i%2)
+					So(s.Write(ctx, &core.Tuple{
+						Data: data.Map{
+							"feature_vector": data.Map{
+								"x": data.Float(x + rg.NormFloat64()*0.1),
+								"y": data.Float(x + rg.NormFloat64()*0.1),
+							},
+						},
+					}), ShouldBeNil)
+				}
+
+				Convey("it should find both centers.", func() {
+					cs, err := KCenter(ctx, "cl")
+					So(err, ShouldBeNil)
+					So(len(cs), ShouldEqual, 2)
+
+					c0, err := NearestCenter(ctx, "cl", data.Map{"x": data.Float(0), "y": data.Float(0)})
+					So(err, ShouldBeNil)
+					x, _ := data.AsFloat(c0["x"])
+					So(x, ShouldAlmostEqual, 0, 0.5)
+
+					c1, err := NearestCenter(ctx, "cl", data.Map{"x": data.Float(10), "y": data.Float(10)})
+					So(err, ShouldBeNil)
+					x, _ = data.AsFloat(c1["x"])
+					So(x, ShouldAlmostEqual, 10, 0.5)
+				})
+
+				Convey("members of a cluster should be near the center.", func() {
+					ms, err := NearestMembers(ctx, "cl", data.Map{"x": data.Float(10), "y": data.Float(10)})
+					So(err, ShouldBeNil)
+					So(len(ms), ShouldBeGreaterThan, 0)
+					for _, m := range ms {
+						x, _ := data.AsFloat(m.(data.Map)["point"].(data.Map)["x"])
+						So(x, ShouldAlmostEqual, 10, 1)
+					}
+
+					cms, err := CoreMembers(ctx, "cl")
+					So(err, ShouldBeNil)
+					So(len(cms), ShouldEqual, 2)
+				})
+
+				Convey("and saving and loading it", func() {
+					buf := bytes.NewBuffer(nil)
+					So(s.Save(ctx, buf, data.Map{}), ShouldBeNil)
+					s2, err := c.LoadState(ctx, buf, data.Map{})
+					So(err, ShouldBeNil)
+
+					Convey("the loaded state should be same.", func() {
+						c2 := s2.(*State).clustering
+						So(c2.method, ShouldEqual, s.clustering.method)
+						So(c2.k, ShouldEqual, s.clustering.k)
+						So(c2.storage, ShouldResemble, s.clustering.storage)
+						So(c2.centers, ShouldResemble, s.clustering.centers)
+						So(c2.gmm, ShouldResemble, s.clustering.gmm)
+					})
+				})
+			})
+		})
+	}
+}
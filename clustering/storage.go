@@ -0,0 +1,208 @@
+package clustering
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ugorji/go/codec"
+	"io"
+	"math/rand"
+)
+
+// storage holds weighted points used for clustering.
+type storage interface {
+	// add adds a point with weight 1. It returns true when the clustering
+	// needs to be updated.
+	add(v vector, rg *rand.Rand) bool
+
+	// points returns all points in the storage.
+	points() []point
+
+	name() string
+}
+
+// simpleStorage holds the latest BucketSize points. The clustering is updated
+// every time BucketSize points are added.
+//
+// jubatus::core::clustering::simple_storage
+type simpleStorage struct {
+	_struct    struct{} `codec:",toarray"`
+	BucketSize int
+	Points     []point
+	Count      uint64
+}
+
+func newSimpleStorage(bucketSize int) (*simpleStorage, error) {
+	if bucketSize <= 0 {
+		return nil, errors.New("bucket size must be greater than zero")
+	}
+	return &simpleStorage{
+		BucketSize: bucketSize,
+	}, nil
+}
+
+func (s *simpleStorage) add(v vector, rg *rand.Rand) bool {
+	s.Points = append(s.Points, point{Weight: 1, Vector: v})
+	if len(s.Points) > s.BucketSize {
+		s.Points = s.Points[len(s.Points)-s.BucketSize:]
+	}
+	s.Count++
+	return s.Count%uint64(s.BucketSize) == 0
+}
+
+func (s *simpleStorage) points() []point {
+	return s.Points
+}
+
+func (s *simpleStorage) name() string {
+	return "simple"
+}
+
+// compressiveStorage compresses points into a coreset every time BucketSize
+// points are added. Levels[0] has raw points and Levels[i] has points
+// compressed i times. When Levels[i] has more than BucketLength compressed
+// buckets, it's compressed again into Levels[i+1]. Weights of compressed
+// points are multiplied by 1 - ForgettingFactor at each compression so that
+// old points gradually lose their influence.
+//
+// jubatus::core::clustering::compressive_storage
+type compressiveStorage struct {
+	_struct              struct{} `codec:",toarray"`
+	BucketSize           int
+	CompressedBucketSize int
+	BucketLength         int
+	ForgettingFactor     float32
+	Levels               [][]point
+}
+
+func newCompressiveStorage(bucketSize, compressedBucketSize, bucketLength int, forgettingFactor float32) (*compressiveStorage, error) {
+	if bucketSize <= 0 {
+		return nil, errors.New("bucket size must be greater than zero")
+	}
+	if compressedBucketSize <= 0 || compressedBucketSize > bucketSize {
+		return nil, errors.New("compressed bucket size must be greater than zero and not greater than bucket size")
+	}
+	if bucketLength < 2 {
+		return nil, errors.New("bucket length must be greater than one")
+	}
+	if forgettingFactor < 0 || forgettingFactor >= 1 {
+		return nil, errors.New("forgetting factor must be in [0, 1)")
+	}
+	return &compressiveStorage{
+		BucketSize:           bucketSize,
+		CompressedBucketSize: compressedBucketSize,
+		BucketLength:         bucketLength,
+		ForgettingFactor:     forgettingFactor,
+		Levels:               make([][]point, 1),
+	}, nil
+}
+
+func (s *compressiveStorage) add(v vector, rg *rand.Rand) bool {
+	s.Levels[0] = append(s.Levels[0], point{Weight: 1, Vector: v})
+	if len(s.Levels[0]) < s.BucketSize {
+		return false
+	}
+
+	decay := 1 - s.ForgettingFactor
+	for i := 1; i < len(s.Levels); i++ {
+		for j := range s.Levels[i] {
+			s.Levels[i][j].Weight *= decay
+		}
+	}
+
+	carry := compress(s.Levels[0], s.CompressedBucketSize, rg)
+	s.Levels[0] = nil
+	for i := 1; carry != nil; i++ {
+		if i == len(s.Levels) {
+			s.Levels = append(s.Levels, nil)
+		}
+		s.Levels[i] = append(s.Levels[i], carry...)
+		carry = nil
+		if len(s.Levels[i]) > s.BucketLength*s.CompressedBucketSize {
+			carry = compress(s.Levels[i], s.CompressedBucketSize, rg)
+			s.Levels[i] = nil
+		}
+	}
+	return true
+}
+
+func (s *compressiveStorage) points() []point {
+	var ret []point
+	for _, l := range s.Levels {
+		ret = append(ret, l...)
+	}
+	return ret
+}
+
+func (s *compressiveStorage) name() string {
+	return "compressive"
+}
+
+// compress selects size representative points from ps by k-means++ seeding.
+// Each selected point gets the total weight of points nearest to it.
+//
+// jubatus::core::clustering::kmeans_compressor
+func compress(ps []point, size int, rg *rand.Rand) []point {
+	if len(ps) <= size {
+		ret := make([]point, len(ps))
+		copy(ret, ps)
+		return ret
+	}
+
+	ixs := kmeansPP(ps, size, rg)
+	centers := make([]vector, len(ixs))
+	for i, ix := range ixs {
+		centers[i] = ps[ix].Vector
+	}
+	ret := make([]point, len(ixs))
+	for i, c := range centers {
+		ret[i].Vector = c
+	}
+	for _, p := range ps {
+		ix, _ := nearestIx(centers, p.Vector)
+		ret[ix].Weight += p.Weight
+	}
+	return ret
+}
+
+type storageMsgpack struct {
+	_struct struct{} `codec:",toarray"`
+	Name    string
+}
+
+func saveStorage(s storage, w io.Writer) error {
+	enc := codec.NewEncoder(w, clusteringMsgpackHandle)
+	if err := enc.Encode(&storageMsgpack{
+		Name: s.name(),
+	}); err != nil {
+		return err
+	}
+	return enc.Encode(s)
+}
+
+func loadStorage(r io.Reader) (storage, error) {
+	var d storageMsgpack
+	dec := codec.NewDecoder(r, clusteringMsgpackHandle)
+	if err := dec.Decode(&d); err != nil {
+		return nil, err
+	}
+
+	switch d.Name {
+	case "simple":
+		s := &simpleStorage{}
+		if err := dec.Decode(s); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case "compressive":
+		s := &compressiveStorage{}
+		if err := dec.Decode(s); err != nil {
+			return nil, err
+		}
+		if len(s.Levels) == 0 {
+			s.Levels = make([][]point, 1)
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unsupported clustering storage: %v", d.Name)
+	}
+}
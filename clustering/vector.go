@@ -0,0 +1,92 @@
+package clustering
+
+import (
+	"github.com/sensorbee/jubatus/internal/nested"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+)
+
+// FeatureVector is a type for feature vectors.
+type FeatureVector data.Map
+
+// vector is a sparse vector having flattened keys of a feature vector.
+type vector map[string]float32
+
+func (v FeatureVector) toInternal() (vector, error) {
+	ret := make(vector, len(v))
+	err := nested.Flatten(data.Map(v), func(key string, value float32) {
+		ret[key] = value
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (v vector) toMap() data.Map {
+	return nested.Unflatten(v)
+}
+
+// squaredDist returns the squared euclidean distance between v and w.
+func (v vector) squaredDist(w vector) float32 {
+	var ret float32
+	for k, x := range v {
+		d := x - w[k]
+		ret += d * d
+	}
+	for k, y := range w {
+		if _, ok := v[k]; !ok {
+			ret += y * y
+		}
+	}
+	return ret
+}
+
+// addScaled adds s * w to v.
+func (v vector) addScaled(s float32, w vector) {
+	for k, y := range w {
+		v[k] += s * y
+	}
+}
+
+func (v vector) scale(s float32) {
+	for k := range v {
+		v[k] *= s
+	}
+}
+
+// point is a weighted point stored in storage.
+type point struct {
+	_struct struct{} `codec:",toarray"`
+	Weight  float32
+	Vector  vector
+}
+
+// dims returns all dimensions of ps in ascending order.
+func dims(ps []point) []string {
+	set := map[string]struct{}{}
+	for _, p := range ps {
+		for k := range p.Vector {
+			set[k] = struct{}{}
+		}
+	}
+	ret := make([]string, 0, len(set))
+	for k := range set {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// nearestIx returns the index of the center nearest to v and the squared
+// distance to it. centers must not be empty.
+func nearestIx(centers []vector, v vector) (int, float32) {
+	ix := 0
+	min := centers[0].squaredDist(v)
+	for i := 1; i < len(centers); i++ {
+		if d := centers[i].squaredDist(v); d < min {
+			ix, min = i, d
+		}
+	}
+	return ix, min
+}
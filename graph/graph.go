@@ -0,0 +1,440 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ugorji/go/codec"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Graph is a directed graph whose nodes and edges have properties. It
+// computes PageRank centrality and approximate shortest paths on subgraphs
+// selected by preset queries.
+//
+// Modifying the graph only invalidates indices, and an invalidated index is
+// updated when it's read next time or UpdateIndex is called. Centrality
+// indices are updated incrementally around modified nodes, while shortest
+// path indices are recomputed from scratch. Updates hold the write lock.
+type Graph struct {
+	dampingFactor float64
+	landmarkNum   int
+
+	nodes map[string]*node
+	edges map[uint64]*edge
+	// nextID is shared by nodes and edges.
+	nextID uint64
+
+	// version is incremented every time the graph is modified. Indices
+	// computed on an older version are updated when they're used.
+	version uint64
+
+	// modified has the version at which each node was modified last. It
+	// has all nodes modified after modifiedSince and is used to update
+	// centrality indices incrementally.
+	modified      map[string]uint64
+	modifiedSince uint64
+
+	centralityIndices   map[string]*centralityIndex
+	shortestPathIndices map[string]*shortestPathIndex
+
+	m sync.RWMutex
+}
+
+// Property is a set of key-value pairs attached to a node or an edge.
+type Property map[string]string
+
+type node struct {
+	_struct struct{} `codec:",toarray"`
+
+	Property Property
+	// In and Out have IDs of incoming and outgoing edges in ascending order.
+	In  []uint64
+	Out []uint64
+}
+
+type edge struct {
+	_struct struct{} `codec:",toarray"`
+
+	Property Property
+	Source   string
+	Target   string
+}
+
+// Node is information of a node.
+type Node struct {
+	Property Property
+	InEdges  []uint64
+	OutEdges []uint64
+}
+
+// Edge is information of an edge.
+type Edge struct {
+	Property Property
+	Source   string
+	Target   string
+}
+
+// New creates a Graph. dampingFactor is the damping factor of PageRank.
+// landmarkNum is the number of landmarks used to answer shortest path
+// queries.
+func New(dampingFactor float64, landmarkNum int) (*Graph, error) {
+	if !(0 < dampingFactor && dampingFactor < 1) {
+		return nil, errors.New("damping factor must be in (0, 1)")
+	}
+	if landmarkNum <= 0 {
+		return nil, errors.New("number of landmarks must be greater than zero")
+	}
+	return &Graph{
+		dampingFactor:       dampingFactor,
+		landmarkNum:         landmarkNum,
+		nodes:               make(map[string]*node),
+		edges:               make(map[uint64]*edge),
+		modified:            make(map[string]uint64),
+		centralityIndices:   make(map[string]*centralityIndex),
+		shortestPathIndices: make(map[string]*shortestPathIndex),
+	}, nil
+}
+
+// CreateNode creates a node without properties and returns its ID.
+func (g *Graph) CreateNode() string {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	id := strconv.FormatUint(g.nextID, 10)
+	g.nextID++
+	g.nodes[id] = &node{Property: Property{}}
+	g.touch(id)
+	return id
+}
+
+// UpdateNode replaces properties of a node.
+func (g *Graph) UpdateNode(id string, p Property) error {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	n, ok := g.nodes[id]
+	if !ok {
+		return fmt.Errorf("node '%v' doesn't exist", id)
+	}
+	n.Property = p.clone()
+	g.touch(id)
+	return nil
+}
+
+// RemoveNode removes a node. A node having edges cannot be removed. It
+// returns false when the node doesn't exist.
+func (g *Graph) RemoveNode(id string) (bool, error) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	n, ok := g.nodes[id]
+	if !ok {
+		return false, nil
+	}
+	if len(n.In) > 0 || len(n.Out) > 0 {
+		return false, fmt.Errorf("node '%v' has edges", id)
+	}
+	delete(g.nodes, id)
+	g.touch(id)
+	return true, nil
+}
+
+// Node returns information of a node.
+func (g *Graph) Node(id string) (*Node, error) {
+	g.m.RLock()
+	defer g.m.RUnlock()
+
+	n, ok := g.nodes[id]
+	if !ok {
+		return nil, fmt.Errorf("node '%v' doesn't exist", id)
+	}
+	return &Node{
+		Property: n.Property.clone(),
+		InEdges:  append([]uint64{}, n.In...),
+		OutEdges: append([]uint64{}, n.Out...),
+	}, nil
+}
+
+// CreateEdge creates an edge from source to target and returns its ID.
+func (g *Graph) CreateEdge(source, target string, p Property) (uint64, error) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	s, ok := g.nodes[source]
+	if !ok {
+		return 0, fmt.Errorf("node '%v' doesn't exist", source)
+	}
+	t, ok := g.nodes[target]
+	if !ok {
+		return 0, fmt.Errorf("node '%v' doesn't exist", target)
+	}
+
+	id := g.nextID
+	g.nextID++
+	g.edges[id] = &edge{
+		Property: p.clone(),
+		Source:   source,
+		Target:   target,
+	}
+	s.Out = append(s.Out, id)
+	t.In = append(t.In, id)
+	g.touch(source, target)
+	return id, nil
+}
+
+// UpdateEdge replaces properties of an edge.
+func (g *Graph) UpdateEdge(id uint64, p Property) error {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	e, ok := g.edges[id]
+	if !ok {
+		return fmt.Errorf("edge '%v' doesn't exist", id)
+	}
+	e.Property = p.clone()
+	g.touch(e.Source, e.Target)
+	return nil
+}
+
+// RemoveEdge removes an edge. It returns false when the edge doesn't exist.
+func (g *Graph) RemoveEdge(id uint64) bool {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	e, ok := g.edges[id]
+	if !ok {
+		return false
+	}
+	s := g.nodes[e.Source]
+	s.Out = removeID(s.Out, id)
+	t := g.nodes[e.Target]
+	t.In = removeID(t.In, id)
+	delete(g.edges, id)
+	g.touch(e.Source, e.Target)
+	return true
+}
+
+// Edge returns information of an edge.
+func (g *Graph) Edge(id uint64) (*Edge, error) {
+	g.m.RLock()
+	defer g.m.RUnlock()
+
+	e, ok := g.edges[id]
+	if !ok {
+		return nil, fmt.Errorf("edge '%v' doesn't exist", id)
+	}
+	return &Edge{
+		Property: e.Property.clone(),
+		Source:   e.Source,
+		Target:   e.Target,
+	}, nil
+}
+
+// Clear removes all nodes and edges. Preset queries are kept.
+func (g *Graph) Clear() {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	g.nodes = make(map[string]*node)
+	g.edges = make(map[uint64]*edge)
+	for _, c := range g.centralityIndices {
+		c.Scores = nil
+	}
+	g.version++
+	g.modified = make(map[string]uint64)
+	g.modifiedSince = g.version
+}
+
+// touch increments the version of the graph and records that nodes are
+// modified. It requires write lock.
+func (g *Graph) touch(ids ...string) {
+	g.version++
+	for _, id := range ids {
+		g.modified[id] = g.version
+	}
+}
+
+// affectedNodes returns nodes whose PageRank equations can have changed
+// since the given version: modified nodes, their out-neighbors, and
+// out-neighbors of their in-neighbors, whose out-degrees can have changed
+// when the modified node entered or left a subgraph. It requires read lock.
+func (g *Graph) affectedNodes(since uint64) map[string]bool {
+	ret := map[string]bool{}
+	addTargets := func(n *node) {
+		for _, eid := range n.Out {
+			ret[g.edges[eid].Target] = true
+		}
+	}
+	for id, v := range g.modified {
+		if v <= since {
+			continue
+		}
+		ret[id] = true
+		n, ok := g.nodes[id]
+		if !ok {
+			continue
+		}
+		addTargets(n)
+		for _, eid := range n.In {
+			addTargets(g.nodes[g.edges[eid].Source])
+		}
+	}
+	return ret
+}
+
+// compactModified forgets modifications which all computed centrality
+// indices have already reflected. It requires write lock.
+func (g *Graph) compactModified() {
+	since := g.version
+	for _, c := range g.centralityIndices {
+		if c.version != 0 && c.version < since {
+			since = c.version
+		}
+	}
+	for id, v := range g.modified {
+		if v <= since {
+			delete(g.modified, id)
+		}
+	}
+	g.modifiedSince = since
+}
+
+func (p Property) clone() Property {
+	ret := make(Property, len(p))
+	for k, v := range p {
+		ret[k] = v
+	}
+	return ret
+}
+
+// matches returns true when p has all key-value pairs of q.
+func (p Property) matches(q Property) bool {
+	for k, v := range q {
+		if pv, ok := p[k]; !ok || pv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// removeID removes id from ids keeping the order.
+func removeID(ids []uint64, id uint64) []uint64 {
+	i := sort.Search(len(ids), func(i int) bool { return ids[i] >= id })
+	if i < len(ids) && ids[i] == id {
+		return append(ids[:i], ids[i+1:]...)
+	}
+	return ids
+}
+
+const (
+	graphFormatVersion uint8 = 1
+)
+
+type graphMsgpack struct {
+	_struct struct{} `codec:",toarray"`
+
+	DampingFactor float64
+	LandmarkNum   int
+
+	Nodes  map[string]*node
+	Edges  map[uint64]*edge
+	NextID uint64
+
+	// CentralityIndices has preset queries of centrality and their scores.
+	// Indices of shortest paths are recomputed from their queries.
+	CentralityIndices   []*centralityIndex
+	ShortestPathQueries []*Query
+}
+
+// Save saves the current state of Graph.
+func (g *Graph) Save(w io.Writer) error {
+	g.m.RLock()
+	defer g.m.RUnlock()
+
+	if _, err := w.Write([]byte{graphFormatVersion}); err != nil {
+		return err
+	}
+
+	m := &graphMsgpack{
+		DampingFactor: g.dampingFactor,
+		LandmarkNum:   g.landmarkNum,
+		Nodes:         g.nodes,
+		Edges:         g.edges,
+		NextID:        g.nextID,
+	}
+	for _, c := range g.centralityIndices {
+		m.CentralityIndices = append(m.CentralityIndices, c)
+	}
+	for _, s := range g.shortestPathIndices {
+		m.ShortestPathQueries = append(m.ShortestPathQueries, s.query)
+	}
+	enc := codec.NewEncoder(w, graphMsgpackHandle)
+	return enc.Encode(m)
+}
+
+// Load loads Graph from the saved data.
+func Load(r io.Reader) (*Graph, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadFormatV1(r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of Graph container: %v", formatVersion[0])
+	}
+}
+
+func loadFormatV1(r io.Reader) (*Graph, error) {
+	m := graphMsgpack{}
+	dec := codec.NewDecoder(r, graphMsgpackHandle)
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+
+	g, err := New(m.DampingFactor, m.LandmarkNum)
+	if err != nil {
+		return nil, err
+	}
+	if m.Nodes != nil {
+		g.nodes = m.Nodes
+	}
+	if m.Edges != nil {
+		g.edges = m.Edges
+	}
+	for _, n := range g.nodes {
+		if n.Property == nil {
+			n.Property = Property{}
+		}
+	}
+	for id, e := range g.edges {
+		if _, ok := g.nodes[e.Source]; !ok {
+			return nil, fmt.Errorf("source node of edge '%v' is missing", id)
+		}
+		if _, ok := g.nodes[e.Target]; !ok {
+			return nil, fmt.Errorf("target node of edge '%v' is missing", id)
+		}
+		if e.Property == nil {
+			e.Property = Property{}
+		}
+	}
+	g.nextID = m.NextID
+
+	// The version of the loaded graph is one so that saved scores are used
+	// as initial values and indices are recomputed when they're used.
+	g.version = 1
+	g.modifiedSince = g.version
+	for _, c := range m.CentralityIndices {
+		c.version = 0
+		g.centralityIndices[c.Query.key()] = c
+	}
+	for _, q := range m.ShortestPathQueries {
+		g.shortestPathIndices[q.key()] = &shortestPathIndex{query: q}
+	}
+	return g, nil
+}
@@ -0,0 +1,479 @@
+package graph
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Query selects a subgraph. A node is selected when it has all properties
+// in NodeQuery, and an edge is selected when it has all properties in
+// EdgeQuery and both of its ends are selected.
+type Query struct {
+	_struct struct{} `codec:",toarray"`
+
+	NodeQuery Property
+	EdgeQuery Property
+}
+
+// key returns a string identifying the query.
+func (q *Query) key() string {
+	enc := func(p Property) string {
+		kvs := make([]string, 0, len(p))
+		for k, v := range p {
+			kvs = append(kvs, strconv.Quote(k)+":"+strconv.Quote(v))
+		}
+		sort.Strings(kvs)
+		return strings.Join(kvs, ",")
+	}
+	return enc(q.NodeQuery) + "/" + enc(q.EdgeQuery)
+}
+
+// subgraph is an adjacency list of a subgraph selected by a query.
+type subgraph struct {
+	// nodes are sorted by their IDs.
+	nodes []string
+	out   map[string][]string
+	in    map[string][]string
+}
+
+func (s *subgraph) has(id string) bool {
+	_, ok := s.out[id]
+	return ok
+}
+
+// subgraph returns the subgraph selected by q. It requires read lock.
+func (g *Graph) subgraph(q *Query) *subgraph {
+	s := &subgraph{
+		out: map[string][]string{},
+		in:  map[string][]string{},
+	}
+	for id, n := range g.nodes {
+		if n.Property.matches(q.NodeQuery) {
+			s.nodes = append(s.nodes, id)
+			s.out[id] = nil
+			s.in[id] = nil
+		}
+	}
+	sort.Strings(s.nodes)
+
+	for _, id := range s.nodes {
+		for _, eid := range g.nodes[id].Out {
+			e := g.edges[eid]
+			if !s.has(e.Target) || !e.Property.matches(q.EdgeQuery) {
+				continue
+			}
+			s.out[id] = append(s.out[id], e.Target)
+			s.in[e.Target] = append(s.in[e.Target], id)
+		}
+	}
+	return s
+}
+
+// selects returns true when the node exists and is selected by q. It
+// requires read lock.
+func (g *Graph) selects(id string, q *Query) bool {
+	n, ok := g.nodes[id]
+	return ok && n.Property.matches(q.NodeQuery)
+}
+
+// outNeighbors returns targets of edges from a node in the subgraph selected
+// by q. A target appears as many times as edges to it. It requires read
+// lock.
+func (g *Graph) outNeighbors(id string, q *Query) []string {
+	var ret []string
+	for _, eid := range g.nodes[id].Out {
+		e := g.edges[eid]
+		if e.Property.matches(q.EdgeQuery) && g.selects(e.Target, q) {
+			ret = append(ret, e.Target)
+		}
+	}
+	return ret
+}
+
+// inNeighbors returns sources of edges to a node in the subgraph selected by
+// q. It requires read lock.
+func (g *Graph) inNeighbors(id string, q *Query) []string {
+	var ret []string
+	for _, eid := range g.nodes[id].In {
+		e := g.edges[eid]
+		if e.Property.matches(q.EdgeQuery) && g.selects(e.Source, q) {
+			ret = append(ret, e.Source)
+		}
+	}
+	return ret
+}
+
+type centralityIndex struct {
+	_struct struct{} `codec:",toarray"`
+
+	Query *Query
+	// Scores has PageRank scores of nodes computed on the graph whose
+	// version is version.
+	Scores  map[string]float64
+	version uint64
+
+	// residuals has the difference between the right-hand side of the
+	// PageRank equation and the score of each node which hasn't been pushed
+	// yet because it's smaller than the tolerance. Nodes not in residuals
+	// have no residual.
+	residuals map[string]float64
+}
+
+const (
+	pageRankTolerance = 1e-6
+)
+
+// update updates PageRank scores of the subgraph selected by the query with
+// the push method. Residuals of nodes affected by modifications since the
+// last update are recomputed and pushed to their neighbors until all
+// residuals become smaller than the tolerance, so that only the part of
+// the graph around modified nodes is visited. Residuals of all nodes are
+// recomputed when the index has never been computed on the graph or the
+// graph no longer remembers modifications since the last update. Previous
+// scores are used as initial values in both cases. It requires write lock.
+func (c *centralityIndex) update(g *Graph) {
+	var dirty map[string]bool
+	if c.version == 0 || c.version < g.modifiedSince || c.Scores == nil {
+		dirty = make(map[string]bool, len(g.nodes))
+		for id := range g.nodes {
+			dirty[id] = true
+		}
+		for id := range c.Scores {
+			if _, ok := g.nodes[id]; !ok {
+				dirty[id] = true
+			}
+		}
+		if c.Scores == nil {
+			c.Scores = make(map[string]float64, len(g.nodes))
+		}
+		c.residuals = make(map[string]float64)
+	} else {
+		dirty = g.affectedNodes(c.version)
+	}
+
+	// Nodes which left the subgraph are dropped and new nodes start from 1.
+	for id := range dirty {
+		if !g.selects(id, c.Query) {
+			delete(c.Scores, id)
+			delete(c.residuals, id)
+			delete(dirty, id)
+			continue
+		}
+		if _, ok := c.Scores[id]; !ok {
+			c.Scores[id] = 1
+		}
+	}
+
+	// Residuals of dirty nodes are recomputed from the current scores of
+	// their in-neighbors.
+	d := g.dampingFactor
+	var queue []string
+	queued := map[string]bool{}
+	for id := range dirty {
+		v := 0.0
+		for _, src := range g.inNeighbors(id, c.Query) {
+			v += c.Scores[src] / float64(len(g.outNeighbors(src, c.Query)))
+		}
+		r := (1 - d) + d*v - c.Scores[id]
+		c.residuals[id] = r
+		if math.Abs(r) >= pageRankTolerance {
+			queue = append(queue, id)
+			queued[id] = true
+		}
+	}
+
+	// Pushing a residual to the score of a node moves d times of it to the
+	// residuals of the out-neighbors, so the sum of absolute residuals
+	// decreases at every push and the loop terminates.
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		queued[id] = false
+
+		r := c.residuals[id]
+		delete(c.residuals, id)
+		c.Scores[id] += r
+		out := g.outNeighbors(id, c.Query)
+		for _, dst := range out {
+			c.residuals[dst] += d * r / float64(len(out))
+			if !queued[dst] && math.Abs(c.residuals[dst]) >= pageRankTolerance {
+				queue = append(queue, dst)
+				queued[dst] = true
+			}
+		}
+	}
+	c.version = g.version
+	g.compactModified()
+}
+
+type shortestPathIndex struct {
+	query     *Query
+	landmarks []*landmark
+	version   uint64
+}
+
+// landmark has shortest path trees from and to a landmark node.
+type landmark struct {
+	id string
+	// parent[v] is the previous node of v on a shortest path from the
+	// landmark to v.
+	parent map[string]string
+	// next[v] is the next node of v on a shortest path from v to the
+	// landmark.
+	next map[string]string
+}
+
+// update selects landmarks having the largest degrees and computes shortest
+// path trees of them. It requires write lock.
+func (s *shortestPathIndex) update(g *Graph) {
+	sg := g.subgraph(s.query)
+	ds := make(byDegree, len(sg.nodes))
+	for i, id := range sg.nodes {
+		ds[i] = nodeDegree{id, len(sg.in[id]) + len(sg.out[id])}
+	}
+	sort.Stable(ds)
+	if len(ds) > g.landmarkNum {
+		ds = ds[:g.landmarkNum]
+	}
+
+	s.landmarks = make([]*landmark, len(ds))
+	for i, d := range ds {
+		id := d.id
+		s.landmarks[i] = &landmark{
+			id:     id,
+			parent: bfs(id, sg.out),
+			next:   bfs(id, sg.in),
+		}
+	}
+	s.version = g.version
+}
+
+type nodeDegree struct {
+	id     string
+	degree int
+}
+
+type byDegree []nodeDegree
+
+func (s byDegree) Len() int {
+	return len(s)
+}
+
+func (s byDegree) Less(i, j int) bool {
+	return s[i].degree > s[j].degree
+}
+
+func (s byDegree) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// bfs returns the previous node of each node reachable from start following
+// adj. The previous node of start is itself.
+func bfs(start string, adj map[string][]string) map[string]string {
+	prev := map[string]string{start: start}
+	q := []string{start}
+	for len(q) > 0 {
+		v := q[0]
+		q = q[1:]
+		for _, u := range adj[v] {
+			if _, ok := prev[u]; ok {
+				continue
+			}
+			prev[u] = v
+			q = append(q, u)
+		}
+	}
+	return prev
+}
+
+// path returns the shortest path from source to target passing through one
+// of the landmarks. It returns nil when there's no such path.
+func (s *shortestPathIndex) path(source, target string) []string {
+	var best []string
+	for _, l := range s.landmarks {
+		if _, ok := l.next[source]; !ok {
+			continue
+		}
+		if _, ok := l.parent[target]; !ok {
+			continue
+		}
+
+		var p []string
+		for v := source; v != l.id; v = l.next[v] {
+			p = append(p, v)
+		}
+		var rest []string
+		for v := target; v != l.id; v = l.parent[v] {
+			rest = append(rest, v)
+		}
+		p = append(p, l.id)
+		for i := len(rest) - 1; i >= 0; i-- {
+			p = append(p, rest[i])
+		}
+		p = removeLoops(p)
+
+		if best == nil || len(p) < len(best) {
+			best = p
+		}
+	}
+	return best
+}
+
+// removeLoops removes cycles from a path.
+func removeLoops(p []string) []string {
+	last := make(map[string]int, len(p))
+	for i, v := range p {
+		last[v] = i
+	}
+	ret := make([]string, 0, len(p))
+	for i := 0; i < len(p); i = last[p[i]] + 1 {
+		ret = append(ret, p[i])
+	}
+	return ret
+}
+
+// AddCentralityQuery registers a preset query of centrality. It returns false
+// when the query has already been registered.
+func (g *Graph) AddCentralityQuery(q *Query) bool {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	k := q.key()
+	if _, ok := g.centralityIndices[k]; ok {
+		return false
+	}
+	g.centralityIndices[k] = &centralityIndex{Query: q.clone()}
+	return true
+}
+
+// RemoveCentralityQuery removes a preset query of centrality. It returns
+// false when the query doesn't exist.
+func (g *Graph) RemoveCentralityQuery(q *Query) bool {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	k := q.key()
+	if _, ok := g.centralityIndices[k]; !ok {
+		return false
+	}
+	delete(g.centralityIndices, k)
+	return true
+}
+
+// AddShortestPathQuery registers a preset query of shortest paths. It returns
+// false when the query has already been registered.
+func (g *Graph) AddShortestPathQuery(q *Query) bool {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	k := q.key()
+	if _, ok := g.shortestPathIndices[k]; ok {
+		return false
+	}
+	g.shortestPathIndices[k] = &shortestPathIndex{query: q.clone()}
+	return true
+}
+
+// RemoveShortestPathQuery removes a preset query of shortest paths. It
+// returns false when the query doesn't exist.
+func (g *Graph) RemoveShortestPathQuery(q *Query) bool {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	k := q.key()
+	if _, ok := g.shortestPathIndices[k]; !ok {
+		return false
+	}
+	delete(g.shortestPathIndices, k)
+	return true
+}
+
+// Centrality returns the PageRank score of a node in the subgraph selected
+// by a preset query. When the graph has been modified since the scores were
+// computed, scores of the query are updated before returning.
+func (g *Graph) Centrality(id string, q *Query) (float64, error) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	c, ok := g.centralityIndices[q.key()]
+	if !ok {
+		return 0, fmt.Errorf("the centrality query isn't registered")
+	}
+	if _, ok := g.nodes[id]; !ok {
+		return 0, fmt.Errorf("node '%v' doesn't exist", id)
+	}
+	if c.version != g.version {
+		c.update(g)
+	}
+	v, ok := c.Scores[id]
+	if !ok {
+		return 0, fmt.Errorf("node '%v' doesn't match the query", id)
+	}
+	return v, nil
+}
+
+// ShortestPath returns a path from source to target in the subgraph selected
+// by a preset query. The path is approximated by the shortest one passing
+// through a landmark. It returns nil when no path having at most maxHop edges
+// is found.
+func (g *Graph) ShortestPath(source, target string, maxHop int, q *Query) ([]string, error) {
+	if maxHop <= 0 {
+		return nil, fmt.Errorf("max hop must be greater than zero")
+	}
+
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	s, ok := g.shortestPathIndices[q.key()]
+	if !ok {
+		return nil, fmt.Errorf("the shortest path query isn't registered")
+	}
+	for _, id := range []string{source, target} {
+		n, ok := g.nodes[id]
+		if !ok {
+			return nil, fmt.Errorf("node '%v' doesn't exist", id)
+		}
+		if !n.Property.matches(q.NodeQuery) {
+			return nil, fmt.Errorf("node '%v' doesn't match the query", id)
+		}
+	}
+	if source == target {
+		return []string{source}, nil
+	}
+
+	if s.version != g.version {
+		s.update(g)
+	}
+	p := s.path(source, target)
+	if len(p)-1 > maxHop {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// UpdateIndex updates all indices of preset queries.
+func (g *Graph) UpdateIndex() {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	for _, c := range g.centralityIndices {
+		if c.version != g.version {
+			c.update(g)
+		}
+	}
+	for _, s := range g.shortestPathIndices {
+		if s.version != g.version {
+			s.update(g)
+		}
+	}
+}
+
+func (q *Query) clone() *Query {
+	return &Query{
+		NodeQuery: q.NodeQuery.clone(),
+		EdgeQuery: q.EdgeQuery.clone(),
+	}
+}
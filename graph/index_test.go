@@ -0,0 +1,204 @@
+package graph
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestRemoveLoops(t *testing.T) {
+	Convey("Given paths without loops", t, func() {
+		Convey("removing loops should keep them as they are.", func() {
+			So(removeLoops([]string{}), ShouldResemble, []string{})
+			So(removeLoops([]string{"a"}), ShouldResemble, []string{"a"})
+			So(removeLoops([]string{"a", "b", "c"}), ShouldResemble, []string{"a", "b", "c"})
+		})
+	})
+
+	Convey("Given a path having a loop", t, func() {
+		Convey("removing loops should remove the nodes in the loop.", func() {
+			So(removeLoops([]string{"a", "b", "a", "c"}), ShouldResemble, []string{"a", "c"})
+			So(removeLoops([]string{"a", "b", "c", "b", "d"}), ShouldResemble, []string{"a", "b", "d"})
+		})
+	})
+
+	Convey("Given a path having overlapping loops", t, func() {
+		Convey("removing loops should remove the outermost loop.", func() {
+			So(removeLoops([]string{"a", "b", "c", "a", "b", "d"}), ShouldResemble, []string{"a", "b", "d"})
+		})
+	})
+
+	Convey("Given a path having consecutive loops", t, func() {
+		Convey("removing loops should remove all of them.", func() {
+			So(removeLoops([]string{"a", "b", "c", "d", "b", "e", "d", "f"}), ShouldResemble, []string{"a", "b", "e", "d", "f"})
+		})
+	})
+}
+
+func TestLandmarkShortestPath(t *testing.T) {
+	// createGraph creates the following graph:
+	//
+	// 0 -> 1 -> 2 -> 3
+	// |         ^
+	// +---------+
+	createGraph := func(landmarkNum int) (*Graph, []string, *Query) {
+		g, err := New(0.9, landmarkNum)
+		So(err, ShouldBeNil)
+		ns := make([]string, 4)
+		for i := range ns {
+			ns[i] = g.CreateNode()
+		}
+		for _, e := range [][2]int{{0, 1}, {1, 2}, {2, 3}, {0, 2}} {
+			_, err := g.CreateEdge(ns[e[0]], ns[e[1]], Property{})
+			So(err, ShouldBeNil)
+		}
+		q := &Query{}
+		So(g.AddShortestPathQuery(q), ShouldBeTrue)
+		return g, ns, q
+	}
+
+	Convey("Given a graph whose nodes are all landmarks", t, func() {
+		g, ns, q := createGraph(4)
+
+		Convey("shortest paths should be exact.", func() {
+			p, err := g.ShortestPath(ns[0], ns[3], 10, q)
+			So(err, ShouldBeNil)
+			So(p, ShouldResemble, []string{ns[0], ns[2], ns[3]})
+
+			p, err = g.ShortestPath(ns[1], ns[3], 10, q)
+			So(err, ShouldBeNil)
+			So(p, ShouldResemble, []string{ns[1], ns[2], ns[3]})
+
+			p, err = g.ShortestPath(ns[0], ns[1], 10, q)
+			So(err, ShouldBeNil)
+			So(p, ShouldResemble, []string{ns[0], ns[1]})
+		})
+
+		Convey("a path against edges shouldn't be found.", func() {
+			p, err := g.ShortestPath(ns[3], ns[0], 10, q)
+			So(err, ShouldBeNil)
+			So(p, ShouldBeNil)
+		})
+
+		Convey("a path having more hops than the limit shouldn't be found.", func() {
+			p, err := g.ShortestPath(ns[0], ns[3], 1, q)
+			So(err, ShouldBeNil)
+			So(p, ShouldBeNil)
+
+			p, err = g.ShortestPath(ns[0], ns[3], 2, q)
+			So(err, ShouldBeNil)
+			So(p, ShouldResemble, []string{ns[0], ns[2], ns[3]})
+		})
+	})
+
+	Convey("Given a graph having one landmark", t, func() {
+		// Node 2, which has the largest degree, is the landmark.
+		g, ns, q := createGraph(1)
+
+		Convey("paths passing through the landmark should be found.", func() {
+			p, err := g.ShortestPath(ns[0], ns[3], 10, q)
+			So(err, ShouldBeNil)
+			So(p, ShouldResemble, []string{ns[0], ns[2], ns[3]})
+
+			p, err = g.ShortestPath(ns[1], ns[3], 10, q)
+			So(err, ShouldBeNil)
+			So(p, ShouldResemble, []string{ns[1], ns[2], ns[3]})
+		})
+
+		Convey("a path not passing through the landmark shouldn't be found.", func() {
+			p, err := g.ShortestPath(ns[0], ns[1], 10, q)
+			So(err, ShouldBeNil)
+			So(p, ShouldBeNil)
+		})
+	})
+}
+
+func TestIncrementalCentrality(t *testing.T) {
+	Convey("Given a graph having a centrality index", t, func() {
+		g, err := New(0.85, 1)
+		So(err, ShouldBeNil)
+		active := Property{"active": "true"}
+		ns := make([]string, 8)
+		for i := range ns {
+			ns[i] = g.CreateNode()
+			So(g.UpdateNode(ns[i], active), ShouldBeNil)
+		}
+		// A chain 0 -> 1 -> ... -> 7 with a shortcut 0 -> 4.
+		for i := 0; i+1 < len(ns); i++ {
+			_, err := g.CreateEdge(ns[i], ns[i+1], Property{})
+			So(err, ShouldBeNil)
+		}
+		shortcut, err := g.CreateEdge(ns[0], ns[4], Property{})
+		So(err, ShouldBeNil)
+		q := &Query{NodeQuery: active}
+		So(g.AddCentralityQuery(q), ShouldBeTrue)
+		g.UpdateIndex()
+
+		Convey("when modifying the end of the chain", func() {
+			_, err := g.CreateEdge(ns[7], ns[6], Property{})
+			So(err, ShouldBeNil)
+
+			Convey("only nodes around it should be affected.", func() {
+				c := g.centralityIndices[q.key()]
+				So(g.affectedNodes(c.version), ShouldResemble, map[string]bool{
+					ns[6]: true, ns[7]: true,
+				})
+			})
+
+			Convey("scores should be same as the ones computed from scratch.", func() {
+				g.UpdateIndex()
+				So(g.centralityIndices[q.key()].Scores, shouldBeCloseToPageRank, g, q)
+			})
+		})
+
+		Convey("when removing an edge and excluding a node from the query", func() {
+			So(g.RemoveEdge(shortcut), ShouldBeTrue)
+			So(g.UpdateNode(ns[2], Property{}), ShouldBeNil)
+			n := g.CreateNode()
+			So(g.UpdateNode(n, active), ShouldBeNil)
+			_, err := g.CreateEdge(n, ns[5], Property{})
+			So(err, ShouldBeNil)
+			g.UpdateIndex()
+
+			Convey("scores should be same as the ones computed from scratch.", func() {
+				scores := g.centralityIndices[q.key()].Scores
+				So(scores, ShouldNotContainKey, ns[2])
+				So(scores, ShouldContainKey, n)
+				So(scores, shouldBeCloseToPageRank, g, q)
+			})
+		})
+	})
+}
+
+// shouldBeCloseToPageRank compares scores with PageRank of the subgraph
+// selected by a query computed by power iteration.
+func shouldBeCloseToPageRank(actual interface{}, expected ...interface{}) string {
+	scores := actual.(map[string]float64)
+	g := expected[0].(*Graph)
+	s := g.subgraph(expected[1].(*Query))
+
+	want := make(map[string]float64, len(s.nodes))
+	for _, id := range s.nodes {
+		want[id] = 1
+	}
+	for i := 0; i < 1000; i++ {
+		next := make(map[string]float64, len(s.nodes))
+		for _, id := range s.nodes {
+			v := 0.0
+			for _, src := range s.in[id] {
+				v += want[src] / float64(len(s.out[src]))
+			}
+			next[id] = (1 - g.dampingFactor) + g.dampingFactor*v
+		}
+		want = next
+	}
+
+	if msg := ShouldHaveLength(scores, len(want)); msg != "" {
+		return msg
+	}
+	for id, v := range want {
+		if msg := ShouldAlmostEqual(scores[id], v, 1e-4); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
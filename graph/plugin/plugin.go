@@ -0,0 +1,26 @@
+package plugin
+
+import (
+	"github.com/sensorbee/jubatus/graph"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+)
+
+func init() {
+	udf.MustRegisterGlobalUDSCreator("jubagraph", &graph.StateCreator{})
+
+	udf.MustRegisterGlobalUDF("jubagraph_create_node", udf.MustConvertGeneric(graph.CreateNode))
+	udf.MustRegisterGlobalUDF("jubagraph_update_node", udf.MustConvertGeneric(graph.UpdateNode))
+	udf.MustRegisterGlobalUDF("jubagraph_remove_node", udf.MustConvertGeneric(graph.RemoveNode))
+	udf.MustRegisterGlobalUDF("jubagraph_get_node", udf.MustConvertGeneric(graph.GetNode))
+	udf.MustRegisterGlobalUDF("jubagraph_create_edge", udf.MustConvertGeneric(graph.CreateEdge))
+	udf.MustRegisterGlobalUDF("jubagraph_update_edge", udf.MustConvertGeneric(graph.UpdateEdge))
+	udf.MustRegisterGlobalUDF("jubagraph_remove_edge", udf.MustConvertGeneric(graph.RemoveEdge))
+	udf.MustRegisterGlobalUDF("jubagraph_get_edge", udf.MustConvertGeneric(graph.GetEdge))
+	udf.MustRegisterGlobalUDF("jubagraph_add_centrality_query", udf.MustConvertGeneric(graph.AddCentralityQuery))
+	udf.MustRegisterGlobalUDF("jubagraph_remove_centrality_query", udf.MustConvertGeneric(graph.RemoveCentralityQuery))
+	udf.MustRegisterGlobalUDF("jubagraph_add_shortest_path_query", udf.MustConvertGeneric(graph.AddShortestPathQuery))
+	udf.MustRegisterGlobalUDF("jubagraph_remove_shortest_path_query", udf.MustConvertGeneric(graph.RemoveShortestPathQuery))
+	udf.MustRegisterGlobalUDF("jubagraph_get_centrality", udf.MustConvertGeneric(graph.GetCentrality))
+	udf.MustRegisterGlobalUDF("jubagraph_get_shortest_path", udf.MustConvertGeneric(graph.GetShortestPath))
+	udf.MustRegisterGlobalUDF("jubagraph_update_index", udf.MustConvertGeneric(graph.UpdateIndex))
+}
@@ -0,0 +1,393 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/pluginutil"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"reflect"
+)
+
+// State is a state which has a Graph. The graph is modified only by UDFs.
+type State struct {
+	graph *Graph
+}
+
+var _ core.SavableSharedState = &State{}
+
+// StateCreator is used by BQL to create or load a State as a UDS.
+type StateCreator struct {
+}
+
+var _ udf.UDSLoader = &StateCreator{}
+
+// CreateState creates a new State.
+func (c *StateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	df, err := pluginutil.ExtractParamAndConvertToFloatWithDefault(params, "damping_factor", 0.9)
+	if err != nil {
+		return nil, err
+	}
+	landmarkNum, err := pluginutil.ExtractParamAsBoundedIntWithDefault(params, "landmark_num", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := New(df, landmarkNum)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize graph: %v", err)
+	}
+	return &State{
+		graph: g,
+	}, nil
+}
+
+var (
+	graphMsgpackHandle = &codec.MsgpackHandle{
+		RawToString: true,
+	}
+)
+
+func init() {
+	graphMsgpackHandle.MapType = reflect.TypeOf(map[string]interface{}{})
+}
+
+// LoadState loads a new State.
+func (c *StateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadStateFormatV1(ctx, r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of graph State container: %v", formatVersion[0])
+	}
+}
+
+func loadStateFormatV1(ctx *core.Context, r io.Reader) (core.SharedState, error) {
+	g, err := Load(r)
+	if err != nil {
+		return nil, err
+	}
+	return &State{
+		graph: g,
+	}, nil
+}
+
+// Terminate terminates the state.
+func (*State) Terminate(ctx *core.Context) error {
+	return nil
+}
+
+// Write isn't supported. Use UDFs to modify the graph.
+func (s *State) Write(ctx *core.Context, t *core.Tuple) error {
+	return errors.New("graph state doesn't support writing tuples")
+}
+
+const (
+	graphStateFormatVersion = 1
+)
+
+// Save is provided as a part of core.SavableSharedState.
+func (s *State) Save(ctx *core.Context, w io.Writer, params data.Map) error {
+	if _, err := w.Write([]byte{graphStateFormatVersion}); err != nil {
+		return err
+	}
+	return s.graph.Save(w)
+}
+
+// CreateNode creates a node and returns its ID.
+func CreateNode(ctx *core.Context, stateName string) (string, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return "", err
+	}
+	return s.graph.CreateNode(), nil
+}
+
+// UpdateNode replaces properties of a node. Values of property must be
+// strings.
+func UpdateNode(ctx *core.Context, stateName string, nodeID string, property data.Map) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	p, err := toProperty(property)
+	if err != nil {
+		return false, err
+	}
+	if err := s.graph.UpdateNode(nodeID, p); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RemoveNode removes a node having no edges. It returns false when the node
+// doesn't exist.
+func RemoveNode(ctx *core.Context, stateName string, nodeID string) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	return s.graph.RemoveNode(nodeID)
+}
+
+// GetNode returns a map having "property", "in_edges", and "out_edges" of a
+// node.
+func GetNode(ctx *core.Context, stateName string, nodeID string) (data.Map, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	n, err := s.graph.Node(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	return data.Map{
+		"property":  fromProperty(n.Property),
+		"in_edges":  edgeIDsToArray(n.InEdges),
+		"out_edges": edgeIDsToArray(n.OutEdges),
+	}, nil
+}
+
+// CreateEdge creates an edge from source to target and returns its ID.
+// Values of property must be strings.
+func CreateEdge(ctx *core.Context, stateName string, source, target string, property data.Map) (int64, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return 0, err
+	}
+	p, err := toProperty(property)
+	if err != nil {
+		return 0, err
+	}
+	id, err := s.graph.CreateEdge(source, target, p)
+	if err != nil {
+		return 0, err
+	}
+	return int64(id), nil
+}
+
+// UpdateEdge replaces properties of an edge. Values of property must be
+// strings.
+func UpdateEdge(ctx *core.Context, stateName string, edgeID int64, property data.Map) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	p, err := toProperty(property)
+	if err != nil {
+		return false, err
+	}
+	if err := s.graph.UpdateEdge(uint64(edgeID), p); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RemoveEdge removes an edge. It returns false when the edge doesn't exist.
+func RemoveEdge(ctx *core.Context, stateName string, edgeID int64) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	return s.graph.RemoveEdge(uint64(edgeID)), nil
+}
+
+// GetEdge returns a map having "property", "source", and "target" of an
+// edge.
+func GetEdge(ctx *core.Context, stateName string, edgeID int64) (data.Map, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	e, err := s.graph.Edge(uint64(edgeID))
+	if err != nil {
+		return nil, err
+	}
+	return data.Map{
+		"property": fromProperty(e.Property),
+		"source":   data.String(e.Source),
+		"target":   data.String(e.Target),
+	}, nil
+}
+
+// AddCentralityQuery registers a preset query of centrality. query is a map
+// which can have "node_query" and "edge_query". Each of them is a map from
+// property keys to values which selected nodes or edges must have.
+func AddCentralityQuery(ctx *core.Context, stateName string, query data.Map) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	q, err := toQuery(query)
+	if err != nil {
+		return false, err
+	}
+	return s.graph.AddCentralityQuery(q), nil
+}
+
+// RemoveCentralityQuery removes a preset query of centrality.
+func RemoveCentralityQuery(ctx *core.Context, stateName string, query data.Map) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	q, err := toQuery(query)
+	if err != nil {
+		return false, err
+	}
+	return s.graph.RemoveCentralityQuery(q), nil
+}
+
+// AddShortestPathQuery registers a preset query of shortest paths. query has
+// the same form as the one of AddCentralityQuery.
+func AddShortestPathQuery(ctx *core.Context, stateName string, query data.Map) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	q, err := toQuery(query)
+	if err != nil {
+		return false, err
+	}
+	return s.graph.AddShortestPathQuery(q), nil
+}
+
+// RemoveShortestPathQuery removes a preset query of shortest paths.
+func RemoveShortestPathQuery(ctx *core.Context, stateName string, query data.Map) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	q, err := toQuery(query)
+	if err != nil {
+		return false, err
+	}
+	return s.graph.RemoveShortestPathQuery(q), nil
+}
+
+// GetCentrality returns the PageRank score of a node in the subgraph selected
+// by a preset query. The first call after the graph is modified updates
+// scores of the query around modified nodes. Call jubagraph_update_index in
+// advance to avoid the latency.
+func GetCentrality(ctx *core.Context, stateName string, nodeID string, query data.Map) (float64, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return 0, err
+	}
+	q, err := toQuery(query)
+	if err != nil {
+		return 0, err
+	}
+	return s.graph.Centrality(nodeID, q)
+}
+
+// GetShortestPath returns an array of node IDs on a path from source to
+// target in the subgraph selected by a preset query. It returns an empty
+// array when no path having at most maxHop edges is found.
+func GetShortestPath(ctx *core.Context, stateName string, source, target string, maxHop int, query data.Map) (data.Array, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	q, err := toQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.graph.ShortestPath(source, target, maxHop, q)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(data.Array, len(p))
+	for i, id := range p {
+		ret[i] = data.String(id)
+	}
+	return ret, nil
+}
+
+// UpdateIndex updates indices of all preset queries which are outdated.
+// Indices are also updated when they're used after the graph is modified.
+func UpdateIndex(ctx *core.Context, stateName string) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	s.graph.UpdateIndex()
+	return true, nil
+}
+
+func toProperty(m data.Map) (Property, error) {
+	p := make(Property, len(m))
+	for k, v := range m {
+		s, err := data.AsString(v)
+		if err != nil {
+			return nil, fmt.Errorf("value of property '%v' is not a string: %v", k, err)
+		}
+		p[k] = s
+	}
+	return p, nil
+}
+
+func fromProperty(p Property) data.Map {
+	ret := make(data.Map, len(p))
+	for k, v := range p {
+		ret[k] = data.String(v)
+	}
+	return ret
+}
+
+func toQuery(m data.Map) (*Query, error) {
+	q := &Query{
+		NodeQuery: Property{},
+		EdgeQuery: Property{},
+	}
+	for k, v := range m {
+		var dst *Property
+		switch k {
+		case "node_query":
+			dst = &q.NodeQuery
+		case "edge_query":
+			dst = &q.EdgeQuery
+		default:
+			return nil, fmt.Errorf("invalid query key: %v", k)
+		}
+
+		pm, err := data.AsMap(v)
+		if err != nil {
+			return nil, fmt.Errorf("%v is not a map: %v", k, err)
+		}
+		p, err := toProperty(pm)
+		if err != nil {
+			return nil, err
+		}
+		*dst = p
+	}
+	return q, nil
+}
+
+func edgeIDsToArray(ids []uint64) data.Array {
+	ret := make(data.Array, len(ids))
+	for i, id := range ids {
+		ret[i] = data.Int(id)
+	}
+	return ret
+}
+
+func lookupState(ctx *core.Context, stateName string) (*State, error) {
+	st, err := ctx.SharedStates.Get(stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := st.(*State); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("state '%v' isn't a graph state", stateName)
+}
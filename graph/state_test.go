@@ -0,0 +1,172 @@
+package graph
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestGraphState(t *testing.T) {
+	Convey("Given a graph state", t, func() {
+		ctx := core.NewContext(nil)
+		c := StateCreator{}
+		ss, err := c.CreateState(ctx, data.Map{})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("graph", "jubagraph", ss), ShouldBeNil)
+		s := ss.(*State)
+
+		ns := make([]string, 4)
+		for i := range ns {
+			ns[i], err = CreateNode(ctx, "graph")
+			So(err, ShouldBeNil)
+		}
+		edges := []struct {
+			source, target int
+			typ            string
+		}{
+			{0, 1, "long"},
+			{1, 2, "long"},
+			{2, 3, "long"},
+			{0, 2, "short"},
+		}
+		for _, e := range edges {
+			_, err := CreateEdge(ctx, "graph", ns[e.source], ns[e.target], data.Map{"type": data.String(e.typ)})
+			So(err, ShouldBeNil)
+		}
+
+		all := data.Map{}
+		long := data.Map{"edge_query": data.Map{"type": data.String("long")}}
+		for _, q := range []data.Map{all, long} {
+			added, err := AddCentralityQuery(ctx, "graph", q)
+			So(err, ShouldBeNil)
+			So(added, ShouldBeTrue)
+			added, err = AddShortestPathQuery(ctx, "graph", q)
+			So(err, ShouldBeNil)
+			So(added, ShouldBeTrue)
+		}
+
+		Convey("when getting a node", func() {
+			n, err := GetNode(ctx, "graph", ns[2])
+			So(err, ShouldBeNil)
+
+			Convey("it should have its edges.", func() {
+				So(len(n["in_edges"].(data.Array)), ShouldEqual, 2)
+				So(len(n["out_edges"].(data.Array)), ShouldEqual, 1)
+
+				e, err := GetEdge(ctx, "graph", int64(n["out_edges"].(data.Array)[0].(data.Int)))
+				So(err, ShouldBeNil)
+				So(e["source"], ShouldEqual, data.String(ns[2]))
+				So(e["target"], ShouldEqual, data.String(ns[3]))
+				So(e["property"], ShouldResemble, data.Map{"type": data.String("long")})
+			})
+		})
+
+		Convey("when getting centrality", func() {
+			Convey("a node without incoming edges should have the minimum score.", func() {
+				v, err := GetCentrality(ctx, "graph", ns[0], all)
+				So(err, ShouldBeNil)
+				So(v, ShouldAlmostEqual, 0.1)
+			})
+
+			Convey("a node having more incoming edges should have a higher score.", func() {
+				v1, err := GetCentrality(ctx, "graph", ns[1], all)
+				So(err, ShouldBeNil)
+				v2, err := GetCentrality(ctx, "graph", ns[2], all)
+				So(err, ShouldBeNil)
+				So(v2, ShouldBeGreaterThan, v1)
+			})
+
+			Convey("it should be updated after modifying the graph.", func() {
+				before, err := GetCentrality(ctx, "graph", ns[1], all)
+				So(err, ShouldBeNil)
+				_, err = CreateEdge(ctx, "graph", ns[3], ns[1], data.Map{})
+				So(err, ShouldBeNil)
+				after, err := GetCentrality(ctx, "graph", ns[1], all)
+				So(err, ShouldBeNil)
+				So(after, ShouldBeGreaterThan, before)
+			})
+
+			Convey("an unregistered query should fail.", func() {
+				_, err := GetCentrality(ctx, "graph", ns[1], data.Map{"node_query": data.Map{"a": data.String("b")}})
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("when getting shortest paths", func() {
+			Convey("it should use all edges selected by the query.", func() {
+				p, err := GetShortestPath(ctx, "graph", ns[0], ns[3], 10, all)
+				So(err, ShouldBeNil)
+				So(p, ShouldResemble, data.Array{data.String(ns[0]), data.String(ns[2]), data.String(ns[3])})
+
+				p, err = GetShortestPath(ctx, "graph", ns[0], ns[3], 10, long)
+				So(err, ShouldBeNil)
+				So(p, ShouldResemble, data.Array{data.String(ns[0]), data.String(ns[1]), data.String(ns[2]), data.String(ns[3])})
+			})
+
+			Convey("it should return an empty path when it's too long.", func() {
+				p, err := GetShortestPath(ctx, "graph", ns[0], ns[3], 2, long)
+				So(err, ShouldBeNil)
+				So(p, ShouldBeEmpty)
+			})
+
+			Convey("it should return an empty path when it doesn't exist.", func() {
+				p, err := GetShortestPath(ctx, "graph", ns[3], ns[0], 10, all)
+				So(err, ShouldBeNil)
+				So(p, ShouldBeEmpty)
+			})
+		})
+
+		Convey("when removing a node having edges", func() {
+			_, err := RemoveNode(ctx, "graph", ns[0])
+
+			Convey("it should fail.", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("when removing edges", func() {
+			n, err := GetNode(ctx, "graph", ns[3])
+			So(err, ShouldBeNil)
+			removed, err := RemoveEdge(ctx, "graph", int64(n["in_edges"].(data.Array)[0].(data.Int)))
+			So(err, ShouldBeNil)
+			So(removed, ShouldBeTrue)
+
+			Convey("the node should be removable.", func() {
+				removed, err := RemoveNode(ctx, "graph", ns[3])
+				So(err, ShouldBeNil)
+				So(removed, ShouldBeTrue)
+				_, err = GetNode(ctx, "graph", ns[3])
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("when saving and loading the state", func() {
+			v, err := GetCentrality(ctx, "graph", ns[2], long)
+			So(err, ShouldBeNil)
+
+			buf := bytes.NewBuffer(nil)
+			So(s.Save(ctx, buf, data.Map{}), ShouldBeNil)
+			s2, err := c.LoadState(ctx, buf, data.Map{})
+			So(err, ShouldBeNil)
+			g2 := s2.(*State).graph
+
+			Convey("the loaded state should be same.", func() {
+				So(g2.nodes, ShouldResemble, s.graph.nodes)
+				So(g2.edges, ShouldResemble, s.graph.edges)
+				So(g2.nextID, ShouldEqual, s.graph.nextID)
+
+				q, err := toQuery(long)
+				So(err, ShouldBeNil)
+				v2, err := g2.Centrality(ns[2], q)
+				So(err, ShouldBeNil)
+				So(v2, ShouldAlmostEqual, v)
+
+				p, err := g2.ShortestPath(ns[0], ns[3], 10, q)
+				So(err, ShouldBeNil)
+				So(p, ShouldResemble, []string{ns[0], ns[1], ns[2], ns[3]})
+			})
+		})
+	})
+}
@@ -0,0 +1,269 @@
+package fvconverter
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// Config is a configuration of Converter. It's compatible with fv_converter
+// of Jubatus except that plugins and filters aren't supported.
+type Config struct {
+	_struct struct{} `codec:",toarray"`
+
+	// StringTypes defines string types used in StringRules. Each type has
+	// "method" and parameters of the method. Methods are "ngram" having
+	// "char_num" and "regexp" having "pattern" and optional "group".
+	StringTypes map[string]map[string]string
+	StringRules []*StringRule
+
+	// NumTypes defines aliases of num types. Each type has "method" which
+	// is "num", "log", or "str".
+	NumTypes map[string]map[string]string
+	NumRules []*NumRule
+}
+
+// StringRule is a rule applied to string values.
+type StringRule struct {
+	_struct struct{} `codec:",toarray"`
+
+	// Key is a pattern of keys to which the rule is applied. "*" matches
+	// all keys, "prefix*" and "*suffix" match keys having the prefix or the
+	// suffix, "/regexp/" matches keys matching the regular expression, and
+	// other patterns only match the same key.
+	Key string
+
+	// Except is a pattern of keys to which the rule isn't applied. It can
+	// be empty.
+	Except string
+
+	// Type is "str", "space", or a type defined in StringTypes.
+	Type string
+
+	// SampleWeight is "bin", "tf", or "log_tf".
+	SampleWeight string
+
+	// GlobalWeight is "bin", "idf", or "bm25".
+	GlobalWeight string
+}
+
+// NumRule is a rule applied to numeric values.
+type NumRule struct {
+	_struct struct{} `codec:",toarray"`
+
+	// Key and Except are same as the ones of StringRule.
+	Key    string
+	Except string
+
+	// Type is "num", "log", "str", or a type defined in NumTypes.
+	Type string
+}
+
+// TokenizerRule is a rule tokenizing string values when a Converter flattens
+// a datum without Config.
+type TokenizerRule struct {
+	_struct struct{} `codec:",toarray"`
+
+	// Key and Except are same as the ones of StringRule.
+	Key    string
+	Except string
+
+	// Params has "method" and parameters of the method. Methods are "ngram"
+	// having "char_num", "regexp" having "pattern" and optional "group",
+	// "space" splitting by white spaces, and "word" splitting by white
+	// spaces and punctuations.
+	Params map[string]string
+
+	// SampleWeight is "bin", "tf", or "log_tf".
+	SampleWeight string
+
+	// GlobalWeight is "bin", "idf", or "bm25".
+	GlobalWeight string
+}
+
+// ParseConfig parses a configuration written in the same form as the one of
+// Jubatus:
+//
+//	{
+//	  "string_types": {"bigram": {"method": "ngram", "char_num": "2"}},
+//	  "string_rules": [
+//	    {"key": "*", "type": "bigram", "sample_weight": "tf", "global_weight": "idf"}
+//	  ],
+//	  "num_rules": [{"key": "*", "type": "num"}]
+//	}
+//
+// Parameters of types can also be integers.
+func ParseConfig(m data.Map) (*Config, error) {
+	c := &Config{
+		StringTypes: map[string]map[string]string{},
+		NumTypes:    map[string]map[string]string{},
+	}
+	for k, v := range m {
+		var err error
+		switch k {
+		case "string_types":
+			c.StringTypes, err = parseTypes(k, v)
+		case "string_rules":
+			err = parseRules(k, v, func(r data.Map) error {
+				sr := &StringRule{}
+				if err := extractStrings(r, map[string]*string{
+					"key":           &sr.Key,
+					"except":        &sr.Except,
+					"type":          &sr.Type,
+					"sample_weight": &sr.SampleWeight,
+					"global_weight": &sr.GlobalWeight,
+				}, "except"); err != nil {
+					return err
+				}
+				c.StringRules = append(c.StringRules, sr)
+				return nil
+			})
+		case "num_types":
+			c.NumTypes, err = parseTypes(k, v)
+		case "num_rules":
+			err = parseRules(k, v, func(r data.Map) error {
+				nr := &NumRule{}
+				if err := extractStrings(r, map[string]*string{
+					"key":    &nr.Key,
+					"except": &nr.Except,
+					"type":   &nr.Type,
+				}, "except"); err != nil {
+					return err
+				}
+				c.NumRules = append(c.NumRules, nr)
+				return nil
+			})
+		default:
+			return nil, fmt.Errorf("unsupported converter config: %v", k)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func parseTypes(name string, v data.Value) (map[string]map[string]string, error) {
+	m, err := data.AsMap(v)
+	if err != nil {
+		return nil, fmt.Errorf("%v is not a map: %v", name, err)
+	}
+	ret := make(map[string]map[string]string, len(m))
+	for t, v := range m {
+		pm, err := data.AsMap(v)
+		if err != nil {
+			return nil, fmt.Errorf("%v of %v is not a map: %v", t, name, err)
+		}
+		ps := make(map[string]string, len(pm))
+		for k, v := range pm {
+			s, err := data.ToString(v)
+			if err != nil {
+				return nil, fmt.Errorf("%v of %v of %v is not a string: %v", k, t, name, err)
+			}
+			ps[k] = s
+		}
+		ret[t] = ps
+	}
+	return ret, nil
+}
+
+func parseRules(name string, v data.Value, parse func(r data.Map) error) error {
+	a, err := data.AsArray(v)
+	if err != nil {
+		return fmt.Errorf("%v is not an array: %v", name, err)
+	}
+	for i, v := range a {
+		r, err := data.AsMap(v)
+		if err != nil {
+			return fmt.Errorf("rule %v of %v is not a map: %v", i, name, err)
+		}
+		if err := parse(r); err != nil {
+			return fmt.Errorf("rule %v of %v is invalid: %v", i, name, err)
+		}
+	}
+	return nil
+}
+
+// extractStrings extracts values of keys from m. Keys other than optional
+// ones must exist.
+func extractStrings(m data.Map, keys map[string]*string, optional ...string) error {
+	for k := range m {
+		if _, ok := keys[k]; !ok {
+			return fmt.Errorf("unsupported key: %v", k)
+		}
+	}
+	for k, dst := range keys {
+		v, ok := m[k]
+		if !ok {
+			if isOneOf(k, optional) {
+				continue
+			}
+			return fmt.Errorf("%v is missing", k)
+		}
+		s, err := data.AsString(v)
+		if err != nil {
+			return fmt.Errorf("%v is not a string: %v", k, err)
+		}
+		*dst = s
+	}
+	return nil
+}
+
+func isOneOf(s string, ss []string) bool {
+	for _, x := range ss {
+		if s == x {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTokenizerRules parses an array of tokenizer rules:
+//
+//	[
+//	  {"key": "title", "method": "ngram", "char_num": 2, "sample_weight": "tf"},
+//	  {"key": "*", "method": "word", "global_weight": "idf"}
+//	]
+//
+// "except" is optional, "sample_weight" is "tf" by default, and
+// "global_weight" is "bin" by default. Other keys are parameters of the
+// method.
+func ParseTokenizerRules(v data.Value) ([]*TokenizerRule, error) {
+	var rules []*TokenizerRule
+	if err := parseRules("tokenizers", v, func(r data.Map) error {
+		tr := &TokenizerRule{
+			Params:       map[string]string{},
+			SampleWeight: "tf",
+			GlobalWeight: "bin",
+		}
+		for k, v := range r {
+			s, err := data.ToString(v)
+			if err != nil {
+				return fmt.Errorf("%v is not a string: %v", k, err)
+			}
+			switch k {
+			case "key":
+				tr.Key = s
+			case "except":
+				tr.Except = s
+			case "sample_weight":
+				tr.SampleWeight = s
+			case "global_weight":
+				tr.GlobalWeight = s
+			default:
+				tr.Params[k] = s
+			}
+		}
+		if tr.Key == "" {
+			return errors.New("key is missing")
+		}
+		if _, ok := tr.Params["method"]; !ok {
+			return errors.New("method is missing")
+		}
+		rules = append(rules, tr)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
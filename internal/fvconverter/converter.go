@@ -0,0 +1,600 @@
+package fvconverter
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/nested"
+	"github.com/sensorbee/jubatus/internal/pluginutil"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// Converter converts a datum into a flat feature vector by rules compatible
+// with fv_converter of Jubatus. Keys of nested values are joined by "\x00".
+//
+// A string value v of a key k is split into terms by each matching string
+// rule, and each term t becomes a feature "k$t@type#sample_weight/global_weight".
+// A numeric value v of a key k becomes "k@num" having v, "k@log" having
+// log(max(1, v)), or "k$v@str" having 1. Values without matching rules are
+// ignored.
+//
+// A Converter without a config flattens a datum by nested.Flattener instead.
+// String values of keys matching tokenizer rules are tokenized by the
+// flattener and other values are converted according to the flatten mode.
+// Terms of tokenizer rules having global weights other than "bin" are
+// weighted in the same way as the ones of string rules. A nil Converter is
+// valid and returns the datum as it is.
+type Converter struct {
+	// config is nil when rules aren't used.
+	config     *Config
+	mode       nested.Mode
+	tokenizers []*TokenizerRule
+	flattener  *nested.Flattener
+	// globalWeights has global weights of text rules of the flattener
+	// other than "bin".
+	globalWeights map[*nested.TextRule]string
+
+	stringRules []*stringRule
+	numRules    []*numRule
+
+	weights *weightManager
+	m       sync.RWMutex
+}
+
+type stringRule struct {
+	match        matcher
+	tokenizer    nested.Tokenizer
+	name         string
+	sampleWeight string
+	termWeight   nested.TermWeight
+	globalWeight string
+}
+
+type numRule struct {
+	match  matcher
+	method string
+	name   string
+}
+
+// New creates a Converter from a config. When c is nil, the Converter
+// flattens a datum with mode and tokenizers.
+func New(c *Config, mode nested.Mode, tokenizers []*TokenizerRule) (*Converter, error) {
+	conv := &Converter{
+		config:     c,
+		mode:       mode,
+		tokenizers: tokenizers,
+		weights:    newWeightManager(),
+	}
+	if c == nil {
+		conv.flattener = &nested.Flattener{Mode: mode}
+		conv.globalWeights = map[*nested.TextRule]string{}
+		for _, r := range tokenizers {
+			m, err := newRuleMatcher(r.Key, r.Except)
+			if err != nil {
+				return nil, err
+			}
+			t, err := newMethodTokenizer(fmt.Sprintf("tokenizer of '%v'", r.Key), r.Params)
+			if err != nil {
+				return nil, err
+			}
+			w, err := parseSampleWeight(r.SampleWeight)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkGlobalWeight(r.GlobalWeight); err != nil {
+				return nil, err
+			}
+			tr := &nested.TextRule{
+				Match:     m,
+				Tokenizer: t,
+				Weight:    w,
+			}
+			conv.flattener.TextRules = append(conv.flattener.TextRules, tr)
+			if r.GlobalWeight != "bin" {
+				conv.globalWeights[tr] = r.GlobalWeight
+			}
+		}
+		return conv, nil
+	}
+	if mode != nested.NumericMode {
+		return nil, errors.New("flatten mode cannot be used with converter rules")
+	}
+	if len(tokenizers) > 0 {
+		return nil, errors.New("tokenizers cannot be used with converter rules")
+	}
+
+	for _, r := range c.StringRules {
+		m, err := newRuleMatcher(r.Key, r.Except)
+		if err != nil {
+			return nil, err
+		}
+		t, err := newTokenizer(r.Type, c.StringTypes)
+		if err != nil {
+			return nil, err
+		}
+		w, err := parseSampleWeight(r.SampleWeight)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkGlobalWeight(r.GlobalWeight); err != nil {
+			return nil, err
+		}
+		conv.stringRules = append(conv.stringRules, &stringRule{
+			match:        m,
+			tokenizer:    t,
+			name:         r.Type,
+			sampleWeight: r.SampleWeight,
+			termWeight:   w,
+			globalWeight: r.GlobalWeight,
+		})
+	}
+
+	for _, r := range c.NumRules {
+		m, err := newRuleMatcher(r.Key, r.Except)
+		if err != nil {
+			return nil, err
+		}
+		method := r.Type
+		if t, ok := c.NumTypes[r.Type]; ok {
+			method = t["method"]
+		}
+		switch method {
+		case "num", "log", "str":
+		default:
+			return nil, fmt.Errorf("invalid num type: %v", r.Type)
+		}
+		conv.numRules = append(conv.numRules, &numRule{
+			match:  m,
+			method: method,
+			name:   r.Type,
+		})
+	}
+	return conv, nil
+}
+
+func checkGlobalWeight(s string) error {
+	switch s {
+	case "bin", "idf", "bm25":
+		return nil
+	default:
+		return fmt.Errorf("invalid global_weight: %v", s)
+	}
+}
+
+// ExtractParams creates a Converter from "converter", "flatten_mode", and
+// "tokenizers" parameters. "converter" is a config parsed by ParseConfig.
+// "flatten_mode" is "numeric" or "categorical". "tokenizers" is an array
+// parsed by ParseTokenizerRules. Neither "flatten_mode" nor "tokenizers" can
+// be used with "converter". It returns nil when none of them is given or
+// only the default mode is given.
+//
+// Document frequencies for global weights are kept in dimensions hashed by
+// "hash_max_size" when it's given. "df_max_size" limits the number of
+// dimensions having document frequencies. Dimensions having the smallest
+// frequencies are removed when the limit is exceeded.
+func ExtractParams(params data.Map) (*Converter, error) {
+	modeName, err := pluginutil.ExtractParamAsStringWithDefault(params, "flatten_mode", "numeric")
+	if err != nil {
+		return nil, err
+	}
+	var mode nested.Mode
+	switch modeName {
+	case "numeric":
+		mode = nested.NumericMode
+	case "categorical":
+		mode = nested.CategoricalMode
+	default:
+		return nil, fmt.Errorf("invalid flatten_mode: %v", modeName)
+	}
+
+	var tokenizers []*TokenizerRule
+	if v, ok := params["tokenizers"]; ok {
+		if tokenizers, err = ParseTokenizerRules(v); err != nil {
+			return nil, fmt.Errorf("tokenizers parameter is invalid: %v", err)
+		}
+	}
+
+	hashMaxSize, err := pluginutil.ExtractParamAsBoundedIntWithDefault(params, "hash_max_size", 0)
+	if err != nil {
+		return nil, err
+	}
+	if hashMaxSize < 0 {
+		return nil, errors.New("hash_max_size parameter must not be less than zero")
+	}
+	dfMaxSize, err := pluginutil.ExtractParamAsBoundedIntWithDefault(params, "df_max_size", 0)
+	if err != nil {
+		return nil, err
+	}
+	if dfMaxSize < 0 {
+		return nil, errors.New("df_max_size parameter must not be less than zero")
+	}
+
+	var conv *Converter
+	if v, ok := params["converter"]; !ok {
+		if mode == nested.NumericMode && len(tokenizers) == 0 {
+			return nil, nil
+		}
+		conv, err = New(nil, mode, tokenizers)
+		if err != nil {
+			return nil, fmt.Errorf("tokenizers parameter is invalid: %v", err)
+		}
+	} else {
+		m, err := data.AsMap(v)
+		if err != nil {
+			return nil, fmt.Errorf("converter parameter is not a map: %v", err)
+		}
+		c, err := ParseConfig(m)
+		if err != nil {
+			return nil, fmt.Errorf("converter parameter is invalid: %v", err)
+		}
+		conv, err = New(c, mode, tokenizers)
+		if err != nil {
+			return nil, fmt.Errorf("converter parameter is invalid: %v", err)
+		}
+	}
+	conv.setDFLimits(hashMaxSize, dfMaxSize)
+	return conv, nil
+}
+
+// Convert converts a datum into a feature vector. It doesn't update document
+// frequencies, so it's used to convert a datum for prediction.
+func (c *Converter) Convert(d data.Map) (data.Map, error) {
+	if c == nil {
+		return d, nil
+	}
+
+	c.m.RLock()
+	defer c.m.RUnlock()
+	return c.convert(d, nil)
+}
+
+// ConvertAndUpdate converts a datum into a feature vector and updates
+// document frequencies with it, so it's used to convert a datum for training.
+func (c *Converter) ConvertAndUpdate(d data.Map) (data.Map, error) {
+	if c == nil {
+		return d, nil
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	doc := &Document{}
+	fv, err := c.convert(d, doc)
+	if err != nil {
+		return nil, err
+	}
+	c.weights.update(doc)
+	return fv, nil
+}
+
+// ConvertForUpdate converts a datum into a feature vector for training
+// without updating document frequencies. The feature vector is weighted as
+// if the datum had already been counted. Document frequencies are updated
+// by passing the returned Document to Update, so that they can be left
+// unchanged when training with the feature vector fails.
+func (c *Converter) ConvertForUpdate(d data.Map) (data.Map, *Document, error) {
+	if c == nil {
+		return d, nil, nil
+	}
+
+	c.m.RLock()
+	defer c.m.RUnlock()
+	doc := &Document{}
+	fv, err := c.convert(d, doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fv, doc, nil
+}
+
+// Update adds a Document returned by ConvertForUpdate of the same Converter
+// to document frequencies. It does nothing when c or doc is nil.
+func (c *Converter) Update(doc *Document) {
+	if c == nil || doc == nil {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.weights.update(doc)
+}
+
+type stringValue struct {
+	key   string
+	value string
+}
+
+type numValue struct {
+	key   string
+	value float64
+}
+
+// convert converts d. When doc isn't nil, features are weighted as if d has
+// already been added to document frequencies and doc is filled to add it
+// later. It requires read lock.
+func (c *Converter) convert(d data.Map, doc *Document) (data.Map, error) {
+	if c.config == nil {
+		return c.flatten(d, doc)
+	}
+
+	var (
+		strs []stringValue
+		nums []numValue
+	)
+	if err := walk("", d, func(key string, v data.Value) error {
+		switch v.Type() {
+		case data.TypeString:
+			s, _ := data.AsString(v)
+			strs = append(strs, stringValue{key, s})
+		case data.TypeInt, data.TypeFloat, data.TypeBool:
+			x, _ := data.ToFloat(v)
+			nums = append(nums, numValue{key, x})
+		case data.TypeNull:
+		default:
+			return fmt.Errorf("value of %v has an unsupported type: %v", key, v.Type())
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	ret := data.Map{}
+	add := func(k string, x float64) {
+		if v, ok := ret[k]; ok {
+			y, _ := data.AsFloat(v)
+			x += y
+		}
+		ret[k] = data.Float(x)
+	}
+
+	// weighted has features having global weights other than bin and
+	// their global weights.
+	weighted := map[string]*globalTerm{}
+	length := 0.0
+	for _, s := range strs {
+		for _, r := range c.stringRules {
+			if !r.match(s.key) {
+				continue
+			}
+			tf := map[string]int{}
+			for _, t := range r.tokenizer.Tokenize(s.value) {
+				tf[t]++
+			}
+			for t, n := range tf {
+				k := s.key + "$" + t + "@" + r.name + "#" + r.sampleWeight + "/" + r.globalWeight
+				x := r.termWeight.Weight(n)
+				if r.globalWeight == "bin" {
+					add(k, x)
+					continue
+				}
+				if g, ok := weighted[k]; ok {
+					g.x += x
+				} else {
+					weighted[k] = &globalTerm{x: x, method: r.globalWeight}
+				}
+				length += x
+			}
+		}
+	}
+
+	c.applyGlobalWeights(weighted, length, doc, add)
+
+	for _, n := range nums {
+		for _, r := range c.numRules {
+			if !r.match(n.key) {
+				continue
+			}
+			switch r.method {
+			case "num":
+				add(n.key+"@"+r.name, n.value)
+			case "log":
+				add(n.key+"@"+r.name, math.Log(math.Max(1, n.value)))
+			case "str":
+				add(n.key+"$"+strconv.FormatFloat(n.value, 'g', -1, 64)+"@"+r.name, 1)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// flatten converts d by the flattener. doc is used in the same way as
+// convert. It requires read lock.
+func (c *Converter) flatten(d data.Map, doc *Document) (data.Map, error) {
+	ret := data.Map{}
+	add := func(k string, x float64) {
+		if v, ok := ret[k]; ok {
+			y, _ := data.AsFloat(v)
+			x += y
+		}
+		ret[k] = data.Float(x)
+	}
+
+	weighted := map[string]*globalTerm{}
+	length := 0.0
+	if err := c.flattener.FlattenText(d, func(k string, x float32) {
+		add(k, float64(x))
+	}, func(r *nested.TextRule, k string, x float32) {
+		g, ok := c.globalWeights[r]
+		if !ok {
+			add(k, float64(x))
+			return
+		}
+		// Multiple rules can give the same key. Their weights are summed
+		// as convert does, and the global weight of the first rule is used.
+		if t, ok := weighted[k]; ok {
+			t.x += float64(x)
+		} else {
+			weighted[k] = &globalTerm{x: float64(x), method: g}
+		}
+		length += float64(x)
+	}); err != nil {
+		return nil, err
+	}
+
+	c.applyGlobalWeights(weighted, length, doc, add)
+	return ret, nil
+}
+
+type globalTerm struct {
+	x      float64
+	method string
+}
+
+// applyGlobalWeights adds features in weighted to a feature vector by add
+// after multiplying their global weights. length is the length of the
+// document. When doc isn't nil, the document is regarded as already added to
+// document frequencies and its keys and length are set to doc.
+func (c *Converter) applyGlobalWeights(weighted map[string]*globalTerm, length float64, doc *Document, add func(k string, x float64)) {
+	pending := doc != nil
+	if pending {
+		doc.keys = make([]string, 0, len(weighted))
+		for k := range weighted {
+			doc.keys = append(doc.keys, k)
+		}
+		doc.length = length
+	}
+	for k, g := range weighted {
+		switch g.method {
+		case "idf":
+			add(k, g.x*c.weights.idf(k, pending))
+		case "bm25":
+			add(k, c.weights.bm25(k, g.x, length, pending))
+		}
+	}
+}
+
+// walk calls f with every leaf value in v. Keys of nested values are joined
+// by "\x00" and elements of arrays have their indices as keys.
+func walk(key string, v data.Value, f func(key string, v data.Value) error) error {
+	prefix := key
+	if prefix != "" {
+		prefix += "\x00"
+	}
+
+	switch v.Type() {
+	case data.TypeMap:
+		m, _ := data.AsMap(v)
+		for k, e := range m {
+			if err := walk(prefix+k, e, f); err != nil {
+				return err
+			}
+		}
+	case data.TypeArray:
+		a, _ := data.AsArray(v)
+		for i, e := range a {
+			if err := walk(prefix+strconv.Itoa(i), e, f); err != nil {
+				return err
+			}
+		}
+	default:
+		return f(key, v)
+	}
+	return nil
+}
+
+const (
+	converterFormatVersion uint8 = 1
+)
+
+var (
+	converterMsgpackHandle = &codec.MsgpackHandle{
+		RawToString: true,
+	}
+)
+
+func init() {
+	converterMsgpackHandle.MapType = reflect.TypeOf(map[string]interface{}{})
+}
+
+type converterMsgpack struct {
+	_struct struct{} `codec:",toarray"`
+
+	// Config is nil when the Converter is nil or doesn't have rules.
+	Config      *Config
+	Weights     *weightManager
+	FlattenMode nested.Mode
+	Tokenizers  []*TokenizerRule
+	HashMaxSize int
+	DFMaxSize   int
+}
+
+// Save saves the config and document frequencies of Converter. A nil
+// Converter can also be saved.
+func (c *Converter) Save(w io.Writer) error {
+	if _, err := w.Write([]byte{converterFormatVersion}); err != nil {
+		return err
+	}
+
+	m := &converterMsgpack{}
+	if c != nil {
+		c.m.RLock()
+		defer c.m.RUnlock()
+		m.Config = c.config
+		m.Weights = c.weights
+		m.FlattenMode = c.mode
+		m.Tokenizers = c.tokenizers
+		m.HashMaxSize = c.weights.hashMaxSize
+		m.DFMaxSize = c.weights.maxSize
+	}
+	enc := codec.NewEncoder(w, converterMsgpackHandle)
+	return enc.Encode(m)
+}
+
+// Load loads Converter from the saved data. It returns nil when a nil
+// Converter was saved.
+func Load(r io.Reader) (*Converter, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadFormatV1(r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of Converter container: %v", formatVersion[0])
+	}
+}
+
+func loadFormatV1(r io.Reader) (*Converter, error) {
+	var m converterMsgpack
+	dec := codec.NewDecoder(r, converterMsgpackHandle)
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	if m.Config == nil && m.FlattenMode == nested.NumericMode && len(m.Tokenizers) == 0 {
+		return nil, nil
+	}
+
+	c, err := New(m.Config, m.FlattenMode, m.Tokenizers)
+	if err != nil {
+		return nil, err
+	}
+	c.setWeights(m.Weights)
+	c.setDFLimits(m.HashMaxSize, m.DFMaxSize)
+	return c, nil
+}
+
+func (c *Converter) setWeights(w *weightManager) {
+	if w == nil {
+		return
+	}
+	c.weights = w
+	if c.weights.DF == nil {
+		c.weights.DF = make(map[string]uint64)
+	}
+}
+
+// setDFLimits sets the hash size and the max number of dimensions of
+// document frequencies. It does nothing when c is nil.
+func (c *Converter) setDFLimits(hashMaxSize, maxSize int) {
+	if c == nil {
+		return
+	}
+	c.weights.hashMaxSize = hashMaxSize
+	c.weights.maxSize = maxSize
+}
@@ -0,0 +1,420 @@
+package fvconverter
+
+import (
+	"bytes"
+	"github.com/sensorbee/jubatus/internal/nested"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"testing"
+)
+
+func TestConverter(t *testing.T) {
+	Convey("Given a converter", t, func() {
+		c, err := ExtractParams(data.Map{
+			"converter": data.Map{
+				"string_types": data.Map{
+					"bigram": data.Map{"method": data.String("ngram"), "char_num": data.Int(2)},
+					"word":   data.Map{"method": data.String("regexp"), "pattern": data.String(`(\w+)=`), "group": data.String("1")},
+				},
+				"string_rules": data.Array{
+					data.Map{"key": data.String("name"), "type": data.String("str"), "sample_weight": data.String("bin"), "global_weight": data.String("bin")},
+					data.Map{"key": data.String("text*"), "type": data.String("space"), "sample_weight": data.String("tf"), "global_weight": data.String("bin")},
+					data.Map{"key": data.String("code"), "type": data.String("bigram"), "sample_weight": data.String("bin"), "global_weight": data.String("bin")},
+					data.Map{"key": data.String("query"), "type": data.String("word"), "sample_weight": data.String("bin"), "global_weight": data.String("bin")},
+					data.Map{"key": data.String("doc"), "type": data.String("space"), "sample_weight": data.String("tf"), "global_weight": data.String("idf")},
+				},
+				"num_rules": data.Array{
+					data.Map{"key": data.String("*"), "except": data.String("*id"), "type": data.String("num")},
+					data.Map{"key": data.String("size"), "type": data.String("log")},
+					data.Map{"key": data.String("*id"), "type": data.String("str")},
+				},
+			},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("when converting a datum", func() {
+			fv, err := c.Convert(data.Map{
+				"name":  data.String("foo bar"),
+				"text":  data.String("a b a"),
+				"code":  data.String("abc"),
+				"query": data.String("x=1&y=2"),
+				"size":  data.Int(100),
+				"id":    data.Int(3),
+				"nested": data.Map{
+					"value": data.Float(1.5),
+				},
+			})
+			So(err, ShouldBeNil)
+
+			Convey("it should apply all matching rules.", func() {
+				So(fv, ShouldResemble, data.Map{
+					"name$foo bar@str#bin/bin": data.Float(1),
+					"text$a@space#tf/bin":      data.Float(2),
+					"text$b@space#tf/bin":      data.Float(1),
+					"code$ab@bigram#bin/bin":   data.Float(1),
+					"code$bc@bigram#bin/bin":   data.Float(1),
+					"query$x@word#bin/bin":     data.Float(1),
+					"query$y@word#bin/bin":     data.Float(1),
+					"size@num":                 data.Float(100),
+					"size@log":                 data.Float(math.Log(100)),
+					"id$3@str":                 data.Float(1),
+					"nested\x00value@num":      data.Float(1.5),
+				})
+			})
+		})
+
+		Convey("when converting documents for training", func() {
+			for _, d := range []string{"a b", "a c", "a d"} {
+				_, err := c.ConvertAndUpdate(data.Map{"doc": data.String(d)})
+				So(err, ShouldBeNil)
+			}
+
+			Convey("rare terms should have larger weights.", func() {
+				fv, err := c.Convert(data.Map{"doc": data.String("a b")})
+				So(err, ShouldBeNil)
+				So(fv["doc$a@space#tf/idf"], ShouldEqual, data.Float(0))
+				So(fv["doc$b@space#tf/idf"], ShouldEqual, data.Float(math.Log(2)))
+			})
+
+			Convey("and saving and loading it", func() {
+				buf := bytes.NewBuffer(nil)
+				So(c.Save(buf), ShouldBeNil)
+				c2, err := Load(buf)
+				So(err, ShouldBeNil)
+
+				Convey("the loaded converter should be same.", func() {
+					So(c2.config, ShouldResemble, c.config)
+					So(c2.weights, ShouldResemble, c.weights)
+
+					d := data.Map{"doc": data.String("a b e"), "text": data.String("x"), "id": data.Int(1)}
+					fv, err := c.Convert(d)
+					So(err, ShouldBeNil)
+					fv2, err := c2.Convert(d)
+					So(err, ShouldBeNil)
+					So(fv2, ShouldResemble, fv)
+				})
+			})
+		})
+
+		Convey("when converting a document for training without updating", func() {
+			for _, d := range []string{"a b", "a c"} {
+				_, err := c.ConvertAndUpdate(data.Map{"doc": data.String(d)})
+				So(err, ShouldBeNil)
+			}
+			buf := bytes.NewBuffer(nil)
+			So(c.Save(buf), ShouldBeNil)
+			c2, err := Load(buf)
+			So(err, ShouldBeNil)
+
+			d := data.Map{"doc": data.String("a d")}
+			fv, doc, err := c.ConvertForUpdate(d)
+			So(err, ShouldBeNil)
+
+			Convey("document frequencies shouldn't be updated.", func() {
+				So(c.weights, ShouldResemble, c2.weights)
+			})
+
+			Convey("it should be weighted as if the document had been added.", func() {
+				fv2, err := c2.ConvertAndUpdate(d)
+				So(err, ShouldBeNil)
+				So(fv, ShouldResemble, fv2)
+			})
+
+			Convey("and updating it", func() {
+				c.Update(doc)
+
+				Convey("document frequencies should be same as ConvertAndUpdate.", func() {
+					_, err := c2.ConvertAndUpdate(d)
+					So(err, ShouldBeNil)
+					So(c.weights, ShouldResemble, c2.weights)
+				})
+			})
+		})
+
+		Convey("when saving and loading a nil converter", func() {
+			var nc *Converter
+			buf := bytes.NewBuffer(nil)
+			So(nc.Save(buf), ShouldBeNil)
+			c2, err := Load(buf)
+
+			Convey("it should be nil.", func() {
+				So(err, ShouldBeNil)
+				So(c2, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given a converter in the categorical mode", t, func() {
+		c, err := ExtractParams(data.Map{
+			"flatten_mode": data.String("categorical"),
+		})
+		So(err, ShouldBeNil)
+
+		Convey("when converting a datum", func() {
+			fv, err := c.Convert(data.Map{
+				"color": data.String("red"),
+				"used":  data.Bool(true),
+				"size":  data.Int(2),
+			})
+			So(err, ShouldBeNil)
+
+			Convey("it should have one-hot dimensions of strings.", func() {
+				So(fv, ShouldResemble, data.Map{
+					"color$red": data.Float(1),
+					"used":      data.Float(1),
+					"size":      data.Float(2),
+				})
+			})
+		})
+
+		Convey("when saving and loading it", func() {
+			buf := bytes.NewBuffer(nil)
+			So(c.Save(buf), ShouldBeNil)
+			c2, err := Load(buf)
+			So(err, ShouldBeNil)
+
+			Convey("the loaded converter should have the same mode.", func() {
+				So(c2, ShouldNotBeNil)
+				So(c2.mode, ShouldEqual, nested.CategoricalMode)
+			})
+		})
+	})
+
+	Convey("Given a converter having tokenizers", t, func() {
+		c, err := ExtractParams(data.Map{
+			"tokenizers": data.Array{
+				data.Map{"key": data.String("title"), "method": data.String("ngram"), "char_num": data.Int(2)},
+				data.Map{"key": data.String("*"), "except": data.String("title"), "method": data.String("word"), "sample_weight": data.String("bin")},
+			},
+		})
+		So(err, ShouldBeNil)
+		d := data.Map{
+			"title": data.String("aaa"),
+			"body":  data.String("a b, a"),
+			"size":  data.Int(2),
+		}
+
+		Convey("when converting a datum", func() {
+			fv, err := c.Convert(d)
+			So(err, ShouldBeNil)
+
+			Convey("it should have dimensions of terms.", func() {
+				So(fv, ShouldResemble, data.Map{
+					"title$aa": data.Float(2),
+					"body$a":   data.Float(1),
+					"body$b":   data.Float(1),
+					"size":     data.Float(2),
+				})
+			})
+		})
+
+		Convey("when saving and loading it", func() {
+			buf := bytes.NewBuffer(nil)
+			So(c.Save(buf), ShouldBeNil)
+			c2, err := Load(buf)
+			So(err, ShouldBeNil)
+
+			Convey("the loaded converter should tokenize strings in the same way.", func() {
+				fv, err := c.Convert(d)
+				So(err, ShouldBeNil)
+				fv2, err := c2.Convert(d)
+				So(err, ShouldBeNil)
+				So(fv2, ShouldResemble, fv)
+			})
+		})
+	})
+
+	Convey("Given a converter having a tokenizer with a global weight", t, func() {
+		c, err := ExtractParams(data.Map{
+			"tokenizers": data.Array{
+				data.Map{"key": data.String("doc"), "method": data.String("space"), "global_weight": data.String("idf")},
+			},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("when converting documents for training", func() {
+			for _, d := range []string{"a b", "a c", "a d"} {
+				_, err := c.ConvertAndUpdate(data.Map{"doc": data.String(d)})
+				So(err, ShouldBeNil)
+			}
+
+			Convey("rare terms should have larger weights.", func() {
+				fv, err := c.Convert(data.Map{"doc": data.String("a b"), "size": data.Int(1)})
+				So(err, ShouldBeNil)
+				So(fv, ShouldResemble, data.Map{
+					"doc$a": data.Float(0),
+					"doc$b": data.Float(math.Log(2)),
+					"size":  data.Float(1),
+				})
+			})
+
+			Convey("converting without updating shouldn't change weights.", func() {
+				_, err := c.Convert(data.Map{"doc": data.String("b")})
+				So(err, ShouldBeNil)
+				So(c.weights.DocCount, ShouldEqual, 3)
+			})
+
+			Convey("and saving and loading it", func() {
+				buf := bytes.NewBuffer(nil)
+				So(c.Save(buf), ShouldBeNil)
+				c2, err := Load(buf)
+				So(err, ShouldBeNil)
+
+				Convey("the loaded converter should have the same weights.", func() {
+					So(c2.weights, ShouldResemble, c.weights)
+					d := data.Map{"doc": data.String("a b e")}
+					fv, err := c.Convert(d)
+					So(err, ShouldBeNil)
+					fv2, err := c2.Convert(d)
+					So(err, ShouldBeNil)
+					So(fv2, ShouldResemble, fv)
+				})
+			})
+		})
+	})
+
+	Convey("Given a converter hashing document frequencies", t, func() {
+		c, err := ExtractParams(data.Map{
+			"tokenizers": data.Array{
+				data.Map{"key": data.String("doc"), "method": data.String("space"), "global_weight": data.String("idf")},
+			},
+			"hash_max_size": data.Int(1),
+		})
+		So(err, ShouldBeNil)
+
+		Convey("when converting documents for training", func() {
+			for _, d := range []string{"a b", "a c"} {
+				_, err := c.ConvertAndUpdate(data.Map{"doc": data.String(d)})
+				So(err, ShouldBeNil)
+			}
+
+			Convey("terms hashed into the same dimension should be counted once in a document.", func() {
+				So(c.weights.DF, ShouldResemble, map[string]uint64{"1": 2})
+			})
+		})
+	})
+
+	Convey("Given a converter limiting the size of document frequencies", t, func() {
+		c, err := ExtractParams(data.Map{
+			"tokenizers": data.Array{
+				data.Map{"key": data.String("doc"), "method": data.String("space"), "global_weight": data.String("idf")},
+			},
+			"df_max_size": data.Int(1),
+		})
+		So(err, ShouldBeNil)
+
+		Convey("when converting documents for training", func() {
+			for _, d := range []string{"a", "a", "b", "c"} {
+				_, err := c.ConvertAndUpdate(data.Map{"doc": data.String(d)})
+				So(err, ShouldBeNil)
+			}
+
+			Convey("rare terms should be removed.", func() {
+				So(c.weights.DF, ShouldResemble, map[string]uint64{"doc$a": 2})
+				So(c.weights.DocCount, ShouldEqual, 4)
+			})
+
+			Convey("and saving and loading it", func() {
+				buf := bytes.NewBuffer(nil)
+				So(c.Save(buf), ShouldBeNil)
+				c2, err := Load(buf)
+				So(err, ShouldBeNil)
+
+				Convey("the loaded converter should have the same limit.", func() {
+					So(c2.weights, ShouldResemble, c.weights)
+				})
+			})
+		})
+	})
+
+	Convey("Given a negative df_max_size", t, func() {
+		_, err := ExtractParams(data.Map{
+			"tokenizers": data.Array{
+				data.Map{"key": data.String("doc"), "method": data.String("space")},
+			},
+			"df_max_size": data.Int(-1),
+		})
+
+		Convey("it should fail.", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a converter having a tokenizer with a global weight for all keys", t, func() {
+		c, err := ExtractParams(data.Map{
+			"tokenizers": data.Array{
+				data.Map{"key": data.String("*"), "method": data.String("space"), "global_weight": data.String("idf")},
+			},
+		})
+		So(err, ShouldBeNil)
+		_, err = c.ConvertAndUpdate(data.Map{"doc": data.String("b")})
+		So(err, ShouldBeNil)
+
+		Convey("when converting a datum having keys which are flattened into the same key", func() {
+			fv, err := c.Convert(data.Map{
+				"doc":      data.Map{"x": data.String("a"), "n": data.Int(1)},
+				"doc\x00x": data.String("a"),
+				"doc\x00n": data.Int(2),
+			})
+			So(err, ShouldBeNil)
+
+			Convey("their weights should be summed.", func() {
+				So(fv, ShouldResemble, data.Map{
+					"doc\x00x$a": data.Float(2 * math.Log(2)),
+					"doc\x00n":   data.Float(3),
+				})
+			})
+		})
+	})
+
+	Convey("Given tokenizers with converter rules", t, func() {
+		_, err := ExtractParams(data.Map{
+			"tokenizers": data.Array{
+				data.Map{"key": data.String("*"), "method": data.String("space")},
+			},
+			"converter": data.Map{},
+		})
+
+		Convey("it should fail.", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a tokenizer having an unsupported method", t, func() {
+		_, err := ExtractParams(data.Map{
+			"tokenizers": data.Array{
+				data.Map{"key": data.String("*"), "method": data.String("unknown")},
+			},
+		})
+
+		Convey("it should fail.", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given the categorical mode with converter rules", t, func() {
+		_, err := ExtractParams(data.Map{
+			"flatten_mode": data.String("categorical"),
+			"converter":    data.Map{},
+		})
+
+		Convey("it should fail.", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given an invalid converter config", t, func() {
+		_, err := ExtractParams(data.Map{
+			"converter": data.Map{
+				"string_rules": data.Array{
+					data.Map{"key": data.String("*"), "type": data.String("undefined"), "sample_weight": data.String("bin"), "global_weight": data.String("bin")},
+				},
+			},
+		})
+
+		Convey("it should fail.", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,53 @@
+package fvconverter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// matcher decides whether a rule is applied to a key.
+type matcher func(key string) bool
+
+// newMatcher creates a matcher from a pattern described in StringRule.Key.
+func newMatcher(pattern string) (matcher, error) {
+	switch {
+	case pattern == "*":
+		return func(string) bool { return true }, nil
+
+	case len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/"):
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid key pattern '%v': %v", pattern, err)
+		}
+		return re.MatchString, nil
+
+	case strings.HasSuffix(pattern, "*"):
+		prefix := pattern[:len(pattern)-1]
+		return func(key string) bool { return strings.HasPrefix(key, prefix) }, nil
+
+	case strings.HasPrefix(pattern, "*"):
+		suffix := pattern[1:]
+		return func(key string) bool { return strings.HasSuffix(key, suffix) }, nil
+
+	default:
+		return func(key string) bool { return key == pattern }, nil
+	}
+}
+
+// newRuleMatcher creates a matcher which matches keys matching key and not
+// matching except. except can be empty.
+func newRuleMatcher(key, except string) (matcher, error) {
+	m, err := newMatcher(key)
+	if err != nil {
+		return nil, err
+	}
+	if except == "" {
+		return m, nil
+	}
+	e, err := newMatcher(except)
+	if err != nil {
+		return nil, err
+	}
+	return func(key string) bool { return m(key) && !e(key) }, nil
+}
@@ -0,0 +1,87 @@
+package fvconverter
+
+import (
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/nested"
+	"regexp"
+	"strconv"
+)
+
+// strTokenizer regards a whole string as a term.
+type strTokenizer struct{}
+
+func (strTokenizer) Tokenize(s string) []string {
+	return []string{s}
+}
+
+// newTokenizer creates a tokenizer of a string type. Types other than "str"
+// and "space" are looked up in types.
+func newTokenizer(typ string, types map[string]map[string]string) (nested.Tokenizer, error) {
+	switch typ {
+	case "str":
+		return strTokenizer{}, nil
+	case "space":
+		return nested.SpaceTokenizer{}, nil
+	}
+
+	params, ok := types[typ]
+	if !ok {
+		return nil, fmt.Errorf("string type '%v' isn't defined", typ)
+	}
+	return newMethodTokenizer(fmt.Sprintf("string type '%v'", typ), params)
+}
+
+// newMethodTokenizer creates a tokenizer from "method" and parameters of the
+// method in params. name is used in error messages.
+func newMethodTokenizer(name string, params map[string]string) (nested.Tokenizer, error) {
+	switch method := params["method"]; method {
+	case "ngram":
+		n, err := strconv.Atoi(params["char_num"])
+		if err != nil {
+			return nil, fmt.Errorf("char_num of %v is not an integer: %v", name, err)
+		}
+		if n <= 0 {
+			return nil, fmt.Errorf("char_num of %v must be greater than zero", name)
+		}
+		return &nested.NgramTokenizer{N: n}, nil
+
+	case "regexp":
+		re, err := regexp.Compile(params["pattern"])
+		if err != nil {
+			return nil, fmt.Errorf("pattern of %v is invalid: %v", name, err)
+		}
+		g := 0
+		if gs, ok := params["group"]; ok {
+			if g, err = strconv.Atoi(gs); err != nil {
+				return nil, fmt.Errorf("group of %v is not an integer: %v", name, err)
+			}
+		}
+		if g < 0 || g > re.NumSubexp() {
+			return nil, fmt.Errorf("group of %v is out of range", name)
+		}
+		return &nested.RegexpTokenizer{Regexp: re, Group: g}, nil
+
+	case "space":
+		return nested.SpaceTokenizer{}, nil
+
+	case "word":
+		return nested.WordTokenizer{}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported method of %v: %v", name, method)
+	}
+}
+
+// parseSampleWeight parses "bin", "tf", or "log_tf".
+func parseSampleWeight(s string) (nested.TermWeight, error) {
+	switch s {
+	case "bin":
+		return nested.BinaryWeight, nil
+	case "tf":
+		return nested.TFWeight, nil
+	case "log_tf":
+		return nested.LogTFWeight, nil
+	default:
+		return 0, fmt.Errorf("invalid sample_weight: %v", s)
+	}
+}
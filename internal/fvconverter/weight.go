@@ -0,0 +1,154 @@
+package fvconverter
+
+import (
+	"github.com/sensorbee/jubatus/internal/intern"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// weightManager keeps document frequencies of features to compute global
+// weights.
+type weightManager struct {
+	_struct struct{} `codec:",toarray"`
+
+	DocCount uint64
+	// DF has the number of documents having each feature. Its keys are
+	// hashed dimensions when hashMaxSize is greater than zero.
+	DF map[string]uint64
+	// TotalLength is the sum of lengths of all documents. It's used by BM25.
+	TotalLength float64
+
+	// hashMaxSize is the number of dimensions features are hashed into.
+	// Features aren't hashed when it's zero.
+	hashMaxSize int
+	// maxSize is the max number of keys DF keeps. DF is unlimited when it's
+	// zero.
+	maxSize int
+}
+
+const (
+	bm25K1 = 2
+	bm25B  = 0.75
+)
+
+func newWeightManager() *weightManager {
+	return &weightManager{
+		DF: make(map[string]uint64),
+	}
+}
+
+// dfKey returns the key of DF for a feature.
+func (w *weightManager) dfKey(key string) string {
+	if w.hashMaxSize <= 0 {
+		return key
+	}
+	return strconv.Itoa(intern.Hash(key, w.hashMaxSize))
+}
+
+// Document is a document converted for training. It's added to document
+// frequencies by Converter.Update.
+type Document struct {
+	// keys are keys of features having global weights.
+	keys []string
+	// length is the length of the document used by BM25.
+	length float64
+}
+
+// update adds a document to document frequencies. Documents without
+// features having global weights are ignored.
+func (w *weightManager) update(doc *Document) {
+	if len(doc.keys) == 0 {
+		return
+	}
+
+	w.DocCount++
+	seen := make(map[string]struct{}, len(doc.keys))
+	for _, k := range doc.keys {
+		// Different keys can be hashed into the same dimension, which
+		// must be counted only once in a document.
+		k = w.dfKey(k)
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		w.DF[k]++
+	}
+	w.TotalLength += doc.length
+	w.prune()
+}
+
+// prune removes keys having the smallest document frequencies from DF so
+// that DF has maxSize keys. It's only done after DF has twice as many keys
+// as maxSize so that the cost of sorting is amortized.
+func (w *weightManager) prune() {
+	if w.maxSize <= 0 || len(w.DF) <= 2*w.maxSize {
+		return
+	}
+
+	dfs := make(byDF, 0, len(w.DF))
+	for k, n := range w.DF {
+		dfs = append(dfs, keyDF{key: k, df: n})
+	}
+	sort.Sort(dfs)
+	for _, d := range dfs[w.maxSize:] {
+		delete(w.DF, d.key)
+	}
+}
+
+// idf returns the smoothed inverse document frequency of key. When
+// pending is true, it's computed as if the document having key has already
+// been added.
+func (w *weightManager) idf(key string, pending bool) float64 {
+	docCount, df := w.DocCount, w.DF[w.dfKey(key)]
+	if pending {
+		docCount++
+		df++
+	}
+	return math.Log(float64(docCount+1) / float64(df+1))
+}
+
+// bm25 returns the BM25 weight of key in a document. x is the sample weight
+// of the key and length is the length of the document. When pending is
+// true, it's computed as if the document has already been added.
+func (w *weightManager) bm25(key string, x, length float64, pending bool) float64 {
+	docCount, total := w.DocCount, w.TotalLength
+	if pending {
+		docCount++
+		total += length
+	}
+	avg := length
+	if docCount > 0 {
+		avg = total / float64(docCount)
+	}
+	norm := 1.0
+	if avg > 0 {
+		norm = 1 - bm25B + bm25B*length/avg
+	}
+	return w.idf(key, pending) * x * (bm25K1 + 1) / (x + bm25K1*norm)
+}
+
+type keyDF struct {
+	key string
+	df  uint64
+}
+
+// byDF sorts keys in descending order of document frequencies. Keys having
+// the same frequency are sorted by themselves so that pruning is
+// deterministic.
+type byDF []keyDF
+
+func (b byDF) Len() int {
+	return len(b)
+}
+
+func (b byDF) Less(i, j int) bool {
+	if b[i].df != b[j].df {
+		return b[i].df > b[j].df
+	}
+	return b[i].key < b[j].key
+}
+
+func (b byDF) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
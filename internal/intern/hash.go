@@ -0,0 +1,13 @@
+package intern
+
+import (
+	"hash/fnv"
+)
+
+// Hash returns an ID for a string in [1, maxSize] by the hashing trick.
+// Different strings can have the same ID. maxSize must be greater than zero.
+func Hash(s string, maxSize int) int {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return int(h.Sum64()%uint64(maxSize)) + 1
+}
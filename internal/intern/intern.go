@@ -46,6 +46,31 @@ func (i *Intern) Get(s string) int {
 	return id
 }
 
+// Len returns the number of registered strings.
+func (i *Intern) Len() int {
+	return len(i.storage)
+}
+
+// Reverse returns a mapping from IDs to strings. It's computed on each call.
+func (i *Intern) Reverse() map[int]string {
+	ret := make(map[int]string, len(i.storage))
+	for s, id := range i.storage {
+		ret[id] = s
+	}
+	return ret
+}
+
+// Compact removes strings whose IDs aren't used from Intern. IDs of the
+// remaining strings don't change, and removed strings will have new IDs when
+// they're registered again.
+func (i *Intern) Compact(used func(id int) bool) {
+	for s, id := range i.storage {
+		if !used(id) {
+			delete(i.storage, s)
+		}
+	}
+}
+
 const (
 	internFormatVersion uint8 = 1
 )
@@ -38,6 +38,25 @@ func TestIntern(t *testing.T) {
 				So(id, ShouldEqual, 0)
 			})
 		})
+
+		Convey("when compacting it", func() {
+			a := i.Get("a")
+			b := i.Get("b")
+			i.Compact(func(id int) bool { return id == b })
+
+			Convey("unused keys should be removed", func() {
+				So(i.Len(), ShouldEqual, 1)
+				So(i.GetOrZero("a"), ShouldEqual, 0)
+			})
+
+			Convey("used keys should have the same IDs", func() {
+				So(i.GetOrZero("b"), ShouldEqual, b)
+			})
+
+			Convey("removed keys should have new IDs when registered again", func() {
+				So(i.Get("a"), ShouldNotEqual, a)
+			})
+		})
 	})
 }
 
@@ -66,3 +85,19 @@ func TestInternSaveLoad(t *testing.T) {
 		})
 	})
 }
+
+func TestHash(t *testing.T) {
+	Convey("Given keys", t, func() {
+		keys := []string{"a", "b", "http://example.com/", ""}
+
+		Convey("when hashing them", func() {
+			Convey("their IDs should be in the range and deterministic.", func() {
+				for _, k := range keys {
+					id := Hash(k, 10)
+					So(id, ShouldBeBetweenOrEqual, 1, 10)
+					So(Hash(k, 10), ShouldEqual, id)
+				}
+			})
+		})
+	})
+}
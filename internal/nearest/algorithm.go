@@ -0,0 +1,78 @@
+package nearest
+
+import (
+	"errors"
+	"github.com/sensorbee/jubatus/internal/nested"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+)
+
+const (
+	// InvalidAlgorithm represents an invalid nearest neighbor algorithm.
+	InvalidAlgorithm Algorithm = iota
+	// LSHAlgorithm represents locality sensitive hashing.
+	LSHAlgorithm
+	// MinhashAlgorithm represents minhash.
+	MinhashAlgorithm
+	// EuclidLSHAlgorithm represents locality sensitive hashing with euclidean
+	// distance.
+	EuclidLSHAlgorithm
+)
+
+// Algorithm is an enum type which represents nearest neighbor algorithms.
+type Algorithm int
+
+// New creates a Neighbor of the given algorithm. hashNum is the number of
+// hash bits.
+func New(algo Algorithm, hashNum int) (Neighbor, error) {
+	switch algo {
+	case LSHAlgorithm:
+		return NewLSH(hashNum), nil
+	case MinhashAlgorithm:
+		return NewMinhash(hashNum), nil
+	case EuclidLSHAlgorithm:
+		return NewEuclidLSH(hashNum), nil
+	default:
+		return nil, errors.New("invalid nearest neighbor algorithm")
+	}
+}
+
+// NewFeatureVector converts a flattened feature vector to FeatureVector.
+// Elements are sorted by dimensions so that hash values don't depend on the
+// order of map iteration.
+func NewFeatureVector(v map[string]float32) FeatureVector {
+	ret := make(FeatureVector, 0, len(v))
+	for k, x := range v {
+		ret = append(ret, FeatureElement{Dim: k, Value: x})
+	}
+	sort.Sort(byDim(ret))
+	return ret
+}
+
+// FlattenFeatureVector flattens a nested feature vector and converts it to
+// FeatureVector. Elements are sorted in the same way as NewFeatureVector.
+func FlattenFeatureVector(v data.Map) (FeatureVector, error) {
+	ret := make(FeatureVector, 0, len(v))
+	err := nested.Flatten(v, func(key string, value float32) {
+		ret = append(ret, FeatureElement{Dim: key, Value: value})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byDim(ret))
+	return ret, nil
+}
+
+type byDim FeatureVector
+
+func (s byDim) Len() int {
+	return len(s)
+}
+
+func (s byDim) Less(i, j int) bool {
+	return s[i].Dim < s[j].Dim
+}
+
+func (s byDim) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
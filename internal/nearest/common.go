@@ -167,8 +167,8 @@ func partialInsertionSort(dists []IDist, n int) {
 		return
 	}
 	if n == 1 {
-		maxIx := maxDistsIx(dists)
-		dists[0], dists[maxIx] = dists[maxIx], dists[0]
+		minIx := minDistsIx(dists)
+		dists[0], dists[minIx] = dists[minIx], dists[0]
 		return
 	}
 
@@ -201,6 +201,17 @@ func maxDistsIx(dists []IDist) int {
 	return ix
 }
 
+func minDistsIx(dists []IDist) int {
+	// len(dists) must >= 1.
+	ix := 0
+	for i := 1; i < len(dists); i++ {
+		if less(&dists[i], &dists[ix]) {
+			ix = i
+		}
+	}
+	return ix
+}
+
 func calcStringHash(s string) uint64 {
 	// FNV-1
 	var hash uint64 = 14695981039346656037
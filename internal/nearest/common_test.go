@@ -0,0 +1,28 @@
+package nearest
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestPartialInsertionSort(t *testing.T) {
+	Convey("Given distances", t, func() {
+		dists := []IDist{{1, 1}, {2, 3}, {3, 0.5}, {4, 1}, {5, 2}}
+
+		Convey("when sorting them partially with n = 1", func() {
+			partialInsertionSort(dists, 1)
+
+			Convey("the first element should be the smallest.", func() {
+				So(dists[0], ShouldResemble, IDist{3, 0.5})
+			})
+		})
+
+		Convey("when sorting them partially with n = 3", func() {
+			partialInsertionSort(dists, 3)
+
+			Convey("the first three elements should be the smallest in order.", func() {
+				So(dists[:3], ShouldResemble, []IDist{{3, 0.5}, {1, 1}, {4, 1}})
+			})
+		})
+	})
+}
@@ -0,0 +1,115 @@
+package nearest
+
+import (
+	"math"
+	"sort"
+)
+
+// InvertedIndex calculates cosine similarities between rows sharing at least
+// one column. Unlike Neighbor, rows can be removed from it. Rows are
+// flattened feature vectors.
+//
+// jubatus::core::storage::inverted_index_storage
+type InvertedIndex struct {
+	// columns maps a column to values of rows having the column.
+	columns map[string]map[ID]float32
+	// squaredNorms has the squared norm of each row.
+	squaredNorms map[ID]float32
+}
+
+// IDScore is an ID with its similarity score. A larger score means more
+// similar.
+type IDScore struct {
+	ID    ID
+	Score float32
+}
+
+// NewInvertedIndex creates an empty InvertedIndex.
+func NewInvertedIndex() *InvertedIndex {
+	return &InvertedIndex{
+		columns:      make(map[string]map[ID]float32),
+		squaredNorms: make(map[ID]float32),
+	}
+}
+
+// SetRow registers a row. When the row has already been registered, the
+// caller must call ClearRow with the old row before calling SetRow.
+func (ii *InvertedIndex) SetRow(id ID, r map[string]float32) {
+	var norm float32
+	for k, x := range r {
+		c, ok := ii.columns[k]
+		if !ok {
+			c = make(map[ID]float32)
+			ii.columns[k] = c
+		}
+		c[id] = x
+		norm += x * x
+	}
+	ii.squaredNorms[id] = norm
+}
+
+// ClearRow removes the row r registered with id.
+func (ii *InvertedIndex) ClearRow(id ID, r map[string]float32) {
+	for k := range r {
+		c := ii.columns[k]
+		delete(c, id)
+		if len(c) == 0 {
+			delete(ii.columns, k)
+		}
+	}
+	delete(ii.squaredNorms, id)
+}
+
+// SimilarRow returns at most size rows sorted by their cosine similarities
+// to r in descending order. Rows not sharing any column with r aren't
+// returned.
+func (ii *InvertedIndex) SimilarRow(r map[string]float32, size int) []IDScore {
+	var norm float32
+	products := make(map[ID]float32)
+	for k, x := range r {
+		norm += x * x
+		for id, y := range ii.columns[k] {
+			products[id] += x * y
+		}
+	}
+	if norm == 0 {
+		return nil
+	}
+	norm = float32(math.Sqrt(float64(norm)))
+
+	ret := make([]IDScore, 0, len(products))
+	for id, p := range products {
+		n := ii.squaredNorms[id]
+		if n == 0 {
+			continue
+		}
+		ret = append(ret, IDScore{
+			ID:    id,
+			Score: p / norm / float32(math.Sqrt(float64(n))),
+		})
+	}
+	sort.Sort(byScore(ret))
+	if len(ret) > size {
+		ret = ret[:size]
+	}
+	return ret
+}
+
+// byScore sorts IDScores by their scores in descending order. Ties are
+// ordered by IDs.
+type byScore []IDScore
+
+func (s byScore) Len() int {
+	return len(s)
+}
+
+func (s byScore) Less(i, j int) bool {
+	if s[i].Score != s[j].Score {
+		return s[i].Score > s[j].Score
+	}
+	return s[i].ID < s[j].ID
+}
+
+func (s byScore) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
@@ -3,21 +3,73 @@ package nested
 import (
 	"fmt"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
 )
 
 type Appender func(string, float32)
 
+// Mode specifies how Flatten converts leaf values.
+type Mode int
+
+const (
+	// NumericMode converts all leaf values by data.ToFloat.
+	NumericMode Mode = iota
+
+	// CategoricalMode converts a string leaf into a one-hot dimension
+	// "key$value" having 1 and a boolean leaf into 0 or 1. Other leaves are
+	// converted by data.ToFloat.
+	CategoricalMode
+)
+
 func Flatten(v data.Map, ap Appender) error {
-	return flattenImpl("", v, ap)
+	return flattenImpl("", v, &Flattener{}, ap, nil)
+}
+
+// FlattenWithMode flattens v like Flatten but converts leaf values according
+// to mode.
+func FlattenWithMode(v data.Map, mode Mode, ap Appender) error {
+	return flattenImpl("", v, &Flattener{Mode: mode}, ap, nil)
+}
+
+// Flattener flattens a data.Map with options. A string leaf is tokenized by
+// the first TextRule matching its key. Other leaves are converted according
+// to Mode.
+type Flattener struct {
+	Mode      Mode
+	TextRules []*TextRule
 }
 
-func flattenImpl(keyPrefix string, v data.Value, ap Appender) error {
+// TextAppender receives a term tokenized by a TextRule r. key is the key of
+// the term's dimension.
+type TextAppender func(r *TextRule, key string, x float32)
+
+// Flatten flattens v like Flatten with options of f.
+func (f *Flattener) Flatten(v data.Map, ap Appender) error {
+	return flattenImpl("", v, f, ap, nil)
+}
+
+// FlattenText flattens v like Flatten but passes tokenized terms to tap
+// instead of ap.
+func (f *Flattener) FlattenText(v data.Map, ap Appender, tap TextAppender) error {
+	return flattenImpl("", v, f, ap, tap)
+}
+
+func (f *Flattener) textRule(key string) *TextRule {
+	for _, r := range f.TextRules {
+		if r.Match(key) {
+			return r
+		}
+	}
+	return nil
+}
+
+func flattenImpl(keyPrefix string, v data.Value, f *Flattener, ap Appender, tap TextAppender) error {
 	switch v.Type() {
 	case data.TypeArray:
 		keyPrefix += "\x00"
 		a, _ := data.AsArray(v)
 		for i, v := range a {
-			err := flattenImpl(fmt.Sprintf(keyPrefix, i), v, ap)
+			err := flattenImpl(fmt.Sprintf(keyPrefix, i), v, f, ap, tap)
 			if err != nil {
 				return err
 			}
@@ -29,21 +81,83 @@ func flattenImpl(keyPrefix string, v data.Value, ap Appender) error {
 		}
 
 		m, _ := data.AsMap(v)
-		for f, v := range m {
-			err := flattenImpl(keyPrefix+f, v, ap)
+		for k, v := range m {
+			err := flattenImpl(keyPrefix+k, v, f, ap, tap)
 			if err != nil {
 				return err
 			}
 		}
 
-	default:
-		xx, err := data.ToFloat(v)
-		if err != nil {
-			// TODO: return better error
-			return err
+	case data.TypeString:
+		s, _ := data.AsString(v)
+		if r := f.textRule(keyPrefix); r != nil {
+			for t, n := range r.termFrequencies(s) {
+				x := float32(r.Weight.Weight(n))
+				if tap != nil {
+					tap(r, keyPrefix+"$"+t, x)
+				} else {
+					ap(keyPrefix+"$"+t, x)
+				}
+			}
+			return nil
+		}
+		if f.Mode == CategoricalMode {
+			ap(keyPrefix+"$"+s, 1)
+			return nil
+		}
+		return appendFloat(keyPrefix, v, ap)
+
+	case data.TypeBool:
+		if f.Mode == CategoricalMode {
+			b, _ := data.AsBool(v)
+			var x float32
+			if b {
+				x = 1
+			}
+			ap(keyPrefix, x)
+			return nil
 		}
-		x := float32(xx)
-		ap(keyPrefix, x)
+		return appendFloat(keyPrefix, v, ap)
+
+	default:
+		return appendFloat(keyPrefix, v, ap)
+	}
+	return nil
+}
+
+func appendFloat(key string, v data.Value, ap Appender) error {
+	xx, err := data.ToFloat(v)
+	if err != nil {
+		// TODO: return better error
+		return err
 	}
+	x := float32(xx)
+	ap(key, x)
 	return nil
 }
+
+// ReadableKey renders a key generated by Flatten readably by joining the path
+// of the key with ".".
+func ReadableKey(key string) string {
+	return strings.Replace(key, "\x00", ".", -1)
+}
+
+// Unflatten restores a nested data.Map from keys and values generated by
+// Flatten. Array elements are restored as maps.
+func Unflatten(kv map[string]float32) data.Map {
+	ret := data.Map{}
+	for key, x := range kv {
+		m := ret
+		path := strings.Split(key, "\x00")
+		for _, f := range path[:len(path)-1] {
+			child, ok := m[f].(data.Map)
+			if !ok {
+				child = data.Map{}
+				m[f] = child
+			}
+			m = child
+		}
+		m[path[len(path)-1]] = data.Float(x)
+	}
+	return ret
+}
@@ -3,6 +3,7 @@ package nested
 import (
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"regexp"
 	"testing"
 )
 
@@ -228,3 +229,129 @@ func TestFlattenNestedArray(t *testing.T) {
 		})
 	})
 }
+
+func TestFlattenCategorical(t *testing.T) {
+	m := data.Map{
+		"color": data.String("red"),
+		"size":  data.Int(3),
+		"flags": data.Map{
+			"used": data.Bool(true),
+			"new":  data.Bool(false),
+		},
+	}
+
+	Convey("Given a data.Map having strings and booleans", t, func() {
+		Convey("when flatten it in the categorical mode", func() {
+			a := map[string]float32{}
+			err := FlattenWithMode(m, CategoricalMode, func(k string, x float32) {
+				a[k] = x
+			})
+
+			Convey("it should convert strings to one-hot dimensions.", func() {
+				So(err, ShouldBeNil)
+				So(a, ShouldResemble, map[string]float32{
+					"color$red":     1,
+					"size":          3,
+					"flags\x00used": 1,
+					"flags\x00new":  0,
+				})
+			})
+		})
+
+		Convey("when flatten it in the numeric mode", func() {
+			err := FlattenWithMode(m, NumericMode, func(string, float32) {})
+
+			Convey("it should fail.", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestFlattenTokenized(t *testing.T) {
+	m := data.Map{
+		"title": data.String("abab"),
+		"body":  data.String("Hello, world. hello world"),
+		"color": data.String("red"),
+	}
+
+	Convey("Given a flattener having text rules", t, func() {
+		f := &Flattener{
+			Mode: CategoricalMode,
+			TextRules: []*TextRule{
+				{
+					Match:     func(k string) bool { return k == "title" },
+					Tokenizer: &NgramTokenizer{N: 2},
+					Weight:    TFWeight,
+				},
+				{
+					Match:     func(k string) bool { return k == "body" },
+					Tokenizer: WordTokenizer{},
+					Weight:    BinaryWeight,
+				},
+			},
+		}
+
+		Convey("when flatten a data.Map with it", func() {
+			a := map[string]float32{}
+			err := f.Flatten(m, func(k string, x float32) {
+				a[k] = x
+			})
+
+			Convey("it should tokenize matching strings.", func() {
+				So(err, ShouldBeNil)
+				So(a, ShouldResemble, map[string]float32{
+					"title$ab":   2,
+					"title$ba":   1,
+					"body$Hello": 1,
+					"body$hello": 1,
+					"body$world": 1,
+					"color$red":  1,
+				})
+			})
+		})
+	})
+
+	Convey("Given a regexp tokenizer", t, func() {
+		tk := &RegexpTokenizer{
+			Regexp: regexp.MustCompile(`(\w+)=\d+`),
+			Group:  1,
+		}
+
+		Convey("when tokenizing a string", func() {
+			ts := tk.Tokenize("a=1, b=22, c=x")
+
+			Convey("it should extract the group of each match.", func() {
+				So(ts, ShouldResemble, []string{"a", "b"})
+			})
+		})
+	})
+}
+
+func TestUnflatten(t *testing.T) {
+	Convey("Given a flattened feature vector", t, func() {
+		kv := map[string]float32{
+			"a":           1,
+			"b\x00c":      2,
+			"b\x00d\x00e": 3,
+			"b\x00d\x00f": 4,
+		}
+
+		Convey("when unflatten it", func() {
+			m := Unflatten(kv)
+
+			Convey("it should restore the nested data.Map.", func() {
+				So(m, ShouldResemble, data.Map{
+					"a": data.Float(1),
+					"b": data.Map{
+						"c": data.Float(2),
+						"d": data.Map{
+							"e": data.Float(3),
+							"f": data.Float(4),
+						},
+					},
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,113 @@
+package nested
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Tokenizer splits a string into terms.
+type Tokenizer interface {
+	Tokenize(s string) []string
+}
+
+// NgramTokenizer splits a string into character n-grams. A string shorter
+// than N doesn't have any terms.
+type NgramTokenizer struct {
+	N int
+}
+
+// Tokenize implements Tokenizer.
+func (t *NgramTokenizer) Tokenize(s string) []string {
+	rs := []rune(s)
+	if len(rs) < t.N {
+		return nil
+	}
+	ret := make([]string, 0, len(rs)-t.N+1)
+	for i := 0; i+t.N <= len(rs); i++ {
+		ret = append(ret, string(rs[i:i+t.N]))
+	}
+	return ret
+}
+
+// SpaceTokenizer splits a string by white spaces.
+type SpaceTokenizer struct {
+}
+
+// Tokenize implements Tokenizer.
+func (SpaceTokenizer) Tokenize(s string) []string {
+	return strings.Fields(s)
+}
+
+// WordTokenizer splits a string by white spaces and punctuations.
+type WordTokenizer struct {
+}
+
+// Tokenize implements Tokenizer.
+func (WordTokenizer) Tokenize(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	})
+}
+
+// RegexpTokenizer extracts the Group-th capture of every match of Regexp as a
+// term. Group 0 means the whole match.
+type RegexpTokenizer struct {
+	Regexp *regexp.Regexp
+	Group  int
+}
+
+// Tokenize implements Tokenizer.
+func (t *RegexpTokenizer) Tokenize(s string) []string {
+	ms := t.Regexp.FindAllStringSubmatch(s, -1)
+	ret := make([]string, 0, len(ms))
+	for _, m := range ms {
+		ret = append(ret, m[t.Group])
+	}
+	return ret
+}
+
+// TermWeight specifies the weight of a term computed from its frequency in a
+// string.
+type TermWeight int
+
+const (
+	// BinaryWeight gives 1 to every term.
+	BinaryWeight TermWeight = iota
+
+	// TFWeight gives the term frequency.
+	TFWeight
+
+	// LogTFWeight gives log(1 + tf).
+	LogTFWeight
+)
+
+// Weight returns the weight of a term whose frequency is tf.
+func (w TermWeight) Weight(tf int) float64 {
+	switch w {
+	case TFWeight:
+		return float64(tf)
+	case LogTFWeight:
+		return math.Log(1 + float64(tf))
+	default:
+		return 1
+	}
+}
+
+// TextRule tokenizes string leaves whose keys match Match. Each term t of a
+// leaf having a key k becomes a dimension "k$t".
+type TextRule struct {
+	Match     func(key string) bool
+	Tokenizer Tokenizer
+	Weight    TermWeight
+}
+
+// termFrequencies returns frequencies of terms in s.
+func (r *TextRule) termFrequencies(s string) map[string]int {
+	tf := map[string]int{}
+	for _, t := range r.Tokenizer.Tokenize(s) {
+		tf[t]++
+	}
+	return tf
+}
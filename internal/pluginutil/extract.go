@@ -3,6 +3,7 @@ package pluginutil
 import (
 	"fmt"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
 )
 
 func ExtractParamAsStringWithDefault(params data.Map, key, def string) (string, error) {
@@ -54,6 +55,34 @@ func ExtractParamAsInt(params data.Map, key string) (int64, error) {
 	return x, nil
 }
 
+// ExtractParamAsBoundedInt extracts an integer parameter as int. It fails
+// when the value doesn't fit in int32, whose max value is INT_MAX of Jubatus,
+// so that the parameter has the same range on all platforms.
+func ExtractParamAsBoundedInt(params data.Map, key string) (int, error) {
+	x, err := ExtractParamAsInt(params, key)
+	if err != nil {
+		return 0, err
+	}
+	return toBoundedInt(key, x)
+}
+
+// ExtractParamAsBoundedIntWithDefault is same as ExtractParamAsBoundedInt
+// except that it returns def when the parameter is missing.
+func ExtractParamAsBoundedIntWithDefault(params data.Map, key string, def int) (int, error) {
+	x, err := ExtractParamAsIntWithDefault(params, key, int64(def))
+	if err != nil {
+		return 0, err
+	}
+	return toBoundedInt(key, x)
+}
+
+func toBoundedInt(key string, x int64) (int, error) {
+	if x < math.MinInt32 || x > math.MaxInt32 {
+		return 0, fmt.Errorf("%s parameter must be in [%v, %v]: %v", key, math.MinInt32, math.MaxInt32, x)
+	}
+	return int(x), nil
+}
+
 func ExtractParamAndConvertToFloat(params data.Map, key string) (float64, error) {
 	v, ok := params[key]
 	if !ok {
@@ -65,3 +94,27 @@ func ExtractParamAndConvertToFloat(params data.Map, key string) (float64, error)
 	}
 	return x, nil
 }
+
+func ExtractParamAndConvertToFloatWithDefault(params data.Map, key string, def float64) (float64, error) {
+	v, ok := params[key]
+	if !ok {
+		return def, nil
+	}
+	x, err := data.ToFloat(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s parameter cannot be converted to float: %v", key, err)
+	}
+	return x, nil
+}
+
+func ExtractParamAsBoolWithDefault(params data.Map, key string, def bool) (bool, error) {
+	v, ok := params[key]
+	if !ok {
+		return def, nil
+	}
+	b, err := data.AsBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s parameter is not a bool: %v", key, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,226 @@
+package pruning
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/pluginutil"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+)
+
+// Policy specifies how dimensions are dropped from a linear model. Zero
+// values of the fields disable the corresponding rules.
+type Policy struct {
+	_struct struct{} `codec:",toarray"`
+
+	// WeightThreshold drops a dimension of a weight vector when the absolute
+	// value of its weight is less than the threshold.
+	WeightThreshold float32
+
+	// MaxIdle drops a dimension when it hasn't appeared in the last MaxIdle
+	// training data.
+	MaxIdle uint64
+
+	// MaxDims is the maximum number of dimensions each weight vector of the
+	// model can have. Least recently updated dimensions are evicted first.
+	MaxDims int
+
+	// Interval is the number of training data between pruning. The model
+	// can temporarily exceed the limits until the next pruning.
+	Interval uint64
+}
+
+const (
+	defaultInterval = 1000
+)
+
+// ParsePolicy parses a pruning policy:
+//
+//	{
+//	  "weight_threshold": 0.001,
+//	  "max_idle": 100000,
+//	  "<maxDimsKey>": 50000,
+//	  "interval": 1000
+//	}
+//
+// maxDimsKey is the name of the parameter of Policy.MaxDims, which depends
+// on how the model has weight vectors. All keys are optional. interval is
+// 1000 by default.
+func ParsePolicy(m data.Map, maxDimsKey string) (*Policy, error) {
+	for k := range m {
+		switch k {
+		case "weight_threshold", "max_idle", maxDimsKey, "interval":
+		default:
+			return nil, fmt.Errorf("unsupported pruning parameter: %v", k)
+		}
+	}
+
+	th, err := pluginutil.ExtractParamAndConvertToFloatWithDefault(m, "weight_threshold", 0)
+	if err != nil {
+		return nil, err
+	}
+	if th < 0 {
+		return nil, errors.New("weight_threshold must not be less than zero")
+	}
+	idle, err := pluginutil.ExtractParamAsIntWithDefault(m, "max_idle", 0)
+	if err != nil {
+		return nil, err
+	}
+	if idle < 0 {
+		return nil, errors.New("max_idle must not be less than zero")
+	}
+	maxDims, err := pluginutil.ExtractParamAsBoundedIntWithDefault(m, maxDimsKey, 0)
+	if err != nil {
+		return nil, err
+	}
+	if maxDims < 0 {
+		return nil, fmt.Errorf("%v must not be less than zero", maxDimsKey)
+	}
+	interval, err := pluginutil.ExtractParamAsIntWithDefault(m, "interval", defaultInterval)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, errors.New("interval must be greater than zero")
+	}
+
+	return &Policy{
+		WeightThreshold: float32(th),
+		MaxIdle:         uint64(idle),
+		MaxDims:         maxDims,
+		Interval:        uint64(interval),
+	}, nil
+}
+
+// Weights is a weight vector of a linear model whose dimensions can be
+// dropped.
+type Weights interface {
+	// EachWeight calls f with each dimension and its weight. f can drop the
+	// dimension.
+	EachWeight(f func(d int, w float32))
+
+	// Drop removes a dimension from the weight vector.
+	Drop(d int)
+}
+
+// Pruner keeps the information required to prune a linear model.
+type Pruner struct {
+	_struct struct{} `codec:",toarray"`
+
+	Policy *Policy
+
+	// Count is the number of training data since the model was created or
+	// cleared.
+	Count uint64
+
+	// LastUsed has the value of Count when each dimension appeared last.
+	// It's only maintained when the policy needs it.
+	LastUsed map[int]uint64
+}
+
+// New creates a Pruner having a policy.
+func New(p *Policy) *Pruner {
+	return &Pruner{
+		Policy:   p,
+		LastUsed: make(map[int]uint64),
+	}
+}
+
+// Reset clears the usage of dimensions.
+func (p *Pruner) Reset() {
+	p.Count = 0
+	p.LastUsed = make(map[int]uint64)
+}
+
+func (p *Pruner) tracksUsage() bool {
+	return p.Policy.MaxIdle > 0 || p.Policy.MaxDims > 0
+}
+
+// Touch records that a training datum having dims appeared. It returns true
+// when the model should be pruned.
+func (p *Pruner) Touch(dims []int) bool {
+	p.Count++
+	if p.tracksUsage() {
+		for _, d := range dims {
+			p.LastUsed[d] = p.Count
+		}
+	}
+	return p.Count%p.Policy.Interval == 0
+}
+
+// Prune drops dimensions from weight vectors of a model according to the
+// policy. current has dimensions of the datum about to be trained. It
+// returns a set of dimensions remaining in the model and dimensions in
+// current. Dimensions in current are regarded as live even when they're
+// dropped from the model so that their usage is kept when they're added to
+// the model again.
+func (p *Pruner) Prune(model []Weights, current []int) map[int]bool {
+	live := make(map[int]bool)
+	for _, d := range current {
+		live[d] = true
+	}
+	for _, ws := range model {
+		var ds byLastUsed
+		ws.EachWeight(func(d int, w float32) {
+			if p.Policy.WeightThreshold > 0 && abs(w) < p.Policy.WeightThreshold {
+				ws.Drop(d)
+				return
+			}
+			if p.Policy.MaxIdle > 0 && p.Count-p.LastUsed[d] > p.Policy.MaxIdle {
+				ws.Drop(d)
+				return
+			}
+			ds = append(ds, dimUsage{d, p.LastUsed[d]})
+		})
+
+		if max := p.Policy.MaxDims; max > 0 && len(ds) > max {
+			sort.Sort(ds)
+			for _, u := range ds[:len(ds)-max] {
+				ws.Drop(u.dim)
+			}
+			ds = ds[len(ds)-max:]
+		}
+
+		for _, u := range ds {
+			live[u.dim] = true
+		}
+	}
+
+	for d := range p.LastUsed {
+		if !live[d] {
+			delete(p.LastUsed, d)
+		}
+	}
+	return live
+}
+
+type dimUsage struct {
+	dim      int
+	lastUsed uint64
+}
+
+// byLastUsed sorts dimensions from the least recently used one. Ties are
+// broken by dimensions to make the result deterministic.
+type byLastUsed []dimUsage
+
+func (b byLastUsed) Len() int {
+	return len(b)
+}
+
+func (b byLastUsed) Less(i, j int) bool {
+	if b[i].lastUsed != b[j].lastUsed {
+		return b[i].lastUsed < b[j].lastUsed
+	}
+	return b[i].dim < b[j].dim
+}
+
+func (b byLastUsed) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
+
+func abs(x float32) float32 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,307 @@
+package nearestneighbor
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/nearest"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"sync"
+)
+
+// NearestNeighbor holds rows identified by string IDs and searches rows near
+// a given row.
+type NearestNeighbor struct {
+	nn        nearest.Neighbor
+	algorithm Algorithm
+	hashNum   int
+
+	// ids maps a row ID to the internal ID used by nearest.Neighbor.
+	ids map[string]nearest.ID
+	// keys[i] is the row ID of the internal ID i+1. It's empty when the row
+	// has been deleted.
+	keys []string
+	// free has internal IDs of deleted rows which will be reused. Rows
+	// cannot be removed from nearest.Neighbor, so deleted rows are filtered
+	// out from search results.
+	free []nearest.ID
+
+	m sync.RWMutex
+}
+
+const (
+	// InvalidAlgorithm represents an invalid nearest neighbor algorithm.
+	InvalidAlgorithm = nearest.InvalidAlgorithm
+	// LSH represents locality sensitive hashing.
+	LSH = nearest.LSHAlgorithm
+	// Minhash represents minhash.
+	Minhash = nearest.MinhashAlgorithm
+	// EuclidLSH represents locality sensitive hashing with euclidean distance.
+	EuclidLSH = nearest.EuclidLSHAlgorithm
+)
+
+// Algorithm is an enum type which represents nearest neighbor algorithms.
+type Algorithm = nearest.Algorithm
+
+// IDDist is a row ID with its distance.
+type IDDist struct {
+	ID   string
+	Dist float32
+}
+
+// IDScore is a row ID with its similarity score. A larger score means more
+// similar. The score is 1 - distance for LSH and Minhash, and -distance for
+// EuclidLSH.
+type IDScore struct {
+	ID    string
+	Score float32
+}
+
+// NewNearestNeighbor creates a NearestNeighbor. hashNum is the number of hash
+// bits.
+func NewNearestNeighbor(algo Algorithm, hashNum int) (*NearestNeighbor, error) {
+	if hashNum <= 0 {
+		return nil, errors.New("number of hash bits must be greater than zero")
+	}
+
+	nn, err := nearest.New(algo, hashNum)
+	if err != nil {
+		return nil, err
+	}
+	return &NearestNeighbor{
+		nn:        nn,
+		algorithm: algo,
+		hashNum:   hashNum,
+		ids:       make(map[string]nearest.ID),
+	}, nil
+}
+
+// SetRow sets v to the row having id. The old row is replaced. It returns
+// true when a new row is created.
+func (n *NearestNeighbor) SetRow(id string, v FeatureVector) (bool, error) {
+	if id == "" {
+		return false, errors.New("id must not be empty")
+	}
+	nnfv, err := nearest.FlattenFeatureVector(data.Map(v))
+	if err != nil {
+		return false, err
+	}
+
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if iid, ok := n.ids[id]; ok {
+		n.nn.SetRow(iid, nnfv)
+		return false, nil
+	}
+
+	var iid nearest.ID
+	if l := len(n.free); l > 0 {
+		iid = n.free[l-1]
+		n.free = n.free[:l-1]
+		n.keys[iid-1] = id
+	} else {
+		n.keys = append(n.keys, id)
+		iid = nearest.ID(len(n.keys))
+	}
+	n.ids[id] = iid
+	n.nn.SetRow(iid, nnfv)
+	return true, nil
+}
+
+// DeleteRow deletes the row having id. It returns false when the row doesn't
+// exist.
+func (n *NearestNeighbor) DeleteRow(id string) bool {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	iid, ok := n.ids[id]
+	if !ok {
+		return false
+	}
+	delete(n.ids, id)
+	n.keys[iid-1] = ""
+	n.free = append(n.free, iid)
+	return true
+}
+
+// Clear deletes all rows.
+func (n *NearestNeighbor) Clear() {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	// The arguments have already been validated.
+	n.nn, _ = nearest.New(n.algorithm, n.hashNum)
+	n.ids = make(map[string]nearest.ID)
+	n.keys = nil
+	n.free = nil
+}
+
+// NeighborRowFromID returns at most size rows near the row having id in
+// ascending order of distances. The result includes the row itself.
+func (n *NearestNeighbor) NeighborRowFromID(id string, size int) ([]IDDist, error) {
+	n.m.RLock()
+	defer n.m.RUnlock()
+
+	iid, ok := n.ids[id]
+	if !ok {
+		return nil, fmt.Errorf("row '%v' doesn't exist", id)
+	}
+	if size <= 0 {
+		return []IDDist{}, nil
+	}
+	return n.filter(n.nn.NeighborRowFromID(iid, size+len(n.free)), size), nil
+}
+
+// NeighborRowFromDatum returns at most size rows near v in ascending order
+// of distances.
+func (n *NearestNeighbor) NeighborRowFromDatum(v FeatureVector, size int) ([]IDDist, error) {
+	nnfv, err := nearest.FlattenFeatureVector(data.Map(v))
+	if err != nil {
+		return nil, err
+	}
+
+	n.m.RLock()
+	defer n.m.RUnlock()
+
+	if size <= 0 || len(n.ids) == 0 {
+		return []IDDist{}, nil
+	}
+	return n.filter(n.nn.NeighborRowFromFV(nnfv, size+len(n.free)), size), nil
+}
+
+// SimilarRowFromID returns at most size rows similar to the row having id in
+// descending order of scores. The result includes the row itself.
+func (n *NearestNeighbor) SimilarRowFromID(id string, size int) ([]IDScore, error) {
+	res, err := n.NeighborRowFromID(id, size)
+	if err != nil {
+		return nil, err
+	}
+	return n.toScores(res), nil
+}
+
+// SimilarRowFromDatum returns at most size rows similar to v in descending
+// order of scores.
+func (n *NearestNeighbor) SimilarRowFromDatum(v FeatureVector, size int) ([]IDScore, error) {
+	res, err := n.NeighborRowFromDatum(v, size)
+	if err != nil {
+		return nil, err
+	}
+	return n.toScores(res), nil
+}
+
+// filter converts internal IDs to row IDs and removes deleted rows. It
+// requires read lock.
+func (n *NearestNeighbor) filter(res []nearest.IDist, size int) []IDDist {
+	ret := make([]IDDist, 0, size)
+	for _, d := range res {
+		key := n.keys[d.ID-1]
+		if key == "" {
+			continue
+		}
+		ret = append(ret, IDDist{
+			ID:   key,
+			Dist: d.Dist,
+		})
+		if len(ret) == size {
+			break
+		}
+	}
+	return ret
+}
+
+func (n *NearestNeighbor) toScores(res []IDDist) []IDScore {
+	ret := make([]IDScore, len(res))
+	for i, d := range res {
+		s := -d.Dist
+		if n.algorithm != EuclidLSH {
+			s++
+		}
+		ret[i] = IDScore{
+			ID:    d.ID,
+			Score: s,
+		}
+	}
+	return ret
+}
+
+const (
+	nearestNeighborFormatVersion uint8 = 1
+)
+
+type nearestNeighborMsgpack struct {
+	_struct struct{} `codec:",toarray"`
+
+	Algorithm Algorithm
+	HashNum   int
+
+	Keys []string
+}
+
+// Save saves the current state of NearestNeighbor.
+func (n *NearestNeighbor) Save(w io.Writer) error {
+	n.m.RLock()
+	defer n.m.RUnlock()
+
+	if _, err := w.Write([]byte{nearestNeighborFormatVersion}); err != nil {
+		return err
+	}
+
+	enc := codec.NewEncoder(w, nnMsgpackHandle)
+	if err := enc.Encode(&nearestNeighborMsgpack{
+		Algorithm: n.algorithm,
+		HashNum:   n.hashNum,
+		Keys:      n.keys,
+	}); err != nil {
+		return err
+	}
+	return nearest.Save(n.nn, w)
+}
+
+// LoadNearestNeighbor loads NearestNeighbor from the saved data.
+func LoadNearestNeighbor(r io.Reader) (*NearestNeighbor, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadNearestNeighborFormatV1(r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of NearestNeighbor container: %v", formatVersion[0])
+	}
+}
+
+func loadNearestNeighborFormatV1(r io.Reader) (*NearestNeighbor, error) {
+	m := nearestNeighborMsgpack{}
+	dec := codec.NewDecoder(r, nnMsgpackHandle)
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	nn, err := nearest.Load(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &NearestNeighbor{
+		nn:        nn,
+		algorithm: m.Algorithm,
+		hashNum:   m.HashNum,
+		ids:       make(map[string]nearest.ID),
+		keys:      m.Keys,
+	}
+	for i, key := range ret.keys {
+		iid := nearest.ID(i + 1)
+		if key == "" {
+			ret.free = append(ret.free, iid)
+			continue
+		}
+		ret.ids[key] = iid
+	}
+	return ret, nil
+}
+
+// FeatureVector is a type for feature vectors.
+type FeatureVector data.Map
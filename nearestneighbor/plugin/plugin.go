@@ -0,0 +1,17 @@
+package plugin
+
+import (
+	"github.com/sensorbee/jubatus/nearestneighbor"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+)
+
+func init() {
+	udf.MustRegisterGlobalUDSCreator("jubanearest_neighbor", &nearestneighbor.StateCreator{})
+
+	udf.MustRegisterGlobalUDF("jubanearest_neighbor_set_row", udf.MustConvertGeneric(nearestneighbor.SetRow))
+	udf.MustRegisterGlobalUDF("jubanearest_neighbor_delete_row", udf.MustConvertGeneric(nearestneighbor.DeleteRow))
+	udf.MustRegisterGlobalUDF("jubanearest_neighbor_neighbor_row_from_id", udf.MustConvertGeneric(nearestneighbor.NeighborRowFromID))
+	udf.MustRegisterGlobalUDF("jubanearest_neighbor_neighbor_row_from_datum", udf.MustConvertGeneric(nearestneighbor.NeighborRowFromDatum))
+	udf.MustRegisterGlobalUDF("jubanearest_neighbor_similar_row_from_id", udf.MustConvertGeneric(nearestneighbor.SimilarRowFromID))
+	udf.MustRegisterGlobalUDF("jubanearest_neighbor_similar_row_from_datum", udf.MustConvertGeneric(nearestneighbor.SimilarRowFromDatum))
+}
@@ -0,0 +1,316 @@
+package nearestneighbor
+
+import (
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/fvconverter"
+	"github.com/sensorbee/jubatus/internal/pluginutil"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// State is a state which has a NearestNeighbor. Writing a tuple to the state
+// sets the row having the ID in the tuple.
+type State struct {
+	nn                 *NearestNeighbor
+	idField            string
+	featureVectorField string
+
+	// converter converts feature vectors before they're passed to the
+	// nearest neighbor. It's nil when feature vectors are used as they are.
+	converter *fvconverter.Converter
+}
+
+var _ core.SavableSharedState = &State{}
+
+type stateMsgpack struct {
+	_struct            struct{} `codec:",toarray"`
+	IDField            string
+	FeatureVectorField string
+}
+
+// StateCreator is used by BQL to create or load a State as a UDS.
+type StateCreator struct {
+}
+
+var _ udf.UDSLoader = &StateCreator{}
+
+// CreateState creates a new State.
+func (c *StateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	id, err := pluginutil.ExtractParamAsStringWithDefault(params, "id_field", "id")
+	if err != nil {
+		return nil, err
+	}
+	fv, err := pluginutil.ExtractParamAsStringWithDefault(params, "feature_vector_field", "feature_vector")
+	if err != nil {
+		return nil, err
+	}
+
+	algoName, err := pluginutil.ExtractParamAsString(params, "method")
+	if err != nil {
+		return nil, err
+	}
+
+	var algo Algorithm
+	switch strings.ToLower(algoName) {
+	case "lsh":
+		algo = LSH
+	case "minhash":
+		algo = Minhash
+	case "euclid_lsh":
+		algo = EuclidLSH
+	default:
+		return nil, fmt.Errorf("invalid method: %s", algoName)
+	}
+
+	hashNum, err := pluginutil.ExtractParamAsBoundedInt(params, "hash_num")
+	if err != nil {
+		return nil, err
+	}
+
+	conv, err := fvconverter.ExtractParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	nn, err := NewNearestNeighbor(algo, hashNum)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize nearest neighbor: %v", err)
+	}
+	return &State{
+		nn:                 nn,
+		idField:            id,
+		featureVectorField: fv,
+		converter:          conv,
+	}, nil
+}
+
+var (
+	nnMsgpackHandle = &codec.MsgpackHandle{
+		RawToString: true,
+	}
+)
+
+func init() {
+	nnMsgpackHandle.MapType = reflect.TypeOf(map[string]interface{}{})
+}
+
+// LoadState loads a new State.
+func (c *StateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadStateFormatV1(ctx, r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of nearest neighbor State container: %v", formatVersion[0])
+	}
+}
+
+func loadStateFormatV1(ctx *core.Context, r io.Reader) (core.SharedState, error) {
+	var d stateMsgpack
+	dec := codec.NewDecoder(r, nnMsgpackHandle)
+	if err := dec.Decode(&d); err != nil {
+		return nil, err
+	}
+
+	conv, err := fvconverter.Load(r)
+	if err != nil {
+		return nil, err
+	}
+	nn, err := LoadNearestNeighbor(r)
+	if err != nil {
+		return nil, err
+	}
+	return &State{
+		nn:                 nn,
+		idField:            d.IDField,
+		featureVectorField: d.FeatureVectorField,
+		converter:          conv,
+	}, nil
+}
+
+// Terminate terminates the state.
+func (*State) Terminate(ctx *core.Context) error {
+	return nil
+}
+
+// Write sets the row having the ID in the tuple.
+func (s *State) Write(ctx *core.Context, t *core.Tuple) error {
+	vid, ok := t.Data[s.idField]
+	if !ok {
+		return fmt.Errorf("%s field is missing", s.idField)
+	}
+	id, err := data.AsString(vid)
+	if err != nil {
+		return fmt.Errorf("%s value is not a string: %v", s.idField, err)
+	}
+
+	vfv, ok := t.Data[s.featureVectorField]
+	if !ok {
+		return fmt.Errorf("%s field is missing", s.featureVectorField)
+	}
+	fv, err := data.AsMap(vfv)
+	if err != nil {
+		return fmt.Errorf("%s value is not a map: %v", s.featureVectorField, err)
+	}
+	fv, err = s.converter.ConvertAndUpdate(fv)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.nn.SetRow(id, FeatureVector(fv))
+	return err
+}
+
+const (
+	nnStateFormatVersion = 1
+)
+
+// Save is provided as a part of core.SavableSharedState.
+func (s *State) Save(ctx *core.Context, w io.Writer, params data.Map) error {
+	if _, err := w.Write([]byte{nnStateFormatVersion}); err != nil {
+		return err
+	}
+
+	enc := codec.NewEncoder(w, nnMsgpackHandle)
+	if err := enc.Encode(&stateMsgpack{
+		IDField:            s.idField,
+		FeatureVectorField: s.featureVectorField,
+	}); err != nil {
+		return err
+	}
+	if err := s.converter.Save(w); err != nil {
+		return err
+	}
+	return s.nn.Save(w)
+}
+
+// SetRow sets featureVector to the row having id. It returns true when a new
+// row is created.
+func SetRow(ctx *core.Context, stateName string, id string, featureVector data.Map) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	fv, err := s.converter.ConvertAndUpdate(featureVector)
+	if err != nil {
+		return false, err
+	}
+	return s.nn.SetRow(id, FeatureVector(fv))
+}
+
+// DeleteRow deletes the row having id. It returns false when the row doesn't
+// exist.
+func DeleteRow(ctx *core.Context, stateName string, id string) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	return s.nn.DeleteRow(id), nil
+}
+
+// NeighborRowFromID returns at most size rows near the row having id. Each
+// element of the result is a map having "id" and "distance".
+func NeighborRowFromID(ctx *core.Context, stateName string, id string, size int) (data.Array, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.nn.NeighborRowFromID(id, size)
+	if err != nil {
+		return nil, err
+	}
+	return idDistsToArray(res), nil
+}
+
+// NeighborRowFromDatum returns at most size rows near featureVector. Each
+// element of the result is a map having "id" and "distance".
+func NeighborRowFromDatum(ctx *core.Context, stateName string, featureVector data.Map, size int) (data.Array, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	fv, err := s.converter.Convert(featureVector)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.nn.NeighborRowFromDatum(FeatureVector(fv), size)
+	if err != nil {
+		return nil, err
+	}
+	return idDistsToArray(res), nil
+}
+
+// SimilarRowFromID returns at most size rows similar to the row having id.
+// Each element of the result is a map having "id" and "score".
+func SimilarRowFromID(ctx *core.Context, stateName string, id string, size int) (data.Array, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.nn.SimilarRowFromID(id, size)
+	if err != nil {
+		return nil, err
+	}
+	return idScoresToArray(res), nil
+}
+
+// SimilarRowFromDatum returns at most size rows similar to featureVector.
+// Each element of the result is a map having "id" and "score".
+func SimilarRowFromDatum(ctx *core.Context, stateName string, featureVector data.Map, size int) (data.Array, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	fv, err := s.converter.Convert(featureVector)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.nn.SimilarRowFromDatum(FeatureVector(fv), size)
+	if err != nil {
+		return nil, err
+	}
+	return idScoresToArray(res), nil
+}
+
+func idDistsToArray(res []IDDist) data.Array {
+	ret := make(data.Array, len(res))
+	for i, r := range res {
+		ret[i] = data.Map{
+			"id":       data.String(r.ID),
+			"distance": data.Float(r.Dist),
+		}
+	}
+	return ret
+}
+
+func idScoresToArray(res []IDScore) data.Array {
+	ret := make(data.Array, len(res))
+	for i, r := range res {
+		ret[i] = data.Map{
+			"id":    data.String(r.ID),
+			"score": data.Float(r.Score),
+		}
+	}
+	return ret
+}
+
+func lookupState(ctx *core.Context, stateName string) (*State, error) {
+	st, err := ctx.SharedStates.Get(stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := st.(*State); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("state '%v' isn't a nearest neighbor state", stateName)
+}
@@ -0,0 +1,147 @@
+package nearestneighbor
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestNearestNeighborState(t *testing.T) {
+	for _, method := range []string{"lsh", "minhash", "euclid_lsh"} {
+		method := method
+		Convey("Given a nearest neighbor state using "+method, t, func() {
+			ctx := core.NewContext(nil)
+			c := StateCreator{}
+			ss, err := c.CreateState(ctx, data.Map{
+				"method":   data.String(method),
+				"hash_num": data.Int(512),
+			})
+			So(err, ShouldBeNil)
+			So(ctx.SharedStates.Add("nn", "jubanearest_neighbor", ss), ShouldBeNil)
+
+			setRow := func(id string, fv data.Map) {
+				So(ss.(*State).Write(ctx, &core.Tuple{
+					Data: data.Map{
+						"id":             data.String(id),
+						"feature_vector": fv,
+					},
+				}), ShouldBeNil)
+			}
+			setRow("a", data.Map{"x": data.Int(1), "y": data.Int(1)})
+			setRow("b", data.Map{"x": data.Int(1), "y": data.Int(1), "z": data.Int(1)})
+			setRow("c", data.Map{"p": data.Int(1), "q": data.Int(1)})
+
+			query := data.Map{"x": data.Int(1), "y": data.Int(1)}
+
+			Convey("when getting neighbor rows from a datum", func() {
+				res, err := NeighborRowFromDatum(ctx, "nn", query, 3)
+				So(err, ShouldBeNil)
+				So(len(res), ShouldEqual, 3)
+				ids, dists := idsAndDists(res)
+
+				Convey("the same row should be the nearest with zero distance.", func() {
+					So(ids[0], ShouldEqual, "a")
+					So(dists[0], ShouldEqual, 0)
+				})
+
+				Convey("the overlapping row should be nearer than the disjoint row.", func() {
+					So(ids[1:], ShouldResemble, []string{"b", "c"})
+					So(dists[1], ShouldBeGreaterThan, 0)
+					So(dists[2], ShouldBeGreaterThan, dists[1])
+				})
+			})
+
+			Convey("when getting neighbor rows with a size smaller than the number of rows", func() {
+				res, err := NeighborRowFromDatum(ctx, "nn", query, 1)
+				So(err, ShouldBeNil)
+
+				Convey("it should only return the nearest row.", func() {
+					ids, _ := idsAndDists(res)
+					So(ids, ShouldResemble, []string{"a"})
+				})
+			})
+
+			Convey("when deleting a row", func() {
+				deleted, err := DeleteRow(ctx, "nn", "a")
+				So(err, ShouldBeNil)
+				So(deleted, ShouldBeTrue)
+
+				Convey("it should not be returned as a neighbor.", func() {
+					res, err := NeighborRowFromDatum(ctx, "nn", query, 3)
+					So(err, ShouldBeNil)
+					ids, _ := idsAndDists(res)
+					So(ids, ShouldResemble, []string{"b", "c"})
+				})
+
+				Convey("getting neighbor rows from its ID should fail.", func() {
+					_, err := NeighborRowFromID(ctx, "nn", "a", 3)
+					So(err, ShouldNotBeNil)
+				})
+
+				Convey("deleting it again should return false.", func() {
+					deleted, err := DeleteRow(ctx, "nn", "a")
+					So(err, ShouldBeNil)
+					So(deleted, ShouldBeFalse)
+				})
+
+				Convey("and setting a row again", func() {
+					setRow("d", data.Map{"x": data.Int(1), "y": data.Int(1)})
+
+					Convey("the new row should be returned instead.", func() {
+						res, err := NeighborRowFromDatum(ctx, "nn", query, 3)
+						So(err, ShouldBeNil)
+						ids, dists := idsAndDists(res)
+						So(ids, ShouldResemble, []string{"d", "b", "c"})
+						So(dists[0], ShouldEqual, 0)
+					})
+				})
+			})
+
+			Convey("when deleting a row which doesn't exist", func() {
+				deleted, err := DeleteRow(ctx, "nn", "x")
+
+				Convey("it should return false.", func() {
+					So(err, ShouldBeNil)
+					So(deleted, ShouldBeFalse)
+				})
+			})
+
+			Convey("when saving and loading it after deleting a row", func() {
+				deleted, err := DeleteRow(ctx, "nn", "b")
+				So(err, ShouldBeNil)
+				So(deleted, ShouldBeTrue)
+
+				buf := bytes.NewBuffer(nil)
+				So(ss.(*State).Save(ctx, buf, data.Map{}), ShouldBeNil)
+				ss2, err := c.LoadState(ctx, buf, data.Map{})
+				So(err, ShouldBeNil)
+				So(ctx.SharedStates.Add("nn2", "jubanearest_neighbor", ss2), ShouldBeNil)
+
+				Convey("the loaded state should return the same neighbors and distances.", func() {
+					res, err := NeighborRowFromDatum(ctx, "nn", query, 3)
+					So(err, ShouldBeNil)
+					res2, err := NeighborRowFromDatum(ctx, "nn2", query, 3)
+					So(err, ShouldBeNil)
+					So(res2, ShouldResemble, res)
+
+					ids, dists := idsAndDists(res2)
+					So(ids, ShouldResemble, []string{"a", "c"})
+					So(dists[0], ShouldEqual, 0)
+				})
+			})
+		})
+	}
+}
+
+func idsAndDists(res data.Array) ([]string, []float64) {
+	ids := make([]string, len(res))
+	dists := make([]float64, len(res))
+	for i, r := range res {
+		m := r.(data.Map)
+		ids[i], _ = data.AsString(m["id"])
+		dists[i], _ = data.AsFloat(m["distance"])
+	}
+	return ids, dists
+}
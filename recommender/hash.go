@@ -0,0 +1,41 @@
+package recommender
+
+import (
+	"github.com/sensorbee/jubatus/internal/nearest"
+)
+
+// hashEngine is an engine using nearest.Neighbor. Rows cannot be removed from
+// nearest.Neighbor, so Recommender filters cleared rows out.
+//
+// jubatus::core::recommender::nearest_neighbor_recommender
+type hashEngine struct {
+	nn nearest.Neighbor
+
+	// euclid is true when the distance isn't normalized to [0, 1].
+	euclid bool
+}
+
+func (h *hashEngine) setRow(id nearest.ID, r row) {
+	h.nn.SetRow(id, nearest.NewFeatureVector(r))
+}
+
+func (h *hashEngine) clearRow(id nearest.ID, r row) {
+}
+
+// similarRow converts distances to scores. The score is 1 - distance for LSH
+// and Minhash, and -distance for EuclidLSH.
+func (h *hashEngine) similarRow(r row, size int) []idScore {
+	res := h.nn.NeighborRowFromFV(nearest.NewFeatureVector(r), size)
+	ret := make([]idScore, len(res))
+	for i, d := range res {
+		s := -d.Dist
+		if !h.euclid {
+			s++
+		}
+		ret[i] = idScore{
+			id:    d.ID,
+			score: s,
+		}
+	}
+	return ret
+}
@@ -0,0 +1,37 @@
+package recommender
+
+import (
+	"github.com/sensorbee/jubatus/internal/nearest"
+)
+
+// invertedIndex is an engine which calculates cosine similarities between
+// rows sharing at least one column.
+type invertedIndex struct {
+	ii *nearest.InvertedIndex
+}
+
+func newInvertedIndex() *invertedIndex {
+	return &invertedIndex{
+		ii: nearest.NewInvertedIndex(),
+	}
+}
+
+func (e *invertedIndex) setRow(id nearest.ID, r row) {
+	e.ii.SetRow(id, r)
+}
+
+func (e *invertedIndex) clearRow(id nearest.ID, r row) {
+	e.ii.ClearRow(id, r)
+}
+
+func (e *invertedIndex) similarRow(r row, size int) []idScore {
+	res := e.ii.SimilarRow(r, size)
+	ret := make([]idScore, len(res))
+	for i, s := range res {
+		ret[i] = idScore{
+			id:    s.ID,
+			score: s.Score,
+		}
+	}
+	return ret
+}
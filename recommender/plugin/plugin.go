@@ -0,0 +1,18 @@
+package plugin
+
+import (
+	"github.com/sensorbee/jubatus/recommender"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+)
+
+func init() {
+	udf.MustRegisterGlobalUDSCreator("jubarecommender", &recommender.StateCreator{})
+
+	udf.MustRegisterGlobalUDF("jubarecommender_update_row", udf.MustConvertGeneric(recommender.UpdateRow))
+	udf.MustRegisterGlobalUDF("jubarecommender_clear_row", udf.MustConvertGeneric(recommender.ClearRow))
+	udf.MustRegisterGlobalUDF("jubarecommender_complete_row_from_id", udf.MustConvertGeneric(recommender.CompleteRowFromID))
+	udf.MustRegisterGlobalUDF("jubarecommender_complete_row_from_datum", udf.MustConvertGeneric(recommender.CompleteRowFromDatum))
+	udf.MustRegisterGlobalUDF("jubarecommender_similar_row_from_id", udf.MustConvertGeneric(recommender.SimilarRowFromID))
+	udf.MustRegisterGlobalUDF("jubarecommender_similar_row_from_datum", udf.MustConvertGeneric(recommender.SimilarRowFromDatum))
+	udf.MustRegisterGlobalUDF("jubarecommender_decode_row", udf.MustConvertGeneric(recommender.DecodeRow))
+}
@@ -0,0 +1,412 @@
+package recommender
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/nearest"
+	"github.com/sensorbee/jubatus/internal/nested"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"sync"
+)
+
+// Recommender holds rows identified by string IDs and finds rows similar to
+// a given row. It also completes missing columns of a row from similar rows.
+type Recommender struct {
+	algorithm Algorithm
+	hashNum   int
+	engine    engine
+
+	// ids maps a row ID to the internal ID used by the engine.
+	ids map[string]nearest.ID
+	// keys[i] is the row ID of the internal ID i+1. It's empty when the row
+	// has been cleared.
+	keys []string
+	// rows[i] is the row of the internal ID i+1.
+	rows []row
+	// free has internal IDs of cleared rows which will be reused.
+	free []nearest.ID
+
+	m sync.RWMutex
+}
+
+const (
+	// InvalidAlgorithm represents an invalid recommender algorithm.
+	InvalidAlgorithm Algorithm = iota
+	// InvertedIndex represents an inverted index with cosine similarity.
+	InvertedIndex
+	// LSH represents locality sensitive hashing.
+	LSH
+	// Minhash represents minhash.
+	Minhash
+	// EuclidLSH represents locality sensitive hashing with euclidean distance.
+	EuclidLSH
+)
+
+// Algorithm is an enum type which represents recommender algorithms.
+type Algorithm int
+
+// IDScore is a row ID with its similarity score. A larger score means more
+// similar.
+type IDScore struct {
+	ID    string
+	Score float32
+}
+
+// engine searches similar rows by internal IDs.
+type engine interface {
+	// setRow registers a row. When the row has already been registered, the
+	// caller must call clearRow with the old row before calling setRow.
+	setRow(id nearest.ID, r row)
+
+	// clearRow removes the row from the index if the engine supports it.
+	clearRow(id nearest.ID, r row)
+
+	// similarRow returns at most size rows sorted by their scores in
+	// descending order. The result can contain cleared rows.
+	similarRow(r row, size int) []idScore
+}
+
+type idScore struct {
+	id    nearest.ID
+	score float32
+}
+
+func newEngine(algo Algorithm, hashNum int) (engine, error) {
+	switch algo {
+	case InvertedIndex:
+		return newInvertedIndex(), nil
+	case LSH:
+		return &hashEngine{nn: nearest.NewLSH(hashNum)}, nil
+	case Minhash:
+		return &hashEngine{nn: nearest.NewMinhash(hashNum)}, nil
+	case EuclidLSH:
+		return &hashEngine{nn: nearest.NewEuclidLSH(hashNum), euclid: true}, nil
+	default:
+		return nil, errors.New("invalid recommender algorithm")
+	}
+}
+
+// NewRecommender creates a Recommender. hashNum is the number of hash bits
+// and is only used by LSH, Minhash, and EuclidLSH.
+func NewRecommender(algo Algorithm, hashNum int) (*Recommender, error) {
+	if algo != InvertedIndex && hashNum <= 0 {
+		return nil, errors.New("number of hash bits must be greater than zero")
+	}
+
+	e, err := newEngine(algo, hashNum)
+	if err != nil {
+		return nil, err
+	}
+	return &Recommender{
+		algorithm: algo,
+		hashNum:   hashNum,
+		engine:    e,
+		ids:       make(map[string]nearest.ID),
+	}, nil
+}
+
+// UpdateRow merges columns of v into the row having id. Existing columns are
+// overwritten. It returns true when a new row is created.
+func (r *Recommender) UpdateRow(id string, v FeatureVector) (bool, error) {
+	if id == "" {
+		return false, errors.New("id must not be empty")
+	}
+	nr, err := v.toRow()
+	if err != nil {
+		return false, err
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if iid, ok := r.ids[id]; ok {
+		old := r.rows[iid-1]
+		r.engine.clearRow(iid, old)
+		merged := make(row, len(old)+len(nr))
+		for k, x := range old {
+			merged[k] = x
+		}
+		for k, x := range nr {
+			merged[k] = x
+		}
+		r.rows[iid-1] = merged
+		r.engine.setRow(iid, merged)
+		return false, nil
+	}
+
+	var iid nearest.ID
+	if n := len(r.free); n > 0 {
+		iid = r.free[n-1]
+		r.free = r.free[:n-1]
+		r.keys[iid-1] = id
+		r.rows[iid-1] = nr
+	} else {
+		r.keys = append(r.keys, id)
+		r.rows = append(r.rows, nr)
+		iid = nearest.ID(len(r.keys))
+	}
+	r.ids[id] = iid
+	r.engine.setRow(iid, nr)
+	return true, nil
+}
+
+// ClearRow removes the row having id. It returns false when the row doesn't
+// exist.
+func (r *Recommender) ClearRow(id string) bool {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	iid, ok := r.ids[id]
+	if !ok {
+		return false
+	}
+	r.engine.clearRow(iid, r.rows[iid-1])
+	delete(r.ids, id)
+	r.keys[iid-1] = ""
+	r.rows[iid-1] = nil
+	r.free = append(r.free, iid)
+	return true
+}
+
+// Clear removes all rows.
+func (r *Recommender) Clear() {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	// The arguments have already been validated.
+	r.engine, _ = newEngine(r.algorithm, r.hashNum)
+	r.ids = make(map[string]nearest.ID)
+	r.keys = nil
+	r.rows = nil
+	r.free = nil
+}
+
+// DecodeRow returns the row having id.
+func (r *Recommender) DecodeRow(id string) (data.Map, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	rw, err := r.lookupRow(id)
+	if err != nil {
+		return nil, err
+	}
+	return nested.Unflatten(rw), nil
+}
+
+// SimilarRowFromID returns at most size rows similar to the row having id.
+// The result includes the row itself.
+func (r *Recommender) SimilarRowFromID(id string, size int) ([]IDScore, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	rw, err := r.lookupRow(id)
+	if err != nil {
+		return nil, err
+	}
+	return r.similarRow(rw, size), nil
+}
+
+// SimilarRowFromDatum returns at most size rows similar to v.
+func (r *Recommender) SimilarRowFromDatum(v FeatureVector, size int) ([]IDScore, error) {
+	rw, err := v.toRow()
+	if err != nil {
+		return nil, err
+	}
+
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return r.similarRow(rw, size), nil
+}
+
+// CompleteRowFromID returns the row having id whose missing columns are
+// filled with the average of the size most similar rows. The row itself
+// isn't used for the average.
+func (r *Recommender) CompleteRowFromID(id string, size int) (data.Map, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	rw, err := r.lookupRow(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := r.completeRow(rw, size, id)
+	for k, x := range rw {
+		ret[k] = x
+	}
+	return nested.Unflatten(ret), nil
+}
+
+// CompleteRowFromDatum returns the average of the size most similar rows of
+// v. Columns v has are kept as they are.
+func (r *Recommender) CompleteRowFromDatum(v FeatureVector, size int) (data.Map, error) {
+	rw, err := v.toRow()
+	if err != nil {
+		return nil, err
+	}
+
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	ret := r.completeRow(rw, size, "")
+	for k, x := range rw {
+		ret[k] = x
+	}
+	return nested.Unflatten(ret), nil
+}
+
+// lookupRow returns the row having id. It requires read lock.
+func (r *Recommender) lookupRow(id string) (row, error) {
+	iid, ok := r.ids[id]
+	if !ok {
+		return nil, fmt.Errorf("row '%v' doesn't exist", id)
+	}
+	return r.rows[iid-1], nil
+}
+
+// similarRow returns at most size rows similar to rw excluding cleared rows.
+// It requires read lock.
+func (r *Recommender) similarRow(rw row, size int) []IDScore {
+	if size <= 0 || len(r.ids) == 0 {
+		return []IDScore{}
+	}
+
+	// The engine can return cleared rows.
+	res := r.engine.similarRow(rw, size+len(r.free))
+	ret := make([]IDScore, 0, size)
+	for _, s := range res {
+		key := r.keys[s.id-1]
+		if key == "" {
+			continue
+		}
+		ret = append(ret, IDScore{
+			ID:    key,
+			Score: s.score,
+		})
+		if len(ret) == size {
+			break
+		}
+	}
+	return ret
+}
+
+// completeRow returns the average of the size most similar rows of rw. The
+// row having exclude isn't used. It requires read lock.
+func (r *Recommender) completeRow(rw row, size int, exclude string) row {
+	n := size
+	if exclude != "" {
+		n++
+	}
+
+	ret := row{}
+	cnt := 0
+	for _, s := range r.similarRow(rw, n) {
+		if s.ID == exclude || cnt == size {
+			continue
+		}
+		cnt++
+		for k, x := range r.rows[r.ids[s.ID]-1] {
+			ret[k] += x
+		}
+	}
+	for k := range ret {
+		ret[k] /= float32(cnt)
+	}
+	return ret
+}
+
+const (
+	recommenderFormatVersion uint8 = 1
+)
+
+type recommenderMsgpack struct {
+	_struct struct{} `codec:",toarray"`
+
+	Algorithm Algorithm
+	HashNum   int
+
+	Keys []string
+	Rows []row
+}
+
+// Save saves the current state of Recommender. The index of the engine isn't
+// saved because it can be rebuilt from rows.
+func (r *Recommender) Save(w io.Writer) error {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	if _, err := w.Write([]byte{recommenderFormatVersion}); err != nil {
+		return err
+	}
+
+	enc := codec.NewEncoder(w, recommenderMsgpackHandle)
+	return enc.Encode(&recommenderMsgpack{
+		Algorithm: r.algorithm,
+		HashNum:   r.hashNum,
+		Keys:      r.keys,
+		Rows:      r.rows,
+	})
+}
+
+// LoadRecommender loads Recommender from the saved data.
+func LoadRecommender(r io.Reader) (*Recommender, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadRecommenderFormatV1(r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of Recommender container: %v", formatVersion[0])
+	}
+}
+
+func loadRecommenderFormatV1(r io.Reader) (*Recommender, error) {
+	m := recommenderMsgpack{}
+	dec := codec.NewDecoder(r, recommenderMsgpackHandle)
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	if len(m.Keys) != len(m.Rows) {
+		return nil, errors.New("the number of row IDs and rows are different")
+	}
+
+	rec, err := NewRecommender(m.Algorithm, m.HashNum)
+	if err != nil {
+		return nil, err
+	}
+	rec.keys = m.Keys
+	rec.rows = m.Rows
+	for i, key := range rec.keys {
+		iid := nearest.ID(i + 1)
+		if key == "" {
+			rec.rows[i] = nil
+			rec.free = append(rec.free, iid)
+			continue
+		}
+		rec.ids[key] = iid
+		rec.engine.setRow(iid, rec.rows[i])
+	}
+	return rec, nil
+}
+
+// FeatureVector is a type for feature vectors.
+type FeatureVector data.Map
+
+// row is a flattened feature vector.
+type row map[string]float32
+
+func (v FeatureVector) toRow() (row, error) {
+	ret := make(row, len(v))
+	err := nested.Flatten(data.Map(v), func(key string, value float32) {
+		ret[key] = value
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
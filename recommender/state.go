@@ -0,0 +1,325 @@
+package recommender
+
+import (
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/fvconverter"
+	"github.com/sensorbee/jubatus/internal/pluginutil"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// State is a state which has a Recommender. Writing a tuple to the state
+// updates the row having the ID in the tuple.
+type State struct {
+	recommender        *Recommender
+	idField            string
+	featureVectorField string
+
+	// completeRowNum is the number of similar rows used to complete a row.
+	completeRowNum int
+
+	// converter converts feature vectors before they're passed to the
+	// recommender. It's nil when feature vectors are used as they are.
+	converter *fvconverter.Converter
+}
+
+var _ core.SavableSharedState = &State{}
+
+type stateMsgpack struct {
+	_struct            struct{} `codec:",toarray"`
+	IDField            string
+	FeatureVectorField string
+	CompleteRowNum     int
+}
+
+// StateCreator is used by BQL to create or load a State as a UDS.
+type StateCreator struct {
+}
+
+var _ udf.UDSLoader = &StateCreator{}
+
+// CreateState creates a new State.
+func (c *StateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	id, err := pluginutil.ExtractParamAsStringWithDefault(params, "id_field", "id")
+	if err != nil {
+		return nil, err
+	}
+	fv, err := pluginutil.ExtractParamAsStringWithDefault(params, "feature_vector_field", "feature_vector")
+	if err != nil {
+		return nil, err
+	}
+
+	algoName, err := pluginutil.ExtractParamAsString(params, "method")
+	if err != nil {
+		return nil, err
+	}
+
+	var algo Algorithm
+	switch strings.ToLower(algoName) {
+	case "inverted_index":
+		algo = InvertedIndex
+	case "lsh":
+		algo = LSH
+	case "minhash":
+		algo = Minhash
+	case "euclid_lsh":
+		algo = EuclidLSH
+	default:
+		return nil, fmt.Errorf("invalid method: %s", algoName)
+	}
+
+	var hashNum int
+	if algo != InvertedIndex {
+		hashNum, err = pluginutil.ExtractParamAsBoundedInt(params, "hash_num")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	crNum, err := pluginutil.ExtractParamAsBoundedIntWithDefault(params, "complete_row_num", 128)
+	if err != nil {
+		return nil, err
+	}
+	if crNum <= 0 {
+		return nil, fmt.Errorf("complete_row_num parameter must be greater than zero")
+	}
+	conv, err := fvconverter.ExtractParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	rec, err := NewRecommender(algo, hashNum)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize recommender: %v", err)
+	}
+	return &State{
+		recommender:        rec,
+		idField:            id,
+		featureVectorField: fv,
+		completeRowNum:     crNum,
+		converter:          conv,
+	}, nil
+}
+
+var (
+	recommenderMsgpackHandle = &codec.MsgpackHandle{
+		RawToString: true,
+	}
+)
+
+func init() {
+	recommenderMsgpackHandle.MapType = reflect.TypeOf(map[string]interface{}{})
+}
+
+// LoadState loads a new State.
+func (c *StateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadStateFormatV1(ctx, r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of recommender State container: %v", formatVersion[0])
+	}
+}
+
+func loadStateFormatV1(ctx *core.Context, r io.Reader) (core.SharedState, error) {
+	var d stateMsgpack
+	dec := codec.NewDecoder(r, recommenderMsgpackHandle)
+	if err := dec.Decode(&d); err != nil {
+		return nil, err
+	}
+
+	conv, err := fvconverter.Load(r)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := LoadRecommender(r)
+	if err != nil {
+		return nil, err
+	}
+	return &State{
+		recommender:        rec,
+		idField:            d.IDField,
+		featureVectorField: d.FeatureVectorField,
+		completeRowNum:     d.CompleteRowNum,
+		converter:          conv,
+	}, nil
+}
+
+// Terminate terminates the state.
+func (*State) Terminate(ctx *core.Context) error {
+	return nil
+}
+
+// Write updates the row having the ID in the tuple.
+func (s *State) Write(ctx *core.Context, t *core.Tuple) error {
+	vid, ok := t.Data[s.idField]
+	if !ok {
+		return fmt.Errorf("%s field is missing", s.idField)
+	}
+	id, err := data.AsString(vid)
+	if err != nil {
+		return fmt.Errorf("%s value is not a string: %v", s.idField, err)
+	}
+
+	vfv, ok := t.Data[s.featureVectorField]
+	if !ok {
+		return fmt.Errorf("%s field is missing", s.featureVectorField)
+	}
+	fv, err := data.AsMap(vfv)
+	if err != nil {
+		return fmt.Errorf("%s value is not a map: %v", s.featureVectorField, err)
+	}
+	fv, err = s.converter.ConvertAndUpdate(fv)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.recommender.UpdateRow(id, FeatureVector(fv))
+	return err
+}
+
+const (
+	recommenderStateFormatVersion = 1
+)
+
+// Save is provided as a part of core.SavableSharedState.
+func (s *State) Save(ctx *core.Context, w io.Writer, params data.Map) error {
+	if _, err := w.Write([]byte{recommenderStateFormatVersion}); err != nil {
+		return err
+	}
+
+	enc := codec.NewEncoder(w, recommenderMsgpackHandle)
+	if err := enc.Encode(&stateMsgpack{
+		IDField:            s.idField,
+		FeatureVectorField: s.featureVectorField,
+		CompleteRowNum:     s.completeRowNum,
+	}); err != nil {
+		return err
+	}
+	if err := s.converter.Save(w); err != nil {
+		return err
+	}
+	return s.recommender.Save(w)
+}
+
+// UpdateRow merges columns of featureVector into the row having id. It
+// returns true when a new row is created.
+func UpdateRow(ctx *core.Context, stateName string, id string, featureVector data.Map) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	fv, err := s.converter.ConvertAndUpdate(featureVector)
+	if err != nil {
+		return false, err
+	}
+	return s.recommender.UpdateRow(id, FeatureVector(fv))
+}
+
+// ClearRow removes the row having id. It returns false when the row doesn't
+// exist.
+func ClearRow(ctx *core.Context, stateName string, id string) (bool, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return false, err
+	}
+	return s.recommender.ClearRow(id), nil
+}
+
+// CompleteRowFromID returns the row having id whose missing columns are
+// filled from similar rows.
+func CompleteRowFromID(ctx *core.Context, stateName string, id string) (data.Map, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return s.recommender.CompleteRowFromID(id, s.completeRowNum)
+}
+
+// CompleteRowFromDatum returns featureVector whose missing columns are filled
+// from similar rows.
+func CompleteRowFromDatum(ctx *core.Context, stateName string, featureVector data.Map) (data.Map, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	fv, err := s.converter.Convert(featureVector)
+	if err != nil {
+		return nil, err
+	}
+	return s.recommender.CompleteRowFromDatum(FeatureVector(fv), s.completeRowNum)
+}
+
+// SimilarRowFromID returns at most size rows similar to the row having id.
+// Each element of the result is a map having "id" and "score".
+func SimilarRowFromID(ctx *core.Context, stateName string, id string, size int) (data.Array, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.recommender.SimilarRowFromID(id, size)
+	if err != nil {
+		return nil, err
+	}
+	return idScoresToArray(res), nil
+}
+
+// SimilarRowFromDatum returns at most size rows similar to featureVector.
+// Each element of the result is a map having "id" and "score".
+func SimilarRowFromDatum(ctx *core.Context, stateName string, featureVector data.Map, size int) (data.Array, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	fv, err := s.converter.Convert(featureVector)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.recommender.SimilarRowFromDatum(FeatureVector(fv), size)
+	if err != nil {
+		return nil, err
+	}
+	return idScoresToArray(res), nil
+}
+
+// DecodeRow returns the row having id.
+func DecodeRow(ctx *core.Context, stateName string, id string) (data.Map, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return s.recommender.DecodeRow(id)
+}
+
+func idScoresToArray(res []IDScore) data.Array {
+	ret := make(data.Array, len(res))
+	for i, r := range res {
+		ret[i] = data.Map{
+			"id":    data.String(r.ID),
+			"score": data.Float(r.Score),
+		}
+	}
+	return ret
+}
+
+func lookupState(ctx *core.Context, stateName string) (*State, error) {
+	st, err := ctx.SharedStates.Get(stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := st.(*State); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("state '%v' isn't a recommender state", stateName)
+}
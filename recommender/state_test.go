@@ -0,0 +1,154 @@
+package recommender
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestRecommenderState(t *testing.T) {
+	methods := []data.Map{
+		{"method": data.String("inverted_index")},
+		{"method": data.String("lsh"), "hash_num": data.Int(512)},
+		{"method": data.String("minhash"), "hash_num": data.Int(512)},
+		{"method": data.String("euclid_lsh"), "hash_num": data.Int(512)},
+	}
+
+	for _, params := range methods {
+		params := params
+		params["complete_row_num"] = data.Int(2)
+		Convey("Given a recommender state using "+params["method"].String(), t, func() {
+			ctx := core.NewContext(nil)
+			c := StateCreator{}
+			ss, err := c.CreateState(ctx, params)
+			So(err, ShouldBeNil)
+			So(ctx.SharedStates.Add("rec", "jubarecommender", ss), ShouldBeNil)
+			s := ss.(*State)
+
+			rows := []struct {
+				id string
+				fv data.Map
+			}{
+				{"a1", data.Map{"x": data.Int(1), "y": data.Int(1)}},
+				{"a2", data.Map{"x": data.Int(1), "y": data.Int(1), "z": data.Int(1)}},
+				{"b1", data.Map{"p": data.Int(1), "q": data.Int(1)}},
+				{"b2", data.Map{"p": data.Int(1), "q": data.Int(1), "r": data.Int(1)}},
+			}
+			for _, r := range rows {
+				So(s.Write(ctx, &core.Tuple{
+					Data: data.Map{
+						"id":             data.String(r.id),
+						"feature_vector": r.fv,
+					},
+				}), ShouldBeNil)
+			}
+
+			Convey("when getting similar rows from an ID", func() {
+				res, err := SimilarRowFromID(ctx, "rec", "a1", 2)
+				So(err, ShouldBeNil)
+
+				Convey("it should return the row itself and the similar row.", func() {
+					So(len(res), ShouldEqual, 2)
+					So(res[0].(data.Map)["id"], ShouldEqual, data.String("a1"))
+					So(res[1].(data.Map)["id"], ShouldEqual, data.String("a2"))
+				})
+			})
+
+			Convey("when completing a row from a datum", func() {
+				m, err := CompleteRowFromDatum(ctx, "rec", data.Map{"p": data.Int(1), "q": data.Int(1)})
+				So(err, ShouldBeNil)
+
+				Convey("it should fill missing columns from similar rows.", func() {
+					So(m["p"], ShouldEqual, data.Float(1))
+					So(m["r"], ShouldEqual, data.Float(0.5))
+					_, ok := m["x"]
+					So(ok, ShouldBeFalse)
+				})
+			})
+
+			Convey("when completing a row from an ID", func() {
+				m, err := CompleteRowFromID(ctx, "rec", "a1")
+				So(err, ShouldBeNil)
+
+				Convey("it should fill missing columns without using the row itself.", func() {
+					So(m["x"], ShouldEqual, data.Float(1))
+					So(m["z"], ShouldBeGreaterThanOrEqualTo, data.Float(0.5))
+				})
+			})
+
+			Convey("when updating an existing row", func() {
+				created, err := UpdateRow(ctx, "rec", "a1", data.Map{"y": data.Int(3), "w": data.Int(2)})
+				So(err, ShouldBeNil)
+
+				Convey("it should merge columns.", func() {
+					So(created, ShouldBeFalse)
+					m, err := DecodeRow(ctx, "rec", "a1")
+					So(err, ShouldBeNil)
+					So(m, ShouldResemble, data.Map{
+						"x": data.Float(1),
+						"y": data.Float(3),
+						"w": data.Float(2),
+					})
+				})
+			})
+
+			Convey("when clearing a row", func() {
+				cleared, err := ClearRow(ctx, "rec", "a2")
+				So(err, ShouldBeNil)
+				So(cleared, ShouldBeTrue)
+
+				Convey("it should not be returned as a similar row.", func() {
+					res, err := SimilarRowFromDatum(ctx, "rec", data.Map{"x": data.Int(1), "y": data.Int(1), "z": data.Int(1)}, 4)
+					So(err, ShouldBeNil)
+					for _, r := range res {
+						So(r.(data.Map)["id"], ShouldNotEqual, data.String("a2"))
+					}
+					_, err = DecodeRow(ctx, "rec", "a2")
+					So(err, ShouldNotBeNil)
+				})
+
+				Convey("clearing it again should return false.", func() {
+					cleared, err := ClearRow(ctx, "rec", "a2")
+					So(err, ShouldBeNil)
+					So(cleared, ShouldBeFalse)
+				})
+
+				Convey("a new row should reuse the internal ID.", func() {
+					created, err := UpdateRow(ctx, "rec", "c1", data.Map{"x": data.Int(1), "y": data.Int(1), "z": data.Int(1)})
+					So(err, ShouldBeNil)
+					So(created, ShouldBeTrue)
+					So(len(s.recommender.keys), ShouldEqual, 4)
+
+					res, err := SimilarRowFromID(ctx, "rec", "c1", 1)
+					So(err, ShouldBeNil)
+					So(res[0].(data.Map)["id"], ShouldEqual, data.String("c1"))
+				})
+
+				Convey("and saving and loading it", func() {
+					buf := bytes.NewBuffer(nil)
+					So(s.Save(ctx, buf, data.Map{}), ShouldBeNil)
+					s2, err := c.LoadState(ctx, buf, data.Map{})
+					So(err, ShouldBeNil)
+
+					Convey("the loaded state should be same.", func() {
+						r2 := s2.(*State).recommender
+						So(s2.(*State).completeRowNum, ShouldEqual, 2)
+						So(r2.keys, ShouldResemble, s.recommender.keys)
+						So(r2.rows, ShouldResemble, s.recommender.rows)
+						So(r2.ids, ShouldResemble, s.recommender.ids)
+						So(r2.free, ShouldResemble, s.recommender.free)
+
+						fv := FeatureVector{"p": data.Int(1)}
+						res, err := s.recommender.SimilarRowFromDatum(fv, 3)
+						So(err, ShouldBeNil)
+						res2, err := r2.SimilarRowFromDatum(fv, 3)
+						So(err, ShouldBeNil)
+						So(res2, ShouldResemble, res)
+					})
+				})
+			})
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package regression
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// AROW holds a model for regression using Adaptive Regularization of Weight
+// Vectors (AROW).
+type AROW struct {
+	confidenceRegression
+}
+
+// NewAROW creates an AROW model. regWeight must be greater than zero.
+// sensitivity must not be less than zero.
+func NewAROW(regWeight float32, sensitivity float32) (*AROW, error) {
+	if regWeight <= 0 {
+		return nil, errors.New("regularization weight must be larger than zero")
+	}
+	if sensitivity < 0 {
+		return nil, errors.New("sensitivity must not be less than zero")
+	}
+	a := &AROW{}
+	a.init(regWeight, sensitivity)
+	return a, nil
+}
+
+// Train trains a model with a feature vector and a value.
+//
+// jubatus::core::regression::arow::train
+func (a *AROW) Train(v FeatureVector, value float32) error {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	fv, err := a.prepareTrain(v)
+	if err != nil {
+		return err
+	}
+
+	sign, loss := a.loss(fv, value)
+	if loss <= 0 {
+		return nil
+	}
+
+	beta := 1 / (a.model.variance(fv) + 1/a.regWeight)
+	alpha := sign * loss * beta
+	a.update(fv, alpha, func(cov, x float32) float32 {
+		return cov - beta*cov*cov*x*x
+	})
+	return nil
+}
+
+const (
+	arowFormatVersion = 1
+)
+
+// Save saves the current state of AROW.
+func (a *AROW) Save(w io.Writer) error {
+	a.m.RLock()
+	defer a.m.RUnlock()
+
+	return a.save(w, arowFormatVersion)
+}
+
+// LoadAROW loads AROW from the saved data.
+func LoadAROW(r io.Reader) (*AROW, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		a := &AROW{}
+		if err := a.load(r); err != nil {
+			return nil, err
+		}
+		return a, nil
+	default:
+		return nil, fmt.Errorf("unsupported format version of AROW container: %v", formatVersion[0])
+	}
+}
@@ -0,0 +1,36 @@
+package regression
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+)
+
+// AROWStateCreator is used by BQL to create or load a State having AROW
+// regression algorithm as a UDS.
+type AROWStateCreator struct {
+}
+
+var _ udf.UDSLoader = &AROWStateCreator{}
+
+// CreateState creates a new state for AROW regression.
+func (c *AROWStateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	rw, sen, err := extractRegWeightAndSensitivity(params)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := NewAROW(rw, sen)
+	if err != nil {
+		return nil, err
+	}
+	return newState("arow", r, params)
+}
+
+// LoadState loads a new state for AROW regression.
+func (c *AROWStateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	return loadState(ctx, r, "arow", func(r io.Reader) (Regression, error) {
+		return LoadAROW(r)
+	})
+}
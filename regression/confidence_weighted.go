@@ -0,0 +1,95 @@
+package regression
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ConfidenceWeighted holds a model for regression using Confidence Weighted
+// (CW) learning.
+type ConfidenceWeighted struct {
+	confidenceRegression
+}
+
+// NewConfidenceWeighted creates a ConfidenceWeighted model. regWeight is the
+// confidence parameter of CW and must be greater than zero. sensitivity must
+// not be less than zero.
+func NewConfidenceWeighted(regWeight float32, sensitivity float32) (*ConfidenceWeighted, error) {
+	if regWeight <= 0 {
+		return nil, errors.New("regularization weight must be larger than zero")
+	}
+	if sensitivity < 0 {
+		return nil, errors.New("sensitivity must not be less than zero")
+	}
+	cw := &ConfidenceWeighted{}
+	cw.init(regWeight, sensitivity)
+	return cw, nil
+}
+
+// Train trains a model with a feature vector and a value. The loss is
+// regarded as a negative margin of the classification version of CW.
+//
+// jubatus::core::regression::confidence_weighted::train
+func (cw *ConfidenceWeighted) Train(v FeatureVector, value float32) error {
+	cw.m.Lock()
+	defer cw.m.Unlock()
+
+	fv, err := cw.prepareTrain(v)
+	if err != nil {
+		return err
+	}
+
+	sign, loss := cw.loss(fv, value)
+	if loss <= 0 {
+		return nil
+	}
+	margin := -loss
+	variance := cw.model.variance(fv)
+
+	C := cw.regWeight
+	b := 1 + 2*C*margin
+	gamma := -b + float32(math.Sqrt(float64(b*b-8*C*(margin-C*variance))))
+	if !(gamma > 0) {
+		// gamma can also be NaN.
+		return nil
+	}
+	gamma /= 4 * C * variance
+
+	cw.update(fv, sign*gamma, func(cov, x float32) float32 {
+		return 1 / (1/cov + 2*gamma*C*x*x)
+	})
+	return nil
+}
+
+const (
+	cwFormatVersion = 1
+)
+
+// Save saves the current state of ConfidenceWeighted.
+func (cw *ConfidenceWeighted) Save(w io.Writer) error {
+	cw.m.RLock()
+	defer cw.m.RUnlock()
+
+	return cw.save(w, cwFormatVersion)
+}
+
+// LoadConfidenceWeighted loads ConfidenceWeighted from the saved data.
+func LoadConfidenceWeighted(r io.Reader) (*ConfidenceWeighted, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		cw := &ConfidenceWeighted{}
+		if err := cw.load(r); err != nil {
+			return nil, err
+		}
+		return cw, nil
+	default:
+		return nil, fmt.Errorf("unsupported format version of ConfidenceWeighted container: %v", formatVersion[0])
+	}
+}
@@ -0,0 +1,36 @@
+package regression
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+)
+
+// ConfidenceWeightedStateCreator is used by BQL to create or load a State having ConfidenceWeighted
+// regression algorithm as a UDS.
+type ConfidenceWeightedStateCreator struct {
+}
+
+var _ udf.UDSLoader = &ConfidenceWeightedStateCreator{}
+
+// CreateState creates a new state for ConfidenceWeighted regression.
+func (c *ConfidenceWeightedStateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	rw, sen, err := extractRegWeightAndSensitivity(params)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := NewConfidenceWeighted(rw, sen)
+	if err != nil {
+		return nil, err
+	}
+	return newState("confidence_weighted", r, params)
+}
+
+// LoadState loads a new state for ConfidenceWeighted regression.
+func (c *ConfidenceWeightedStateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	return loadState(ctx, r, "confidence_weighted", func(r io.Reader) (Regression, error) {
+		return LoadConfidenceWeighted(r)
+	})
+}
@@ -0,0 +1,58 @@
+package regression
+
+// Contribution is a contribution of a feature to an estimated value. The
+// contribution is Value * Weight.
+type Contribution struct {
+	// Key is the flattened key of the feature.
+	Key    string
+	Value  float32
+	Weight float32
+}
+
+// Explain returns contributions of features of v to the estimated value.
+func (pa *PassiveAggressive) Explain(v FeatureVector) ([]Contribution, error) {
+	pa.m.RLock()
+	defer pa.m.RUnlock()
+	return pa.explain(v, func(d dim) float32 {
+		return pa.model[d]
+	})
+}
+
+// Explain returns contributions of features of v to the estimated value.
+func (p *Perceptron) Explain(v FeatureVector) ([]Contribution, error) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.explain(v, func(d dim) float32 {
+		return p.model[d]
+	})
+}
+
+// Explain returns contributions of features of v to the estimated value.
+func (c *confidenceRegression) Explain(v FeatureVector) ([]Contribution, error) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	return c.explain(v, func(d dim) float32 {
+		return c.model.get(d).Weight
+	})
+}
+
+// byContribution sorts contributions in the descending order of their
+// absolute values. Ties are broken by keys to make the result deterministic.
+type byContribution []Contribution
+
+func (b byContribution) Len() int {
+	return len(b)
+}
+
+func (b byContribution) Less(i, j int) bool {
+	ci := abs(b[i].Value * b[i].Weight)
+	cj := abs(b[j].Value * b[j].Weight)
+	if ci != cj {
+		return ci > cj
+	}
+	return b[i].Key < b[j].Key
+}
+
+func (b byContribution) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
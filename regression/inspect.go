@@ -0,0 +1,132 @@
+package regression
+
+import (
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/nested"
+	"sort"
+)
+
+// FeatureWeight is a weight of a feature in a linear model.
+type FeatureWeight struct {
+	// Key is the flattened key of the feature rendered by
+	// nested.ReadableKey. Keys of hashed features are "#" followed by their
+	// hash values because original keys aren't kept.
+	Key    string
+	Weight float32
+
+	// Covariance is the variance of the weight. It's only set when
+	// ModelWeights.HasCovariance is true.
+	Covariance float32
+}
+
+// ModelWeights has features having the largest positive weights and the
+// largest negative weights of a model. Positive is sorted in the descending
+// order of weights and Negative is sorted in the ascending order.
+type ModelWeights struct {
+	Positive []FeatureWeight
+	Negative []FeatureWeight
+
+	// HasCovariance is true when the algorithm tracks confidence of weights.
+	HasCovariance bool
+}
+
+// topWeights returns at most n positive and n negative weights. each calls f
+// with every dimension of the model and its weight. Covariance is set when
+// withCov is true. It requires read lock.
+func (l *linearRegression) topWeights(n int, withCov bool, each func(f func(d dim, w weight))) *ModelWeights {
+	var keys map[int]string
+	if l.hashMaxSize == 0 {
+		keys = l.intern.Reverse()
+	}
+	key := func(d dim) string {
+		if keys == nil {
+			return fmt.Sprintf("#%v", int(d))
+		}
+		return nested.ReadableKey(keys[int(d)])
+	}
+
+	var pos, neg byWeight
+	each(func(d dim, w weight) {
+		fw := FeatureWeight{
+			Key:    key(d),
+			Weight: w.Weight,
+		}
+		if withCov {
+			fw.Covariance = w.Covariance
+		}
+		switch {
+		case w.Weight > 0:
+			pos = append(pos, fw)
+		case w.Weight < 0:
+			neg = append(neg, fw)
+		}
+	})
+	sort.Sort(sort.Reverse(pos))
+	sort.Sort(neg)
+	if len(pos) > n {
+		pos = pos[:n]
+	}
+	if len(neg) > n {
+		neg = neg[:n]
+	}
+	return &ModelWeights{
+		Positive:      pos,
+		Negative:      neg,
+		HasCovariance: withCov,
+	}
+}
+
+// TopWeights returns at most n features having the largest positive weights
+// and n features having the largest negative weights.
+func (pa *PassiveAggressive) TopWeights(n int) *ModelWeights {
+	pa.m.RLock()
+	defer pa.m.RUnlock()
+	return pa.topWeights(n, false, pa.model.eachAsWeight)
+}
+
+// TopWeights returns at most n features having the largest positive weights
+// and n features having the largest negative weights.
+func (p *Perceptron) TopWeights(n int) *ModelWeights {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.topWeights(n, false, p.model.eachAsWeight)
+}
+
+// TopWeights returns at most n features having the largest positive weights
+// and n features having the largest negative weights with their covariance.
+func (c *confidenceRegression) TopWeights(n int) *ModelWeights {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	return c.topWeights(n, true, func(f func(d dim, w weight)) {
+		for d, w := range c.model {
+			f(d, w)
+		}
+	})
+}
+
+// eachAsWeight calls f with every dimension and its weight. Covariance of
+// the weight is always zero.
+func (m model) eachAsWeight(f func(d dim, w weight)) {
+	for d, w := range m {
+		f(d, weight{Weight: w})
+	}
+}
+
+// byWeight sorts features in the ascending order of weights. Ties are broken
+// by keys to make the result deterministic.
+type byWeight []FeatureWeight
+
+func (b byWeight) Len() int {
+	return len(b)
+}
+
+func (b byWeight) Less(i, j int) bool {
+	if b[i].Weight != b[j].Weight {
+		return b[i].Weight < b[j].Weight
+	}
+	return b[i].Key < b[j].Key
+}
+
+func (b byWeight) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
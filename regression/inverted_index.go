@@ -0,0 +1,221 @@
+package regression
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/nearest"
+	"github.com/sensorbee/jubatus/internal/nested"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"math/rand"
+	"sync"
+)
+
+// InvertedIndex holds a model for regression using an inverted index. It
+// stores all rows with their values and estimates a value from the values of
+// the k rows having the largest cosine similarities.
+type InvertedIndex struct {
+	ii *nearest.InvertedIndex
+
+	// rows[i] and values[i] are the row and the value whose ID is i+1.
+	rows   []map[string]float32
+	values []float32
+
+	k int
+	// weighted is true when each value is weighted by the similarity of its
+	// row. Otherwise, values are simply averaged.
+	weighted bool
+
+	// for random unlearner
+	maxSize int
+	rg      *rand.Rand
+
+	m sync.RWMutex
+}
+
+// NewInvertedIndex creates an InvertedIndex model. k is the number of similar
+// rows used for estimation. When weighted is true, each value is weighted by
+// the cosine similarity of its row. maxSize is the maximum number of rows and
+// 0 means no limit. When the number of rows exceeds maxSize, a randomly
+// selected row is unlearned.
+func NewInvertedIndex(k int, weighted bool, maxSize int, seed int64) (*InvertedIndex, error) {
+	const maxSizeLimit = 0x7fffffff
+
+	if k <= 0 {
+		return nil, errors.New("number of nearest neighbor must be greater than zero")
+	}
+	if maxSize < 0 {
+		return nil, errors.New("max size must be greater than or equal to zero")
+	}
+	if maxSize > maxSizeLimit {
+		return nil, fmt.Errorf("max size must be less than or equal to %v", maxSizeLimit)
+	}
+
+	// maxSize == 0 means no unlearn.
+	if maxSize == 0 {
+		maxSize = maxSizeLimit
+	}
+
+	return &InvertedIndex{
+		ii:       nearest.NewInvertedIndex(),
+		k:        k,
+		weighted: weighted,
+		maxSize:  maxSize,
+		rg:       rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+// Train trains a model with a feature vector and a value.
+func (n *InvertedIndex) Train(v FeatureVector, value float32) error {
+	r, err := v.toRow()
+	if err != nil {
+		return err
+	}
+
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	var id nearest.ID
+	if len(n.values) < n.maxSize {
+		n.rows = append(n.rows, r)
+		n.values = append(n.values, value)
+		id = nearest.ID(len(n.values))
+	} else {
+		// unlearn
+		id = nearest.ID(n.rg.Intn(n.maxSize)) + 1
+		n.ii.ClearRow(id, n.rows[id-1])
+		n.rows[id-1] = r
+		n.values[id-1] = value
+	}
+	n.ii.SetRow(id, r)
+	return nil
+}
+
+// Estimate estimates a value from a model and a feature vector. It returns
+// zero when no row shares a key with the feature vector.
+//
+// jubatus::core::regression::inverted_index_regression::estimate
+func (n *InvertedIndex) Estimate(v FeatureVector) (float32, error) {
+	r, err := v.toRow()
+	if err != nil {
+		return 0, err
+	}
+
+	n.m.RLock()
+	defer n.m.RUnlock()
+
+	var sum, weightSum float32
+	for _, s := range n.ii.SimilarRow(r, n.k) {
+		w := float32(1)
+		if n.weighted {
+			w = s.Score
+		}
+		sum += w * n.values[s.ID-1]
+		weightSum += w
+	}
+	if weightSum == 0 {
+		return 0, nil
+	}
+	return sum / weightSum, nil
+}
+
+// Clear clears a model.
+func (n *InvertedIndex) Clear() {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	n.ii = nearest.NewInvertedIndex()
+	n.rows = nil
+	n.values = nil
+}
+
+const (
+	invertedIndexFormatVersion uint8 = 1
+)
+
+type invertedIndexMsgpack struct {
+	_struct struct{} `codec:",toarray"`
+
+	Rows   []map[string]float32
+	Values []float32
+
+	K        int
+	Weighted bool
+	MaxSize  int
+}
+
+// Save saves the current state of InvertedIndex. The index isn't saved
+// because it can be rebuilt from rows.
+func (n *InvertedIndex) Save(w io.Writer) error {
+	n.m.RLock()
+	defer n.m.RUnlock()
+
+	if _, err := w.Write([]byte{invertedIndexFormatVersion}); err != nil {
+		return err
+	}
+
+	enc := codec.NewEncoder(w, regressionMsgpackHandle)
+	return enc.Encode(&invertedIndexMsgpack{
+		Rows:   n.rows,
+		Values: n.values,
+
+		K:        n.k,
+		Weighted: n.weighted,
+		MaxSize:  n.maxSize,
+	})
+}
+
+// LoadInvertedIndex loads InvertedIndex from the saved data.
+func LoadInvertedIndex(r io.Reader) (*InvertedIndex, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadInvertedIndexFormatV1(r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of InvertedIndex container: %v", formatVersion[0])
+	}
+}
+
+func loadInvertedIndexFormatV1(r io.Reader) (*InvertedIndex, error) {
+	m := invertedIndexMsgpack{}
+	dec := codec.NewDecoder(r, regressionMsgpackHandle)
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	if len(m.Rows) != len(m.Values) {
+		return nil, errors.New("the number of rows and values are different")
+	}
+
+	n := &InvertedIndex{
+		ii:     nearest.NewInvertedIndex(),
+		rows:   m.Rows,
+		values: m.Values,
+
+		k:        m.K,
+		weighted: m.Weighted,
+
+		maxSize: m.MaxSize,
+		rg:      rand.New(rand.NewSource(0)),
+	}
+	for i, r := range n.rows {
+		n.ii.SetRow(nearest.ID(i+1), r)
+	}
+	return n, nil
+}
+
+// toRow flattens the feature vector.
+func (v FeatureVector) toRow() (map[string]float32, error) {
+	ret := make(map[string]float32, len(v))
+	err := nested.Flatten(data.Map(v), func(key string, value float32) {
+		ret[key] = value
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,75 @@
+package regression
+
+import (
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/pluginutil"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+)
+
+// InvertedIndexStateCreator is used by BQL to create or load a State having
+// inverted index regression algorithm as a UDS.
+type InvertedIndexStateCreator struct {
+}
+
+var _ udf.UDSLoader = &InvertedIndexStateCreator{}
+
+// CreateState creates a new state for inverted index regression.
+func (c *InvertedIndexStateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	nnNum, err := pluginutil.ExtractParamAsBoundedInt(params, "nearest_neighbor_num")
+	if err != nil {
+		return nil, err
+	}
+
+	weight, err := pluginutil.ExtractParamAsStringWithDefault(params, "weight", "uniform")
+	if err != nil {
+		return nil, err
+	}
+	var weighted bool
+	switch weight {
+	case "uniform":
+		weighted = false
+	case "distance":
+		weighted = true
+	default:
+		return nil, fmt.Errorf("invalid weight: %v", weight)
+	}
+
+	unlearn, err := pluginutil.ExtractParamAsStringWithDefault(params, "unlearner", "no")
+	if err != nil {
+		return nil, err
+	}
+	var maxSize int
+	var seed int64
+	switch unlearn {
+	case "no":
+		maxSize = 0
+	case "random":
+		maxSize, err = pluginutil.ExtractParamAsBoundedInt(params, "max_size")
+		if err != nil {
+			return nil, err
+		}
+
+		seed, err = pluginutil.ExtractParamAsIntWithDefault(params, "seed", 0)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid unlearner: %v", unlearn)
+	}
+
+	ii, err := NewInvertedIndex(nnNum, weighted, maxSize, seed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize inverted index regression: %v", err)
+	}
+	return newState("inverted_index", ii, params)
+}
+
+// LoadState loads a new state for inverted index regression.
+func (c *InvertedIndexStateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	return loadState(ctx, r, "inverted_index", func(r io.Reader) (Regression, error) {
+		return LoadInvertedIndex(r)
+	})
+}
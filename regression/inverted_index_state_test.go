@@ -0,0 +1,96 @@
+package regression
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestInvertedIndexStateSaveLoad(t *testing.T) {
+	ctx := core.NewContext(nil)
+	c := InvertedIndexStateCreator{}
+	ss, err := c.CreateState(ctx, data.Map{
+		"nearest_neighbor_num": data.Int(5),
+		"weight":               data.String("distance"),
+		"unlearner":            data.String("random"),
+		"max_size":             data.Int(50),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := ss.(*State)
+
+	for i := 0; i < 100; i++ {
+		k, v := "a", 1
+		if i%2 == 1 {
+			k, v = "b", 5
+		}
+		if err := s.Write(ctx, &core.Tuple{
+			Data: data.Map{
+				"value": data.Int(v),
+				"feature_vector": data.Map{
+					k:   data.Int(10),
+					"n": data.Int(i % 3),
+				},
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Convey("Given a trained InvertedIndex State", t, func() {
+		n := s.regression.(*InvertedIndex)
+
+		Convey("it should not have rows more than max_size.", func() {
+			So(len(n.rows), ShouldEqual, 50)
+			So(len(n.values), ShouldEqual, 50)
+		})
+
+		Convey("it should estimate values from similar rows.", func() {
+			v, err := n.Estimate(FeatureVector{"a": data.Int(1)})
+			So(err, ShouldBeNil)
+			So(v, ShouldAlmostEqual, 1, 0.0001)
+
+			v, err = n.Estimate(FeatureVector{"b": data.Int(1)})
+			So(err, ShouldBeNil)
+			So(v, ShouldAlmostEqual, 5, 0.0001)
+		})
+
+		Convey("it should estimate zero when no row shares a key.", func() {
+			v, err := n.Estimate(FeatureVector{"c": data.Int(1)})
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, 0)
+		})
+
+		Convey("when saving it", func() {
+			buf := bytes.NewBuffer(nil)
+			err := s.Save(ctx, buf, data.Map{})
+
+			Convey("it should succeed.", func() {
+				So(err, ShouldBeNil)
+
+				Convey("and the loaded state should be same.", func() {
+					s2, err := c.LoadState(ctx, buf, data.Map{})
+					So(err, ShouldBeNil)
+
+					n2 := s2.(*State).regression.(*InvertedIndex)
+					So(n2.ii, ShouldResemble, n.ii)
+					So(n2.rows, ShouldResemble, n.rows)
+					So(n2.values, ShouldResemble, n.values)
+					So(n2.k, ShouldEqual, n.k)
+					So(n2.weighted, ShouldEqual, n.weighted)
+					So(n2.maxSize, ShouldEqual, n.maxSize)
+
+					fv := FeatureVector{"a": data.Int(1), "n": data.Int(2)}
+					v, err := n.Estimate(fv)
+					So(err, ShouldBeNil)
+					v2, err := n2.Estimate(fv)
+					So(err, ShouldBeNil)
+					So(v2, ShouldEqual, v)
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,378 @@
+package regression
+
+import (
+	"errors"
+	"github.com/sensorbee/jubatus/internal/intern"
+	"github.com/sensorbee/jubatus/internal/nested"
+	"github.com/sensorbee/jubatus/internal/pruning"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"sync"
+)
+
+// linearRegression is a base of linear regression algorithms. It converts
+// keys of feature vectors into dimensions of the model by interning or
+// hashing them.
+type linearRegression struct {
+	intern *intern.Intern
+	m      sync.RWMutex
+
+	// hashMaxSize is the number of dimensions into which keys of feature
+	// vectors are hashed. intern isn't used when it's greater than zero.
+	hashMaxSize int
+
+	// pruner drops dimensions from the model. It's nil when pruning is
+	// disabled.
+	pruner *pruning.Pruner
+}
+
+// initDims initializes interned keys. It also resets usage of dimensions
+// when pruning is enabled, so it's used to clear the model, too.
+func (l *linearRegression) initDims() {
+	l.intern = intern.New()
+	if l.pruner != nil {
+		l.pruner.Reset()
+	}
+}
+
+// toInternal converts a feature vector to the internal format by hashing or
+// interning keys. It requires write lock.
+func (l *linearRegression) toInternal(v FeatureVector) (fVector, error) {
+	if l.hashMaxSize > 0 {
+		return v.toHashed(l.hashMaxSize)
+	}
+	return v.toInternal(l.intern)
+}
+
+// toInternalForEstimate converts a feature vector to the internal format by
+// hashing or interning keys. Keys which haven't been interned are ignored.
+// It requires read lock.
+func (l *linearRegression) toInternalForEstimate(v FeatureVector) (fVector, error) {
+	if l.hashMaxSize > 0 {
+		return v.toHashed(l.hashMaxSize)
+	}
+	return v.toInternalForEstimate(l.intern)
+}
+
+// dim returns the dimension of a flattened key. It returns zero when the key
+// hasn't been interned. It requires read lock.
+func (l *linearRegression) dim(key string) dim {
+	if l.hashMaxSize > 0 {
+		return dim(intern.Hash(key, l.hashMaxSize))
+	}
+	return dim(l.intern.GetOrZero(key))
+}
+
+// setHashMaxSize sets the number of dimensions into which keys are hashed.
+// trained must be true when the model has any weight. It requires write
+// lock.
+func (l *linearRegression) setHashMaxSize(maxSize int, trained bool) error {
+	if maxSize < 0 {
+		return errors.New("hash max size must not be less than zero")
+	}
+	if trained {
+		return errors.New("hash max size cannot be changed after training")
+	}
+	l.hashMaxSize = maxSize
+	return nil
+}
+
+// HashMaxSize returns the number of dimensions into which keys are hashed.
+// It returns zero when hashing is disabled.
+func (l *linearRegression) HashMaxSize() int {
+	l.m.RLock()
+	defer l.m.RUnlock()
+	return l.hashMaxSize
+}
+
+// SetPruningPolicy sets a policy to drop dimensions from the model. nil
+// disables pruning.
+func (l *linearRegression) SetPruningPolicy(p *PruningPolicy) error {
+	if p != nil && p.Interval == 0 {
+		return errors.New("pruning interval must be greater than zero")
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if p == nil {
+		l.pruner = nil
+		return nil
+	}
+	l.pruner = pruning.New(p)
+	return nil
+}
+
+// PruningPolicy returns the current pruning policy. It returns nil when
+// pruning is disabled.
+func (l *linearRegression) PruningPolicy() *PruningPolicy {
+	l.m.RLock()
+	defer l.m.RUnlock()
+
+	if l.pruner == nil {
+		return nil
+	}
+	p := *l.pruner.Policy
+	return &p
+}
+
+// touch notifies the pruner that v is being trained and prunes m when it's
+// time to do. Interned keys which no longer have dimensions in m are removed.
+// It requires write lock.
+func (l *linearRegression) touch(v fVector, m pruning.Weights) {
+	if l.pruner == nil {
+		return
+	}
+	dims := v.dims()
+	if !l.pruner.Touch(dims) {
+		return
+	}
+
+	// Dimensions of v are kept in live because v is about to be added to
+	// the model.
+	live := l.pruner.Prune([]pruning.Weights{m}, dims)
+	if l.hashMaxSize > 0 {
+		return
+	}
+	l.intern.Compact(func(id int) bool {
+		return live[id]
+	})
+}
+
+// explain returns contributions of features of v. weight returns the weight
+// of a dimension. Features having the same hashed dimension share its
+// weight. It requires read lock.
+func (l *linearRegression) explain(v FeatureVector, weight func(d dim) float32) ([]Contribution, error) {
+	var ret []Contribution
+	if err := nested.Flatten(data.Map(v), func(key string, value float32) {
+		ret = append(ret, Contribution{
+			Key:    key,
+			Value:  value,
+			Weight: weight(l.dim(key)),
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+type linearMsgpack struct {
+	_struct     struct{} `codec:",toarray"`
+	HashMaxSize int
+
+	// Pruner is nil when pruning is disabled.
+	Pruner *pruning.Pruner
+}
+
+// saveDims saves the hash max size, the pruner, and interned keys. It
+// requires read lock.
+func (l *linearRegression) saveDims(w io.Writer) error {
+	enc := codec.NewEncoder(w, regressionMsgpackHandle)
+	if err := enc.Encode(&linearMsgpack{
+		HashMaxSize: l.hashMaxSize,
+		Pruner:      l.pruner,
+	}); err != nil {
+		return err
+	}
+	return l.intern.Save(w)
+}
+
+// loadDims loads the data saved by saveDims.
+func (l *linearRegression) loadDims(r io.Reader) error {
+	dec := codec.NewDecoder(r, regressionMsgpackHandle)
+	var d linearMsgpack
+	if err := dec.Decode(&d); err != nil {
+		return err
+	}
+	l.hashMaxSize = d.HashMaxSize
+	l.pruner = d.Pruner
+	if l.pruner != nil && l.pruner.LastUsed == nil {
+		l.pruner.LastUsed = make(map[int]uint64)
+	}
+
+	i, err := intern.Load(r)
+	if err != nil {
+		return err
+	}
+	l.intern = i
+	return nil
+}
+
+// internModel converts a model saved by format version 1, which has keys of
+// feature vectors as they are, to a model having interned dimensions.
+func (l *linearRegression) internModel(m map[string]float32) model {
+	ret := make(model, len(m))
+	for k, w := range m {
+		ret[dim(l.intern.Get(k))] = w
+	}
+	return ret
+}
+
+// confidenceRegression is a base of linear regression algorithms which track
+// the confidence of each dimension as the diagonal of a covariance matrix.
+type confidenceRegression struct {
+	linearRegression
+	model weights
+
+	regWeight   float32
+	sensitivity float32
+}
+
+func (c *confidenceRegression) init(regWeight, sensitivity float32) {
+	c.model = make(weights)
+	c.initDims()
+	c.regWeight = regWeight
+	c.sensitivity = sensitivity
+}
+
+// Estimate estimates a value from a model and a feature vector.
+func (c *confidenceRegression) Estimate(v FeatureVector) (float32, error) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	fv, err := c.toInternalForEstimate(v)
+	if err != nil {
+		return 0, err
+	}
+	return c.model.estimate(fv), nil
+}
+
+// Clear clears a model.
+func (c *confidenceRegression) Clear() {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.model = make(weights)
+	c.initDims()
+}
+
+// SetHashMaxSize makes the model hash keys of feature vectors into maxSize
+// dimensions instead of interning them, so that the size of the model is
+// bounded. Zero disables hashing. It must be called before training.
+func (c *confidenceRegression) SetHashMaxSize(maxSize int) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.setHashMaxSize(maxSize, len(c.model) > 0)
+}
+
+// prepareTrain converts a feature vector to the internal format and prunes
+// the model when it's time to do. It requires write lock.
+func (c *confidenceRegression) prepareTrain(v FeatureVector) (fVector, error) {
+	fv, err := c.toInternal(v)
+	if err != nil {
+		return nil, err
+	}
+	c.touch(fv, c.model)
+	return fv, nil
+}
+
+// RegWeight returns regularization weight.
+func (c *confidenceRegression) RegWeight() float32 {
+	return c.regWeight
+}
+
+// Sensitivity returns sensitivity.
+func (c *confidenceRegression) Sensitivity() float32 {
+	return c.sensitivity
+}
+
+// loss returns the sign of the error and the epsilon-insensitive loss of fv.
+// The model needs to be updated only when the loss is positive. It requires
+// read lock.
+func (c *confidenceRegression) loss(fv fVector, value float32) (float32, float32) {
+	error := value - c.model.estimate(fv)
+	return sign(error), abs(error) - c.sensitivity
+}
+
+// update moves the weight of each dimension by stepWidth * covariance * x
+// and replaces the covariance with newCov(covariance, x). It requires write
+// lock.
+func (c *confidenceRegression) update(v fVector, stepWidth float32, newCov func(cov, x float32) float32) {
+	for i := range v {
+		dim := v[i].dim
+		x := v[i].value
+
+		w := c.model.get(dim)
+		w.Weight += stepWidth * w.Covariance * x
+		w.Covariance = newCov(w.Covariance, x)
+		c.model[dim] = w
+	}
+}
+
+type confidenceMsgpack struct {
+	_struct struct{} `codec:",toarray"`
+
+	Model weights
+
+	RegWeight   float32
+	Sensitivity float32
+}
+
+// save saves the model with the format version of the algorithm. It requires
+// read lock.
+func (c *confidenceRegression) save(w io.Writer, formatVersion uint8) error {
+	if _, err := w.Write([]byte{formatVersion}); err != nil {
+		return err
+	}
+
+	enc := codec.NewEncoder(w, regressionMsgpackHandle)
+	if err := enc.Encode(&confidenceMsgpack{
+		Model:       c.model,
+		RegWeight:   c.regWeight,
+		Sensitivity: c.sensitivity,
+	}); err != nil {
+		return err
+	}
+	return c.saveDims(w)
+}
+
+// load loads the model saved by confidenceRegression.save. The format
+// version must be read by the caller.
+func (c *confidenceRegression) load(r io.Reader) error {
+	dec := codec.NewDecoder(r, regressionMsgpackHandle)
+	var m confidenceMsgpack
+	if err := dec.Decode(&m); err != nil {
+		return err
+	}
+	c.model = m.Model
+	if c.model == nil {
+		c.model = make(weights)
+	}
+	c.regWeight = m.RegWeight
+	c.sensitivity = m.Sensitivity
+	return c.loadDims(r)
+}
+
+type weight struct {
+	_struct    struct{} `codec:",toarray"`
+	Weight     float32
+	Covariance float32
+}
+
+type weights map[dim]weight
+
+func (ws weights) get(dim dim) weight {
+	if w, ok := ws[dim]; ok {
+		return w
+	}
+	return weight{Covariance: 1}
+}
+
+func (ws weights) estimate(v fVector) float32 {
+	var ret float32
+	for i := range v {
+		ret += v[i].value * ws.get(v[i].dim).Weight
+	}
+	return ret
+}
+
+// variance returns x^T Σ x where Σ is the diagonal covariance matrix.
+func (ws weights) variance(v fVector) float32 {
+	var ret float32
+	for i := range v {
+		x := v[i].value
+		ret += ws.get(v[i].dim).Covariance * x * x
+	}
+	return ret
+}
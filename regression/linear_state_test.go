@@ -0,0 +1,239 @@
+package regression
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/intern"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestLinearStatesSaveLoad(t *testing.T) {
+	ctx := core.NewContext(nil)
+	creators := []struct {
+		name   string
+		c      udf.UDSLoader
+		params data.Map
+	}{
+		{"perceptron", &PerceptronStateCreator{}, data.Map{"learning_rate": data.Float(0.1)}},
+		{"cw", &ConfidenceWeightedStateCreator{}, data.Map{"regularization_weight": data.Float(1), "sensitivity": data.Float(0.01)}},
+		{"arow", &AROWStateCreator{}, data.Map{"regularization_weight": data.Float(1), "sensitivity": data.Float(0.01)}},
+		{"nherd", &NormalHerdStateCreator{}, data.Map{"regularization_weight": data.Float(1), "sensitivity": data.Float(0.01)}},
+	}
+
+	for _, cr := range creators {
+		cr := cr
+		Convey("Given a trained "+cr.name+" State", t, func() {
+			ss, err := cr.c.CreateState(ctx, cr.params)
+			So(err, ShouldBeNil)
+			s := ss.(*State)
+
+			for i := 0; i < 200; i++ {
+				x := float32(i%10) / 10
+				So(s.Write(ctx, &core.Tuple{
+					Data: data.Map{
+						"value": data.Float(2*x + 1),
+						"feature_vector": data.Map{
+							"x":    data.Float(x),
+							"bias": data.Int(1),
+						},
+					},
+				}), ShouldBeNil)
+			}
+
+			Convey("it should estimate a value close to the answer.", func() {
+				v, err := s.regression.Estimate(FeatureVector{
+					"x":    data.Float(0.5),
+					"bias": data.Int(1),
+				})
+				So(err, ShouldBeNil)
+				So(v, ShouldAlmostEqual, 2, 0.5)
+			})
+
+			Convey("when saving it", func() {
+				buf := bytes.NewBuffer(nil)
+				err := s.Save(ctx, buf, data.Map{})
+
+				Convey("it should succeed.", func() {
+					So(err, ShouldBeNil)
+
+					Convey("and the loaded state should be same.", func() {
+						s2, err := cr.c.LoadState(ctx, buf, data.Map{})
+						So(err, ShouldBeNil)
+						So(s2, ShouldResemble, s)
+
+						fv := FeatureVector{"x": data.Float(0.3)}
+						v, err := s.regression.Estimate(fv)
+						So(err, ShouldBeNil)
+						v2, err := s2.(*State).regression.Estimate(fv)
+						So(err, ShouldBeNil)
+						So(v2, ShouldEqual, v)
+					})
+				})
+			})
+		})
+	}
+}
+
+// linearDims returns the number of dimensions of a linear model and its
+// interned keys.
+func linearDims(r Regression) (int, *intern.Intern) {
+	switch m := r.(type) {
+	case *PassiveAggressive:
+		return len(m.model), m.intern
+	case *Perceptron:
+		return len(m.model), m.intern
+	case *AROW:
+		return len(m.model), m.intern
+	}
+	panic(fmt.Sprintf("unsupported regression: %T", r))
+}
+
+func TestLinearStatesPruning(t *testing.T) {
+	ctx := core.NewContext(nil)
+	pruning := data.Map{
+		"max_dims": data.Int(5),
+		"interval": data.Int(10),
+	}
+	creators := []struct {
+		name   string
+		c      udf.UDSLoader
+		params data.Map
+	}{
+		{"pa", &PassiveAggressiveStateCreator{}, data.Map{"regularization_weight": data.Float(1), "sensitivity": data.Float(0.01), "pruning": pruning}},
+		{"perceptron", &PerceptronStateCreator{}, data.Map{"learning_rate": data.Float(0.1), "pruning": pruning}},
+		{"arow", &AROWStateCreator{}, data.Map{"regularization_weight": data.Float(1), "sensitivity": data.Float(0.01), "pruning": pruning}},
+	}
+
+	for _, cr := range creators {
+		cr := cr
+		Convey("Given a trained "+cr.name+" State with a pruning policy", t, func() {
+			ss, err := cr.c.CreateState(ctx, cr.params)
+			So(err, ShouldBeNil)
+			s := ss.(*State)
+
+			for i := 0; i < 100; i++ {
+				So(s.Write(ctx, &core.Tuple{
+					Data: data.Map{
+						"value": data.Int(i % 2),
+						"feature_vector": data.Map{
+							"id":   data.Map{fmt.Sprint(i): data.Int(1)},
+							"bias": data.Int(1),
+						},
+					},
+				}), ShouldBeNil)
+			}
+
+			Convey("it shouldn't have too many dimensions.", func() {
+				// The last datum was added after pruning.
+				n, _ := linearDims(s.regression)
+				So(n, ShouldBeLessThanOrEqualTo, 5+2)
+			})
+
+			Convey("its intern should be compacted.", func() {
+				_, i := linearDims(s.regression)
+				So(i.Len(), ShouldBeLessThanOrEqualTo, 5+2)
+				So(i.GetOrZero("id\x000"), ShouldEqual, 0)
+				So(i.GetOrZero("bias"), ShouldNotEqual, 0)
+			})
+
+			Convey("when saving and loading it", func() {
+				buf := bytes.NewBuffer(nil)
+				So(s.Save(ctx, buf, data.Map{}), ShouldBeNil)
+				s2, err := cr.c.LoadState(ctx, buf, data.Map{})
+				So(err, ShouldBeNil)
+
+				Convey("the loaded state should be same.", func() {
+					So(s2, ShouldResemble, s)
+					So(s2.(*State).regression.(Pruner).PruningPolicy(), ShouldResemble, s.regression.(Pruner).PruningPolicy())
+				})
+			})
+		})
+	}
+
+	Convey("Given an invalid pruning policy", t, func() {
+		_, err := (&PassiveAggressiveStateCreator{}).CreateState(ctx, data.Map{
+			"regularization_weight": data.Float(1),
+			"sensitivity":           data.Float(0.01),
+			"pruning": data.Map{
+				"max_dims_per_label": data.Int(5),
+			},
+		})
+
+		Convey("creating a state should fail.", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestTopWeights(t *testing.T) {
+	ctx := core.NewContext(nil)
+	creators := []struct {
+		name    string
+		c       udf.UDSLoader
+		params  data.Map
+		withCov bool
+	}{
+		{"pa", &PassiveAggressiveStateCreator{}, data.Map{"regularization_weight": data.Float(1), "sensitivity": data.Float(0.01)}, false},
+		{"arow", &AROWStateCreator{}, data.Map{"regularization_weight": data.Float(1), "sensitivity": data.Float(0.01)}, true},
+	}
+
+	for _, c := range creators {
+		s, err := c.c.CreateState(ctx, c.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ctx.SharedStates.Add(c.name, "jubaregression_"+c.name, s); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			fv := data.Map{"word": data.Map{"good": data.Int(1)}}
+			v := 1
+			if i%2 == 0 {
+				fv = data.Map{"word": data.Map{"bad": data.Int(1)}}
+				v = -1
+			}
+			if err := s.(*State).Write(ctx, &core.Tuple{
+				Data: data.Map{
+					"value":          data.Int(v),
+					"feature_vector": fv,
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, c := range creators {
+		c := c
+		Convey("Given a trained "+c.name+" state", t, func() {
+			Convey("when getting top weights", func() {
+				ws, err := TopWeights(ctx, c.name, 1)
+				So(err, ShouldBeNil)
+
+				Convey("the most positive feature should have its original key.", func() {
+					pos := ws["positive"].(data.Array)
+					So(len(pos), ShouldEqual, 1)
+					fw := pos[0].(data.Map)
+					So(fw["key"], ShouldEqual, data.String("word.good"))
+					_, hasCov := fw["covariance"]
+					So(hasCov, ShouldEqual, c.withCov)
+				})
+
+				Convey("the most negative feature should have its original key.", func() {
+					neg := ws["negative"].(data.Array)
+					So(len(neg), ShouldEqual, 1)
+					So(neg[0].(data.Map)["key"], ShouldEqual, data.String("word.bad"))
+				})
+			})
+
+			Convey("getting a negative number of top weights should fail.", func() {
+				_, err := TopWeights(ctx, c.name, -1)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package regression
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/nearest"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// NearestNeighbor holds a model for regression using k-nearest neighbors. It
+// stores all rows with their values and estimates a value by the weighted
+// average of the values of the k nearest rows.
+type NearestNeighbor struct {
+	nn      nearest.Neighbor
+	nnAlgo  NNAlgorithm
+	hashNum int
+
+	// values[i] is the value of the row whose ID is i+1.
+	values []float32
+
+	k     int
+	alpha float32
+
+	// for random unlearner
+	maxSize int
+	rg      *rand.Rand
+
+	m sync.RWMutex
+}
+
+const (
+	// InvalidNNAlgorithm represents an invalid nearest neighbor algorithm.
+	InvalidNNAlgorithm = nearest.InvalidAlgorithm
+	// LSH represents locality sensitive hashing.
+	LSH = nearest.LSHAlgorithm
+	// Minhash represents minhash.
+	Minhash = nearest.MinhashAlgorithm
+	// EuclidLSH represents locality sensitive hashing with euclidean distance.
+	EuclidLSH = nearest.EuclidLSHAlgorithm
+)
+
+// NNAlgorithm is an enum type which represents nearest neighbor algorithms.
+type NNAlgorithm = nearest.Algorithm
+
+// NewNearestNeighbor creates a NearestNeighbor model. k is the number of
+// neighbors used for estimation. The value of each neighbor is weighted by
+// exp(-alpha * distance). maxSize is the maximum number of rows and 0 means no limit.
+// When the number of rows exceeds maxSize, a randomly selected row is
+// unlearned.
+func NewNearestNeighbor(nnAlgo NNAlgorithm, hashNum, k int, alpha float32, maxSize int, seed int64) (*NearestNeighbor, error) {
+	const maxSizeLimit = 0x7fffffff
+
+	if hashNum <= 0 {
+		return nil, errors.New("number of hash bits must be greater than zero")
+	}
+	if k <= 0 {
+		return nil, errors.New("number of nearest neighbor must be greater than zero")
+	}
+	if alpha < 0 {
+		return nil, errors.New("local sensitivity must not be less than zero")
+	}
+	if maxSize < 0 {
+		return nil, errors.New("max size must be greater than or equal to zero")
+	}
+	if maxSize > maxSizeLimit {
+		return nil, fmt.Errorf("max size must be less than or equal to %v", maxSizeLimit)
+	}
+
+	nn, err := nearest.New(nnAlgo, hashNum)
+	if err != nil {
+		return nil, err
+	}
+
+	// maxSize == 0 means no unlearn.
+	if maxSize == 0 {
+		maxSize = maxSizeLimit
+	}
+
+	return &NearestNeighbor{
+		nn:      nn,
+		nnAlgo:  nnAlgo,
+		hashNum: hashNum,
+		k:       k,
+		alpha:   alpha,
+		maxSize: maxSize,
+		rg:      rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+// Train trains a model with a feature vector and a value.
+func (n *NearestNeighbor) Train(v FeatureVector, value float32) error {
+	nnfv, err := nearest.FlattenFeatureVector(data.Map(v))
+	if err != nil {
+		return err
+	}
+
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	var id nearest.ID
+	if len(n.values) < n.maxSize {
+		n.values = append(n.values, value)
+		id = nearest.ID(len(n.values))
+	} else {
+		// unlearn
+		id = nearest.ID(n.rg.Intn(n.maxSize)) + 1
+		n.values[id-1] = value
+	}
+	n.nn.SetRow(id, nnfv)
+	return nil
+}
+
+// Estimate estimates a value from a model and a feature vector. It returns
+// zero when the model has no rows.
+//
+// jubatus::core::regression::nearest_neighbor_regression::estimate
+func (n *NearestNeighbor) Estimate(v FeatureVector) (float32, error) {
+	nnfv, err := nearest.FlattenFeatureVector(data.Map(v))
+	if err != nil {
+		return 0, err
+	}
+
+	n.m.RLock()
+	defer n.m.RUnlock()
+
+	if len(n.values) == 0 {
+		return 0, nil
+	}
+
+	var sum, weightSum float32
+	for _, nb := range n.nn.NeighborRowFromFV(nnfv, n.k) {
+		w := float32(math.Exp(float64(-n.alpha * nb.Dist)))
+		sum += w * n.values[nb.ID-1]
+		weightSum += w
+	}
+	if weightSum == 0 {
+		// all weights can underflow when alpha is large.
+		return 0, nil
+	}
+	return sum / weightSum, nil
+}
+
+// Clear clears a model.
+func (n *NearestNeighbor) Clear() {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	// The arguments have already been validated.
+	n.nn, _ = nearest.New(n.nnAlgo, n.hashNum)
+	n.values = nil
+}
+
+const (
+	nearestNeighborFormatVersion uint8 = 1
+)
+
+type nearestNeighborMsgpack struct {
+	_struct struct{} `codec:",toarray"`
+
+	NNAlgorithm NNAlgorithm
+	HashNum     int
+
+	Values []float32
+
+	K       int
+	Alpha   float32
+	MaxSize int
+}
+
+// Save saves the current state of NearestNeighbor.
+func (n *NearestNeighbor) Save(w io.Writer) error {
+	n.m.RLock()
+	defer n.m.RUnlock()
+
+	if _, err := w.Write([]byte{nearestNeighborFormatVersion}); err != nil {
+		return err
+	}
+
+	enc := codec.NewEncoder(w, regressionMsgpackHandle)
+	if err := enc.Encode(&nearestNeighborMsgpack{
+		NNAlgorithm: n.nnAlgo,
+		HashNum:     n.hashNum,
+
+		Values: n.values,
+
+		K:       n.k,
+		Alpha:   n.alpha,
+		MaxSize: n.maxSize,
+	}); err != nil {
+		return err
+	}
+	return nearest.Save(n.nn, w)
+}
+
+// LoadNearestNeighbor loads NearestNeighbor from the saved data.
+func LoadNearestNeighbor(r io.Reader) (*NearestNeighbor, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadNearestNeighborFormatV1(r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of NearestNeighbor container: %v", formatVersion[0])
+	}
+}
+
+func loadNearestNeighborFormatV1(r io.Reader) (*NearestNeighbor, error) {
+	m := nearestNeighborMsgpack{}
+	dec := codec.NewDecoder(r, regressionMsgpackHandle)
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	nn, err := nearest.Load(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NearestNeighbor{
+		nn:      nn,
+		nnAlgo:  m.NNAlgorithm,
+		hashNum: m.HashNum,
+
+		values: m.Values,
+
+		k:     m.K,
+		alpha: m.Alpha,
+
+		maxSize: m.MaxSize,
+		rg:      rand.New(rand.NewSource(0)),
+	}, nil
+}
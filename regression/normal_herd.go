@@ -0,0 +1,83 @@
+package regression
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// NormalHerd holds a model for regression using Normal Herd (NHERD).
+type NormalHerd struct {
+	confidenceRegression
+}
+
+// NewNormalHerd creates a NormalHerd model. regWeight must be greater than
+// zero. sensitivity must not be less than zero.
+func NewNormalHerd(regWeight float32, sensitivity float32) (*NormalHerd, error) {
+	if regWeight <= 0 {
+		return nil, errors.New("regularization weight must be larger than zero")
+	}
+	if sensitivity < 0 {
+		return nil, errors.New("sensitivity must not be less than zero")
+	}
+	nh := &NormalHerd{}
+	nh.init(regWeight, sensitivity)
+	return nh, nil
+}
+
+// Train trains a model with a feature vector and a value.
+//
+// jubatus::core::regression::normal_herd::train
+func (nh *NormalHerd) Train(v FeatureVector, value float32) error {
+	nh.m.Lock()
+	defer nh.m.Unlock()
+
+	fv, err := nh.prepareTrain(v)
+	if err != nil {
+		return err
+	}
+
+	sign, loss := nh.loss(fv, value)
+	if loss <= 0 {
+		return nil
+	}
+	variance := nh.model.variance(fv)
+
+	C := nh.regWeight
+	stepWidth := sign * loss / (variance + 1/C)
+	nh.update(fv, stepWidth, func(cov, x float32) float32 {
+		return 1 / (1/cov + (2*C+C*C*variance)*x*x)
+	})
+	return nil
+}
+
+const (
+	nherdFormatVersion = 1
+)
+
+// Save saves the current state of NormalHerd.
+func (nh *NormalHerd) Save(w io.Writer) error {
+	nh.m.RLock()
+	defer nh.m.RUnlock()
+
+	return nh.save(w, nherdFormatVersion)
+}
+
+// LoadNormalHerd loads NormalHerd from the saved data.
+func LoadNormalHerd(r io.Reader) (*NormalHerd, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		nh := &NormalHerd{}
+		if err := nh.load(r); err != nil {
+			return nil, err
+		}
+		return nh, nil
+	default:
+		return nil, fmt.Errorf("unsupported format version of NormalHerd container: %v", formatVersion[0])
+	}
+}
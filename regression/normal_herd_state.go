@@ -0,0 +1,36 @@
+package regression
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+)
+
+// NormalHerdStateCreator is used by BQL to create or load a State having NormalHerd
+// regression algorithm as a UDS.
+type NormalHerdStateCreator struct {
+}
+
+var _ udf.UDSLoader = &NormalHerdStateCreator{}
+
+// CreateState creates a new state for NormalHerd regression.
+func (c *NormalHerdStateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	rw, sen, err := extractRegWeightAndSensitivity(params)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := NewNormalHerd(rw, sen)
+	if err != nil {
+		return nil, err
+	}
+	return newState("normal_herd", r, params)
+}
+
+// LoadState loads a new state for NormalHerd regression.
+func (c *NormalHerdStateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	return loadState(ctx, r, "normal_herd", func(r io.Reader) (Regression, error) {
+		return LoadNormalHerd(r)
+	})
+}
@@ -3,21 +3,21 @@ package regression
 import (
 	"errors"
 	"fmt"
+	"github.com/sensorbee/jubatus/internal/intern"
 	"github.com/sensorbee/jubatus/internal/nested"
 	"github.com/ugorji/go/codec"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"io"
 	"math"
-	"sync"
 )
 
 // PassiveAggressive holds a model for regression.
 type PassiveAggressive struct {
+	linearRegression
 	model model
 	sum   float32
 	sqSum float32
 	count uint64
-	m     sync.RWMutex
 
 	regWeight   float32
 	sensitivity float32
@@ -32,22 +32,25 @@ func NewPassiveAggressive(regWeight float32, sensitivity float32) (*PassiveAggre
 	if sensitivity < 0 {
 		return nil, errors.New("sensitivity must not be less than zero")
 	}
-	return &PassiveAggressive{
+	pa := &PassiveAggressive{
 		model:       make(model),
 		regWeight:   regWeight,
 		sensitivity: sensitivity,
-	}, nil
+	}
+	pa.initDims()
+	return pa, nil
 }
 
 // Train trains a model with a feature vector and a value.
 func (pa *PassiveAggressive) Train(v FeatureVector, value float32) error {
-	fv, err := v.toInternal()
+	pa.m.Lock()
+	defer pa.m.Unlock()
+
+	fv, err := pa.toInternal(v)
 	if err != nil {
 		return err
 	}
-
-	pa.m.Lock()
-	defer pa.m.Unlock()
+	pa.touch(fv, pa.model)
 
 	pa.sum += value
 	pa.sqSum += value * value
@@ -56,7 +59,7 @@ func (pa *PassiveAggressive) Train(v FeatureVector, value float32) error {
 	avg := pa.sum / float32(pa.count)
 	stdDev := sqrt(pa.sqSum/float32(pa.count) - avg*avg)
 
-	predict := pa.estimate(fv)
+	predict := pa.model.estimate(fv)
 	error := value - predict
 	loss := abs(error) - pa.sensitivity*stdDev
 
@@ -71,21 +74,20 @@ func (pa *PassiveAggressive) Train(v FeatureVector, value float32) error {
 
 	C := pa.regWeight
 	coeff := sign(error) * min(C, loss) / fv.squaredNorm()
-	pa.update(fv, coeff)
+	pa.model.update(fv, coeff)
 	return nil
 }
 
 // Estimate estimates a value from a model and a feature vector.
 func (pa *PassiveAggressive) Estimate(v FeatureVector) (float32, error) {
-	fv, err := v.toInternal()
-	if err != nil {
-		return 0, err
-	}
-
 	pa.m.RLock()
 	defer pa.m.RUnlock()
 
-	return pa.estimate(fv), nil
+	fv, err := pa.toInternalForEstimate(v)
+	if err != nil {
+		return 0, err
+	}
+	return pa.model.estimate(fv), nil
 }
 
 // Clear clears a model.
@@ -94,18 +96,42 @@ func (pa *PassiveAggressive) Clear() {
 	defer pa.m.Unlock()
 
 	pa.model = make(model)
+	pa.initDims()
 	pa.sum = 0
 	pa.sqSum = 0
 	pa.count = 0
 }
 
+// SetHashMaxSize makes the model hash keys of feature vectors into maxSize
+// dimensions instead of interning them, so that the size of the model is
+// bounded. Zero disables hashing. It must be called before training.
+func (pa *PassiveAggressive) SetHashMaxSize(maxSize int) error {
+	pa.m.Lock()
+	defer pa.m.Unlock()
+	return pa.setHashMaxSize(maxSize, len(pa.model) > 0)
+}
+
 const (
-	paForwatVersion = 1
+	paForwatVersion = 2
 )
 
+// paMsgpack is used by format version 1, which doesn't intern keys.
 type paMsgpack struct {
 	_struct struct{} `codec:",toarray"`
 
+	Model map[string]float32
+	Sum   float32
+	SqSum float32
+	Count uint64
+
+	RegWeight   float32
+	Sensitivity float32
+}
+
+// paMsgpackV2 is used by format version 2.
+type paMsgpackV2 struct {
+	_struct struct{} `codec:",toarray"`
+
 	Model model
 	Sum   float32
 	SqSum float32
@@ -125,15 +151,17 @@ func (pa *PassiveAggressive) Save(w io.Writer) error {
 	}
 
 	enc := codec.NewEncoder(w, regressionMsgpackHandle)
-	err := enc.Encode(&paMsgpack{
+	if err := enc.Encode(&paMsgpackV2{
 		Model:       pa.model,
 		Sum:         pa.sum,
 		SqSum:       pa.sqSum,
 		Count:       pa.count,
 		RegWeight:   pa.regWeight,
 		Sensitivity: pa.sensitivity,
-	})
-	return err
+	}); err != nil {
+		return err
+	}
+	return pa.saveDims(w)
 }
 
 // LoadPassiveAggressive loads PassiveAggressive from the saved data.
@@ -146,6 +174,8 @@ func LoadPassiveAggressive(r io.Reader) (*PassiveAggressive, error) {
 	switch formatVersion[0] {
 	case 1:
 		return loadPassiveAggressiveFormatV1(r)
+	case 2:
+		return loadPassiveAggressiveFormatV2(r)
 	default:
 		return nil, fmt.Errorf("unsupported format version of PassiveAggressive container: %v", formatVersion[0])
 	}
@@ -158,7 +188,30 @@ func loadPassiveAggressiveFormatV1(r io.Reader) (*PassiveAggressive, error) {
 		return nil, err
 	}
 
-	return &PassiveAggressive{
+	pa := &PassiveAggressive{
+		sum:   m.Sum,
+		sqSum: m.SqSum,
+		count: m.Count,
+
+		regWeight:   m.RegWeight,
+		sensitivity: m.Sensitivity,
+	}
+	pa.initDims()
+	pa.model = pa.internModel(m.Model)
+	return pa, nil
+}
+
+func loadPassiveAggressiveFormatV2(r io.Reader) (*PassiveAggressive, error) {
+	m := paMsgpackV2{}
+	dec := codec.NewDecoder(r, regressionMsgpackHandle)
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	if m.Model == nil {
+		m.Model = make(model)
+	}
+
+	pa := &PassiveAggressive{
 		model: m.Model,
 		sum:   m.Sum,
 		sqSum: m.SqSum,
@@ -166,7 +219,11 @@ func loadPassiveAggressiveFormatV1(r io.Reader) (*PassiveAggressive, error) {
 
 		regWeight:   m.RegWeight,
 		sensitivity: m.Sensitivity,
-	}, nil
+	}
+	if err := pa.loadDims(r); err != nil {
+		return nil, err
+	}
+	return pa, nil
 }
 
 // RegWeight returns regularization weight.
@@ -179,37 +236,74 @@ func (pa *PassiveAggressive) Sensitivity() float32 {
 	return pa.sensitivity
 }
 
-func (pa *PassiveAggressive) estimate(v fVector) float32 {
+type dim int
+
+type model map[dim]float32
+
+func (m model) estimate(v fVector) float32 {
 	var ret float32
 	for i := range v {
 		dim := v[i].dim
 		x := v[i].value
 
-		ret += x * pa.model[dim]
+		ret += x * m[dim]
 	}
 	return ret
 }
 
-func (pa *PassiveAggressive) update(v fVector, coeff float32) {
+func (m model) update(v fVector, coeff float32) {
 	for i := range v {
 		dim := v[i].dim
 		x := v[i].value
 
-		pa.model[dim] += coeff * x
+		m[dim] += coeff * x
 	}
 }
 
-type dim string
-
-type model map[dim]float32
-
 // FeatureVector is a type for feature vectors.
 type FeatureVector data.Map
 
-func (v FeatureVector) toInternal() (fVector, error) {
+// toInternal converts a feature vector to internal format. It requires write
+// lock for intern.
+func (v FeatureVector) toInternal(intern *intern.Intern) (fVector, error) {
+	ret := make(fVector, 0, len(v))
+	err := nested.Flatten(data.Map(v), func(key string, value float32) {
+		ret = append(ret, fElement{dim: dim(intern.Get(key)), value: value})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// toInternalForEstimate converts a feature vector to internal format
+// without registering new keys. It requires read lock for intern.
+func (v FeatureVector) toInternalForEstimate(intern *intern.Intern) (fVector, error) {
+	ret := make(fVector, 0, len(v))
+	err := nested.Flatten(data.Map(v), func(key string, value float32) {
+		if d := intern.GetOrZero(key); d != 0 {
+			ret = append(ret, fElement{dim: dim(d), value: value})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// toHashed converts a feature vector to internal format by hashing keys into
+// maxSize dimensions. Values of keys having the same hash are summed up.
+func (v FeatureVector) toHashed(maxSize int) (fVector, error) {
+	idx := make(map[dim]int, len(v))
 	ret := make(fVector, 0, len(v))
 	err := nested.Flatten(data.Map(v), func(key string, value float32) {
-		ret = append(ret, fElement{dim: dim(key), value: value})
+		d := dim(intern.Hash(key, maxSize))
+		if i, ok := idx[d]; ok {
+			ret[i].value += value
+			return
+		}
+		idx[d] = len(ret)
+		ret = append(ret, fElement{dim: d, value: value})
 	})
 	if err != nil {
 		return nil, err
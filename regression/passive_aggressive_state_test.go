@@ -2,7 +2,9 @@ package regression
 
 import (
 	"bytes"
+	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/ugorji/go/codec"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"testing"
@@ -50,9 +52,9 @@ func TestPassiveAggressiveStateLoad(t *testing.T) {
 					fv := FeatureVector{
 						"n": data.Int(123),
 					}
-					v, err := pa.pa.Estimate(fv)
+					v, err := pa.regression.Estimate(fv)
 					So(err, ShouldBeNil)
-					v2, err := pa2.(*PassiveAggressiveState).pa.Estimate(fv)
+					v2, err := pa2.(*PassiveAggressiveState).regression.Estimate(fv)
 					So(err, ShouldBeNil)
 					So(v2, ShouldResemble, v)
 				})
@@ -60,3 +62,143 @@ func TestPassiveAggressiveStateLoad(t *testing.T) {
 		})
 	})
 }
+
+func TestLoadPassiveAggressiveFormatV1(t *testing.T) {
+	Convey("Given a PassiveAggressive saved in format version 1", t, func() {
+		buf := bytes.NewBuffer([]byte{1})
+		enc := codec.NewEncoder(buf, regressionMsgpackHandle)
+		So(enc.Encode(&paMsgpack{
+			Model:       map[string]float32{"x": 2, "y\x00z": -1},
+			RegWeight:   1,
+			Sensitivity: 0.1,
+		}), ShouldBeNil)
+
+		Convey("when loading it", func() {
+			pa, err := LoadPassiveAggressive(buf)
+			So(err, ShouldBeNil)
+
+			Convey("it should have interned keys.", func() {
+				So(pa.intern.Len(), ShouldEqual, 2)
+				v, err := pa.Estimate(FeatureVector{
+					"x": data.Int(1),
+					"y": data.Map{"z": data.Int(3)},
+				})
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, -1)
+			})
+		})
+	})
+}
+
+func TestPassiveAggressiveStateHashing(t *testing.T) {
+	ctx := core.NewContext(nil)
+	c := PassiveAggressiveStateCreator{}
+	pas, err := c.CreateState(ctx, data.Map{
+		"regularization_weight": data.Float(3.402823e+38),
+		"sensitivity":           data.Float(0.1),
+		"hash_max_size":         data.Int(8),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pa := pas.(*State)
+
+	for i := 0; i < 100; i++ {
+		if err := pa.Write(ctx, &core.Tuple{
+			Data: data.Map{
+				"value": data.Float(i),
+				"feature_vector": data.Map{
+					"n":  data.Int(i),
+					"id": data.Map{fmt.Sprint(i): data.Int(1)},
+				},
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Convey("Given a trained State with hash_max_size", t, func() {
+		Convey("its model should be bounded by hash_max_size.", func() {
+			So(len(pa.regression.(*PassiveAggressive).model), ShouldBeLessThanOrEqualTo, 8)
+		})
+
+		Convey("when saving and loading it", func() {
+			buf := bytes.NewBuffer(nil)
+			So(pa.Save(ctx, buf, data.Map{}), ShouldBeNil)
+			pa2, err := c.LoadState(ctx, buf, data.Map{})
+			So(err, ShouldBeNil)
+
+			Convey("the loaded state should estimate the same value.", func() {
+				So(pa2.(*State).regression.(FeatureHasher).HashMaxSize(), ShouldEqual, 8)
+				ctx.SharedStates.Add("pa", "jubaregression_pa", pa)
+				ctx.SharedStates.Add("pa2", "jubaregression_pa", pa2)
+				fv := data.Map{"n": data.Int(123)}
+				v, err := Estimate(ctx, "pa", fv)
+				So(err, ShouldBeNil)
+				v2, err := Estimate(ctx, "pa2", fv)
+				So(err, ShouldBeNil)
+				So(v2, ShouldEqual, v)
+			})
+		})
+	})
+}
+
+func TestPassiveAggressiveStateExplain(t *testing.T) {
+	ctx := core.NewContext(nil)
+	c := PassiveAggressiveStateCreator{}
+	for _, name := range []string{"pa", "hashed_pa"} {
+		params := data.Map{
+			"regularization_weight": data.Float(3.402823e+38),
+			"sensitivity":           data.Float(0.1),
+		}
+		if name == "hashed_pa" {
+			params["hash_max_size"] = data.Int(1024)
+		}
+		s, err := c.CreateState(ctx, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ctx.SharedStates.Add(name, "jubaregression_pa", s); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			if err := s.(*State).Write(ctx, &core.Tuple{
+				Data: data.Map{
+					"value": data.Float(2*i + 1),
+					"feature_vector": data.Map{
+						"x":    data.Int(i),
+						"bias": data.Int(1),
+					},
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, name := range []string{"pa", "hashed_pa"} {
+		name := name
+		Convey("Given a trained State "+name, t, func() {
+			fv := data.Map{"x": data.Int(10), "bias": data.Int(1)}
+
+			Convey("when explaining an estimation", func() {
+				e, err := Explain(ctx, name, fv)
+				So(err, ShouldBeNil)
+
+				Convey("the value should be the estimated value.", func() {
+					v, err := Estimate(ctx, name, fv)
+					So(err, ShouldBeNil)
+					x, _ := data.AsFloat(e["value"])
+					So(x, ShouldAlmostEqual, v, 1e-3)
+				})
+
+				Convey("it should have contributions of original keys.", func() {
+					cs := e["contributions"].(data.Array)
+					So(len(cs), ShouldEqual, 2)
+					So(cs[0].(data.Map)["key"], ShouldEqual, data.String("x"))
+					So(cs[1].(data.Map)["key"], ShouldEqual, data.String("bias"))
+				})
+			})
+		})
+	}
+}
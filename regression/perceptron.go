@@ -0,0 +1,148 @@
+package regression
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ugorji/go/codec"
+	"io"
+)
+
+// Perceptron holds a model for regression using the perceptron update rule.
+type Perceptron struct {
+	linearRegression
+	model model
+
+	learningRate float32
+}
+
+// NewPerceptron creates a Perceptron model. learningRate must be greater than
+// zero.
+func NewPerceptron(learningRate float32) (*Perceptron, error) {
+	if learningRate <= 0 {
+		return nil, errors.New("learning rate must be larger than zero")
+	}
+	p := &Perceptron{
+		model:        make(model),
+		learningRate: learningRate,
+	}
+	p.initDims()
+	return p, nil
+}
+
+// Train trains a model with a feature vector and a value.
+//
+// jubatus::core::regression::perceptron::train
+func (p *Perceptron) Train(v FeatureVector, value float32) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	fv, err := p.toInternal(v)
+	if err != nil {
+		return err
+	}
+	p.touch(fv, p.model)
+
+	error := value - p.model.estimate(fv)
+	p.model.update(fv, p.learningRate*error)
+	return nil
+}
+
+// Estimate estimates a value from a model and a feature vector.
+func (p *Perceptron) Estimate(v FeatureVector) (float32, error) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	fv, err := p.toInternalForEstimate(v)
+	if err != nil {
+		return 0, err
+	}
+	return p.model.estimate(fv), nil
+}
+
+// Clear clears a model.
+func (p *Perceptron) Clear() {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.model = make(model)
+	p.initDims()
+}
+
+// SetHashMaxSize makes the model hash keys of feature vectors into maxSize
+// dimensions instead of interning them, so that the size of the model is
+// bounded. Zero disables hashing. It must be called before training.
+func (p *Perceptron) SetHashMaxSize(maxSize int) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return p.setHashMaxSize(maxSize, len(p.model) > 0)
+}
+
+const (
+	perceptronFormatVersion = 1
+)
+
+type perceptronMsgpack struct {
+	_struct struct{} `codec:",toarray"`
+
+	Model        model
+	LearningRate float32
+}
+
+// Save saves the current state of Perceptron.
+func (p *Perceptron) Save(w io.Writer) error {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if _, err := w.Write([]byte{perceptronFormatVersion}); err != nil {
+		return err
+	}
+
+	enc := codec.NewEncoder(w, regressionMsgpackHandle)
+	if err := enc.Encode(&perceptronMsgpack{
+		Model:        p.model,
+		LearningRate: p.learningRate,
+	}); err != nil {
+		return err
+	}
+	return p.saveDims(w)
+}
+
+// LoadPerceptron loads Perceptron from the saved data.
+func LoadPerceptron(r io.Reader) (*Perceptron, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadPerceptronFormatV1(r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of Perceptron container: %v", formatVersion[0])
+	}
+}
+
+func loadPerceptronFormatV1(r io.Reader) (*Perceptron, error) {
+	m := perceptronMsgpack{}
+	dec := codec.NewDecoder(r, regressionMsgpackHandle)
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	if m.Model == nil {
+		m.Model = make(model)
+	}
+
+	p := &Perceptron{
+		model:        m.Model,
+		learningRate: m.LearningRate,
+	}
+	if err := p.loadDims(r); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// LearningRate returns learning rate.
+func (p *Perceptron) LearningRate() float32 {
+	return p.learningRate
+}
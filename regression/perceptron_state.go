@@ -0,0 +1,41 @@
+package regression
+
+import (
+	"errors"
+	"github.com/sensorbee/jubatus/internal/pluginutil"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+)
+
+// PerceptronStateCreator is used by BQL to create or load a State having Perceptron
+// regression algorithm as a UDS.
+type PerceptronStateCreator struct {
+}
+
+var _ udf.UDSLoader = &PerceptronStateCreator{}
+
+// CreateState creates a new state for Perceptron regression.
+func (c *PerceptronStateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	lr, err := pluginutil.ExtractParamAndConvertToFloat(params, "learning_rate")
+	if err != nil {
+		return nil, err
+	}
+	if lr <= 0 {
+		return nil, errors.New("learning_rate parameter must be greater than zero")
+	}
+
+	r, err := NewPerceptron(float32(lr))
+	if err != nil {
+		return nil, err
+	}
+	return newState("perceptron", r, params)
+}
+
+// LoadState loads a new state for Perceptron regression.
+func (c *PerceptronStateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	return loadState(ctx, r, "perceptron", func(r io.Reader) (Regression, error) {
+		return LoadPerceptron(r)
+	})
+}
@@ -7,6 +7,14 @@ import (
 
 func init() {
 	udf.MustRegisterGlobalUDSCreator("jubaregression_pa", &regression.PassiveAggressiveStateCreator{})
+	udf.MustRegisterGlobalUDSCreator("jubaregression_perceptron", &regression.PerceptronStateCreator{})
+	udf.MustRegisterGlobalUDSCreator("jubaregression_cw", &regression.ConfidenceWeightedStateCreator{})
+	udf.MustRegisterGlobalUDSCreator("jubaregression_arow", &regression.AROWStateCreator{})
+	udf.MustRegisterGlobalUDSCreator("jubaregression_nherd", &regression.NormalHerdStateCreator{})
+	udf.MustRegisterGlobalUDSCreator("jubaregression_nearest_neighbor", &regression.NearestNeighborStateCreator{})
+	udf.MustRegisterGlobalUDSCreator("jubaregression_inverted_index", &regression.InvertedIndexStateCreator{})
 
-	udf.MustRegisterGlobalUDF("jubaregression_estimate", udf.MustConvertGeneric(regression.PassiveAggressiveEstimate))
+	udf.MustRegisterGlobalUDF("jubaregression_estimate", udf.MustConvertGeneric(regression.Estimate))
+	udf.MustRegisterGlobalUDF("jubaregression_explain", udf.MustConvertGeneric(regression.Explain))
+	udf.MustRegisterGlobalUDF("jubaregression_top_weights", udf.MustConvertGeneric(regression.TopWeights))
 }
@@ -0,0 +1,57 @@
+package regression
+
+import (
+	"github.com/sensorbee/jubatus/internal/pruning"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// PruningPolicy specifies how dimensions are dropped from a linear model.
+// MaxDims is the maximum number of dimensions the model can have.
+type PruningPolicy = pruning.Policy
+
+// ParsePruningPolicy parses a pruning policy:
+//
+//	{
+//	  "weight_threshold": 0.001,
+//	  "max_idle": 100000,
+//	  "max_dims": 50000,
+//	  "interval": 1000
+//	}
+//
+// All keys are optional. interval is 1000 by default.
+func ParsePruningPolicy(m data.Map) (*PruningPolicy, error) {
+	return pruning.ParsePolicy(m, "max_dims")
+}
+
+// EachWeight is provided as a part of pruning.Weights.
+func (m model) EachWeight(f func(d int, w float32)) {
+	for d, w := range m {
+		f(int(d), w)
+	}
+}
+
+// Drop is provided as a part of pruning.Weights.
+func (m model) Drop(d int) {
+	delete(m, dim(d))
+}
+
+// EachWeight is provided as a part of pruning.Weights.
+func (ws weights) EachWeight(f func(d int, w float32)) {
+	for d, w := range ws {
+		f(int(d), w.Weight)
+	}
+}
+
+// Drop is provided as a part of pruning.Weights.
+func (ws weights) Drop(d int) {
+	delete(ws, dim(d))
+}
+
+// dims returns dimensions of v.
+func (v fVector) dims() []int {
+	ret := make([]int, len(v))
+	for i, e := range v {
+		ret[i] = int(e.dim)
+	}
+	return ret
+}
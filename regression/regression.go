@@ -0,0 +1,103 @@
+package regression
+
+import (
+	"io"
+)
+
+// Regression is an interface which all regression algorithms implement.
+type Regression interface {
+	// Train trains a model with a feature vector and a value.
+	Train(v FeatureVector, value float32) error
+
+	// Estimate estimates a value from a model and a feature vector.
+	Estimate(v FeatureVector) (float32, error)
+
+	// Clear clears a model.
+	Clear()
+
+	// Save saves the current state of the model.
+	Save(w io.Writer) error
+}
+
+// Explainer is an interface which linear regression algorithms implement to
+// explain their estimated values.
+type Explainer interface {
+	// Explain returns contributions of features of v to the estimated
+	// value.
+	Explain(v FeatureVector) ([]Contribution, error)
+}
+
+// WeightInspector is an interface which linear regression algorithms
+// implement to expose their weights.
+type WeightInspector interface {
+	// TopWeights returns at most n features having the largest positive
+	// weights and n features having the largest negative weights.
+	TopWeights(n int) *ModelWeights
+}
+
+// FeatureHasher is an interface which regression algorithms supporting the
+// hashing trick implement.
+type FeatureHasher interface {
+	// SetHashMaxSize makes a model hash keys of feature vectors into maxSize
+	// dimensions instead of keeping all keys. Zero disables hashing. It
+	// must be called before training.
+	SetHashMaxSize(maxSize int) error
+
+	// HashMaxSize returns the number of dimensions into which keys are
+	// hashed. It returns zero when hashing is disabled.
+	HashMaxSize() int
+}
+
+// Pruner is an interface which regression algorithms supporting pruning of
+// dimensions implement.
+type Pruner interface {
+	// SetPruningPolicy sets a policy to drop dimensions from a model. nil
+	// disables pruning.
+	SetPruningPolicy(p *PruningPolicy) error
+
+	// PruningPolicy returns the current pruning policy. It returns nil when
+	// pruning is disabled.
+	PruningPolicy() *PruningPolicy
+}
+
+var (
+	_ Regression = &PassiveAggressive{}
+	_ Regression = &Perceptron{}
+	_ Regression = &ConfidenceWeighted{}
+	_ Regression = &AROW{}
+	_ Regression = &NormalHerd{}
+	_ Regression = &NearestNeighbor{}
+	_ Regression = &InvertedIndex{}
+)
+
+var (
+	_ Explainer = &PassiveAggressive{}
+	_ Explainer = &Perceptron{}
+	_ Explainer = &ConfidenceWeighted{}
+	_ Explainer = &AROW{}
+	_ Explainer = &NormalHerd{}
+)
+
+var (
+	_ FeatureHasher = &PassiveAggressive{}
+	_ FeatureHasher = &Perceptron{}
+	_ FeatureHasher = &ConfidenceWeighted{}
+	_ FeatureHasher = &AROW{}
+	_ FeatureHasher = &NormalHerd{}
+)
+
+var (
+	_ Pruner = &PassiveAggressive{}
+	_ Pruner = &Perceptron{}
+	_ Pruner = &ConfidenceWeighted{}
+	_ Pruner = &AROW{}
+	_ Pruner = &NormalHerd{}
+)
+
+var (
+	_ WeightInspector = &PassiveAggressive{}
+	_ WeightInspector = &Perceptron{}
+	_ WeightInspector = &ConfidenceWeighted{}
+	_ WeightInspector = &AROW{}
+	_ WeightInspector = &NormalHerd{}
+)
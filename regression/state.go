@@ -0,0 +1,405 @@
+package regression
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/fvconverter"
+	"github.com/sensorbee/jubatus/internal/nested"
+	"github.com/sensorbee/jubatus/internal/pluginutil"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// regressionMsgpack has information of the saved file.
+type regressionMsgpack struct {
+	_struct   struct{} `codec:",toarray"`
+	Algorithm string
+}
+
+// State is a state which supports any regression algorithm implementing
+// Regression. All regression UDSs create this state so that UDFs such as
+// jubaregression_estimate work regardless of the algorithm.
+type State struct {
+	regression         Regression
+	algorithm          string
+	valueField         string
+	featureVectorField string
+
+	// converter converts feature vectors before they're passed to the
+	// regression. It's nil when feature vectors are used as they are.
+	converter *fvconverter.Converter
+}
+
+var _ core.SavableSharedState = &State{}
+
+type stateMsgpack struct {
+	_struct            struct{} `codec:",toarray"`
+	ValueField         string
+	FeatureVectorField string
+}
+
+// newState creates a new State having r. It extracts common parameters from
+// params.
+func newState(algorithm string, r Regression, params data.Map) (core.SharedState, error) {
+	value, err := pluginutil.ExtractParamAsStringWithDefault(params, "value_field", "value")
+	if err != nil {
+		return nil, err
+	}
+	fv, err := pluginutil.ExtractParamAsStringWithDefault(params, "feature_vector_field", "feature_vector")
+	if err != nil {
+		return nil, err
+	}
+	conv, err := fvconverter.ExtractParams(params)
+	if err != nil {
+		return nil, err
+	}
+	hashMaxSize, err := pluginutil.ExtractParamAsBoundedIntWithDefault(params, "hash_max_size", 0)
+	if err != nil {
+		return nil, err
+	}
+	if hashMaxSize != 0 {
+		h, ok := r.(FeatureHasher)
+		if !ok {
+			return nil, fmt.Errorf("%v regression doesn't support hash_max_size", algorithm)
+		}
+		if hashMaxSize < 0 {
+			return nil, errors.New("hash_max_size parameter must not be less than zero")
+		}
+		if err := h.SetHashMaxSize(hashMaxSize); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := params["pruning"]; ok {
+		p, ok := r.(Pruner)
+		if !ok {
+			return nil, fmt.Errorf("%v regression doesn't support pruning", algorithm)
+		}
+		m, err := data.AsMap(v)
+		if err != nil {
+			return nil, fmt.Errorf("pruning parameter is not a map: %v", err)
+		}
+		policy, err := ParsePruningPolicy(m)
+		if err != nil {
+			return nil, fmt.Errorf("pruning parameter is invalid: %v", err)
+		}
+		if err := p.SetPruningPolicy(policy); err != nil {
+			return nil, err
+		}
+	}
+
+	return &State{
+		regression:         r,
+		algorithm:          algorithm,
+		valueField:         value,
+		featureVectorField: fv,
+		converter:          conv,
+	}, nil
+}
+
+// extractRegWeightAndSensitivity extracts regularization_weight and
+// sensitivity parameters which are common to many algorithms.
+func extractRegWeightAndSensitivity(params data.Map) (float32, float32, error) {
+	rw, err := pluginutil.ExtractParamAndConvertToFloat(params, "regularization_weight")
+	if err != nil {
+		return 0, 0, err
+	}
+	if rw <= 0 {
+		return 0, 0, errors.New("regularization_weight parameter must be greater than zero")
+	}
+
+	sen, err := pluginutil.ExtractParamAndConvertToFloat(params, "sensitivity")
+	if err != nil {
+		return 0, 0, err
+	}
+	if sen < 0 {
+		return 0, 0, errors.New("sensitivity parameter must be not less than zero")
+	}
+	return float32(rw), float32(sen), nil
+}
+
+var (
+	regressionMsgpackHandle = &codec.MsgpackHandle{
+		RawToString: true,
+	}
+)
+
+func init() {
+	regressionMsgpackHandle.MapType = reflect.TypeOf(map[string]interface{}{})
+}
+
+// regressionLoader loads a Regression saved by Regression.Save.
+type regressionLoader func(r io.Reader) (Regression, error)
+
+// loadState loads a State having the given algorithm.
+func loadState(ctx *core.Context, r io.Reader, algorithm string, load regressionLoader) (core.SharedState, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadStateFormatV1(ctx, r, algorithm, load)
+	case 2:
+		return loadStateFormatV2(ctx, r, algorithm, load)
+	default:
+		return nil, fmt.Errorf("unsupported format version of regression State container: %v", formatVersion[0])
+	}
+}
+
+func loadStateFormatV1(ctx *core.Context, r io.Reader, algorithm string, load regressionLoader) (core.SharedState, error) {
+	var header regressionMsgpack
+	dec := codec.NewDecoder(r, regressionMsgpackHandle)
+	if err := dec.Decode(&header); err != nil {
+		return nil, err
+	}
+	if header.Algorithm != algorithm {
+		return nil, fmt.Errorf("unsupported regression algorithm: %v", header.Algorithm)
+	}
+
+	s := &State{
+		algorithm: algorithm,
+	}
+
+	var d stateMsgpack
+	if err := dec.Decode(&d); err != nil {
+		return nil, err
+	}
+	s.valueField = d.ValueField
+	s.featureVectorField = d.FeatureVectorField
+
+	reg, err := load(r)
+	if err != nil {
+		return nil, err
+	}
+	s.regression = reg
+	return s, nil
+}
+
+func loadStateFormatV2(ctx *core.Context, r io.Reader, algorithm string, load regressionLoader) (core.SharedState, error) {
+	var header regressionMsgpack
+	dec := codec.NewDecoder(r, regressionMsgpackHandle)
+	if err := dec.Decode(&header); err != nil {
+		return nil, err
+	}
+	if header.Algorithm != algorithm {
+		return nil, fmt.Errorf("unsupported regression algorithm: %v", header.Algorithm)
+	}
+
+	// This is the current format and no data type conversion is required.
+	s := &State{
+		algorithm: algorithm,
+	}
+
+	var d stateMsgpack
+	if err := dec.Decode(&d); err != nil {
+		return nil, err
+	}
+	s.valueField = d.ValueField
+	s.featureVectorField = d.FeatureVectorField
+
+	conv, err := fvconverter.Load(r)
+	if err != nil {
+		return nil, err
+	}
+	s.converter = conv
+
+	reg, err := load(r)
+	if err != nil {
+		return nil, err
+	}
+	s.regression = reg
+	return s, nil
+}
+
+// Terminate terminates the state.
+func (*State) Terminate(ctx *core.Context) error {
+	return nil
+}
+
+// Write trains the machine learning model the state has with a given tuple.
+func (s *State) Write(ctx *core.Context, t *core.Tuple) error {
+	vval, ok := t.Data[s.valueField]
+	if !ok {
+		return fmt.Errorf("%s field is missing", s.valueField)
+	}
+	val64, err := data.ToFloat(vval)
+	if err != nil {
+		return fmt.Errorf("%s cannot be converted to float: %v", s.valueField, err)
+	}
+	val := float32(val64)
+
+	vfv, ok := t.Data[s.featureVectorField]
+	if !ok {
+		return fmt.Errorf("%s field is missing", s.featureVectorField)
+	}
+	fv, err := data.AsMap(vfv)
+	if err != nil {
+		return fmt.Errorf("%s value is not a map: %v", s.featureVectorField, err)
+	}
+	fv, doc, err := s.converter.ConvertForUpdate(fv)
+	if err != nil {
+		return err
+	}
+
+	if err := s.regression.Train(FeatureVector(fv), val); err != nil {
+		return err
+	}
+	s.converter.Update(doc)
+	return nil
+}
+
+const (
+	regressionFormatVersion = 2
+)
+
+// Save is provided as a part of core.SavableSharedState.
+func (s *State) Save(ctx *core.Context, w io.Writer, params data.Map) error {
+	if _, err := w.Write([]byte{regressionFormatVersion}); err != nil {
+		return err
+	}
+
+	enc := codec.NewEncoder(w, regressionMsgpackHandle)
+	if err := enc.Encode(&regressionMsgpack{
+		Algorithm: s.algorithm,
+	}); err != nil {
+		return err
+	}
+
+	if err := enc.Encode(&stateMsgpack{
+		ValueField:         s.valueField,
+		FeatureVectorField: s.featureVectorField,
+	}); err != nil {
+		return err
+	}
+	if err := s.converter.Save(w); err != nil {
+		return err
+	}
+	return s.regression.Save(w)
+}
+
+// Estimate estimates a value from a feature vector using the given model
+// having stateName.
+func Estimate(ctx *core.Context, stateName string, featureVector data.Map) (float32, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return 0, err
+	}
+
+	fv, err := s.converter.Convert(featureVector)
+	if err != nil {
+		return 0, err
+	}
+	return s.regression.Estimate(FeatureVector(fv))
+}
+
+// Explain estimates a value from a feature vector using the given model
+// having stateName and returns contributions of its features to the value:
+//
+//	{
+//	  "value": 3.5,
+//	  "contributions": [
+//	    {"key": "size", "value": 2, "weight": 1.5, "contribution": 3},
+//	    ...
+//	  ]
+//	}
+//
+// Keys are converted by the converter of the state and contributions are
+// sorted in the descending order of their absolute values.
+func Explain(ctx *core.Context, stateName string, featureVector data.Map) (data.Map, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	e, ok := s.regression.(Explainer)
+	if !ok {
+		return nil, fmt.Errorf("%v regression of state '%v' doesn't support explanation", s.algorithm, stateName)
+	}
+
+	fv, err := s.converter.Convert(featureVector)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := e.Explain(FeatureVector(fv))
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byContribution(cs))
+
+	var value float32
+	a := make(data.Array, len(cs))
+	for i, c := range cs {
+		value += c.Value * c.Weight
+		a[i] = data.Map{
+			"key":          data.String(nested.ReadableKey(c.Key)),
+			"value":        data.Float(c.Value),
+			"weight":       data.Float(c.Weight),
+			"contribution": data.Float(c.Value * c.Weight),
+		}
+	}
+	return data.Map{
+		"value":         data.Float(value),
+		"contributions": a,
+	}, nil
+}
+
+// TopWeights returns at most n features having the largest positive weights
+// and n features having the largest negative weights of the model having
+// stateName:
+//
+//	{
+//	  "positive": [{"key": "a.b", "weight": 1.5, "covariance": 0.2}, ...],
+//	  "negative": [...]
+//	}
+//
+// covariance is only included when the algorithm tracks it.
+func TopWeights(ctx *core.Context, stateName string, n int) (data.Map, error) {
+	if n < 0 {
+		return nil, errors.New("the number of features must not be less than zero")
+	}
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	wi, ok := s.regression.(WeightInspector)
+	if !ok {
+		return nil, fmt.Errorf("%v regression of state '%v' doesn't support weight inspection", s.algorithm, stateName)
+	}
+
+	tw := wi.TopWeights(n)
+	return data.Map{
+		"positive": featureWeightsToArray(tw.Positive, tw.HasCovariance),
+		"negative": featureWeightsToArray(tw.Negative, tw.HasCovariance),
+	}, nil
+}
+
+func featureWeightsToArray(fws []FeatureWeight, withCov bool) data.Array {
+	ret := make(data.Array, len(fws))
+	for i, fw := range fws {
+		m := data.Map{
+			"key":    data.String(fw.Key),
+			"weight": data.Float(fw.Weight),
+		}
+		if withCov {
+			m["covariance"] = data.Float(fw.Covariance)
+		}
+		ret[i] = m
+	}
+	return ret
+}
+
+func lookupState(ctx *core.Context, stateName string) (*State, error) {
+	st, err := ctx.SharedStates.Get(stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := st.(*State); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("state '%v' isn't a regression state", stateName)
+}
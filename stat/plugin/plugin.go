@@ -0,0 +1,17 @@
+package plugin
+
+import (
+	"github.com/sensorbee/jubatus/stat"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+)
+
+func init() {
+	udf.MustRegisterGlobalUDSCreator("jubastat", &stat.StateCreator{})
+
+	udf.MustRegisterGlobalUDF("jubastat_sum", udf.MustConvertGeneric(stat.Sum))
+	udf.MustRegisterGlobalUDF("jubastat_stddev", udf.MustConvertGeneric(stat.Stddev))
+	udf.MustRegisterGlobalUDF("jubastat_max", udf.MustConvertGeneric(stat.Max))
+	udf.MustRegisterGlobalUDF("jubastat_min", udf.MustConvertGeneric(stat.Min))
+	udf.MustRegisterGlobalUDF("jubastat_entropy", udf.MustConvertGeneric(stat.Entropy))
+	udf.MustRegisterGlobalUDF("jubastat_moment", udf.MustConvertGeneric(stat.Moment))
+}
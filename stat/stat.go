@@ -0,0 +1,278 @@
+package stat
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ugorji/go/codec"
+	"io"
+	"math"
+	"sync"
+)
+
+// Stat keeps the latest values of each key in a window and computes
+// statistics of them.
+type Stat struct {
+	windowSize int
+	windows    map[string]*window
+	// total is the number of values in all windows.
+	total int
+	m     sync.RWMutex
+}
+
+// window is a ring buffer having at most size values.
+type window struct {
+	values []float64
+	// head is the index of the oldest value when the window is full.
+	head int
+}
+
+func (w *window) push(size int, v float64) (removed bool) {
+	if len(w.values) < size {
+		w.values = append(w.values, v)
+		return false
+	}
+	w.values[w.head] = v
+	w.head = (w.head + 1) % size
+	return true
+}
+
+// ordered returns values from the oldest to the latest.
+func (w *window) ordered() []float64 {
+	ret := make([]float64, 0, len(w.values))
+	ret = append(ret, w.values[w.head:]...)
+	return append(ret, w.values[:w.head]...)
+}
+
+var (
+	// ErrNoValue is returned when statistics of a key without values are
+	// requested.
+	ErrNoValue = errors.New("the key doesn't have any values")
+)
+
+// New creates a Stat keeping at most windowSize latest values for each key.
+func New(windowSize int) (*Stat, error) {
+	if windowSize <= 0 {
+		return nil, errors.New("window size must be greater than zero")
+	}
+	return &Stat{
+		windowSize: windowSize,
+		windows:    make(map[string]*window),
+	}, nil
+}
+
+// Push adds a value of key. The oldest value of the key is removed when the
+// window of the key is full.
+func (s *Stat) Push(key string, v float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return errors.New("value must be a finite number")
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	w, ok := s.windows[key]
+	if !ok {
+		w = &window{}
+		s.windows[key] = w
+	}
+	if !w.push(s.windowSize, v) {
+		s.total++
+	}
+	return nil
+}
+
+// Sum returns the sum of values of key.
+func (s *Stat) Sum(key string) (float64, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	vs, err := s.values(key)
+	if err != nil {
+		return 0, err
+	}
+	return sum(vs), nil
+}
+
+// Stddev returns the standard deviation of values of key.
+func (s *Stat) Stddev(key string) (float64, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	vs, err := s.values(key)
+	if err != nil {
+		return 0, err
+	}
+	return math.Sqrt(moment(vs, 2, mean(vs))), nil
+}
+
+// Max returns the maximum value of key.
+func (s *Stat) Max(key string) (float64, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	vs, err := s.values(key)
+	if err != nil {
+		return 0, err
+	}
+	ret := vs[0]
+	for _, v := range vs[1:] {
+		ret = math.Max(ret, v)
+	}
+	return ret, nil
+}
+
+// Min returns the minimum value of key.
+func (s *Stat) Min(key string) (float64, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	vs, err := s.values(key)
+	if err != nil {
+		return 0, err
+	}
+	ret := vs[0]
+	for _, v := range vs[1:] {
+		ret = math.Min(ret, v)
+	}
+	return ret, nil
+}
+
+// Entropy returns the entropy of the distribution of keys, where the
+// probability of a key is the ratio of the number of its values to the number
+// of values of all keys. It returns zero when there's no value.
+func (s *Stat) Entropy() float64 {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	ret := 0.0
+	for _, w := range s.windows {
+		p := float64(len(w.values)) / float64(s.total)
+		ret -= p * math.Log(p)
+	}
+	return ret
+}
+
+// Moment returns the n-th central moment of values of key.
+func (s *Stat) Moment(key string, n int) (float64, error) {
+	if n < 0 {
+		return 0, errors.New("degree of moment must be greater than or equal to zero")
+	}
+
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	vs, err := s.values(key)
+	if err != nil {
+		return 0, err
+	}
+	return moment(vs, n, mean(vs)), nil
+}
+
+// Clear removes all values.
+func (s *Stat) Clear() {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.windows = make(map[string]*window)
+	s.total = 0
+}
+
+// values returns values of key. It requires read lock.
+func (s *Stat) values(key string) ([]float64, error) {
+	w, ok := s.windows[key]
+	if !ok {
+		return nil, ErrNoValue
+	}
+	return w.values, nil
+}
+
+func sum(vs []float64) float64 {
+	ret := 0.0
+	for _, v := range vs {
+		ret += v
+	}
+	return ret
+}
+
+func mean(vs []float64) float64 {
+	return sum(vs) / float64(len(vs))
+}
+
+func moment(vs []float64, n int, center float64) float64 {
+	ret := 0.0
+	for _, v := range vs {
+		ret += math.Pow(v-center, float64(n))
+	}
+	return ret / float64(len(vs))
+}
+
+const (
+	statFormatVersion uint8 = 1
+)
+
+type statMsgpack struct {
+	_struct struct{} `codec:",toarray"`
+
+	WindowSize int
+	// Values has values of each key from the oldest to the latest.
+	Values map[string][]float64
+}
+
+// Save saves the current state of Stat.
+func (s *Stat) Save(w io.Writer) error {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	if _, err := w.Write([]byte{statFormatVersion}); err != nil {
+		return err
+	}
+
+	vs := make(map[string][]float64, len(s.windows))
+	for k, w := range s.windows {
+		vs[k] = w.ordered()
+	}
+	enc := codec.NewEncoder(w, statMsgpackHandle)
+	return enc.Encode(&statMsgpack{
+		WindowSize: s.windowSize,
+		Values:     vs,
+	})
+}
+
+// Load loads Stat from the saved data.
+func Load(r io.Reader) (*Stat, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadFormatV1(r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of Stat container: %v", formatVersion[0])
+	}
+}
+
+func loadFormatV1(r io.Reader) (*Stat, error) {
+	m := statMsgpack{}
+	dec := codec.NewDecoder(r, statMsgpackHandle)
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+
+	s, err := New(m.WindowSize)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range m.Values {
+		if len(vs) == 0 {
+			continue
+		}
+		if len(vs) > s.windowSize {
+			return nil, fmt.Errorf("the number of values of key '%v' exceeds window size", k)
+		}
+		s.windows[k] = &window{values: vs}
+		s.total += len(vs)
+	}
+	return s, nil
+}
@@ -0,0 +1,102 @@
+package stat
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"math"
+	"testing"
+)
+
+func TestMoment(t *testing.T) {
+	Convey("Given values 1, 2 and 3", t, func() {
+		vs := []float64{1, 2, 3}
+
+		Convey("the 0th moment should be 1.", func() {
+			So(moment(vs, 0, 2), ShouldAlmostEqual, 1, 1e-9)
+		})
+
+		Convey("the 1st moment about the mean should be 0.", func() {
+			So(moment(vs, 1, 2), ShouldAlmostEqual, 0, 1e-9)
+		})
+
+		Convey("the 2nd moment about the mean should be the variance.", func() {
+			So(moment(vs, 2, 2), ShouldAlmostEqual, 2.0/3, 1e-9)
+		})
+
+		Convey("the 3rd moment about 0 should be the mean of cubes.", func() {
+			So(moment(vs, 3, 0), ShouldAlmostEqual, 12, 1e-9)
+		})
+	})
+
+	Convey("Given values 1, 2 and 6", t, func() {
+		Convey("the 3rd moment about the mean should be positive.", func() {
+			So(moment([]float64{1, 2, 6}, 3, 3), ShouldAlmostEqual, (-8-1+27)/3.0, 1e-9)
+		})
+	})
+
+	Convey("Given the same values", t, func() {
+		Convey("the 2nd moment about the value should be 0.", func() {
+			So(moment([]float64{2, 2}, 2, 2), ShouldAlmostEqual, 0, 1e-9)
+		})
+	})
+
+	Convey("Given values -1 and 1", t, func() {
+		Convey("the 4th moment about 0 should be 1.", func() {
+			So(moment([]float64{-1, 1}, 4, 0), ShouldAlmostEqual, 1, 1e-9)
+		})
+	})
+}
+
+func TestEntropy(t *testing.T) {
+	Convey("Given a Stat having window size 5", t, func() {
+		s, err := New(5)
+		So(err, ShouldBeNil)
+
+		push := func(key string, n int) {
+			for i := 0; i < n; i++ {
+				So(s.Push(key, float64(i)), ShouldBeNil)
+			}
+		}
+
+		Convey("when it has no value", func() {
+			Convey("its entropy should be 0.", func() {
+				So(s.Entropy(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("when it has values of a single key", func() {
+			push("a", 3)
+
+			Convey("its entropy should be 0.", func() {
+				So(s.Entropy(), ShouldAlmostEqual, 0, 1e-9)
+			})
+		})
+
+		Convey("when it has the same number of values of two keys", func() {
+			push("a", 1)
+			push("b", 1)
+
+			Convey("its entropy should be log 2.", func() {
+				So(s.Entropy(), ShouldAlmostEqual, math.Log(2), 1e-9)
+			})
+		})
+
+		Convey("when it has values of three keys in ratio 2:1:1", func() {
+			push("a", 2)
+			push("b", 1)
+			push("c", 1)
+
+			Convey("its entropy should be computed from the ratio.", func() {
+				So(s.Entropy(), ShouldAlmostEqual, -(0.5*math.Log(0.5) + 2*0.25*math.Log(0.25)), 1e-9)
+			})
+		})
+
+		Convey("when it has more values than the window size", func() {
+			push("a", 10)
+			push("b", 5)
+
+			Convey("only values in windows should be counted.", func() {
+				So(s.Entropy(), ShouldAlmostEqual, math.Log(2), 1e-9)
+			})
+		})
+	})
+}
@@ -0,0 +1,218 @@
+package stat
+
+import (
+	"fmt"
+	"github.com/sensorbee/jubatus/internal/pluginutil"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"reflect"
+)
+
+// State is a state which has a Stat. Writing a tuple to the state pushes the
+// value in the tuple to the window of the key in the tuple.
+type State struct {
+	stat       *Stat
+	keyField   string
+	valueField string
+}
+
+var _ core.SavableSharedState = &State{}
+
+type stateMsgpack struct {
+	_struct    struct{} `codec:",toarray"`
+	KeyField   string
+	ValueField string
+}
+
+// StateCreator is used by BQL to create or load a State as a UDS.
+type StateCreator struct {
+}
+
+var _ udf.UDSLoader = &StateCreator{}
+
+// CreateState creates a new State.
+func (c *StateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	key, err := pluginutil.ExtractParamAsStringWithDefault(params, "key_field", "key")
+	if err != nil {
+		return nil, err
+	}
+	value, err := pluginutil.ExtractParamAsStringWithDefault(params, "value_field", "value")
+	if err != nil {
+		return nil, err
+	}
+
+	windowSize, err := pluginutil.ExtractParamAsBoundedInt(params, "window_size")
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := New(windowSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize stat: %v", err)
+	}
+	return &State{
+		stat:       s,
+		keyField:   key,
+		valueField: value,
+	}, nil
+}
+
+var (
+	statMsgpackHandle = &codec.MsgpackHandle{
+		RawToString: true,
+	}
+)
+
+func init() {
+	statMsgpackHandle.MapType = reflect.TypeOf(map[string]interface{}{})
+}
+
+// LoadState loads a new State.
+func (c *StateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	formatVersion := make([]byte, 1)
+	if _, err := r.Read(formatVersion); err != nil {
+		return nil, err
+	}
+
+	switch formatVersion[0] {
+	case 1:
+		return loadStateFormatV1(ctx, r)
+	default:
+		return nil, fmt.Errorf("unsupported format version of stat State container: %v", formatVersion[0])
+	}
+}
+
+func loadStateFormatV1(ctx *core.Context, r io.Reader) (core.SharedState, error) {
+	var d stateMsgpack
+	dec := codec.NewDecoder(r, statMsgpackHandle)
+	if err := dec.Decode(&d); err != nil {
+		return nil, err
+	}
+
+	s, err := Load(r)
+	if err != nil {
+		return nil, err
+	}
+	return &State{
+		stat:       s,
+		keyField:   d.KeyField,
+		valueField: d.ValueField,
+	}, nil
+}
+
+// Terminate terminates the state.
+func (*State) Terminate(ctx *core.Context) error {
+	return nil
+}
+
+// Write pushes the value in the tuple to the window of the key in the tuple.
+func (s *State) Write(ctx *core.Context, t *core.Tuple) error {
+	vkey, ok := t.Data[s.keyField]
+	if !ok {
+		return fmt.Errorf("%s field is missing", s.keyField)
+	}
+	key, err := data.AsString(vkey)
+	if err != nil {
+		return fmt.Errorf("%s value is not a string: %v", s.keyField, err)
+	}
+
+	vval, ok := t.Data[s.valueField]
+	if !ok {
+		return fmt.Errorf("%s field is missing", s.valueField)
+	}
+	val, err := data.ToFloat(vval)
+	if err != nil {
+		return fmt.Errorf("%s value is not convertible to float: %v", s.valueField, err)
+	}
+
+	return s.stat.Push(key, val)
+}
+
+const (
+	statStateFormatVersion = 1
+)
+
+// Save is provided as a part of core.SavableSharedState.
+func (s *State) Save(ctx *core.Context, w io.Writer, params data.Map) error {
+	if _, err := w.Write([]byte{statStateFormatVersion}); err != nil {
+		return err
+	}
+
+	enc := codec.NewEncoder(w, statMsgpackHandle)
+	if err := enc.Encode(&stateMsgpack{
+		KeyField:   s.keyField,
+		ValueField: s.valueField,
+	}); err != nil {
+		return err
+	}
+	return s.stat.Save(w)
+}
+
+// Sum returns the sum of values of the key.
+func Sum(ctx *core.Context, stateName string, key string) (float64, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return 0, err
+	}
+	return s.stat.Sum(key)
+}
+
+// Stddev returns the standard deviation of values of the key.
+func Stddev(ctx *core.Context, stateName string, key string) (float64, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return 0, err
+	}
+	return s.stat.Stddev(key)
+}
+
+// Max returns the maximum value of the key.
+func Max(ctx *core.Context, stateName string, key string) (float64, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return 0, err
+	}
+	return s.stat.Max(key)
+}
+
+// Min returns the minimum value of the key.
+func Min(ctx *core.Context, stateName string, key string) (float64, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return 0, err
+	}
+	return s.stat.Min(key)
+}
+
+// Entropy returns the entropy of the distribution of keys.
+func Entropy(ctx *core.Context, stateName string) (float64, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return 0, err
+	}
+	return s.stat.Entropy(), nil
+}
+
+// Moment returns the n-th central moment of values of the key.
+func Moment(ctx *core.Context, stateName string, key string, n int) (float64, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return 0, err
+	}
+	return s.stat.Moment(key, n)
+}
+
+func lookupState(ctx *core.Context, stateName string) (*State, error) {
+	st, err := ctx.SharedStates.Get(stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := st.(*State); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("state '%v' isn't a stat state", stateName)
+}
@@ -0,0 +1,108 @@
+package stat
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"testing"
+)
+
+func TestStatState(t *testing.T) {
+	Convey("Given a stat state having a window of size 4", t, func() {
+		ctx := core.NewContext(nil)
+		c := StateCreator{}
+		ss, err := c.CreateState(ctx, data.Map{
+			"window_size": data.Int(4),
+		})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("stat", "jubastat", ss), ShouldBeNil)
+		s := ss.(*State)
+
+		// The first value of "a" is pushed out of the window.
+		values := []struct {
+			key   string
+			value data.Value
+		}{
+			{"a", data.Int(100)},
+			{"a", data.Int(1)},
+			{"a", data.Float(2)},
+			{"b", data.Int(5)},
+			{"a", data.Int(3)},
+			{"a", data.Int(6)},
+			{"b", data.Int(7)},
+		}
+		for _, v := range values {
+			So(s.Write(ctx, &core.Tuple{
+				Data: data.Map{
+					"key":   data.String(v.key),
+					"value": v.value,
+				},
+			}), ShouldBeNil)
+		}
+
+		Convey("when getting statistics of a key", func() {
+			Convey("they should be computed from values in the window.", func() {
+				sum, err := Sum(ctx, "stat", "a")
+				So(err, ShouldBeNil)
+				So(sum, ShouldEqual, 12)
+
+				max, err := Max(ctx, "stat", "a")
+				So(err, ShouldBeNil)
+				So(max, ShouldEqual, 6)
+
+				min, err := Min(ctx, "stat", "a")
+				So(err, ShouldBeNil)
+				So(min, ShouldEqual, 1)
+
+				sd, err := Stddev(ctx, "stat", "a")
+				So(err, ShouldBeNil)
+				So(sd, ShouldAlmostEqual, math.Sqrt(3.5))
+
+				m, err := Moment(ctx, "stat", "a", 3)
+				So(err, ShouldBeNil)
+				So(m, ShouldAlmostEqual, 4.5)
+			})
+		})
+
+		Convey("when getting the entropy", func() {
+			e, err := Entropy(ctx, "stat")
+			So(err, ShouldBeNil)
+
+			Convey("it should be computed from the numbers of values of keys.", func() {
+				So(e, ShouldAlmostEqual, -(4.0/6*math.Log(4.0/6) + 2.0/6*math.Log(2.0/6)))
+			})
+		})
+
+		Convey("when getting statistics of a missing key", func() {
+			_, err := Sum(ctx, "stat", "c")
+
+			Convey("it should fail.", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("when saving and loading the state", func() {
+			buf := bytes.NewBuffer(nil)
+			So(s.Save(ctx, buf, data.Map{}), ShouldBeNil)
+			s2, err := c.LoadState(ctx, buf, data.Map{})
+			So(err, ShouldBeNil)
+			st2 := s2.(*State).stat
+
+			Convey("the loaded state should be same.", func() {
+				So(st2.windowSize, ShouldEqual, 4)
+				So(st2.total, ShouldEqual, s.stat.total)
+				So(st2.windows["a"].ordered(), ShouldResemble, s.stat.windows["a"].ordered())
+				So(st2.windows["b"].ordered(), ShouldResemble, s.stat.windows["b"].ordered())
+			})
+
+			Convey("pushing a value should remove the oldest one.", func() {
+				So(st2.Push("a", 10), ShouldBeNil)
+				min, err := st2.Min("a")
+				So(err, ShouldBeNil)
+				So(min, ShouldEqual, 2)
+			})
+		})
+	})
+}